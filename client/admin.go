@@ -0,0 +1,268 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Limits are the quotas of a namespace; zero means no limit
+type Limits struct {
+	MaxKeySize    int   `json:"max_key_size,omitempty"`
+	MaxValueSize  int64 `json:"max_value_size,omitempty"`
+	MaxKeys       int64 `json:"max_keys,omitempty"`
+	MaxTotalBytes int64 `json:"max_total_bytes,omitempty"`
+}
+
+// NamespaceInfo describes a namespace
+type NamespaceInfo struct {
+	Name   string `json:"name"`
+	Limits Limits `json:"limits"`
+	Usage  struct {
+		Keys  int   `json:"keys"`
+		Bytes int64 `json:"bytes"`
+	} `json:"usage"`
+	Tokens int `json:"tokens"` // Number of tokens that can access it
+}
+
+// CreateNamespace registers a namespace. If tokens is empty the cluster generates one,
+// which is returned; it can't be read back later.
+func (c *Client) CreateNamespace(ctx context.Context, name string, tokens []string, limits Limits) (NamespaceInfo, string, error) {
+	body, err := json.Marshal(struct {
+		Name   string   `json:"name"`
+		Tokens []string `json:"tokens,omitempty"`
+		Limits Limits   `json:"limits"`
+	}{name, tokens, limits})
+	if err != nil {
+		return NamespaceInfo{}, "", err
+	}
+	var resp struct {
+		NamespaceInfo
+		Token string `json:"token"`
+	}
+	if err := c.doJSON(ctx, &request{method: http.MethodPost, path: "/admin/namespaces", body: body}, &resp); err != nil {
+		return NamespaceInfo{}, "", err
+	}
+	return resp.NamespaceInfo, resp.Token, nil
+}
+
+// Namespaces lists every namespace
+func (c *Client) Namespaces(ctx context.Context) ([]NamespaceInfo, error) {
+	var resp struct {
+		Namespaces []NamespaceInfo `json:"namespaces"`
+	}
+	err := c.doJSON(ctx, &request{method: http.MethodGet, path: "/admin/namespaces", idempotent: true, read: true}, &resp)
+	return resp.Namespaces, err
+}
+
+// GetNamespace describes one namespace
+func (c *Client) GetNamespace(ctx context.Context, name string) (NamespaceInfo, error) {
+	var info NamespaceInfo
+	err := c.doJSON(ctx, &request{method: http.MethodGet, path: "/admin/namespaces/" + url.PathEscape(name), idempotent: true, read: true}, &info)
+	return info, err
+}
+
+// DeleteNamespace removes a namespace and every key in it
+func (c *Client) DeleteNamespace(ctx context.Context, name string) error {
+	return c.doJSON(ctx, &request{method: http.MethodDelete, path: "/admin/namespaces/" + url.PathEscape(name), idempotent: true}, nil)
+}
+
+// StateHash is a node's hash of its whole state after a log index
+type StateHash struct {
+	Index     uint64 `json:"index"`
+	Hash      string `json:"hash"`
+	LastCheck *struct {
+		Index    uint64    `json:"index"`
+		Expected string    `json:"expected"`
+		Actual   string    `json:"actual"`
+		Match    bool      `json:"match"`
+		Time     time.Time `json:"time"`
+	} `json:"last_check,omitempty"`
+}
+
+// Hash returns the state hash of the node at endpoint, after log entry index or at the
+// node's current index if index is 0. Hashes are per node, so this call doesn't fail over.
+func (c *Client) Hash(ctx context.Context, endpoint string, index uint64) (StateHash, error) {
+	path := "/admin/hash"
+	if index != 0 {
+		path += "?index=" + strconv.FormatUint(index, 10)
+	}
+	resp, err := c.send(ctx, endpoint, &request{method: http.MethodGet, path: path})
+	if err != nil {
+		return StateHash{}, fmt.Errorf("client: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return StateHash{}, readError(resp)
+	}
+	defer resp.Body.Close()
+	var hash StateHash
+	if err := json.NewDecoder(resp.Body).Decode(&hash); err != nil {
+		return StateHash{}, fmt.Errorf("client: decoding hash: %w", err)
+	}
+	return hash, nil
+}
+
+// Join adds a node to the cluster as a voter
+func (c *Client) Join(ctx context.Context, nodeID, raftAddr string) error {
+	body, err := json.Marshal(map[string]string{"node_id": nodeID, "raft_addr": raftAddr})
+	if err != nil {
+		return err
+	}
+	return c.doJSON(ctx, &request{method: http.MethodPost, path: "/raft/join", body: body, idempotent: true}, nil)
+}
+
+// Remove removes a node from the cluster
+func (c *Client) Remove(ctx context.Context, nodeID string) error {
+	body, err := json.Marshal(map[string]string{"node_id": nodeID})
+	if err != nil {
+		return err
+	}
+	return c.doJSON(ctx, &request{method: http.MethodPost, path: "/raft/remove", body: body, idempotent: true}, nil)
+}
+
+// BackupInfo describes a backup
+type BackupInfo struct {
+	Index     uint64    `json:"index"` // Last Raft index included in the backup
+	Term      uint64    `json:"term"`
+	NodeID    string    `json:"node_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Backup writes a consistent snapshot of the cluster, taken by the leader, to w
+func (c *Client) Backup(ctx context.Context, w io.Writer) (BackupInfo, error) {
+	resp, err := c.do(ctx, &request{method: http.MethodGet, path: "/admin/backup", idempotent: true})
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	defer resp.Body.Close()
+	info := BackupInfo{NodeID: resp.Header.Get("X-Backup-Node")}
+	info.Index, _ = strconv.ParseUint(resp.Header.Get("X-Backup-Index"), 10, 64)
+	info.Term, _ = strconv.ParseUint(resp.Header.Get("X-Backup-Term"), 10, 64)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return info, fmt.Errorf("client: reading backup: %w", err)
+	}
+	return info, nil
+}
+
+// RestoreResult is returned by Restore
+type RestoreResult struct {
+	Backup BackupInfo `json:"backup"`
+	Keys   int        `json:"keys"`
+	Bytes  int64      `json:"bytes"`
+}
+
+// Restore replaces the whole state of the cluster with a backup. The backup is
+// streamed once, so the request is not retried; if it fails because the leader
+// changed, call Restore again with a fresh reader and it goes to the new leader.
+func (c *Client) Restore(ctx context.Context, backup io.Reader) (RestoreResult, error) {
+	var result RestoreResult
+	err := c.doJSON(ctx, &request{method: http.MethodPost, path: "/admin/restore", stream: backup}, &result)
+	return result, err
+}
+
+// Export writes every key as JSON Lines to w
+func (c *Client) Export(ctx context.Context, w io.Writer) error {
+	return c.export(ctx, w, "/admin/export")
+}
+
+// ExportNamespace writes the keys of namespace ns as JSON Lines to w. The default
+// namespace is "".
+func (c *Client) ExportNamespace(ctx context.Context, w io.Writer, ns string) error {
+	return c.export(ctx, w, "/admin/export?ns="+url.QueryEscape(ns))
+}
+
+func (c *Client) export(ctx context.Context, w io.Writer, path string) error {
+	resp, err := c.do(ctx, &request{method: http.MethodGet, path: path, idempotent: true, read: true})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("client: reading export: %w", err)
+	}
+	return nil
+}
+
+// ImportProgress reports how far an import got
+type ImportProgress struct {
+	Offset   int64  `json:"offset"`   // Records of the input handled; resume from here
+	Imported int64  `json:"imported"` // Records written by this call
+	DryRun   bool   `json:"dry_run,omitempty"`
+	Done     bool   `json:"done,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ImportOptions tune Import; zero values use the server defaults
+type ImportOptions struct {
+	Batch  int   // Records per Raft entry
+	Offset int64 // Records of the input to skip, to resume an interrupted import
+	DryRun bool  // Only validate the input
+}
+
+// Import loads JSON Lines records, as written by Export, and returns the last progress
+// the cluster reported. Like Restore it is not retried: on failure, resume from the
+// returned Offset.
+func (c *Client) Import(ctx context.Context, records io.Reader, opts ImportOptions) (ImportProgress, error) {
+	query := url.Values{}
+	if opts.Batch > 0 {
+		query.Set("batch", strconv.Itoa(opts.Batch))
+	}
+	if opts.Offset > 0 {
+		query.Set("offset", strconv.FormatInt(opts.Offset, 10))
+	}
+	if opts.DryRun {
+		query.Set("dry_run", "true")
+	}
+	path := "/admin/import"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	resp, err := c.do(ctx, &request{method: http.MethodPost, path: path, stream: records, read: opts.DryRun})
+	if err != nil {
+		return ImportProgress{Offset: opts.Offset}, err
+	}
+	defer resp.Body.Close()
+
+	progress := ImportProgress{Offset: opts.Offset}
+	lines := bufio.NewScanner(resp.Body)
+	for lines.Scan() {
+		if err := json.Unmarshal(lines.Bytes(), &progress); err != nil {
+			return progress, fmt.Errorf("client: decoding import progress: %w", err)
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return progress, fmt.Errorf("client: reading import progress: %w", err)
+	}
+	if progress.Error != "" {
+		return progress, fmt.Errorf("client: import stopped at record %d: %s", progress.Offset, progress.Error)
+	}
+	if !progress.Done {
+		return progress, fmt.Errorf("client: import ended early at record %d", progress.Offset)
+	}
+	return progress, nil
+}
+
+// doJSON runs req and decodes the response into v, if v is not nil
+func (c *Client) doJSON(ctx context.Context, req *request, v interface{}) error {
+	if req.body != nil {
+		req.header = http.Header{"Content-Type": {"application/json"}}
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer drain(resp)
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("client: decoding %s %s: %w", req.method, req.path, err)
+	}
+	return nil
+}
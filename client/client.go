@@ -0,0 +1,406 @@
+// Package client is the Go client for the distributed KV store. It covers the key-value
+// and admin APIs, sends requests to the last known leader, follows leader redirects and
+// fails over to the other nodes with backoff when a node is down or no longer leads.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxAttempts = 30
+	defaultMinBackoff  = 50 * time.Millisecond
+	defaultMaxBackoff  = 2 * time.Second
+
+	// maxErrorBody caps how much of an error response is kept as its message
+	maxErrorBody = 4 << 10
+)
+
+var (
+	// ErrNotFound is matched by errors for a missing key or namespace (HTTP 404)
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is matched by errors for a write that doesn't fit the stored value (HTTP 409),
+	// such as incrementing a non-integer or a JSON Patch whose test fails
+	ErrConflict = errors.New("conflict")
+	// ErrNoLeader is returned when no node accepted a leader-only request before the client
+	// ran out of attempts, e.g. during an election
+	ErrNoLeader = errors.New("no leader available")
+)
+
+// Config configures a Client
+type Config struct {
+	// Endpoints are the base URLs of the nodes, e.g. http://127.0.0.1:9001
+	Endpoints []string
+	// Token is sent as a bearer token with every request
+	Token string
+	// HTTPClient sends the requests; http.DefaultClient's settings are used if nil.
+	// The client handles redirects itself, so CheckRedirect is replaced.
+	HTTPClient *http.Client
+	// MaxAttempts caps the attempts per request across all endpoints. The default of 30
+	// rides out a leader election with the default backoff; a context deadline can end
+	// the retries sooner.
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the wait after every endpoint has failed once
+	// (defaults 50ms and 2s). The wait doubles each round and is jittered.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Client talks to a cluster. It is safe for concurrent use.
+type Client struct {
+	http        *http.Client
+	endpoints   []string
+	token       string
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+
+	// kvPath is where keys live: /kv/ or /ns/{name}/kv/
+	kvPath string
+	// leader is shared with the clients returned by Namespace
+	leader *leaderCache
+}
+
+// leaderCache remembers the endpoint that last accepted a leader-only request
+type leaderCache struct {
+	mu  sync.Mutex
+	url string
+}
+
+func (l *leaderCache) get() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.url
+}
+
+func (l *leaderCache) set(url string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.url = url
+}
+
+// forget clears the cached leader if it is still url
+func (l *leaderCache) forget(url string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.url == url {
+		l.url = ""
+	}
+}
+
+// New creates a client for the nodes in cfg.Endpoints
+func New(cfg Config) (*Client, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, errors.New("client: at least one endpoint is required")
+	}
+	endpoints := make([]string, len(cfg.Endpoints))
+	for i, e := range cfg.Endpoints {
+		u, err := url.Parse(e)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("client: invalid endpoint %q", e)
+		}
+		endpoints[i] = strings.TrimSuffix(u.String(), "/")
+	}
+
+	hc := http.Client{}
+	if cfg.HTTPClient != nil {
+		hc = *cfg.HTTPClient
+	}
+	hc.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	c := &Client{
+		http:        &hc,
+		endpoints:   endpoints,
+		token:       cfg.Token,
+		maxAttempts: cfg.MaxAttempts,
+		minBackoff:  cfg.MinBackoff,
+		maxBackoff:  cfg.MaxBackoff,
+		kvPath:      "/kv/",
+		leader:      &leaderCache{},
+	}
+	if c.maxAttempts <= 0 {
+		c.maxAttempts = defaultMaxAttempts
+	}
+	if c.minBackoff <= 0 {
+		c.minBackoff = defaultMinBackoff
+	}
+	if c.maxBackoff < c.minBackoff {
+		c.maxBackoff = max(defaultMaxBackoff, c.minBackoff)
+	}
+	return c, nil
+}
+
+// Namespace returns a client whose key-value calls go to namespace name and are
+// authenticated with the namespace's token. It shares the leader cache with c.
+func (c *Client) Namespace(name, token string) *Client {
+	ns := *c
+	ns.kvPath = "/ns/" + url.PathEscape(name) + "/kv/"
+	ns.token = token
+	return &ns
+}
+
+// Leader returns the endpoint the client currently believes is the leader, or "" if
+// it doesn't know
+func (c *Client) Leader() string {
+	return c.leader.get()
+}
+
+// Error is returned for a request the cluster answered with an error status
+type Error struct {
+	StatusCode int
+	Message    string
+	Code       string // Machine-readable code from a /v1 error, such as key_not_found
+	Retryable  bool   // Set by /v1 errors the same request may recover from
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("client: %s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// Is matches ErrNotFound and ErrConflict by status code
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	}
+	return false
+}
+
+// request is one API call, replayed on every attempt
+type request struct {
+	method string
+	path   string // escaped path and query
+	header http.Header
+	body   []byte
+
+	// stream is sent instead of body. It can only be sent once, so the request is
+	// not retried once it may have been read.
+	stream io.Reader
+
+	// idempotent requests are retried after errors that leave their outcome unknown
+	idempotent bool
+	// read requests are served by any node, so answering one doesn't make it the leader
+	read bool
+}
+
+// do sends req to the cached leader, or to each endpoint in turn, until a node answers
+// it. It follows redirects to the leader, moves on when a node is down or not the
+// leader, and backs off after every endpoint has failed. The caller closes the body
+// of the returned response, which has a status below 400.
+func (c *Client) do(ctx context.Context, req *request) (*http.Response, error) {
+	var (
+		lastErr error
+		target  string // next endpoint, set by a redirect
+		failed  int    // attempts that moved on to another endpoint
+		backoff = c.minBackoff
+	)
+	for attempt := 1; ; attempt++ {
+		base := target
+		if base == "" {
+			base = c.pick(failed)
+		}
+		target = ""
+
+		resp, err := c.send(ctx, base, req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("client: %w", ctx.Err())
+			}
+			c.leader.forget(base)
+			if req.stream != nil || (!req.idempotent && !isDialError(err)) {
+				// The node may have applied the request before the connection broke
+				return nil, fmt.Errorf("client: %s %s: %w", req.method, req.path, err)
+			}
+			lastErr = err
+			failed++
+		} else if location, ok := redirectLocation(resp); ok {
+			drain(resp)
+			c.leader.set(location)
+			target = location
+			lastErr = &Error{StatusCode: resp.StatusCode, Message: "redirected to the leader at " + location}
+		} else if resp.StatusCode >= http.StatusBadRequest {
+			apiErr := readError(resp)
+			switch {
+			case notLeader(apiErr):
+				c.leader.forget(base)
+				lastErr = fmt.Errorf("%w: %s", ErrNoLeader, apiErr.Message)
+				failed++
+			case apiErr.Retryable, retryable(apiErr.StatusCode, req.idempotent):
+				lastErr = apiErr
+				failed++
+			default:
+				return nil, apiErr
+			}
+		} else {
+			if !req.read {
+				c.leader.set(base)
+			}
+			return resp, nil
+		}
+
+		if req.stream != nil {
+			return nil, lastErr
+		}
+		if attempt >= c.maxAttempts {
+			return nil, fmt.Errorf("client: giving up after %d attempts: %w", attempt, lastErr)
+		}
+		// Wait once every endpoint has been tried, instead of spinning through them
+		if target == "" && failed%len(c.endpoints) == 0 {
+			if err := sleep(ctx, jitter(backoff)); err != nil {
+				return nil, fmt.Errorf("client: %w (last error: %v)", err, lastErr)
+			}
+			backoff = min(backoff*2, c.maxBackoff)
+		}
+	}
+}
+
+// pick returns the cached leader for a first attempt, and otherwise goes through the
+// endpoints in order, starting after the leader
+func (c *Client) pick(failed int) string {
+	start := 0
+	if leader := c.leader.get(); leader != "" {
+		for i, e := range c.endpoints {
+			if e == leader {
+				start = i
+				break
+			}
+		}
+		if failed == 0 {
+			return leader
+		}
+	}
+	return c.endpoints[(start+failed)%len(c.endpoints)]
+}
+
+// send makes one attempt of req against the node at base
+func (c *Client) send(ctx context.Context, base string, req *request) (*http.Response, error) {
+	var body io.Reader
+	if req.stream != nil {
+		body = req.stream
+	} else if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	r, err := http.NewRequestWithContext(ctx, req.method, base+req.path, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range req.header {
+		r.Header[name] = values
+	}
+	if c.token != "" {
+		r.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.http.Do(r)
+}
+
+// redirectLocation returns the base URL of the node a 307/308 redirect points to
+func redirectLocation(resp *http.Response) (string, bool) {
+	if resp.StatusCode != http.StatusTemporaryRedirect && resp.StatusCode != http.StatusPermanentRedirect {
+		return "", false
+	}
+	u, err := resp.Location()
+	if err != nil {
+		return "", false
+	}
+	return u.Scheme + "://" + u.Host, true
+}
+
+// readError turns an error response into an *Error and closes its body. It reads the
+// JSON envelope of the /v1 API as well as the plain-text errors of the other routes.
+func readError(resp *http.Response) *Error {
+	defer drain(resp)
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var envelope struct {
+			Error struct {
+				Code      string `json:"code"`
+				Message   string `json:"message"`
+				Retryable bool   `json:"retryable"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(msg, &envelope) == nil && envelope.Error.Code != "" {
+			e := envelope.Error
+			return &Error{StatusCode: resp.StatusCode, Message: e.Message, Code: e.Code, Retryable: e.Retryable}
+		}
+	}
+	text := strings.TrimSpace(string(msg))
+	if text == "" {
+		text = http.StatusText(resp.StatusCode)
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: text}
+}
+
+// notLeader reports whether a node refused a request because it isn't the leader,
+// either before proposing it or because Raft rejected the proposal. Nothing was
+// applied in both cases, so any request can be retried elsewhere.
+func notLeader(err *Error) bool {
+	if err.Code != "" {
+		return err.Code == "not_leader"
+	}
+	switch err.StatusCode {
+	case http.StatusBadRequest:
+		return err.Message == "Not the leader"
+	case http.StatusInternalServerError:
+		return strings.HasSuffix(err.Message, "node is not the leader")
+	}
+	return false
+}
+
+// retryable reports whether an error status is worth another attempt. A 500 can mean
+// the leader lost leadership while committing, so the write may have been applied.
+func retryable(status int, idempotent bool) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusInternalServerError:
+		return idempotent
+	}
+	return false
+}
+
+// isDialError reports whether err happened while connecting, before anything was sent
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func drain(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBody))
+	resp.Body.Close()
+}
+
+// jitter spreads d over [d/2, d) so clients don't retry in lockstep
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
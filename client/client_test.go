@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeNode answers /kv/ requests: a leader stores the value, a follower refuses writes
+// the way the HTTP handlers do
+type fakeNode struct {
+	leader atomic.Bool
+	calls  atomic.Int32
+	value  atomic.Value
+}
+
+func (n *fakeNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.calls.Add(1)
+	if r.Method == http.MethodGet {
+		v, _ := n.value.Load().(string)
+		if v == "" {
+			http.Error(w, "Key not found", http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, v)
+		return
+	}
+	if !n.leader.Load() {
+		w.Header().Set("X-Leader", "127.0.0.1:9011")
+		http.Error(w, "Not the leader", http.StatusBadRequest)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/incr") {
+		io.WriteString(w, `{"value":1}`)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	n.value.Store(string(body))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newTestClient(t *testing.T, endpoints ...string) *Client {
+	t.Helper()
+	c, err := New(Config{Endpoints: endpoints, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	return c
+}
+
+func TestClient_FindsAndCachesLeader(t *testing.T) {
+	follower, leader := &fakeNode{}, &fakeNode{}
+	leader.leader.Store(true)
+	fs, ls := httptest.NewServer(follower), httptest.NewServer(leader)
+	defer fs.Close()
+	defer ls.Close()
+
+	c := newTestClient(t, fs.URL, ls.URL)
+	if err := c.Put(context.Background(), "k", []byte("v1")); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if c.Leader() != ls.URL {
+		t.Errorf("Expected leader %s, got %q", ls.URL, c.Leader())
+	}
+
+	// The next write goes straight to the cached leader
+	follower.calls.Store(0)
+	if err := c.Put(context.Background(), "k", []byte("v2")); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if follower.calls.Load() != 0 {
+		t.Errorf("Expected no calls to the follower, got %d", follower.calls.Load())
+	}
+
+	// Leadership moves: the client notices and fails over
+	leader.leader.Store(false)
+	follower.leader.Store(true)
+	if err := c.Put(context.Background(), "k", []byte("v3")); err != nil {
+		t.Fatalf("Put() after leader change failed: %v", err)
+	}
+	if got, _ := follower.value.Load().(string); got != "v3" || c.Leader() != fs.URL {
+		t.Errorf("Expected the new leader to get v3, got %q (leader %q)", got, c.Leader())
+	}
+}
+
+func TestClient_FollowsRedirect(t *testing.T) {
+	leader := &fakeNode{}
+	leader.leader.Store(true)
+	ls := httptest.NewServer(leader)
+	defer ls.Close()
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, ls.URL+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+	}))
+	defer redirector.Close()
+
+	c := newTestClient(t, redirector.URL)
+	if err := c.Put(context.Background(), "k", []byte("v")); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if got, _ := leader.value.Load().(string); got != "v" {
+		t.Errorf("Expected the leader to store v, got %q", got)
+	}
+	if c.Leader() != ls.URL {
+		t.Errorf("Expected leader %s, got %q", ls.URL, c.Leader())
+	}
+}
+
+func TestClient_FailsOverDownNode(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	leader := &fakeNode{}
+	leader.leader.Store(true)
+	leader.value.Store("v")
+	ls := httptest.NewServer(leader)
+	defer ls.Close()
+
+	c := newTestClient(t, down.URL, ls.URL)
+	val, err := c.Get(context.Background(), "k")
+	if err != nil || string(val) != "v" {
+		t.Fatalf("Expected v, got %q, %v", val, err)
+	}
+	// Connection refused happens before anything is sent, so increments fail over too
+	if n, err := c.Incr(context.Background(), "k", 1); err != nil || n != 1 {
+		t.Fatalf("Expected Incr to return 1, got %d, %v", n, err)
+	}
+	if leader.calls.Load() != 2 {
+		t.Errorf("Expected 2 calls to reach the leader, got %d", leader.calls.Load())
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		switch r.URL.Path {
+		case "/kv/missing":
+			http.Error(w, "Key not found", http.StatusNotFound)
+		case "/kv/text/incr":
+			http.Error(w, "Value is not an integer", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to apply command: leadership lost while committing log", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	c := newTestClient(t, server.URL)
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := c.Incr(ctx, "text", 1); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict, got %v", err)
+	}
+
+	// A write that may have been applied is only retried if it is idempotent
+	calls.Store(0)
+	var apiErr *Error
+	if _, err := c.Incr(ctx, "other", 1); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected an HTTP 500 error, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected Incr to be sent once, got %d", calls.Load())
+	}
+	calls.Store(0)
+	if err := c.Put(ctx, "other", []byte("v")); err == nil {
+		t.Error("Expected Put to fail")
+	}
+	if calls.Load() != defaultMaxAttempts {
+		t.Errorf("Expected Put to be sent %d times, got %d", defaultMaxAttempts, calls.Load())
+	}
+}
+
+func TestClient_JSONErrors(t *testing.T) {
+	leader := &fakeNode{}
+	leader.leader.Store(true)
+	ls := httptest.NewServer(leader)
+	defer ls.Close()
+	// A /v1 node answers with error envelopes instead of plain text
+	v1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error":{"code":"key_not_found","message":"Key not found","retryable":false}}`)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":{"code":"not_leader","message":"Not the leader","leader":"127.0.0.1:9011","retryable":true}}`)
+	}))
+	defer v1.Close()
+
+	c := newTestClient(t, v1.URL, ls.URL)
+	var apiErr *Error
+	if _, err := c.Get(context.Background(), "k"); !errors.Is(err, ErrNotFound) || !errors.As(err, &apiErr) || apiErr.Code != "key_not_found" {
+		t.Errorf("Expected a key_not_found error, got %v", err)
+	}
+	if err := c.Put(context.Background(), "k", []byte("v")); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if c.Leader() != ls.URL {
+		t.Errorf("Expected leader %s, got %q", ls.URL, c.Leader())
+	}
+}
+
+func TestClient_ContextDeadline(t *testing.T) {
+	follower := &fakeNode{}
+	fs := httptest.NewServer(follower)
+	defer fs.Close()
+	c, err := New(Config{Endpoints: []string{fs.URL}, MaxAttempts: 1000, MinBackoff: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = c.Put(ctx, "k", []byte("v"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Put to stop at the deadline, took %v", elapsed)
+	}
+
+	// Without a deadline the client gives up after MaxAttempts
+	c.maxAttempts = 3
+	if err := c.Put(context.Background(), "k", []byte("v")); !errors.Is(err, ErrNoLeader) {
+		t.Errorf("Expected ErrNoLeader, got %v", err)
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	if _, err := New(Config{}); err == nil {
+		t.Error("Expected an error without endpoints")
+	}
+	if _, err := New(Config{Endpoints: []string{"127.0.0.1:9001"}}); err == nil {
+		t.Error("Expected an error for an endpoint without a scheme")
+	}
+}
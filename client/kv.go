@@ -0,0 +1,271 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Meta describes a stored value, as returned with GET and HEAD
+type Meta struct {
+	CreateIndex uint64 // Raft index of the write that created the key
+	ModifyIndex uint64 // Raft index of the latest write
+	Version     uint64 // Number of writes since the key was created
+	Created     time.Time
+	Modified    time.Time
+	ContentType string
+	Headers     map[string]string // Custom metadata sent as X-Meta-* headers
+	Size        int64
+}
+
+// PutOptions are stored with a value by PutWithOptions
+type PutOptions struct {
+	ContentType string
+	// Headers are stored as custom metadata and sent as X-Meta-{name}
+	Headers map[string]string
+}
+
+// keyPath returns the escaped path of key, with an optional suffix such as /incr
+func (c *Client) keyPath(key, suffix string) string {
+	return c.kvPath + url.PathEscape(key) + suffix
+}
+
+// Get returns the value of key. A missing key returns an error matching ErrNotFound.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	val, _, err := c.GetWithMeta(ctx, key)
+	return val, err
+}
+
+// GetWithMeta returns the value of key and its metadata
+func (c *Client) GetWithMeta(ctx context.Context, key string) ([]byte, Meta, error) {
+	resp, err := c.do(ctx, &request{method: http.MethodGet, path: c.keyPath(key, ""), idempotent: true, read: true})
+	if err != nil {
+		return nil, Meta{}, err
+	}
+	defer resp.Body.Close()
+	val, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, Meta{}, fmt.Errorf("client: reading %s: %w", key, err)
+	}
+	meta := metaFromHeaders(resp.Header)
+	meta.Size = int64(len(val))
+	return val, meta, nil
+}
+
+// GetPath returns the part of the JSON value of key selected by a JSONPath such as
+// $.address.city, encoded as JSON
+func (c *Client) GetPath(ctx context.Context, key, path string) ([]byte, error) {
+	resp, err := c.do(ctx, &request{
+		method:     http.MethodGet,
+		path:       c.keyPath(key, "") + "?path=" + url.QueryEscape(path),
+		idempotent: true,
+		read:       true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Stat returns the metadata of key without its value
+func (c *Client) Stat(ctx context.Context, key string) (Meta, error) {
+	resp, err := c.do(ctx, &request{method: http.MethodHead, path: c.keyPath(key, ""), idempotent: true, read: true})
+	if err != nil {
+		return Meta{}, err
+	}
+	resp.Body.Close()
+	meta := metaFromHeaders(resp.Header)
+	meta.Size = resp.ContentLength
+	return meta, nil
+}
+
+// metaFromHeaders reads the metadata headers of a GET or HEAD response
+func metaFromHeaders(h http.Header) Meta {
+	meta := Meta{ContentType: h.Get("Content-Type")}
+	meta.CreateIndex, _ = strconv.ParseUint(h.Get("X-Create-Index"), 10, 64)
+	meta.ModifyIndex, _ = strconv.ParseUint(h.Get("X-Modify-Index"), 10, 64)
+	meta.Version, _ = strconv.ParseUint(h.Get("X-Version"), 10, 64)
+	if t, err := time.Parse(time.RFC3339Nano, h.Get("X-Created-At")); err == nil {
+		meta.Created = t
+	}
+	if t, err := http.ParseTime(h.Get("Last-Modified")); err == nil {
+		meta.Modified = t
+	}
+	for name, values := range h {
+		if suffix, ok := strings.CutPrefix(name, "X-Meta-"); ok && suffix != "" {
+			if meta.Headers == nil {
+				meta.Headers = make(map[string]string)
+			}
+			meta.Headers[suffix] = strings.Join(values, ", ")
+		}
+	}
+	return meta
+}
+
+// Put stores value under key
+func (c *Client) Put(ctx context.Context, key string, value []byte) error {
+	return c.PutWithOptions(ctx, key, value, PutOptions{})
+}
+
+// PutWithOptions stores value under key with a content type and custom metadata
+func (c *Client) PutWithOptions(ctx context.Context, key string, value []byte, opts PutOptions) error {
+	header := http.Header{}
+	if opts.ContentType != "" {
+		header.Set("Content-Type", opts.ContentType)
+	}
+	for name, v := range opts.Headers {
+		header.Set("X-Meta-"+name, v)
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	resp, err := c.do(ctx, &request{method: http.MethodPut, path: c.keyPath(key, ""), header: header, body: value, idempotent: true})
+	if err != nil {
+		return err
+	}
+	drain(resp)
+	return nil
+}
+
+// Delete removes key. A missing key returns an error matching ErrNotFound.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	resp, err := c.do(ctx, &request{method: http.MethodDelete, path: c.keyPath(key, ""), idempotent: true})
+	if err != nil {
+		return err
+	}
+	drain(resp)
+	return nil
+}
+
+// Incr adds delta to the integer stored under key and returns the new value.
+// A missing key counts as 0.
+func (c *Client) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	return c.count(ctx, key, "/incr", delta)
+}
+
+// Decr subtracts delta from the integer stored under key and returns the new value
+func (c *Client) Decr(ctx context.Context, key string, delta int64) (int64, error) {
+	return c.count(ctx, key, "/decr", delta)
+}
+
+// count is not retried after errors that leave its outcome unknown, since a repeated
+// increment would count twice
+func (c *Client) count(ctx context.Context, key, op string, delta int64) (int64, error) {
+	resp, err := c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   c.keyPath(key, op) + "?delta=" + strconv.FormatInt(delta, 10),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Value int64 `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("client: decoding counter: %w", err)
+	}
+	return result.Value, nil
+}
+
+// MergePatch applies an RFC 7386 merge patch to the JSON value of key
+func (c *Client) MergePatch(ctx context.Context, key string, patch []byte) error {
+	// Applying a merge patch twice gives the same document
+	return c.patch(ctx, key, "application/merge-patch+json", patch, true)
+}
+
+// JSONPatch applies an RFC 6902 JSON Patch to the JSON value of key. A patch that
+// doesn't fit the document, such as a failed test operation, returns an error
+// matching ErrConflict.
+func (c *Client) JSONPatch(ctx context.Context, key string, patch []byte) error {
+	return c.patch(ctx, key, "application/json-patch+json", patch, false)
+}
+
+func (c *Client) patch(ctx context.Context, key, contentType string, patch []byte, idempotent bool) error {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	resp, err := c.do(ctx, &request{method: http.MethodPatch, path: c.keyPath(key, ""), header: header, body: patch, idempotent: idempotent})
+	if err != nil {
+		return err
+	}
+	drain(resp)
+	return nil
+}
+
+// Value is one key read by MGet
+type Value struct {
+	Key   string
+	Found bool
+	Value []byte
+	Meta  Meta
+}
+
+// MGet reads keys at a single applied index, which it returns with one Value per key
+// in request order. Missing keys have Found false.
+func (c *Client) MGet(ctx context.Context, keys []string) (uint64, []Value, error) {
+	body, err := json.Marshal(map[string][]string{"keys": keys})
+	if err != nil {
+		return 0, nil, err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	resp, err := c.do(ctx, &request{method: http.MethodPost, path: c.kvPath + "_mget", header: header, body: body, idempotent: true, read: true})
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Index   uint64 `json:"index"`
+		Results []struct {
+			Key   string `json:"key"`
+			Found bool   `json:"found"`
+			Value []byte `json:"value"`
+			Meta  *struct {
+				CreateIndex uint64            `json:"create_index"`
+				ModifyIndex uint64            `json:"modify_index"`
+				Version     uint64            `json:"version"`
+				Created     int64             `json:"created"`
+				Modified    int64             `json:"modified"`
+				ContentType string            `json:"content_type"`
+				Headers     map[string]string `json:"headers"`
+				Size        int64             `json:"size"`
+			} `json:"meta"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, nil, fmt.Errorf("client: decoding values: %w", err)
+	}
+	values := make([]Value, len(result.Results))
+	for i, r := range result.Results {
+		values[i] = Value{Key: r.Key, Found: r.Found, Value: r.Value}
+		if m := r.Meta; m != nil {
+			values[i].Meta = Meta{
+				CreateIndex: m.CreateIndex,
+				ModifyIndex: m.ModifyIndex,
+				Version:     m.Version,
+				Created:     unixMilli(m.Created),
+				Modified:    unixMilli(m.Modified),
+				ContentType: m.ContentType,
+				Headers:     m.Headers,
+				Size:        m.Size,
+			}
+		}
+	}
+	return result.Index, values, nil
+}
+
+// unixMilli converts a Unix millisecond time, leaving 0 as the zero time
+func unixMilli(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms).UTC()
+}
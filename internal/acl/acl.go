@@ -0,0 +1,66 @@
+// Package acl defines the permissions RBAC roles and JWT claims grant, shared by the
+// store that replicates them and the auth code that checks them.
+package acl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Access levels a Permission can grant. Each level includes the ones before it.
+const (
+	AccessRead  = "read"
+	AccessWrite = "write"
+	AccessAdmin = "admin"
+)
+
+// AnyNamespace in a Permission covers the default namespace and every tenant namespace
+const AnyNamespace = "*"
+
+var accessLevels = map[string]int{AccessRead: 1, AccessWrite: 2, AccessAdmin: 3}
+
+// Permission grants an access level on the keys of a namespace that start with Prefix.
+// Admin access on every key of every namespace is what the cluster admin API requires.
+type Permission struct {
+	Namespace string `json:"ns,omitempty"` // Empty for the default namespace, "*" for all of them
+	Prefix    string `json:"prefix"`       // Empty for every key
+	Access    string `json:"access"`       // "read", "write" or "admin"
+}
+
+// Root is the permission of the bootstrap root credential: admin on everything
+var Root = Permission{Namespace: AnyNamespace, Access: AccessAdmin}
+
+// Validate checks the access level and namespace of p
+func (p Permission) Validate() error {
+	if _, ok := accessLevels[p.Access]; !ok {
+		return fmt.Errorf("invalid access %q: use read, write or admin", p.Access)
+	}
+	if strings.HasPrefix(p.Namespace, "_") {
+		return fmt.Errorf("namespace %q is reserved", p.Namespace)
+	}
+	return nil
+}
+
+// Allows reports whether p grants access on key in namespace ns. Pass AnyNamespace as
+// ns to require a permission that covers every namespace.
+func (p Permission) Allows(ns, key, access string) bool {
+	if p.Namespace != AnyNamespace && p.Namespace != ns {
+		return false
+	}
+	return strings.HasPrefix(key, p.Prefix) && Covers(p.Access, access)
+}
+
+// Covers reports whether the access level granted includes required
+func Covers(granted, required string) bool {
+	return accessLevels[granted] >= accessLevels[required]
+}
+
+// Allows reports whether any of perms grants access on key in namespace ns
+func Allows(perms []Permission, ns, key, access string) bool {
+	for _, p := range perms {
+		if p.Allows(ns, key, access) {
+			return true
+		}
+	}
+	return false
+}
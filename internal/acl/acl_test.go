@@ -0,0 +1,42 @@
+package acl
+
+import "testing"
+
+func TestPermission_Allows(t *testing.T) {
+	tests := []struct {
+		perm   Permission
+		ns     string
+		key    string
+		access string
+		want   bool
+	}{
+		{Permission{Prefix: "app/", Access: AccessRead}, "", "app/config", AccessRead, true},
+		{Permission{Prefix: "app/", Access: AccessRead}, "", "app/config", AccessWrite, false},
+		{Permission{Prefix: "app/", Access: AccessRead}, "", "other", AccessRead, false},
+		{Permission{Prefix: "app/", Access: AccessRead}, "team-a", "app/config", AccessRead, false},
+		{Permission{Prefix: "app/", Access: AccessAdmin}, "", "app/config", AccessWrite, true},
+		{Permission{Namespace: "team-a", Access: AccessWrite}, "team-a", "anything", AccessWrite, true},
+		{Permission{Namespace: AnyNamespace, Access: AccessRead}, "team-b", "anything", AccessRead, true},
+		// The admin API needs a permission covering every namespace and key
+		{Permission{Namespace: "team-a", Access: AccessAdmin}, AnyNamespace, "", AccessAdmin, false},
+		{Permission{Namespace: AnyNamespace, Prefix: "app/", Access: AccessAdmin}, AnyNamespace, "", AccessAdmin, false},
+		{Root, AnyNamespace, "", AccessAdmin, true},
+	}
+	for _, tt := range tests {
+		if got := tt.perm.Allows(tt.ns, tt.key, tt.access); got != tt.want {
+			t.Errorf("%+v.Allows(%q, %q, %s) = %v; expected %v", tt.perm, tt.ns, tt.key, tt.access, got, tt.want)
+		}
+	}
+}
+
+func TestPermission_Validate(t *testing.T) {
+	if err := (Permission{Prefix: "app/", Access: AccessWrite}).Validate(); err != nil {
+		t.Errorf("Validate() failed: %v", err)
+	}
+	if err := (Permission{Access: "delete"}).Validate(); err == nil {
+		t.Error("Expected an unknown access level to be rejected")
+	}
+	if err := (Permission{Namespace: "_users", Access: AccessRead}).Validate(); err == nil {
+		t.Error("Expected a system namespace to be rejected")
+	}
+}
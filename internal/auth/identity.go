@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+)
+
+// Authentication methods recorded on an Identity
+const (
+	MethodToken          = "token"
+	MethodCertificate    = "certificate"
+	MethodNamespaceToken = "namespace_token" // Name is the namespace the token was issued for
+)
+
+// Identity is the authenticated caller of a request
+type Identity struct {
+	Name   string
+	Method string
+	Access string // Level granted by a scoped token or certificate identity; empty if the handlers decide
+}
+
+type (
+	identityKey  struct{}
+	delegatedKey struct{}
+)
+
+// WithIdentity returns a context carrying the caller's identity
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the identity stored by the auth middleware, if any
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// Delegated reports whether the auth middleware left checking the caller's credentials
+// to the handler, because it didn't know them
+func Delegated(ctx context.Context) bool {
+	delegated, _ := ctx.Value(delegatedKey{}).(bool)
+	return delegated
+}
+
+// delegate marks r as carrying credentials for the handler to check
+func delegate(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), delegatedKey{}, true))
+}
+
+// CertificateNames lists the names a client certificate can be identified by:
+// URI, DNS and email SANs followed by the subject common name
+func CertificateNames(cert *x509.Certificate) []string {
+	var names []string
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	return names
+}
+
+// CertificateIdentity maps the request's verified client certificate to an identity.
+// Only certificates that chained to the configured client CA are considered.
+func CertificateIdentity(r *http.Request, identities map[string]string) (Identity, bool) {
+	if !hasVerifiedCertificate(r) || len(identities) == 0 {
+		return Identity{}, false
+	}
+	for _, name := range CertificateNames(r.TLS.VerifiedChains[0][0]) {
+		if id, ok := identities[name]; ok {
+			return Identity{Name: id, Method: MethodCertificate}, true
+		}
+	}
+	return Identity{}, false
+}
+
+// hasVerifiedCertificate reports whether the connection presented a client certificate the server verified
+func hasVerifiedCertificate(r *http.Request) bool {
+	return r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultJWKSReloadInterval is the minimum time between checks of the JWKS file
+const DefaultJWKSReloadInterval = 5 * time.Second
+
+// minRSABits is the smallest RSA modulus accepted for RS256
+const minRSABits = 2048
+
+// ktyAlgs is the signing algorithm supported for each JWK key type
+var ktyAlgs = map[string]string{"oct": "HS256", "RSA": "RS256", "EC": "ES256"}
+
+// jwk is a verification key from a JWKS. Key is []byte for HS256, *rsa.PublicKey for
+// RS256 and *ecdsa.PublicKey for ES256.
+type jwk struct {
+	ID  string
+	Alg string
+	Key interface{}
+}
+
+// KeySet holds the keys of a JWKS file, reloading them when the file changes on disk
+type KeySet struct {
+	path     string
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu        sync.RWMutex
+	keys      []jwk
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+// LoadKeySet reads the JWKS file at path
+func LoadKeySet(path string) (*KeySet, error) {
+	ks := &KeySet{path: path, interval: DefaultJWKSReloadInterval, logger: slog.Default().With("component", "jwks")}
+	if err := ks.load(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// SetInterval changes how often the file is checked for changes
+func (ks *KeySet) SetInterval(d time.Duration) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.interval = d
+}
+
+// lookup returns the keys a token signed with alg and key ID kid may have been signed
+// with: the key with that ID, or every key for alg if the token names none
+func (ks *KeySet) lookup(alg, kid string) []jwk {
+	ks.maybeReload()
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	var keys []jwk
+	for _, k := range ks.keys {
+		if k.Alg == alg && (kid == "" || k.ID == kid) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// maybeReload reloads the file if it changed since the last load.
+// Failed reloads keep the previous keys.
+func (ks *KeySet) maybeReload() {
+	ks.mu.Lock()
+	if time.Since(ks.lastCheck) < ks.interval {
+		ks.mu.Unlock()
+		return
+	}
+	ks.lastCheck = time.Now()
+	info, err := os.Stat(ks.path)
+	changed := err == nil && !info.ModTime().Equal(ks.modTime)
+	ks.mu.Unlock()
+
+	if changed {
+		if err := ks.load(); err != nil {
+			ks.logger.Warn("JWKS reload failed, keeping previous keys", "error", err)
+		}
+	}
+}
+
+// load reads and parses the JWKS file
+func (ks *KeySet) load() error {
+	// Record the modification time first so a write racing with the load is picked up next time
+	info, err := os.Stat(ks.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", ks.path, err)
+	}
+	data, err := os.ReadFile(ks.path)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("invalid JWKS %s: %w", ks.path, err)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = keys
+	ks.modTime = info.ModTime()
+	ks.lastCheck = time.Now()
+	return nil
+}
+
+// parseJWKS parses a JSON Web Key Set (RFC 7517). Keys of other types and keys meant
+// for encryption are skipped.
+func parseJWKS(data []byte) ([]jwk, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			K   string `json:"k"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	var keys []jwk
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		alg, ok := ktyAlgs[k.Kty]
+		if !ok || (k.Alg != "" && k.Alg != alg) {
+			// Other key types, and algorithms such as RS512, aren't supported
+			continue
+		}
+		key := jwk{ID: k.Kid, Alg: alg}
+		var err error
+		switch k.Kty {
+		case "oct":
+			key.Key, err = decodeSymmetricKey(k.K)
+		case "RSA":
+			key.Key, err = decodeRSAKey(k.N, k.E)
+		case "EC":
+			key.Key, err = decodeECKey(k.Crv, k.X, k.Y)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %d (%q): %w", i, k.Kid, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no HS256, RS256 or ES256 signing keys")
+	}
+	return keys, nil
+}
+
+func decodeSymmetricKey(k string) ([]byte, error) {
+	key, err := base64.RawURLEncoding.DecodeString(k)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	// RFC 7518: an HS256 key must be at least as long as the hash
+	if len(key) < 32 {
+		return nil, errors.New("HS256 keys need at least 32 bytes")
+	}
+	return key, nil
+}
+
+func decodeRSAKey(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil || len(eb) == 0 || len(eb) > 4 {
+		return nil, errors.New("invalid exponent")
+	}
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(new(big.Int).SetBytes(eb).Int64())}
+	if key.E < 3 {
+		return nil, errors.New("invalid exponent")
+	}
+	if key.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("RSA keys need at least %d bits", minRSABits)
+	}
+	return key, nil
+}
+
+func decodeECKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	if crv != "P-256" {
+		return nil, fmt.Errorf("unsupported curve %q: ES256 uses P-256", crv)
+	}
+	xb, errX := base64.RawURLEncoding.DecodeString(x)
+	yb, errY := base64.RawURLEncoding.DecodeString(y)
+	if errX != nil || errY != nil || len(xb) != 32 || len(yb) != 32 {
+		return nil, errors.New("invalid coordinates")
+	}
+	// Parsing the uncompressed point checks that it is on the curve
+	if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, xb...), yb...)); err != nil {
+		return nil, fmt.Errorf("invalid point: %w", err)
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}, nil
+}
@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"distributed_cloud_service/internal/cluster"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Errors returned by JWTValidator.Validate
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrUnknownKey       = errors.New("no key to verify the token")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrTokenNotYetValid = errors.New("token not valid yet")
+	ErrInvalidIssuer    = errors.New("invalid issuer")
+	ErrInvalidAudience  = errors.New("invalid audience")
+)
+
+// Claims is the payload of a JWT
+type Claims map[string]interface{}
+
+// JWTValidator checks JWTs signed with HS256, RS256 or ES256 against the keys of a JWKS
+// file, and maps their claims to permissions
+type JWTValidator struct {
+	cfg  cluster.JWTConfig
+	keys *KeySet
+	now  func() time.Time
+}
+
+// NewJWTValidator loads the configured JWKS file and returns a validator for it
+func NewJWTValidator(cfg cluster.JWTConfig) (*JWTValidator, error) {
+	keys, err := LoadKeySet(cfg.JWKSFile)
+	if err != nil {
+		return nil, err
+	}
+	return &JWTValidator{cfg: cfg, keys: keys, now: time.Now}, nil
+}
+
+// KeySet returns the keys tokens are checked against
+func (v *JWTValidator) KeySet() *KeySet {
+	return v.keys
+}
+
+// LooksLikeJWT reports whether token has the three dot-separated parts of a compact
+// JWT, so it isn't worth checking against static tokens
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Validate verifies the signature of token and checks its exp, nbf, iss and aud claims.
+// Tokens without exp are rejected.
+func (v *JWTValidator) Validate(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+	var header struct {
+		Alg  string   `json:"alg"`
+		Kid  string   `json:"kid"`
+		Crit []string `json:"crit"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if len(header.Crit) > 0 {
+		// None of the extensions a token could require us to understand are supported
+		return nil, fmt.Errorf("%w: unsupported critical header %q", ErrMalformedToken, header.Crit[0])
+	}
+	switch header.Alg {
+	case "HS256", "RS256", "ES256":
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlg, header.Alg)
+	}
+
+	keys := v.keys.lookup(header.Alg, header.Kid)
+	if len(keys) == 0 {
+		return nil, ErrUnknownKey
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range keys {
+		if verifySignature(k, signed, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrInvalidSignature
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token into v
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrMalformedToken
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedToken, err)
+	}
+	return nil
+}
+
+// verifySignature checks sig over signed with key
+func verifySignature(key jwk, signed, sig []byte) bool {
+	digest := sha256.Sum256(signed)
+	switch k := key.Key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), sig)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+	case *ecdsa.PublicKey:
+		// JWS signatures are r and s as two 32-byte big-endian integers, not ASN.1
+		if len(sig) != 64 {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(k, digest[:], r, s)
+	}
+	return false
+}
+
+// checkClaims checks the registered claims against the clock and the configuration
+func (v *JWTValidator) checkClaims(claims Claims) error {
+	now := v.now()
+	exp, ok, err := numericDate(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: exp is required", ErrMalformedToken)
+	}
+	if !now.Before(exp.Add(v.cfg.Leeway)) {
+		return ErrTokenExpired
+	}
+	nbf, ok, err := numericDate(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(v.cfg.Leeway).Before(nbf) {
+		return ErrTokenNotYetValid
+	}
+
+	if v.cfg.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+			return ErrInvalidIssuer
+		}
+	}
+	if v.cfg.Audience != "" {
+		// aud is either one string or a list of them
+		switch aud := claims["aud"].(type) {
+		case string:
+			if aud == v.cfg.Audience {
+				return nil
+			}
+		case []interface{}:
+			for _, a := range aud {
+				if a == v.cfg.Audience {
+					return nil
+				}
+			}
+		}
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+// numericDate reads a time claim in seconds since the epoch
+func numericDate(claims Claims, name string) (time.Time, bool, error) {
+	raw, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	secs, ok := raw.(float64)
+	if !ok || math.IsNaN(secs) || math.IsInf(secs, 0) {
+		return time.Time{}, false, fmt.Errorf("%w: %s is not a number", ErrMalformedToken, name)
+	}
+	whole, frac := math.Modf(secs)
+	return time.Unix(int64(whole), int64(frac*1e9)), true, nil
+}
+
+// Permissions returns the permissions the configured claim mappings grant claims
+func (v *JWTValidator) Permissions(claims Claims) []Permission {
+	var perms []Permission
+	for _, m := range v.cfg.Claims {
+		if !claimHasValue(claimAt(claims, m.Claim), m.Value) {
+			continue
+		}
+		for _, p := range m.Permissions {
+			prefix, ok := expandClaims(p.Prefix, claims)
+			if !ok {
+				continue
+			}
+			perms = append(perms, Permission{Namespace: p.Namespace, Prefix: prefix, Access: p.Access})
+		}
+	}
+	return perms
+}
+
+// claimAt returns the claim called name, or else the nested claim its dots lead to.
+// Claims named after URLs, as some providers namespace theirs, are found whole.
+func claimAt(claims Claims, name string) interface{} {
+	if v, ok := claims[name]; ok {
+		return v
+	}
+	var cur interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(name, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = obj[part]
+	}
+	return cur
+}
+
+// claimHasValue reports whether a claim is want, contains it as a list, or contains it
+// as one of its space-separated words (like the OAuth scope claim)
+func claimHasValue(claim interface{}, want string) bool {
+	switch c := claim.(type) {
+	case string:
+		for _, word := range strings.Fields(c) {
+			if word == want {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range c {
+			if item == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expandClaims replaces the {claim} placeholders in prefix with the token's string
+// claims. It returns false if one of them is missing or empty.
+func expandClaims(prefix string, claims Claims) (string, bool) {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(prefix, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(prefix[start:], '}')
+		if end < 0 {
+			break
+		}
+		value, _ := claimAt(claims, prefix[start+1:start+end]).(string)
+		if value == "" {
+			return "", false
+		}
+		b.WriteString(prefix[:start])
+		b.WriteString(value)
+		prefix = prefix[start+end+1:]
+	}
+	b.WriteString(prefix)
+	return b.String(), true
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"distributed_cloud_service/internal/cluster"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var hmacSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signToken builds a compact JWT with the given header and claims, signed with key:
+// []byte for HS256, *rsa.PrivateKey for RS256 and *ecdsa.PrivateKey for ES256
+func signToken(t *testing.T, header, claims map[string]interface{}, key interface{}) string {
+	t.Helper()
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := b64(h) + "." + b64(c)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatalf("Failed to sign: %v", err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + b64(sig)
+}
+
+// writeJWKS writes a key set to path
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	t.Helper()
+	data, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write JWKS: %v", err)
+	}
+}
+
+func TestJWTValidator_Validate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path,
+		map[string]string{"kty": "oct", "kid": "hs", "k": b64(hmacSecret)},
+		map[string]string{"kty": "RSA", "kid": "rs", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		map[string]string{"kty": "EC", "kid": "es", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		map[string]string{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	)
+	v, err := NewJWTValidator(cluster.JWTConfig{JWKSFile: path, Issuer: "https://idp", Audience: "kv", Leeway: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("NewJWTValidator() failed: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	v.now = func() time.Time { return now }
+
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"sub": "alice", "iss": "https://idp", "aud": "kv", "exp": now.Add(time.Hour).Unix()}
+		for k, val := range extra {
+			if val == nil {
+				delete(c, k)
+			} else {
+				c[k] = val
+			}
+		}
+		return c
+	}
+	hs := map[string]interface{}{"alg": "HS256", "kid": "hs"}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"HS256", signToken(t, hs, claims(nil), hmacSecret), nil},
+		{"RS256", signToken(t, map[string]interface{}{"alg": "RS256", "kid": "rs"}, claims(nil), rsaKey), nil},
+		{"ES256", signToken(t, map[string]interface{}{"alg": "ES256", "kid": "es"}, claims(nil), ecKey), nil},
+		{"no kid", signToken(t, map[string]interface{}{"alg": "ES256"}, claims(nil), ecKey), nil},
+		{"audience list", signToken(t, hs, claims(map[string]interface{}{"aud": []string{"other", "kv"}}), hmacSecret), nil},
+		{"expired within leeway", signToken(t, hs, claims(map[string]interface{}{"exp": now.Add(-10 * time.Second).Unix()}), hmacSecret), nil},
+		{"expired", signToken(t, hs, claims(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()}), hmacSecret), ErrTokenExpired},
+		{"no exp", signToken(t, hs, claims(map[string]interface{}{"exp": nil}), hmacSecret), ErrMalformedToken},
+		{"not yet valid", signToken(t, hs, claims(map[string]interface{}{"nbf": now.Add(time.Minute).Unix()}), hmacSecret), ErrTokenNotYetValid},
+		{"wrong issuer", signToken(t, hs, claims(map[string]interface{}{"iss": "https://evil"}), hmacSecret), ErrInvalidIssuer},
+		{"wrong audience", signToken(t, hs, claims(map[string]interface{}{"aud": []string{"other"}}), hmacSecret), ErrInvalidAudience},
+		{"bad signature", signToken(t, hs, claims(nil), []byte("another secret, another 32 bytes")), ErrInvalidSignature},
+		{"alg none", signToken(t, map[string]interface{}{"alg": "none"}, claims(nil), []byte{}), ErrUnsupportedAlg},
+		{"unsupported alg", signToken(t, map[string]interface{}{"alg": "HS512", "kid": "hs"}, claims(nil), hmacSecret), ErrUnsupportedAlg},
+		{"unknown kid", signToken(t, map[string]interface{}{"alg": "HS256", "kid": "nope"}, claims(nil), hmacSecret), ErrUnknownKey},
+		// An RSA public key used as an HMAC secret must not verify
+		{"alg confusion", signToken(t, map[string]interface{}{"alg": "HS256", "kid": "rs"}, claims(nil), rsaKey.N.Bytes()), ErrUnknownKey},
+		{"critical header", signToken(t, map[string]interface{}{"alg": "HS256", "kid": "hs", "crit": []string{"b64"}}, claims(nil), hmacSecret), ErrMalformedToken},
+		{"not a JWT", "abc.def", ErrMalformedToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Validate(tt.token)
+			if tt.want == nil && err != nil {
+				t.Errorf("Expected token to be valid, got %v", err)
+			} else if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestKeySet_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]string{"kty": "oct", "kid": "old", "k": b64(hmacSecret)})
+	v, err := NewJWTValidator(cluster.JWTConfig{JWKSFile: path})
+	if err != nil {
+		t.Fatalf("NewJWTValidator() failed: %v", err)
+	}
+	v.KeySet().SetInterval(0)
+
+	newSecret := []byte("fedcba9876543210fedcba9876543210")
+	claims := map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix()}
+	token := signToken(t, map[string]interface{}{"alg": "HS256", "kid": "new"}, claims, newSecret)
+	if _, err := v.Validate(token); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Expected %v before rotation, got %v", ErrUnknownKey, err)
+	}
+
+	writeJWKS(t, path, map[string]string{"kty": "oct", "kid": "new", "k": b64(newSecret)})
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path, later, later)
+	if _, err := v.Validate(token); err != nil {
+		t.Errorf("Expected the rotated key to be picked up, got %v", err)
+	}
+
+	// A broken file keeps the previous keys
+	os.WriteFile(path, []byte("{"), 0600)
+	later = later.Add(time.Second)
+	os.Chtimes(path, later, later)
+	if _, err := v.Validate(token); err != nil {
+		t.Errorf("Expected the previous keys to be kept, got %v", err)
+	}
+
+	for _, keys := range []string{`{"keys":[]}`, `{"keys":[{"kty":"oct","k":"c2hvcnQ"}]}`, `{"keys":[{"kty":"EC","crv":"P-384","x":"","y":""}]}`} {
+		os.WriteFile(path, []byte(keys), 0600)
+		if _, err := LoadKeySet(path); err == nil {
+			t.Errorf("Expected %s to be rejected", keys)
+		}
+	}
+}
+
+func TestJWTValidator_Permissions(t *testing.T) {
+	v := &JWTValidator{cfg: cluster.JWTConfig{Claims: []cluster.ClaimMapping{
+		{Claim: "scope", Value: "kv:read", Permissions: []cluster.PermissionConfig{{Prefix: "public/", Access: AccessRead}}},
+		{Claim: "realm_access.roles", Value: "owner", Permissions: []cluster.PermissionConfig{{Prefix: "users/{sub}/", Access: AccessWrite}}},
+		{Claim: "https://example.com/groups", Value: "ops", Permissions: []cluster.PermissionConfig{{Namespace: AnyNamespace, Access: AccessAdmin}}},
+		{Claim: "role", Value: "tenant", Permissions: []cluster.PermissionConfig{{Namespace: "acme", Prefix: "{org.id}/", Access: AccessRead}}},
+	}}}
+
+	claims := Claims{
+		"sub":          "alice",
+		"scope":        "openid kv:read",
+		"realm_access": map[string]interface{}{"roles": []interface{}{"owner"}},
+		"role":         "tenant",
+	}
+	perms := v.Permissions(claims)
+	want := []Permission{
+		{Prefix: "public/", Access: AccessRead},
+		{Prefix: "users/alice/", Access: AccessWrite},
+	}
+	if len(perms) != len(want) {
+		t.Fatalf("Expected permissions %+v, got %+v", want, perms)
+	}
+	for i := range want {
+		if perms[i] != want[i] {
+			t.Errorf("Expected permission %+v, got %+v", want[i], perms[i])
+		}
+	}
+
+	if !Allows(perms, "", "users/alice/settings", AccessWrite) || Allows(perms, "", "users/bob/settings", AccessRead) {
+		t.Error("Expected the {sub} prefix to cover only the caller's keys")
+	}
+	if perms := v.Permissions(Claims{"scope": "kv:readonly", "https://example.com/groups": []interface{}{"ops"}}); len(perms) != 1 || perms[0].Access != AccessAdmin {
+		t.Errorf("Expected only the URL-named claim to match, got %+v", perms)
+	}
+}
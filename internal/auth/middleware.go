@@ -1,42 +1,128 @@
-package auth
-
-import (
-	"net/http"
-	"strings"
-)
-
-// AuthMiddleware validates bearer token for write operations
-func AuthMiddleware(token string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// If no token configured, allow all requests
-			if token == "" {
-				next.ServeHTTP(w, r)
-				return
-			}
-
-			// Get Authorization header
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				http.Error(w, "Authorization header required", http.StatusUnauthorized)
-				return
-			}
-
-			// Check Bearer token format
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				http.Error(w, "Invalid authorization format. Use: Bearer <token>", http.StatusUnauthorized)
-				return
-			}
-
-			// Validate token
-			if parts[1] != token {
-				http.Error(w, "Invalid token", http.StatusUnauthorized)
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
+package auth
+
+import (
+	"distributed_cloud_service/internal/acl"
+	"net/http"
+	"strings"
+)
+
+// Options configures how requests are authenticated
+type Options struct {
+	// Token is the shared bearer token; empty disables token auth
+	Token string
+	// CertIdentities maps verified client certificate names (subject CN or SAN) to identities
+	CertIdentities map[string]string
+	// Scopes maps bearer tokens to the access level they grant. A scoped token is only
+	// accepted on routes whose RouteScope it covers, so a read token can't write keys or
+	// change cluster membership.
+	Scopes map[string]string
+	// IdentityScopes maps certificate identities to the access level they grant, checked
+	// against the route like Scopes
+	IdentityScopes map[string]string
+	// WriteError answers rejected requests; nil writes msg as plain text
+	WriteError func(w http.ResponseWriter, r *http.Request, status int, msg string)
+}
+
+// AuthMiddleware validates bearer token for write operations
+func AuthMiddleware(token string) func(http.Handler) http.Handler {
+	return NewMiddleware(Options{Token: token})
+}
+
+// NewMiddleware authenticates requests by verified client certificate or bearer token.
+// Scoped tokens and identities are also checked against the scope of the route. With
+// scopes configured, credentials the middleware doesn't know are passed on to handlers
+// that check them: namespace tokens, RBAC users and JWTs.
+func NewMiddleware(opts Options) func(http.Handler) http.Handler {
+	scoped := len(opts.Scopes) > 0 || len(opts.IdentityScopes) > 0
+	fail := opts.WriteError
+	if fail == nil {
+		fail = func(w http.ResponseWriter, _ *http.Request, status int, msg string) {
+			http.Error(w, msg, status)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope := RouteScope(r)
+
+			// A verified client certificate that maps to a known identity is sufficient,
+			// within its scope if it has one
+			if id, ok := CertificateIdentity(r, opts.CertIdentities); ok {
+				access, hasScope := opts.IdentityScopes[id.Name]
+				switch {
+				case !scoped || scope == "":
+				case hasScope && !acl.Covers(access, scope):
+					fail(w, r, http.StatusForbidden, "Certificate identity does not allow "+scope+" access")
+					return
+				case hasScope:
+					id.Access = access
+				case checkedByHandler(r):
+					// The handler decides, e.g. from the RBAC user of the same name
+					r = delegate(r)
+				default:
+					fail(w, r, http.StatusForbidden, "Client certificate is not authorized")
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+				return
+			}
+
+			// If no credentials configured, allow all requests
+			if opts.Token == "" && len(opts.CertIdentities) == 0 && !scoped {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Public routes need no scope
+			if scoped && scope == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Get Authorization header
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				if hasVerifiedCertificate(r) {
+					fail(w, r, http.StatusForbidden, "Client certificate is not authorized")
+					return
+				}
+				fail(w, r, http.StatusUnauthorized, "Authorization header required")
+				return
+			}
+
+			// Check Bearer token format
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				fail(w, r, http.StatusUnauthorized, "Invalid authorization format. Use: Bearer <token>")
+				return
+			}
+
+			// A scoped token must cover the route
+			if granted, ok := tokenScope(opts.Scopes, parts[1]); ok {
+				if !acl.Covers(granted, scope) {
+					fail(w, r, http.StatusForbidden, "Token does not allow "+scope+" access")
+					return
+				}
+				id := Identity{Name: granted + "-token", Method: MethodToken, Access: granted}
+				next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+				return
+			}
+
+			// Validate token
+			if opts.Token != "" && parts[1] == opts.Token {
+				// The shared token also guards membership changes, so it is the admin credential
+				id := Identity{Name: "token", Method: MethodToken, Access: AccessAdmin}
+				next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+				return
+			}
+
+			// Namespace, RBAC user and JWT tokens are checked by the handlers, with or
+			// without scopes
+			if checkedByHandler(r) {
+				next.ServeHTTP(w, delegate(r))
+				return
+			}
+			fail(w, r, http.StatusUnauthorized, "Invalid token")
+		})
+	}
+}
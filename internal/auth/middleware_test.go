@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func okHandler(t *testing.T, wantIdentity string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := IdentityFromContext(r.Context())
+		if wantIdentity != "" && (!ok || id.Name != wantIdentity) {
+			t.Errorf("Expected identity %q, got %+v", wantIdentity, id)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func withClientCert(r *http.Request, cert *x509.Certificate) *http.Request {
+	r.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	return r
+}
+
+func TestAuthMiddleware_Token(t *testing.T) {
+	handler := AuthMiddleware("secret")(okHandler(t, "token"))
+
+	tests := []struct {
+		header string
+		want   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Basic abc", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		// A route no handler checks credentials on, so unknown tokens stop here
+		req := httptest.NewRequest("POST", "/raft/join", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("Authorization %q: expected status %d, got %d", tt.header, tt.want, w.Code)
+		}
+	}
+}
+
+func TestNewMiddleware_TokenDelegatesNamespaceTokens(t *testing.T) {
+	var delegated bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delegated = Delegated(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := NewMiddleware(Options{Token: "t"})(next)
+
+	tests := []struct {
+		method    string
+		path      string
+		want      int
+		delegated bool
+	}{
+		// Namespace tokens are not known to the middleware; the handler checks them
+		{"PUT", "/ns/tenant/kv/key", http.StatusNoContent, true},
+		{"GET", "/v1/ns/tenant/kv/key", http.StatusNoContent, true},
+		{"GET", "/admin/rbac/users", http.StatusNoContent, true},
+		{"POST", "/raft/join", http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		delegated = false
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Authorization", "Bearer ns-token")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.want || delegated != tt.delegated {
+			t.Errorf("%s %s: expected status %d (delegated %v), got %d (delegated %v)", tt.method, tt.path, tt.want, tt.delegated, w.Code, delegated)
+		}
+	}
+}
+
+func TestNewMiddleware_ClientCertificate(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://corp/deployer")
+	opts := Options{
+		Token: "secret",
+		CertIdentities: map[string]string{
+			"ci-runner":              "ci",
+			"spiffe://corp/deployer": "deployer",
+		},
+	}
+
+	// Subject CN maps to an identity
+	req := withClientCert(httptest.NewRequest("PUT", "/kv/key", nil),
+		&x509.Certificate{Subject: pkix.Name{CommonName: "ci-runner"}})
+	w := httptest.NewRecorder()
+	NewMiddleware(opts)(okHandler(t, "ci")).ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected CN identity to be accepted, got %d", w.Code)
+	}
+
+	// URI SAN maps to an identity
+	req = withClientCert(httptest.NewRequest("PUT", "/kv/key", nil),
+		&x509.Certificate{Subject: pkix.Name{CommonName: "unknown"}, URIs: []*url.URL{spiffe}})
+	w = httptest.NewRecorder()
+	NewMiddleware(opts)(okHandler(t, "deployer")).ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected SAN identity to be accepted, got %d", w.Code)
+	}
+
+	// A verified but unmapped certificate is forbidden without a token
+	req = withClientCert(httptest.NewRequest("PUT", "/kv/key", nil),
+		&x509.Certificate{Subject: pkix.Name{CommonName: "stranger"}})
+	w = httptest.NewRecorder()
+	NewMiddleware(opts)(okHandler(t, "")).ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected unmapped certificate to be forbidden, got %d", w.Code)
+	}
+
+	// Unverified certificates are ignored
+	req = httptest.NewRequest("PUT", "/kv/key", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "ci-runner"}}}}
+	w = httptest.NewRecorder()
+	NewMiddleware(opts)(okHandler(t, "")).ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected unverified certificate to be rejected, got %d", w.Code)
+	}
+}
+
+func TestRouteScope(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"GET", "/health", ""},
+		{"GET", "/kv/key", AccessRead},
+		{"HEAD", "/v1/kv/key", AccessRead},
+		{"POST", "/kv/_mget", AccessRead},
+		{"POST", "/ns/team-a/kv/_mget", AccessRead},
+		{"GET", "/raft/status", AccessRead},
+		{"GET", "/cluster/members", AccessRead},
+		{"PUT", "/kv/key", AccessWrite},
+		{"PUT", "/kv/a/_mget", AccessWrite},
+		{"POST", "/kv/hits/incr", AccessWrite},
+		{"DELETE", "/v1/ns/team-a/kv/key", AccessWrite},
+		{"POST", "/raft/join", AccessAdmin},
+		{"POST", "/raft/remove", AccessAdmin},
+		{"GET", "/raft/events", AccessAdmin},
+		{"GET", "/admin/backup", AccessAdmin},
+		{"GET", "/v1/admin/namespaces", AccessAdmin},
+	}
+	for _, tt := range tests {
+		if got := RouteScope(httptest.NewRequest(tt.method, tt.path, nil)); got != tt.want {
+			t.Errorf("%s %s: expected scope %q, got %q", tt.method, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestNewMiddleware_Scopes(t *testing.T) {
+	handler := NewMiddleware(Options{Scopes: map[string]string{
+		"reader": AccessRead,
+		"writer": AccessWrite,
+		"admin":  AccessAdmin,
+	}})(okHandler(t, ""))
+
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"GET", "/health", "", http.StatusNoContent},
+		{"GET", "/kv/key", "", http.StatusUnauthorized},
+		{"GET", "/kv/key", "wrong", http.StatusNoContent}, // left to the handler
+		{"PUT", "/v1/ns/team-a/kv/key", "tenant", http.StatusNoContent},
+		{"GET", "/raft/status", "wrong", http.StatusUnauthorized},
+		{"POST", "/raft/join", "wrong", http.StatusUnauthorized},
+		{"GET", "/kv/key", "reader", http.StatusNoContent},
+		{"PUT", "/kv/key", "reader", http.StatusForbidden},
+		{"POST", "/raft/remove", "reader", http.StatusForbidden},
+		{"PUT", "/kv/key", "writer", http.StatusNoContent},
+		{"POST", "/raft/remove", "writer", http.StatusForbidden},
+		{"GET", "/admin/backup", "writer", http.StatusForbidden},
+		{"POST", "/raft/remove", "admin", http.StatusNoContent},
+		{"PUT", "/kv/key", "admin", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s with %q: expected status %d, got %d", tt.method, tt.path, tt.token, tt.want, w.Code)
+		}
+	}
+}
+
+func TestNewMiddleware_IdentityScopes(t *testing.T) {
+	var got Identity
+	var delegated bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = IdentityFromContext(r.Context())
+		delegated = Delegated(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})
+	var rejected []string
+	handler := NewMiddleware(Options{
+		CertIdentities: map[string]string{"ci-runner": "ci", "svc": "svc"},
+		IdentityScopes: map[string]string{"ci": AccessWrite},
+		WriteError: func(w http.ResponseWriter, r *http.Request, status int, msg string) {
+			rejected = append(rejected, r.URL.Path)
+			w.WriteHeader(status)
+		},
+	})(next)
+
+	tests := []struct {
+		method    string
+		path      string
+		cn        string
+		want      int
+		access    string
+		delegated bool
+	}{
+		{"PUT", "/kv/key", "ci-runner", http.StatusNoContent, AccessWrite, false},
+		{"POST", "/raft/remove", "ci-runner", http.StatusForbidden, "", false},
+		{"GET", "/v1/admin/namespaces", "ci-runner", http.StatusForbidden, "", false},
+		// Identities without a scope only reach handlers that check credentials
+		{"PUT", "/kv/key", "svc", http.StatusNoContent, "", true},
+		{"GET", "/raft/status", "svc", http.StatusForbidden, "", false},
+	}
+	for _, tt := range tests {
+		got, delegated = Identity{}, false
+		req := withClientCert(httptest.NewRequest(tt.method, tt.path, nil),
+			&x509.Certificate{Subject: pkix.Name{CommonName: tt.cn}})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s as %s: expected status %d, got %d", tt.method, tt.path, tt.cn, tt.want, w.Code)
+		}
+		if w.Code == http.StatusNoContent && (got.Access != tt.access || delegated != tt.delegated) {
+			t.Errorf("%s %s as %s: expected access %q and delegated %v, got %+v, %v",
+				tt.method, tt.path, tt.cn, tt.access, tt.delegated, got, delegated)
+		}
+	}
+	if len(rejected) != 3 {
+		t.Errorf("Expected 3 errors written by the hook, got %v", rejected)
+	}
+}
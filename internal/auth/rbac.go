@@ -0,0 +1,22 @@
+package auth
+
+import "distributed_cloud_service/internal/acl"
+
+// Permission and the access levels live in acl so the store can hold roles without
+// importing auth
+type Permission = acl.Permission
+
+const (
+	AccessRead   = acl.AccessRead
+	AccessWrite  = acl.AccessWrite
+	AccessAdmin  = acl.AccessAdmin
+	AnyNamespace = acl.AnyNamespace
+)
+
+// Root is the permission of the bootstrap root credential: admin on everything
+var Root = acl.Root
+
+// Allows reports whether any of perms grants access on key in namespace ns
+func Allows(perms []Permission, ns, key, access string) bool {
+	return acl.Allows(perms, ns, key, access)
+}
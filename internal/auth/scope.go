@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// RouteScope returns the access level a scoped token needs for r: AccessAdmin for the
+// admin API and cluster membership, AccessWrite for requests that change keys, and
+// AccessRead for everything else. /health is public and returns "".
+func RouteScope(r *http.Request) string {
+	path := unversioned(r.URL.Path)
+	readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+
+	switch {
+	case path == "/health":
+		return ""
+	case path == "/admin" || strings.HasPrefix(path, "/admin/"):
+		return AccessAdmin
+	case strings.HasPrefix(path, "/raft/") || strings.HasPrefix(path, "/cluster/"):
+		// The event stream replays every write, so it is as sensitive as a backup
+		if !readOnly || path == "/raft/events" {
+			return AccessAdmin
+		}
+		return AccessRead
+	case r.Method == http.MethodPost && isMGet(path):
+		return AccessRead
+	case !readOnly:
+		return AccessWrite
+	}
+	return AccessRead
+}
+
+// checkedByHandler reports whether the handler of r checks credentials itself, so bearer
+// tokens the middleware doesn't know (namespace, RBAC user and JWT tokens) can be passed on
+func checkedByHandler(r *http.Request) bool {
+	path := unversioned(r.URL.Path)
+	switch path {
+	case "/admin/namespaces", "/admin/rbac", "/admin/backup", "/admin/restore", "/admin/export",
+		"/admin/import", "/admin/hash", "/raft/events":
+		return true
+	}
+	for _, prefix := range []string{"/kv/", "/ns/", "/admin/namespaces/", "/admin/rbac/"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// unversioned strips the /v1 prefix, as routes under it are scoped like the unversioned ones
+func unversioned(path string) string {
+	if path == "/v1" || strings.HasPrefix(path, "/v1/") {
+		return strings.TrimPrefix(path, "/v1")
+	}
+	return path
+}
+
+// isMGet reports whether path is /kv/_mget or /ns/{tenant}/kv/_mget, which only read
+func isMGet(path string) bool {
+	if path == "/kv/_mget" {
+		return true
+	}
+	rest, ok := strings.CutPrefix(path, "/ns/")
+	_, rest, _ = strings.Cut(rest, "/")
+	return ok && rest == "kv/_mget"
+}
+
+// tokenScope returns the scope of token in scopes, comparing in constant time
+func tokenScope(scopes map[string]string, token string) (string, bool) {
+	scope, found := "", false
+	for t, s := range scopes {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			scope, found = s, true
+		}
+	}
+	return scope, found
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// BearerToken returns the token from an "Authorization: Bearer <token>" header
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || scheme != "Bearer" || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// GenerateToken returns a new random bearer token
+func GenerateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken returns the hex SHA-256 of a token, which is what gets replicated and stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MatchTokenHash reports whether token hashes to one of hashes
+func MatchTokenHash(token string, hashes []string) bool {
+	hash := []byte(HashToken(token))
+	match := false
+	for _, h := range hashes {
+		if subtle.ConstantTimeCompare(hash, []byte(h)) == 1 {
+			match = true
+		}
+	}
+	return match
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		token  string
+		ok     bool
+	}{
+		{"Bearer abc", "abc", true},
+		{"", "", false},
+		{"Basic abc", "", false},
+		{"Bearer ", "", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", tt.header)
+		token, ok := BearerToken(req)
+		if token != tt.token || ok != tt.ok {
+			t.Errorf("BearerToken(%q) = %q, %v; expected %q, %v", tt.header, token, ok, tt.token, tt.ok)
+		}
+	}
+}
+
+func TestMatchTokenHash(t *testing.T) {
+	token, err := GenerateToken()
+	if err != nil {
+		t.Fatalf("GenerateToken() failed: %v", err)
+	}
+	hashes := []string{HashToken("other"), HashToken(token)}
+
+	if !MatchTokenHash(token, hashes) {
+		t.Error("Expected token to match its hash")
+	}
+	if MatchTokenHash("wrong", hashes) {
+		t.Error("Unexpected match for wrong token")
+	}
+	if HashToken(token) == token {
+		t.Error("Hash must not equal the token")
+	}
+}
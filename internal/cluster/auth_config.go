@@ -0,0 +1,74 @@
+package cluster
+
+import "fmt"
+
+// AuthConfig gives data reads, data writes and cluster administration their own bearer
+// tokens, checked per route. Each scope includes the ones before it, so a write token
+// can also read, but only an admin token can change membership or use /admin.
+type AuthConfig struct {
+	ReadTokens  []string `yaml:"read_tokens"`  // GET and HEAD on keys, _mget, status and metrics
+	WriteTokens []string `yaml:"write_tokens"` // Also PUT, PATCH, DELETE and counters
+	AdminTokens []string `yaml:"admin_tokens"` // Also /admin, /raft/join, /raft/remove and other cluster changes
+	// IdentityScopes gives client certificate identities (values of tls.client_identities)
+	// a scope, checked like the tokens'
+	IdentityScopes map[string]string `yaml:"identity_scopes"`
+}
+
+// Enabled reports whether scoped tokens or identities are configured
+func (c AuthConfig) Enabled() bool {
+	return len(c.ReadTokens) > 0 || len(c.WriteTokens) > 0 || len(c.AdminTokens) > 0 || len(c.IdentityScopes) > 0
+}
+
+// Scopes maps each configured token to its scope: "read", "write" or "admin"
+func (c AuthConfig) Scopes() map[string]string {
+	scopes := make(map[string]string)
+	for scope, tokens := range map[string][]string{"read": c.ReadTokens, "write": c.WriteTokens, "admin": c.AdminTokens} {
+		for _, token := range tokens {
+			scopes[token] = scope
+		}
+	}
+	return scopes
+}
+
+// Validate checks that tokens are not empty and belong to a single scope, and that
+// identities have a known scope
+func (c AuthConfig) Validate() error {
+	for id, scope := range c.IdentityScopes {
+		switch scope {
+		case "read", "write", "admin":
+		default:
+			return fmt.Errorf("auth.identity_scopes.%s must be read, write or admin, got %q", id, scope)
+		}
+	}
+	seen := make(map[string]string)
+	for _, scope := range []struct {
+		name   string
+		tokens []string
+	}{{"read_tokens", c.ReadTokens}, {"write_tokens", c.WriteTokens}, {"admin_tokens", c.AdminTokens}} {
+		for _, token := range scope.tokens {
+			if token == "" {
+				return fmt.Errorf("auth.%s must not contain empty tokens", scope.name)
+			}
+			if other, ok := seen[token]; ok {
+				return fmt.Errorf("auth.%s: token is also listed in auth.%s", scope.name, other)
+			}
+			seen[token] = scope.name
+		}
+	}
+	return nil
+}
+
+// ValidateIdentities checks that each identity given a scope is one tls.client_identities maps
+// a certificate to
+func (c AuthConfig) ValidateIdentities(tls HTTPTLSConfig) error {
+	known := make(map[string]bool)
+	for _, id := range tls.ClientIdentities {
+		known[id] = true
+	}
+	for id := range c.IdentityScopes {
+		if !known[id] {
+			return fmt.Errorf("auth.identity_scopes.%s is not an identity in tls.client_identities", id)
+		}
+	}
+	return nil
+}
@@ -1,54 +1,63 @@
-package cluster
-
-// Config represents a node's configuration
-type Config struct {
-	NodeID     string   `yaml:"node_id"`
-	ListenAddr string   `yaml:"listen_addr"` // HTTP address
-	RaftAddr   string   `yaml:"raft_addr"`   // Optional explicit Raft address
-	Peers      []string `yaml:"peers"`
-	Bootstrap  bool     `yaml:"bootstrap"`   // Only first node should set true
-	JoinURL    string   `yaml:"join_url"`    // Leader HTTP base for auto-join (e.g., http://127.0.0.1:9001)
-	AuthToken  string   `yaml:"auth_token"`  // Optional bearer token for write operations
-}
-
-// Node represents a node in the cluster
-type Node struct {
-	ID      string
-	Address string
-}
-
-// Cluster manages membership and node information
-type Cluster struct {
-	Self   Node
-	Peers  []Node
-	Config *Config
-}
-
-// NewCluster creates a new cluster instance
-func NewCluster(config *Config) *Cluster {
-	cluster := &Cluster{
-		Config: config,
-		Self: Node{
-			ID:      config.NodeID,
-			Address: config.ListenAddr,
-		},
-		Peers: make([]Node, 0),
-	}
-
-	// Convert peer addresses to Node objects
-	for _, addr := range config.Peers {
-		cluster.Peers = append(cluster.Peers, Node{
-			Address: addr,
-		})
-	}
-
-	return cluster
-}
-
-// GetMembers returns all cluster members (self + peers)
-func (c *Cluster) GetMembers() []Node {
-	members := []Node{c.Self}
-	members = append(members, c.Peers...)
-	return members
-}
-
+package cluster
+
+// Config represents a node's configuration
+type Config struct {
+	NodeID     string        `yaml:"node_id"`
+	ListenAddr string        `yaml:"listen_addr"` // HTTP address
+	RaftAddr   string        `yaml:"raft_addr"`   // Optional explicit Raft address
+	Peers      []string      `yaml:"peers"`
+	Bootstrap  bool          `yaml:"bootstrap"`  // Only first node should set true
+	JoinURL    string        `yaml:"join_url"`   // Leader HTTP base for auto-join (e.g., http://127.0.0.1:9001)
+	AuthToken  string        `yaml:"auth_token"` // Optional bearer token for write operations
+	Auth       AuthConfig    `yaml:"auth"`       // Optional separate tokens for reads, writes and administration
+	Raft       RaftConfig    `yaml:"raft"`       // Optional Raft tuning (timeouts, snapshots)
+	RaftTLS    TLSConfig     `yaml:"raft_tls"`   // Optional mutual TLS for the Raft transport
+	TLS        HTTPTLSConfig `yaml:"tls"`        // Optional HTTPS (and client certificates) for the API
+	Storage    StorageConfig `yaml:"storage"`    // Storage engine for the key-value state
+	Limits     LimitsConfig  `yaml:"limits"`     // Key, value and keyspace quotas
+	Redis      RedisConfig   `yaml:"redis"`      // Optional RESP (Redis protocol) listener
+	RBAC       RBACConfig    `yaml:"rbac"`       // Optional users, roles and per-prefix permissions
+	JWT        JWTConfig     `yaml:"jwt"`        // Optional JWT bearer tokens with claims-mapped permissions
+}
+
+// Node represents a node in the cluster
+type Node struct {
+	ID      string
+	Address string
+}
+
+// Cluster manages membership and node information
+type Cluster struct {
+	Self   Node
+	Peers  []Node
+	Config *Config
+}
+
+// NewCluster creates a new cluster instance
+func NewCluster(config *Config) *Cluster {
+	cluster := &Cluster{
+		Config: config,
+		Self: Node{
+			ID:      config.NodeID,
+			Address: config.ListenAddr,
+		},
+		Peers: make([]Node, 0),
+	}
+
+	// Convert peer addresses to Node objects
+	for _, addr := range config.Peers {
+		cluster.Peers = append(cluster.Peers, Node{
+			Address: addr,
+		})
+	}
+
+	return cluster
+}
+
+// GetMembers returns all cluster members (self + peers)
+func (c *Cluster) GetMembers() []Node {
+	members := []Node{c.Self}
+	members = append(members, c.Peers...)
+	return members
+}
+
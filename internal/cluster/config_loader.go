@@ -1,24 +1,64 @@
-package cluster
-
-import (
-	"fmt"
-	"os"
-
-	"gopkg.in/yaml.v3"
-)
-
-// LoadConfig loads configuration from a YAML file
-func LoadConfig(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
-	}
-
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
-	}
-
-	return &config, nil
-}
-
+package cluster
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfig loads configuration from a YAML file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	config.Raft = config.Raft.WithDefaults()
+	if err := config.Raft.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := config.RaftTLS.Validate("raft_tls"); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := config.TLS.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := config.Storage.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	config.Redis = config.Redis.WithDefaults()
+	if err := config.Redis.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := config.Auth.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if config.Auth.Enabled() && config.AuthToken != "" {
+		return nil, fmt.Errorf("invalid config: auth_token can't be combined with auth scopes, list it in auth.admin_tokens instead")
+	}
+	if err := config.Auth.ValidateIdentities(config.TLS); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := config.RBAC.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if err := config.JWT.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if (config.RBAC.Enabled || config.JWT.Enabled()) && config.AuthToken != "" {
+		return nil, fmt.Errorf("invalid config: auth_token can't be combined with rbac or jwt, use rbac.root_token or auth.admin_tokens instead")
+	}
+	config.Limits = config.Limits.WithDefaults()
+	if err := config.Limits.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return &config, nil
+}
+
@@ -0,0 +1,236 @@
+package cluster
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "node.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig_RaftDefaults(t *testing.T) {
+	path := writeConfig(t, "node_id: node1\nlisten_addr: 127.0.0.1:9001\n")
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	if config.Raft != DefaultRaftConfig() {
+		t.Errorf("Expected default raft config, got %+v", config.Raft)
+	}
+}
+
+func TestLoadConfig_RaftTuning(t *testing.T) {
+	path := writeConfig(t, `node_id: node1
+listen_addr: 127.0.0.1:9001
+raft:
+  heartbeat_timeout: 2s
+  election_timeout: 3s
+  leader_lease_timeout: 1s
+  snapshot_threshold: 1024
+  snapshot_interval: 30s
+  snapshot_retain: 5
+`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	if config.Raft.HeartbeatTimeout != 2*time.Second || config.Raft.ElectionTimeout != 3*time.Second {
+		t.Errorf("Timeouts not parsed: %+v", config.Raft)
+	}
+	if config.Raft.SnapshotThreshold != 1024 || config.Raft.SnapshotRetain != 5 {
+		t.Errorf("Snapshot settings not parsed: %+v", config.Raft)
+	}
+	// Unset fields keep their defaults
+	if config.Raft.MaxAppendEntries != DefaultRaftConfig().MaxAppendEntries {
+		t.Errorf("Expected default max_append_entries, got %d", config.Raft.MaxAppendEntries)
+	}
+}
+
+func TestRaftConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *RaftConfig)
+		wantErr string
+	}{
+		{"defaults", func(c *RaftConfig) {}, ""},
+		{"lease equal to heartbeat", func(c *RaftConfig) { c.LeaderLeaseTimeout = c.HeartbeatTimeout }, "leader_lease_timeout"},
+		{"election below heartbeat", func(c *RaftConfig) { c.ElectionTimeout = c.HeartbeatTimeout / 2 }, "election_timeout"},
+		{"heartbeat too low", func(c *RaftConfig) { c.HeartbeatTimeout = time.Millisecond }, "heartbeat_timeout"},
+		{"too many append entries", func(c *RaftConfig) { c.MaxAppendEntries = 4096 }, "max_append_entries"},
+		{"negative retain", func(c *RaftConfig) { c.SnapshotRetain = -1 }, "snapshot_retain"},
+		{"hash check disabled", func(c *RaftConfig) { c.HashCheckInterval = -1 }, ""},
+		{"hash check too frequent", func(c *RaftConfig) { c.HashCheckInterval = time.Millisecond }, "hash_check_interval"},
+	}
+
+	for _, tt := range tests {
+		c := DefaultRaftConfig()
+		tt.modify(&c)
+		err := c.Validate()
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error mentioning %q, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestLoadConfig_InvalidRaft(t *testing.T) {
+	path := writeConfig(t, "node_id: node1\nraft:\n  heartbeat_timeout: 100ms\n  leader_lease_timeout: 200ms\n")
+
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("LoadConfig() should reject lease timeout above heartbeat timeout")
+	}
+}
+
+func TestLoadConfig_Limits(t *testing.T) {
+	path := writeConfig(t, "node_id: node1\nlimits:\n  max_value_size: 1024\n  max_keys: 100\n")
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	if config.Limits.MaxValueSize != 1024 || config.Limits.MaxKeys != 100 {
+		t.Errorf("Limits not parsed: %+v", config.Limits)
+	}
+	if config.Limits.MaxKeySize != DefaultLimits().MaxKeySize {
+		t.Errorf("Expected default max_key_size, got %d", config.Limits.MaxKeySize)
+	}
+
+	path = writeConfig(t, "node_id: node1\nlimits:\n  max_total_bytes: -1\n")
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("LoadConfig() should reject negative limits")
+	}
+}
+
+func TestLoadConfig_Redis(t *testing.T) {
+	path := writeConfig(t, "node_id: node1\nredis:\n  listen_addr: 127.0.0.1:6379\n")
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	if !config.Redis.Enabled() || config.Redis.ListenAddr != "127.0.0.1:6379" {
+		t.Errorf("Redis config not parsed: %+v", config.Redis)
+	}
+
+	if config.Redis.Advertised() != "127.0.0.1:6379" || config.Redis.IdleTimeout != DefaultRedisIdleTimeout || config.Redis.MaxClients != DefaultRedisMaxClients {
+		t.Errorf("Unexpected Redis defaults: %+v", config.Redis)
+	}
+
+	path = writeConfig(t, "node_id: node1\nredis:\n  listen_addr: 0.0.0.0:6379\n")
+	if config, err := LoadConfig(path); err != nil || config.Redis.Advertised() != "" {
+		t.Errorf("Expected no advertised address for a wildcard listener, got %v", err)
+	}
+	path = writeConfig(t, "node_id: node1\nredis:\n  listen_addr: 0.0.0.0:6379\n  advertise_addr: node1:6379\n")
+	if config, err := LoadConfig(path); err != nil || config.Redis.Advertised() != "node1:6379" {
+		t.Errorf("Expected the configured advertised address, got %v", err)
+	}
+
+	for _, bad := range []string{"listen_addr: 6379", "listen_addr: :6379\n  advertise_addr: 0.0.0.0:6379", "listen_addr: :6379\n  idle_timeout: -1s"} {
+		if _, err := LoadConfig(writeConfig(t, "node_id: node1\nredis:\n  "+bad+"\n")); err == nil {
+			t.Errorf("LoadConfig() should reject %q", bad)
+		}
+	}
+}
+
+func TestLoadConfig_RBAC(t *testing.T) {
+	path := writeConfig(t, "node_id: node1\nrbac:\n  enabled: true\n  root_token: s3cret\n")
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	if !config.RBAC.Enabled || config.RBAC.RootToken != "s3cret" {
+		t.Errorf("RBAC config not parsed: %+v", config.RBAC)
+	}
+
+	path = writeConfig(t, "node_id: node1\nrbac:\n  enabled: true\n")
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("LoadConfig() should require a root token when RBAC is enabled")
+	}
+}
+
+func TestLoadConfig_JWT(t *testing.T) {
+	path := writeConfig(t, `node_id: node1
+jwt:
+  jwks_file: /etc/kv/jwks.json
+  issuer: https://idp.example.com
+  audience: kv
+  leeway: 30s
+  claims:
+    - claim: scope
+      value: kv:write
+      permissions:
+        - prefix: "users/{sub}/"
+          access: write
+`)
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	if !config.JWT.Enabled() || config.JWT.Leeway != 30*time.Second || len(config.JWT.Claims) != 1 {
+		t.Fatalf("JWT config not parsed: %+v", config.JWT)
+	}
+	if p := config.JWT.Claims[0].Permissions; len(p) != 1 || p[0].Prefix != "users/{sub}/" || p[0].Access != "write" {
+		t.Errorf("Unexpected permissions %+v", p)
+	}
+
+	for _, bad := range []string{
+		"jwt:\n  claims:\n    - claim: scope\n      value: x\n",
+		"jwt:\n  jwks_file: k.json\n  claims:\n    - claim: scope\n      value: x\n      permissions:\n        - access: delete\n",
+		"jwt:\n  jwks_file: k.json\n  claims:\n    - claim: scope\n      value: x\n      permissions:\n        - ns: _users\n          access: read\n",
+	} {
+		if _, err := LoadConfig(writeConfig(t, "node_id: node1\n"+bad)); err == nil {
+			t.Errorf("LoadConfig() should reject %q", bad)
+		}
+	}
+}
+
+func TestLoadConfig_AuthScopes(t *testing.T) {
+	path := writeConfig(t, "node_id: node1\nauth:\n  read_tokens: [r1, r2]\n  write_tokens: [w1]\n  admin_tokens: [a1]\n")
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	scopes := config.Auth.Scopes()
+	if len(scopes) != 4 || scopes["r2"] != "read" || scopes["w1"] != "write" || scopes["a1"] != "admin" {
+		t.Errorf("Unexpected scopes %v", scopes)
+	}
+
+	path = writeConfig(t, "node_id: node1\ntls:\n  cert_file: c.pem\n  key_file: k.pem\n  client_identities: {ci-runner: ci}\n"+
+		"auth:\n  identity_scopes: {ci: write}\n")
+	if config, err = LoadConfig(path); err != nil {
+		t.Fatalf("LoadConfig() failed with identity scopes: %v", err)
+	}
+	if !config.Auth.Enabled() || config.Auth.IdentityScopes["ci"] != "write" {
+		t.Errorf("Unexpected auth config %+v", config.Auth)
+	}
+
+	for _, bad := range []string{
+		"auth:\n  read_tokens: [shared]\n  admin_tokens: [shared]\n",
+		"auth:\n  write_tokens: ['']\n",
+		"auth_token: legacy\nauth:\n  read_tokens: [r1]\n",
+		"auth_token: legacy\nrbac:\n  enabled: true\n  root_token: root\n",
+		"auth:\n  identity_scopes: {ci: all}\n",
+		"auth:\n  identity_scopes: {ci: read}\n", // not in tls.client_identities
+	} {
+		if _, err := LoadConfig(writeConfig(t, "node_id: node1\n"+bad)); err == nil {
+			t.Errorf("LoadConfig() should reject %q", bad)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JWTConfig accepts JWTs issued by an identity provider as bearer tokens. What a token
+// may do comes from its claims, through Claims.
+type JWTConfig struct {
+	// JWKSFile is a local JSON Web Key Set with the verification keys; empty disables JWTs.
+	// It is reloaded when it changes on disk, so keys can be rotated without a restart.
+	JWKSFile string         `yaml:"jwks_file"`
+	Issuer   string         `yaml:"issuer"`   // Required iss claim; empty accepts any issuer
+	Audience string         `yaml:"audience"` // Required entry of the aud claim; empty accepts any audience
+	Leeway   time.Duration  `yaml:"leeway"`   // Clock skew allowed when checking exp and nbf
+	Claims   []ClaimMapping `yaml:"claims"`   // Permissions granted by claim values
+}
+
+// ClaimMapping grants permissions to tokens whose claim has a value. List claims match
+// if they contain the value, and string claims such as scope if one of their
+// space-separated words is the value.
+type ClaimMapping struct {
+	Claim       string             `yaml:"claim"` // Claim name; dots reach nested claims, e.g. realm_access.roles
+	Value       string             `yaml:"value"`
+	Permissions []PermissionConfig `yaml:"permissions"`
+}
+
+// PermissionConfig grants access to keys starting with Prefix. The prefix may contain
+// {claim} placeholders, replaced by the token's string claims, e.g. users/{sub}/.
+type PermissionConfig struct {
+	Namespace string `yaml:"ns"`     // Empty for the default namespace, "*" for all of them
+	Prefix    string `yaml:"prefix"` // Empty for every key
+	Access    string `yaml:"access"` // "read", "write" or "admin"
+}
+
+// Enabled reports whether JWTs are accepted
+func (c JWTConfig) Enabled() bool {
+	return c.JWKSFile != ""
+}
+
+// Validate checks the claim mappings
+func (c JWTConfig) Validate() error {
+	if !c.Enabled() {
+		if len(c.Claims) > 0 {
+			return errors.New("jwt.claims requires jwt.jwks_file")
+		}
+		return nil
+	}
+	if c.Leeway < 0 {
+		return errors.New("jwt.leeway must not be negative")
+	}
+	for i, m := range c.Claims {
+		if m.Claim == "" || m.Value == "" {
+			return fmt.Errorf("jwt.claims[%d]: claim and value are required", i)
+		}
+		for _, p := range m.Permissions {
+			switch p.Access {
+			case "read", "write", "admin":
+			default:
+				return fmt.Errorf("jwt.claims[%d]: invalid access %q: use read, write or admin", i, p.Access)
+			}
+			if strings.HasPrefix(p.Namespace, "_") {
+				return fmt.Errorf("jwt.claims[%d]: namespace %q is reserved", i, p.Namespace)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package cluster
+
+import "fmt"
+
+// LimitsConfig caps what clients can write. Zero key and value sizes fall back to
+// DefaultLimits; zero key count and total bytes mean unlimited.
+type LimitsConfig struct {
+	MaxKeySize    int   `yaml:"max_key_size" json:"max_key_size,omitempty"`       // Longest key in bytes
+	MaxValueSize  int64 `yaml:"max_value_size" json:"max_value_size,omitempty"`   // Largest value in bytes
+	MaxKeys       int64 `yaml:"max_keys" json:"max_keys,omitempty"`               // Most keys the store may hold
+	MaxTotalBytes int64 `yaml:"max_total_bytes" json:"max_total_bytes,omitempty"` // Most bytes of keys and values the store may hold
+}
+
+// DefaultLimits returns the limits used when nothing is configured
+func DefaultLimits() LimitsConfig {
+	return LimitsConfig{
+		MaxKeySize:   4096,
+		MaxValueSize: 8 << 20,
+	}
+}
+
+// WithDefaults returns a copy with unset size limits filled from DefaultLimits
+func (l LimitsConfig) WithDefaults() LimitsConfig {
+	d := DefaultLimits()
+	if l.MaxKeySize == 0 {
+		l.MaxKeySize = d.MaxKeySize
+	}
+	if l.MaxValueSize == 0 {
+		l.MaxValueSize = d.MaxValueSize
+	}
+	return l
+}
+
+// Validate checks the limits are usable
+func (l LimitsConfig) Validate() error {
+	if l.MaxKeySize < 0 || l.MaxValueSize < 0 || l.MaxKeys < 0 || l.MaxTotalBytes < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package cluster
+
+import (
+	"fmt"
+	"time"
+)
+
+// RaftConfig holds Raft tuning parameters. Zero values fall back to the defaults
+// from DefaultRaftConfig, which favour fast failover on a local network.
+type RaftConfig struct {
+	HeartbeatTimeout   time.Duration `yaml:"heartbeat_timeout"`    // Follower wait without leader contact before an election
+	ElectionTimeout    time.Duration `yaml:"election_timeout"`     // Candidate wait before restarting an election
+	LeaderLeaseTimeout time.Duration `yaml:"leader_lease_timeout"` // Leader steps down if it can't reach a quorum for this long
+	CommitTimeout      time.Duration `yaml:"commit_timeout"`       // Max wait before heartbeating with no new entries
+	SnapshotThreshold  uint64        `yaml:"snapshot_threshold"`   // Outstanding log entries that trigger a snapshot
+	SnapshotInterval   time.Duration `yaml:"snapshot_interval"`    // How often to check whether a snapshot is needed
+	TrailingLogs       uint64        `yaml:"trailing_logs"`        // Log entries kept after a snapshot for slow followers
+	SnapshotRetain     int           `yaml:"snapshot_retain"`      // Number of snapshots kept on disk
+	MaxAppendEntries   int           `yaml:"max_append_entries"`   // Max entries per AppendEntries RPC (1-1024)
+	HashCheckInterval  time.Duration `yaml:"hash_check_interval"`  // How often the leader asks replicas to compare state hashes; negative disables
+}
+
+// DefaultRaftConfig returns the tuning used when nothing is configured
+func DefaultRaftConfig() RaftConfig {
+	return RaftConfig{
+		HeartbeatTimeout:   500 * time.Millisecond,
+		ElectionTimeout:    500 * time.Millisecond,
+		LeaderLeaseTimeout: 250 * time.Millisecond,
+		CommitTimeout:      50 * time.Millisecond,
+		SnapshotThreshold:  8192,
+		SnapshotInterval:   120 * time.Second,
+		TrailingLogs:       10240,
+		SnapshotRetain:     3,
+		MaxAppendEntries:   64,
+		HashCheckInterval:  time.Minute,
+	}
+}
+
+// WithDefaults returns a copy with every unset field filled from DefaultRaftConfig
+func (c RaftConfig) WithDefaults() RaftConfig {
+	d := DefaultRaftConfig()
+	if c.HeartbeatTimeout == 0 {
+		c.HeartbeatTimeout = d.HeartbeatTimeout
+	}
+	if c.ElectionTimeout == 0 {
+		c.ElectionTimeout = d.ElectionTimeout
+	}
+	if c.LeaderLeaseTimeout == 0 {
+		c.LeaderLeaseTimeout = d.LeaderLeaseTimeout
+	}
+	if c.CommitTimeout == 0 {
+		c.CommitTimeout = d.CommitTimeout
+	}
+	if c.SnapshotThreshold == 0 {
+		c.SnapshotThreshold = d.SnapshotThreshold
+	}
+	if c.SnapshotInterval == 0 {
+		c.SnapshotInterval = d.SnapshotInterval
+	}
+	if c.TrailingLogs == 0 {
+		c.TrailingLogs = d.TrailingLogs
+	}
+	if c.SnapshotRetain == 0 {
+		c.SnapshotRetain = d.SnapshotRetain
+	}
+	if c.MaxAppendEntries == 0 {
+		c.MaxAppendEntries = d.MaxAppendEntries
+	}
+	if c.HashCheckInterval == 0 {
+		c.HashCheckInterval = d.HashCheckInterval
+	}
+	return c
+}
+
+// Validate checks that the tuning is internally consistent.
+// It should be called on a config that already has defaults applied.
+func (c RaftConfig) Validate() error {
+	if c.HeartbeatTimeout < 5*time.Millisecond {
+		return fmt.Errorf("raft.heartbeat_timeout must be at least 5ms, got %s", c.HeartbeatTimeout)
+	}
+	if c.ElectionTimeout < c.HeartbeatTimeout {
+		return fmt.Errorf("raft.election_timeout (%s) must be >= raft.heartbeat_timeout (%s)", c.ElectionTimeout, c.HeartbeatTimeout)
+	}
+	if c.LeaderLeaseTimeout < 5*time.Millisecond {
+		return fmt.Errorf("raft.leader_lease_timeout must be at least 5ms, got %s", c.LeaderLeaseTimeout)
+	}
+	if c.LeaderLeaseTimeout >= c.HeartbeatTimeout {
+		return fmt.Errorf("raft.leader_lease_timeout (%s) must be < raft.heartbeat_timeout (%s)", c.LeaderLeaseTimeout, c.HeartbeatTimeout)
+	}
+	if c.CommitTimeout < time.Millisecond {
+		return fmt.Errorf("raft.commit_timeout must be at least 1ms, got %s", c.CommitTimeout)
+	}
+	if c.SnapshotInterval < 5*time.Millisecond {
+		return fmt.Errorf("raft.snapshot_interval must be at least 5ms, got %s", c.SnapshotInterval)
+	}
+	if c.SnapshotRetain < 1 {
+		return fmt.Errorf("raft.snapshot_retain must be at least 1, got %d", c.SnapshotRetain)
+	}
+	if c.MaxAppendEntries < 1 || c.MaxAppendEntries > 1024 {
+		return fmt.Errorf("raft.max_append_entries must be between 1 and 1024, got %d", c.MaxAppendEntries)
+	}
+	if c.HashCheckInterval > 0 && c.HashCheckInterval < 10*time.Millisecond {
+		return fmt.Errorf("raft.hash_check_interval must be at least 10ms or negative to disable, got %s", c.HashCheckInterval)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package cluster
+
+import "errors"
+
+// RBACConfig enables role-based access control. Users, roles and their permissions are
+// replicated through Raft and managed through the admin API; the root token is the
+// bootstrap credential used to create them.
+type RBACConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// RootToken authenticates the root user, which may do anything. It is not replicated,
+	// so every node needs it in its own config.
+	RootToken string `yaml:"root_token"`
+}
+
+// Validate checks that an enabled RBAC has a root token
+func (c RBACConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.RootToken == "" {
+		return errors.New("rbac.root_token is required when rbac is enabled")
+	}
+	return nil
+}
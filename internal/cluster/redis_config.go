@@ -0,0 +1,81 @@
+package cluster
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// Defaults for the RESP listener
+const (
+	DefaultRedisIdleTimeout = 5 * time.Minute
+	DefaultRedisMaxClients  = 10000
+)
+
+// RedisConfig enables the RESP (Redis protocol) listener
+type RedisConfig struct {
+	// ListenAddr is the TCP address for RESP clients; empty disables the listener
+	ListenAddr string `yaml:"listen_addr"`
+	// AdvertiseAddr is the host:port clients use to reach this node's listener. Followers
+	// redirect writes to the leader's advertised address with MOVED. Defaults to
+	// ListenAddr unless that listens on all interfaces.
+	AdvertiseAddr string `yaml:"advertise_addr"`
+	// IdleTimeout closes connections that send nothing for this long (default 5m)
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// MaxClients caps open connections; further ones are refused (default 10000)
+	MaxClients int `yaml:"max_clients"`
+}
+
+// Enabled reports whether the RESP listener should be started
+func (c RedisConfig) Enabled() bool {
+	return c.ListenAddr != ""
+}
+
+// WithDefaults fills in the idle timeout and client cap
+func (c RedisConfig) WithDefaults() RedisConfig {
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = DefaultRedisIdleTimeout
+	}
+	if c.MaxClients == 0 {
+		c.MaxClients = DefaultRedisMaxClients
+	}
+	return c
+}
+
+// Advertised returns the address other nodes send clients to, or "" if it isn't known
+func (c RedisConfig) Advertised() string {
+	if c.AdvertiseAddr != "" {
+		return c.AdvertiseAddr
+	}
+	host, _, err := net.SplitHostPort(c.ListenAddr)
+	if err != nil || host == "" || net.ParseIP(host).IsUnspecified() {
+		return ""
+	}
+	return c.ListenAddr
+}
+
+// Validate checks the listener and advertised addresses
+func (c RedisConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		return fmt.Errorf("redis.listen_addr must be host:port: %w", err)
+	}
+	if c.AdvertiseAddr != "" {
+		host, _, err := net.SplitHostPort(c.AdvertiseAddr)
+		if err != nil {
+			return fmt.Errorf("redis.advertise_addr must be host:port: %w", err)
+		}
+		if host == "" || net.ParseIP(host).IsUnspecified() {
+			return fmt.Errorf("redis.advertise_addr must name a reachable host, got %q", c.AdvertiseAddr)
+		}
+	}
+	if c.IdleTimeout < 0 {
+		return fmt.Errorf("redis.idle_timeout must not be negative")
+	}
+	if c.MaxClients < 0 {
+		return fmt.Errorf("redis.max_clients must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package cluster
+
+import "fmt"
+
+// StorageConfig selects where node state is kept
+type StorageConfig struct {
+	// Engine holds the FSM state: "memory" (default) or "bolt" to keep keys on disk
+	Engine string `yaml:"engine"`
+	// LogStore holds the Raft log: "bolt" (default, raft.db) or "wal" for the segmented log
+	LogStore string `yaml:"log_store"`
+	// WALSegmentSize is the size in bytes at which WAL segments are rotated
+	WALSegmentSize int64 `yaml:"wal_segment_size"`
+	// CompressionThreshold is the value size in bytes from which values are compressed;
+	// 0 uses the default and -1 disables compression
+	CompressionThreshold int `yaml:"compression_threshold"`
+	// BoltMmapSize is the memory map reserved for the bolt engine's file in bytes; 0 uses
+	// the default of 1 GiB. Writes that grow the file past it wait for open snapshots.
+	BoltMmapSize int `yaml:"bolt_mmap_size"`
+}
+
+// Validate checks the storage settings
+func (s StorageConfig) Validate() error {
+	switch s.Engine {
+	case "", "memory", "bolt":
+	default:
+		return fmt.Errorf("storage.engine must be \"memory\" or \"bolt\", got %q", s.Engine)
+	}
+	switch s.LogStore {
+	case "", "bolt", "wal":
+	default:
+		return fmt.Errorf("storage.log_store must be \"bolt\" or \"wal\", got %q", s.LogStore)
+	}
+	if s.WALSegmentSize < 0 {
+		return fmt.Errorf("storage.wal_segment_size must not be negative")
+	}
+	if s.BoltMmapSize < 0 {
+		return fmt.Errorf("storage.bolt_mmap_size must not be negative")
+	}
+	if s.CompressionThreshold < -1 {
+		return fmt.Errorf("storage.compression_threshold must be -1 (disabled) or more")
+	}
+	return nil
+}
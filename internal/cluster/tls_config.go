@@ -0,0 +1,102 @@
+package cluster
+
+import "fmt"
+
+// TLS verification modes
+const (
+	// TLSVerifyFull verifies the peer's chain against the CA and its name against the dialed address
+	TLSVerifyFull = "full"
+	// TLSVerifyCA only verifies the peer's chain against the CA (for addresses not listed in certificates)
+	TLSVerifyCA = "ca"
+)
+
+// TLSConfig holds certificate settings for a TLS listener and its clients
+type TLSConfig struct {
+	CAFile     string `yaml:"ca_file"`   // PEM bundle used to verify peers
+	CertFile   string `yaml:"cert_file"` // PEM certificate presented by this node
+	KeyFile    string `yaml:"key_file"`  // PEM private key for cert_file
+	VerifyMode string `yaml:"verify"`    // "full" (default) or "ca"
+}
+
+// Enabled reports whether TLS has been configured
+func (t TLSConfig) Enabled() bool {
+	return t.CAFile != "" || t.CertFile != "" || t.KeyFile != ""
+}
+
+// Verify returns the verification mode, defaulting to full verification
+func (t TLSConfig) Verify() string {
+	if t.VerifyMode == "" {
+		return TLSVerifyFull
+	}
+	return t.VerifyMode
+}
+
+// Validate checks that an enabled TLS config is complete.
+// The name is used to prefix errors with the YAML section.
+func (t TLSConfig) Validate(name string) error {
+	if !t.Enabled() {
+		return nil
+	}
+	if t.CAFile == "" || t.CertFile == "" || t.KeyFile == "" {
+		return fmt.Errorf("%s requires ca_file, cert_file and key_file", name)
+	}
+	switch t.Verify() {
+	case TLSVerifyFull, TLSVerifyCA:
+	default:
+		return fmt.Errorf("%s.verify must be %q or %q, got %q", name, TLSVerifyFull, TLSVerifyCA, t.VerifyMode)
+	}
+	return nil
+}
+
+// Client certificate modes for the HTTP API
+const (
+	ClientAuthNone    = "none"    // client certificates are not requested
+	ClientAuthRequest = "request" // verified if presented, bearer tokens still accepted
+	ClientAuthRequire = "require" // every connection must present a valid client certificate
+)
+
+// HTTPTLSConfig configures HTTPS for the client API
+type HTTPTLSConfig struct {
+	CertFile     string `yaml:"cert_file"`      // PEM server certificate (reloaded when it changes on disk)
+	KeyFile      string `yaml:"key_file"`       // PEM private key for cert_file
+	ClientCAFile string `yaml:"client_ca_file"` // PEM bundle used to verify client certificates
+	ClientAuth   string `yaml:"client_auth"`    // "none" (default), "request" or "require"
+	// ClientIdentities maps a client certificate's subject CN or SAN to an identity the auth layer accepts
+	ClientIdentities map[string]string `yaml:"client_identities"`
+}
+
+// Enabled reports whether HTTPS has been configured
+func (t HTTPTLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// ClientAuthMode returns the client certificate mode, defaulting to none
+func (t HTTPTLSConfig) ClientAuthMode() string {
+	if t.ClientAuth == "" {
+		return ClientAuthNone
+	}
+	return t.ClientAuth
+}
+
+// Validate checks that an enabled HTTPS config is complete
+func (t HTTPTLSConfig) Validate() error {
+	if !t.Enabled() {
+		if t.ClientCAFile != "" || len(t.ClientIdentities) > 0 {
+			return fmt.Errorf("tls client certificate settings require cert_file and key_file")
+		}
+		return nil
+	}
+	if t.CertFile == "" || t.KeyFile == "" {
+		return fmt.Errorf("tls requires both cert_file and key_file")
+	}
+	switch t.ClientAuthMode() {
+	case ClientAuthNone:
+	case ClientAuthRequest, ClientAuthRequire:
+		if t.ClientCAFile == "" {
+			return fmt.Errorf("tls.client_auth %q requires client_ca_file", t.ClientAuth)
+		}
+	default:
+		return fmt.Errorf("tls.client_auth must be %q, %q or %q, got %q", ClientAuthNone, ClientAuthRequest, ClientAuthRequire, t.ClientAuth)
+	}
+	return nil
+}
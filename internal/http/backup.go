@@ -0,0 +1,74 @@
+package http
+
+import (
+	"distributed_cloud_service/internal/raft"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// RestoreResponse is returned by POST /admin/restore
+type RestoreResponse struct {
+	Backup raft.BackupInfo `json:"backup"`
+	Keys   int             `json:"keys"`
+	Bytes  int64           `json:"bytes"`
+}
+
+// HandleBackup handles GET /admin/backup by streaming a consistent snapshot from the leader.
+// The first line of the body carries the backup metadata, which is repeated in X-Backup-* headers.
+func (s *Server) HandleBackup(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !s.requireLeader(w) {
+		return
+	}
+
+	info, view, err := s.raft.Backup()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, err.Error())
+		return
+	}
+	defer view.Release()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"backup-%d.snap\"", info.Index))
+	w.Header().Set("X-Backup-Index", strconv.FormatUint(info.Index, 10))
+	w.Header().Set("X-Backup-Term", strconv.FormatUint(info.Term, 10))
+	w.Header().Set("X-Backup-Node", info.NodeID)
+	w.WriteHeader(http.StatusOK)
+
+	// The status is already sent; a failure here truncates the body, which restore rejects
+	raft.WriteBackup(w, info, view)
+}
+
+// HandleRestore handles POST /admin/restore, replacing the state of the whole cluster
+// with a backup taken by GET /admin/backup
+func (s *Server) HandleRestore(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !s.requireLeader(w) {
+		return
+	}
+
+	info, err := s.raft.Restore(r.Body)
+	if err != nil {
+		if errors.Is(err, raft.ErrInvalidBackup) {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, CodeInternal, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, RestoreResponse{Backup: info, Keys: s.store.Len(), Bytes: s.store.Bytes()})
+}
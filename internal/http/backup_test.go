@@ -0,0 +1,77 @@
+package http
+
+import (
+	"bytes"
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleBackupRestore(t *testing.T) {
+	sourceStore := store.NewStore()
+	sourceStore.PutAt(1, "key1", []byte("value1"))
+	sourceStore.PutAt(2, "key2", []byte("value2"))
+	source := NewServer(sourceStore, &mockRaftNode{isLeader: true, store: sourceStore})
+
+	req := httptest.NewRequest("GET", "/admin/backup", nil)
+	w := httptest.NewRecorder()
+	source.HandleBackup(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Header().Get("X-Backup-Index") != "2" {
+		t.Errorf("Expected X-Backup-Index 2, got %q", w.Header().Get("X-Backup-Index"))
+	}
+	backup := w.Body.Bytes()
+
+	targetStore := store.NewStore()
+	targetStore.Put("stale", []byte("x"))
+	target := NewServer(targetStore, &mockRaftNode{isLeader: true, store: targetStore})
+
+	req = httptest.NewRequest("POST", "/admin/restore", bytes.NewReader(backup))
+	w = httptest.NewRecorder()
+	target.HandleRestore(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var resp RestoreResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Keys != 2 || resp.Backup.Index != 2 {
+		t.Errorf("Expected 2 keys at index 2, got %+v", resp)
+	}
+	if val, ok := targetStore.Get("key2"); !ok || string(val) != "value2" {
+		t.Errorf("Expected key2 to be restored, got %q", val)
+	}
+
+	// Invalid backups are rejected
+	req = httptest.NewRequest("POST", "/admin/restore", strings.NewReader("not a backup"))
+	w = httptest.NewRecorder()
+	target.HandleRestore(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandleBackup_NotLeader(t *testing.T) {
+	kvStore := store.NewStore()
+	server := NewServer(kvStore, &mockRaftNode{isLeader: false, leader: "node1:9011", store: kvStore})
+
+	for _, tc := range []struct {
+		method  string
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"GET", "/admin/backup", server.HandleBackup},
+		{"POST", "/admin/restore", server.HandleRestore},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		w := httptest.NewRecorder()
+		tc.handler(w, req)
+		if w.Code != http.StatusBadRequest || w.Header().Get("X-Leader") != "node1:9011" {
+			t.Errorf("%s: expected status %d with X-Leader, got %d", tc.path, http.StatusBadRequest, w.Code)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"distributed_cloud_service/internal/cluster"
+	"distributed_cloud_service/internal/raft"
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultImportBatch is the number of records proposed per Raft entry during an import
+	defaultImportBatch = 500
+
+	// maxImportBatch caps the batch query parameter
+	maxImportBatch = 10000
+
+	// importBatchBytes ends a batch early so a Raft entry stays small enough to replicate quickly
+	importBatchBytes = 4 << 20
+)
+
+// BulkRecord is one line of an export or import. Indexes and timestamps are not
+// carried over; imported keys get those of the import.
+type BulkRecord struct {
+	Namespace   string            `json:"ns,omitempty"` // Empty for the default namespace
+	Key         string            `json:"key"`
+	Value       []byte            `json:"value"` // base64 in JSON
+	ContentType string            `json:"content_type,omitempty"`
+	Meta        map[string]string `json:"meta,omitempty"`      // Custom metadata (X-Meta-* headers)
+	ExpireAt    int64             `json:"expire_at,omitempty"` // Unix milliseconds; 0 if the key doesn't expire
+}
+
+// ImportProgress is streamed as a JSON line after every batch of an import
+type ImportProgress struct {
+	Offset   int64  `json:"offset"`   // records of the input handled so far; resume from here
+	Imported int64  `json:"imported"` // records written (or validated in a dry run) by this request
+	DryRun   bool   `json:"dry_run,omitempty"`
+	Done     bool   `json:"done,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HandleExport handles GET /admin/export, streaming every key as JSON Lines.
+// ?ns= limits the export to one namespace. The namespace registry and expired keys are not exported.
+func (s *Server) HandleExport(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	ns, filtered := query.Get("ns"), query.Has("ns")
+	if filtered && ns != store.DefaultNamespace {
+		if _, ok := s.store.Namespace(ns); !ok {
+			writeError(w, http.StatusNotFound, CodeNamespaceNotFound, "Namespace not found")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	if err := s.raft.VerifyRead(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, CodeReadUnavailable, "Failed to verify read: "+err.Error())
+		return
+	}
+
+	view, err := s.store.Snapshot()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, err.Error())
+		return
+	}
+	defer view.Release()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Export-Index", strconv.FormatUint(view.AppliedIndex(), 10))
+	w.WriteHeader(http.StatusOK)
+
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+	now := time.Now()
+	err = view.ForEach(func(recNS, key string, encoded []byte) error {
+		if store.IsSystemNamespace(recNS) || (filtered && recNS != ns) || store.Expired(encoded, now) {
+			return nil
+		}
+		val, err := store.DecodeValue(encoded)
+		if err != nil {
+			return err
+		}
+		meta, err := store.ValueMeta(encoded)
+		if err != nil {
+			return err
+		}
+		return enc.Encode(BulkRecord{
+			Namespace:   recNS,
+			Key:         key,
+			Value:       val,
+			ContentType: meta.ContentType,
+			Meta:        meta.Headers,
+			ExpireAt:    store.ValueExpiry(encoded),
+		})
+	})
+	if err != nil {
+		// The status is already sent, so abort the response: the client then sees a broken
+		// transfer rather than an export that looks complete
+		panic(http.ErrAbortHandler)
+	}
+	buf.Flush()
+}
+
+// HandleImport handles POST /admin/import with a JSON Lines body of BulkRecords.
+// Records are proposed in batches (?batch=, default 500), each applied atomically,
+// and progress is streamed back after every batch. ?offset= skips records already
+// imported by an interrupted request; ?dry_run=true only validates the input.
+func (s *Server) HandleImport(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	dryRun := query.Get("dry_run") == "true"
+	batchSize := defaultImportBatch
+	if v := query.Get("batch"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxImportBatch {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("batch must be between 1 and %d", maxImportBatch))
+			return
+		}
+		batchSize = n
+	}
+	var offset int64
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid offset")
+			return
+		}
+		offset = n
+	}
+
+	if !dryRun && !s.requireLeader(w) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	progress := ImportProgress{Offset: offset, DryRun: dryRun}
+	report := func() {
+		enc.Encode(progress)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	imp := &importer{server: s, dryRun: dryRun, nsLimits: make(map[string]cluster.LimitsConfig)}
+	if dryRun {
+		imp.pending = make(map[string]store.Usage)
+	}
+	dec := json.NewDecoder(r.Body)
+	var line int64
+	for {
+		var rec BulkRecord
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line++
+		if err != nil {
+			// The decoder can't resynchronize after a syntax error, so stop here
+			progress.Error = fmt.Sprintf("record %d: %v", line, err)
+			report()
+			return
+		}
+		if line <= offset {
+			continue
+		}
+		if err := imp.add(rec); err != nil {
+			progress.Error = fmt.Sprintf("record %d: %v", line, err)
+			report()
+			return
+		}
+		if len(imp.batch) < batchSize && imp.size < importBatchBytes {
+			continue
+		}
+		n := int64(len(imp.batch))
+		if err := imp.flush(); err != nil {
+			progress.Error = fmt.Sprintf("records %d-%d: %v", line-n+1, line, err)
+			report()
+			return
+		}
+		progress.Offset = line
+		progress.Imported += n
+		report()
+	}
+
+	n := int64(len(imp.batch))
+	if err := imp.flush(); err != nil {
+		progress.Error = fmt.Sprintf("records %d-%d: %v", line-n+1, line, err)
+		report()
+		return
+	}
+	if line > progress.Offset {
+		progress.Offset = line
+	}
+	progress.Imported += n
+	progress.Done = true
+	report()
+}
+
+// importer validates import records and proposes them as batch commands
+type importer struct {
+	server   *Server
+	dryRun   bool
+	nsLimits map[string]cluster.LimitsConfig // namespaces seen so far and their limits
+	pending  map[string]store.Usage          // usage of the batches a dry run checked but didn't apply
+	batch    []raft.KVCommand
+	size     int
+}
+
+// add validates a record and queues it for the next batch
+func (imp *importer) add(rec BulkRecord) error {
+	if rec.Key == "" {
+		return errors.New("key is required")
+	}
+	if rec.ExpireAt < 0 {
+		return errors.New("expire_at must not be negative")
+	}
+	if store.IsSystemNamespace(rec.Namespace) {
+		return fmt.Errorf("namespace %q is reserved", rec.Namespace)
+	}
+	limits, ok := imp.nsLimits[rec.Namespace]
+	if !ok {
+		if rec.Namespace != store.DefaultNamespace {
+			ns, exists := imp.server.store.Namespace(rec.Namespace)
+			if !exists {
+				return fmt.Errorf("namespace %q: %w", rec.Namespace, store.ErrNamespaceNotFound)
+			}
+			limits = ns.Limits
+		}
+		imp.nsLimits[rec.Namespace] = limits
+	}
+	if err := store.CheckSize(imp.server.limits, rec.Key, int64(len(rec.Value))); err != nil {
+		countQuotaRejection(err)
+		return err
+	}
+	if err := store.CheckSize(limits, rec.Key, int64(len(rec.Value))); err != nil {
+		countQuotaRejection(err)
+		return fmt.Errorf("namespace %q: %w", rec.Namespace, err)
+	}
+
+	if err := store.CheckMeta(store.Meta{ContentType: rec.ContentType, Headers: rec.Meta}); err != nil {
+		countQuotaRejection(err)
+		return err
+	}
+
+	imp.batch = append(imp.batch, raft.KVCommand{
+		Op:          "put",
+		Namespace:   rec.Namespace,
+		Key:         rec.Key,
+		Value:       rec.Value,
+		ContentType: rec.ContentType,
+		Meta:        rec.Meta,
+		ExpireAt:    rec.ExpireAt,
+	})
+	imp.size += len(rec.Key) + len(rec.Value)
+	return nil
+}
+
+// flush checks the queued records against the quotas and, unless this is a dry run, proposes them
+func (imp *importer) flush() error {
+	if len(imp.batch) == 0 {
+		return nil
+	}
+	mutations := make([]store.Mutation, len(imp.batch))
+	for i, cmd := range imp.batch {
+		mutations[i] = store.Mutation{Namespace: cmd.Namespace, Key: cmd.Key, Value: store.EncodeValue(cmd.Value, 0)}
+	}
+	if err := imp.server.store.CheckBatchAfter(imp.server.limits, imp.nsLimits, imp.pending, mutations); err != nil {
+		countQuotaRejection(err)
+		return err
+	}
+	if !imp.dryRun {
+		if err := imp.server.raft.Apply(raft.KVCommand{Op: "batch", Batch: imp.batch}); err != nil {
+			return err
+		}
+	}
+	imp.batch = nil
+	imp.size = 0
+	return nil
+}
@@ -0,0 +1,218 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"distributed_cloud_service/internal/cluster"
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func importRequest(server *Server, query, body string) []ImportProgress {
+	req := httptest.NewRequest("POST", "/admin/import"+query, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.HandleImport(w, req)
+
+	var progress []ImportProgress
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var p ImportProgress
+		json.Unmarshal(scanner.Bytes(), &p)
+		progress = append(progress, p)
+	}
+	return progress
+}
+
+func TestHandleExportImport(t *testing.T) {
+	sourceStore := store.NewStore()
+	source := NewServer(sourceStore, &mockRaftNode{isLeader: true, store: sourceStore})
+	createTestNamespace(t, source, `{"name":"team-a"}`)
+	sourceStore.Put("key1", []byte("value1"))
+	sourceStore.Put("key2", []byte{0, 1, 2})
+	sourceStore.PutIn(0, "team-a", "key1", []byte("tenant"))
+
+	req := httptest.NewRequest("GET", "/admin/export", nil)
+	w := httptest.NewRecorder()
+	source.HandleExport(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	export := w.Body.String()
+	if lines := strings.Count(export, "\n"); lines != 3 {
+		t.Errorf("Expected 3 records without the namespace registry, got %d:\n%s", lines, export)
+	}
+
+	targetStore := store.NewStore()
+	target := NewServer(targetStore, &mockRaftNode{isLeader: true, store: targetStore})
+	createTestNamespace(t, target, `{"name":"team-a"}`)
+
+	progress := importRequest(target, "?batch=2", export)
+	if len(progress) != 2 {
+		t.Fatalf("Expected progress after each of 2 batches, got %+v", progress)
+	}
+	last := progress[len(progress)-1]
+	if !last.Done || last.Offset != 3 || last.Imported != 3 || last.Error != "" {
+		t.Errorf("Expected 3 records imported, got %+v", last)
+	}
+	if val, ok := targetStore.Get("key2"); !ok || !bytes.Equal(val, []byte{0, 1, 2}) {
+		t.Errorf("Expected binary value to round-trip, got %v", val)
+	}
+	if val, ok := targetStore.GetIn("team-a", "key1"); !ok || string(val) != "tenant" {
+		t.Errorf("Expected namespaced key to be imported, got %q", val)
+	}
+
+	// Only one namespace
+	req = httptest.NewRequest("GET", "/admin/export?ns=team-a", nil)
+	w = httptest.NewRecorder()
+	source.HandleExport(w, req)
+	if lines := strings.Count(w.Body.String(), "\n"); lines != 1 {
+		t.Errorf("Expected 1 record for team-a, got %d", lines)
+	}
+}
+
+func TestHandleImport_ResumeAndDryRun(t *testing.T) {
+	kvStore := store.NewStore()
+	server := NewServer(kvStore, &mockRaftNode{isLeader: true, store: kvStore})
+
+	input := `{"key":"k1","value":"MQ=="}
+{"key":"k2","value":"Mg=="}
+{"key":"","value":"Mw=="}
+{"key":"k4","value":"NA=="}
+`
+	// A dry run validates without writing and reports the first bad record
+	progress := importRequest(server, "?dry_run=true", input)
+	last := progress[len(progress)-1]
+	if !last.DryRun || last.Done || !strings.Contains(last.Error, "record 3") || kvStore.Len() != 0 {
+		t.Errorf("Expected dry run to stop at record 3 without writing, got %+v and %d keys", last, kvStore.Len())
+	}
+
+	progress = importRequest(server, "?batch=1", input)
+	last = progress[len(progress)-1]
+	if last.Offset != 2 || last.Error == "" || kvStore.Len() != 2 {
+		t.Errorf("Expected import to stop after 2 records, got %+v and %d keys", last, kvStore.Len())
+	}
+
+	// Resume past the bad record
+	progress = importRequest(server, "?offset=3", input)
+	last = progress[len(progress)-1]
+	if !last.Done || last.Offset != 4 || last.Imported != 1 || kvStore.Len() != 3 {
+		t.Errorf("Expected resumed import to add k4, got %+v and %d keys", last, kvStore.Len())
+	}
+}
+
+func TestHandleImport_Quota(t *testing.T) {
+	kvStore := store.NewStore()
+	server := NewServer(kvStore, &mockRaftNode{isLeader: true, store: kvStore})
+	server.SetLimits(cluster.LimitsConfig{MaxKeys: 2})
+
+	input := `{"key":"k1","value":"MQ=="}
+{"key":"k2","value":"Mg=="}
+{"key":"k3","value":"Mw=="}
+`
+	progress := importRequest(server, "", input)
+	last := progress[len(progress)-1]
+	if last.Offset != 0 || !strings.Contains(last.Error, "key quota exceeded") {
+		t.Errorf("Expected the batch to be rejected, got %+v", last)
+	}
+	if kvStore.Len() != 0 {
+		t.Errorf("Expected nothing to be imported, got %d keys", kvStore.Len())
+	}
+
+	// A dry run counts the batches it checked before, like the real import would
+	progress = importRequest(server, "?dry_run=true&batch=1", input)
+	last = progress[len(progress)-1]
+	if last.Done || last.Offset != 2 || !strings.Contains(last.Error, "key quota exceeded") {
+		t.Errorf("Expected the dry run to stop at the third key, got %+v", last)
+	}
+}
+
+func TestHandleExportImport_Meta(t *testing.T) {
+	sourceStore := store.NewStore()
+	source := NewServer(sourceStore, &mockRaftNode{isLeader: true, store: sourceStore})
+	req := httptest.NewRequest("PUT", "/kv/doc", strings.NewReader(`{"a":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Meta-Owner", "ops")
+	source.HandlePut(httptest.NewRecorder(), req)
+
+	w := httptest.NewRecorder()
+	source.HandleExport(w, httptest.NewRequest("GET", "/admin/export", nil))
+	var rec BulkRecord
+	if err := json.Unmarshal(w.Body.Bytes(), &rec); err != nil {
+		t.Fatalf("Failed to decode export %q: %v", w.Body.String(), err)
+	}
+	if rec.ContentType != "application/json" || rec.Meta["Owner"] != "ops" {
+		t.Errorf("Expected metadata in the export, got %+v", rec)
+	}
+
+	targetStore := store.NewStore()
+	target := NewServer(targetStore, &mockRaftNode{isLeader: true, store: targetStore})
+	if progress := importRequest(target, "", w.Body.String()); !progress[len(progress)-1].Done {
+		t.Fatalf("Import failed: %+v", progress)
+	}
+	meta, ok := targetStore.MetaIn(store.DefaultNamespace, "doc")
+	if !ok || meta.ContentType != "application/json" || meta.Headers["Owner"] != "ops" || meta.Version != 1 {
+		t.Errorf("Expected metadata to be imported, got %+v", meta)
+	}
+
+	tooLarge := `{"key":"big","value":"","meta":{"Notes":"` + strings.Repeat("x", store.MaxMetaSize) + `"}}`
+	if progress := importRequest(target, "", tooLarge); progress[0].Error == "" {
+		t.Error("Expected oversized metadata to be rejected")
+	}
+}
+
+func TestHandleExportImport_Expiry(t *testing.T) {
+	sourceStore := store.NewStore()
+	source := NewServer(sourceStore, &mockRaftNode{isLeader: true, store: sourceStore})
+	expireAt := time.Now().Add(time.Hour).UnixMilli()
+	live, _ := store.WithExpiry(store.EncodeValue([]byte("v"), 0), expireAt)
+	expired, _ := store.WithExpiry(store.EncodeValue([]byte("v"), 0), time.Now().Add(-time.Second).UnixMilli())
+	sourceStore.PutEncodedIn(1, store.DefaultNamespace, "live", live)
+	sourceStore.PutEncodedIn(2, store.DefaultNamespace, "expired", expired)
+
+	w := httptest.NewRecorder()
+	source.HandleExport(w, httptest.NewRequest("GET", "/admin/export", nil))
+	var rec BulkRecord
+	if err := json.Unmarshal(w.Body.Bytes(), &rec); err != nil {
+		t.Fatalf("Expected only the live key in the export, got %q: %v", w.Body.String(), err)
+	}
+	if rec.Key != "live" || rec.ExpireAt != expireAt {
+		t.Errorf("Expected the live key to carry expire_at %d, got %+v", expireAt, rec)
+	}
+
+	targetStore := store.NewStore()
+	target := NewServer(targetStore, &mockRaftNode{isLeader: true, store: targetStore})
+	if progress := importRequest(target, "", w.Body.String()); !progress[len(progress)-1].Done {
+		t.Fatalf("Import failed: %+v", progress)
+	}
+	if at, ok := targetStore.ExpiryIn(store.DefaultNamespace, "live"); !ok || at.UnixMilli() != expireAt {
+		t.Errorf("Expected the imported key to expire at %d, got %v", expireAt, at)
+	}
+}
+
+func TestHandleExport_AbortsOnError(t *testing.T) {
+	kvStore := store.NewStore()
+	server := NewServer(kvStore, &mockRaftNode{isLeader: true, store: kvStore})
+	kvStore.Put("key", []byte("v"))
+	// A compressed value whose payload doesn't inflate passes validation but fails mid-export
+	if err := kvStore.PutEncodedIn(1, store.DefaultNamespace, "key-corrupt", []byte{1, 5, 0xff, 0xff}); err != nil {
+		t.Fatalf("PutEncodedIn() failed: %v", err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(server.HandleExport))
+	defer ts.Close()
+	// The status may or may not have reached the client before the abort
+	resp, err := http.Get(ts.URL)
+	if err == nil {
+		_, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if err == nil {
+		t.Error("Expected a failed export to end in a broken transfer, not a complete body")
+	}
+}
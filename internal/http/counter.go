@@ -0,0 +1,90 @@
+package http
+
+import (
+	"distributed_cloud_service/internal/auth"
+	"distributed_cloud_service/internal/raft"
+	"distributed_cloud_service/internal/store"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CounterResponse is the value of a counter after an increment or decrement
+type CounterResponse struct {
+	Value int64 `json:"value"`
+}
+
+// HandleCounter handles POST /kv/{key}/incr and POST /kv/{key}/decr requests
+func (s *Server) HandleCounter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	key, op, ok := counterOp(r.URL.Path[len("/kv/"):])
+	if !ok {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Not found")
+		return
+	}
+	s.countKey(w, r, store.DefaultNamespace, key, op)
+}
+
+// counterOp splits "{key}/incr" or "{key}/decr" into the key and the FSM op
+func counterOp(path string) (key, op string, ok bool) {
+	if key, ok = strings.CutSuffix(path, "/incr"); ok {
+		return key, "incr", true
+	}
+	if key, ok = strings.CutSuffix(path, "/decr"); ok {
+		return key, "decr", true
+	}
+	return "", "", false
+}
+
+// countKey adds ?delta= (default 1) to the integer under key in namespace ns, or
+// subtracts it for "decr", and returns the new value. A missing key counts as 0.
+func (s *Server) countKey(w http.ResponseWriter, r *http.Request, ns, key, op string) {
+	if !s.authorize(w, r, ns, auth.AccessWrite, key) {
+		return
+	}
+	if !s.requireLeader(w) {
+		return
+	}
+
+	if key == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Key is required")
+		return
+	}
+
+	delta := int64(1)
+	if v := r.URL.Query().Get("delta"); v != "" {
+		var err error
+		if delta, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid delta: must be a 64-bit integer")
+			return
+		}
+	}
+
+	cmd := raft.KVCommand{
+		Op:        op,
+		Namespace: ns,
+		Key:       key,
+		Delta:     delta,
+	}
+
+	resp, err := s.raft.Propose(cmd)
+	if err != nil {
+		switch {
+		case writeQuotaError(w, err):
+		case errors.Is(err, raft.ErrNotInteger):
+			writeError(w, http.StatusConflict, CodeNotInteger, "Value is not an integer")
+		case errors.Is(err, raft.ErrOverflow):
+			writeError(w, http.StatusConflict, CodeOverflow, err.Error())
+		default:
+			writeApplyError(w, err)
+		}
+		return
+	}
+
+	value, _ := resp.(int64)
+	writeJSON(w, http.StatusOK, CounterResponse{Value: value})
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleCounter(t *testing.T) {
+	kvStore := store.NewStore()
+	kvStore.Put("text", []byte("abc"))
+	kvStore.Put("max", []byte("9223372036854775807"))
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	count := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.HandleCounter(w, httptest.NewRequest("POST", target, nil))
+		return w
+	}
+
+	steps := []struct {
+		target string
+		want   int64
+	}{
+		{"/kv/hits/incr", 1},
+		{"/kv/hits/incr?delta=10", 11},
+		{"/kv/hits/decr?delta=4", 7},
+		{"/kv/hits/incr?delta=-8", -1},
+	}
+	for _, step := range steps {
+		w := count(step.target)
+		if w.Code != http.StatusOK {
+			t.Fatalf("POST %s: expected status %d, got %d: %s", step.target, http.StatusOK, w.Code, w.Body.String())
+		}
+		var resp CounterResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		if resp.Value != step.want {
+			t.Errorf("POST %s: expected %d, got %d", step.target, step.want, resp.Value)
+		}
+	}
+	if val, _ := kvStore.Get("hits"); string(val) != "-1" {
+		t.Errorf("Expected stored value -1, got %q", val)
+	}
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/kv/text/incr", http.StatusConflict},
+		{"/kv/max/incr", http.StatusConflict},
+		{"/kv/hits/incr?delta=1.5", http.StatusBadRequest},
+		{"/kv/hits/add", http.StatusNotFound},
+		{"/kv//incr", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := count(tt.target); w.Code != tt.status {
+			t.Errorf("POST %s: expected status %d, got %d", tt.target, tt.status, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	server.HandleCounter(w, httptest.NewRequest("GET", "/kv/hits/incr", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+
+	mockRaft.isLeader = false
+	if w := count("/kv/hits/incr"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d on a follower, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,110 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Error codes of the /v1 API. Clients should branch on these rather than on messages.
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeKeyNotFound          = "key_not_found"
+	CodeNamespaceNotFound    = "namespace_not_found"
+	CodePathNotFound         = "path_not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeNotAcceptable        = "not_acceptable"
+	CodeNamespaceExists      = "namespace_exists"
+	CodeUserNotFound         = "user_not_found"
+	CodeUserExists           = "user_exists"
+	CodeRoleNotFound         = "role_not_found"
+	CodeRoleInUse            = "role_in_use"
+	CodeTokenInUse           = "token_in_use"
+	CodeNotInteger           = "not_integer"
+	CodeOverflow             = "overflow"
+	CodeNotJSON              = "not_json"
+	CodePatchConflict        = "patch_conflict"
+	CodeTooLarge             = "too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeQuotaExceeded        = "quota_exceeded"
+	CodeNotLeader            = "not_leader"
+	CodeReadUnavailable      = "read_unavailable"
+	CodeApplyFailed          = "apply_failed"
+	CodeInternal             = "internal"
+)
+
+// retryableCodes are errors where nothing was applied and the same request can succeed
+// later: on the leader, or once the node has caught up
+var retryableCodes = map[string]bool{
+	CodeNotLeader:       true,
+	CodeReadUnavailable: true,
+}
+
+// ErrorResponse is the body of every /v1 error response
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+// ErrorBody describes a failed /v1 request
+type ErrorBody struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Leader    string `json:"leader,omitempty"` // Raft address of the leader, sent with not_leader
+	Retryable bool   `json:"retryable"`        // Whether the same request may succeed if retried
+}
+
+// v1Writer wraps the response to a /v1 request, so errors are written as JSON
+type v1Writer struct {
+	http.ResponseWriter
+}
+
+// Flush lets streaming handlers flush through the wrapper
+func (w *v1Writer) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController
+func (w *v1Writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// isV1 reports whether w answers a /v1 request
+func isV1(w http.ResponseWriter) bool {
+	_, ok := w.(*v1Writer)
+	return ok
+}
+
+// writeError answers a failed request. The legacy routes get msg as plain text; /v1
+// gets the JSON envelope with code, the leader hint set by requireLeader and whether
+// the request can be retried.
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	if !isV1(w) {
+		http.Error(w, msg, status)
+		return
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	writeJSON(w, status, ErrorResponse{Error: ErrorBody{
+		Code:      code,
+		Message:   msg,
+		Leader:    w.Header().Get("X-Leader"),
+		Retryable: retryableCodes[code],
+	}})
+}
+
+// WriteAuthError answers a request the auth middleware rejected, as JSON on /v1 routes.
+// Pass it as auth.Options.WriteError.
+func WriteAuthError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if r.URL.Path == APIPrefix || strings.HasPrefix(r.URL.Path, APIPrefix+"/") {
+		w = &v1Writer{ResponseWriter: w}
+	}
+	code := CodeUnauthorized
+	if status == http.StatusForbidden {
+		code = CodeForbidden
+	}
+	writeError(w, status, code, msg)
+}
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// sseKeepAlive is how often an idle event stream sends a comment to keep proxies from closing it
+const sseKeepAlive = 15 * time.Second
+
+// HandleRaftEvents handles GET /raft/events as a Server-Sent Events stream.
+// Recent history is replayed first; reconnecting clients can send Last-Event-ID
+// (or ?since=) to only receive events they have not seen.
+func (s *Server) HandleRaftEvents(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Streaming not supported")
+		return
+	}
+
+	var afterID uint64
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("since")
+	}
+	if lastID != "" {
+		id, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid event ID")
+			return
+		}
+		afterID = id
+	}
+
+	backlog, events, cancel := s.raft.Events().Subscribe(afterID, 64)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, e := range backlog {
+		if err := writeSSE(w, e.ID, string(e.Type), e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e := <-events:
+			if err := writeSSE(w, e.ID, string(e.Type), e); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeSSE writes a single Server-Sent Events frame with a JSON payload
+func writeSSE(w http.ResponseWriter, id uint64, event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, data)
+	return err
+}
@@ -0,0 +1,82 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"distributed_cloud_service/internal/raft"
+	"distributed_cloud_service/internal/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleRaftEvents(t *testing.T) {
+	kvStore := store.NewStore()
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	bus := mockRaft.Events()
+	bus.Publish(raft.Event{Type: raft.EventLeaderChange, LeaderID: "node1"})
+	bus.Publish(raft.Event{Type: raft.EventPeerAdded, PeerID: "node2"})
+
+	ts := httptest.NewServer(http.HandlerFunc(server.HandleRaftEvents))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL, nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %s", ct)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	readFrame := func() string {
+		var frame strings.Builder
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Failed to read stream: %v", err)
+			}
+			if line == "\n" {
+				return frame.String()
+			}
+			frame.WriteString(line)
+		}
+	}
+
+	// Event 1 was already seen, so the replay starts at event 2
+	frame := readFrame()
+	if !strings.Contains(frame, "id: 2\n") || !strings.Contains(frame, "event: peer_added\n") {
+		t.Errorf("Unexpected replayed frame: %q", frame)
+	}
+
+	bus.Publish(raft.Event{Type: raft.EventStateChange, State: "Candidate"})
+	frame = readFrame()
+	if !strings.Contains(frame, "event: state_change\n") || !strings.Contains(frame, `"state":"Candidate"`) {
+		t.Errorf("Unexpected live frame: %q", frame)
+	}
+}
+
+func TestHandleRaftEvents_InvalidID(t *testing.T) {
+	kvStore := store.NewStore()
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	req := httptest.NewRequest("GET", "/raft/events?since=abc", nil)
+	w := httptest.NewRecorder()
+	server.HandleRaftEvents(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -1,148 +1,316 @@
-package http
-
-import (
-	"context"
-	"distributed_cloud_service/internal/raft"
-	"distributed_cloud_service/internal/store"
-	"io"
-	"net/http"
-	"time"
-)
-
-// Server handles HTTP requests for the key-value store
-type Server struct {
-	store *store.Store
-	raft  RaftNode
-}
-
-// NewServer creates a new HTTP server
-func NewServer(s *store.Store, r RaftNode) *Server {
-	return &Server{
-		store: s,
-		raft:  r,
-	}
-}
-
-// HandlePut handles PUT /kv/{key} requests
-func (s *Server) HandlePut(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Only leader can accept writes
-	if !s.raft.IsLeader() {
-		leader := s.raft.Leader()
-		if leader != "" {
-			w.Header().Set("X-Leader", leader)
-		}
-		http.Error(w, "Not the leader", http.StatusBadRequest)
-		return
-	}
-
-	key := r.URL.Path[len("/kv/"):]
-	if key == "" {
-		http.Error(w, "Key is required", http.StatusBadRequest)
-		return
-	}
-
-	val, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read body", http.StatusBadRequest)
-		return
-	}
-	defer r.Body.Close()
-
-	// Propose command to Raft
-	cmd := raft.KVCommand{
-		Op:    "put",
-		Key:   key,
-		Value: val,
-	}
-
-	if err := s.raft.Apply(cmd); err != nil {
-		http.Error(w, "Failed to apply command: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusNoContent)
-}
-
-// HandleGet handles GET /kv/{key} requests with linearizable reads
-func (s *Server) HandleGet(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	key := r.URL.Path[len("/kv/"):]
-	if key == "" {
-		http.Error(w, "Key is required", http.StatusBadRequest)
-		return
-	}
-
-	// Ensure linearizable read using ReadIndex (for followers)
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
-	
-	if err := s.raft.VerifyRead(ctx); err != nil {
-		http.Error(w, "Failed to verify read: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Now safe to read from local store
-	val, ok := s.store.Get(key)
-	if !ok {
-		http.Error(w, "Key not found", http.StatusNotFound)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.WriteHeader(http.StatusOK)
-	w.Write(val)
-}
-
-// HandleDelete handles DELETE /kv/{key} requests
-func (s *Server) HandleDelete(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Only leader can accept writes
-	if !s.raft.IsLeader() {
-		leader := s.raft.Leader()
-		if leader != "" {
-			w.Header().Set("X-Leader", leader)
-		}
-		http.Error(w, "Not the leader", http.StatusBadRequest)
-		return
-	}
-
-	key := r.URL.Path[len("/kv/"):]
-	if key == "" {
-		http.Error(w, "Key is required", http.StatusBadRequest)
-		return
-	}
-
-	// Check if key exists first (read from store is okay)
-	_, ok := s.store.Get(key)
-	if !ok {
-		http.Error(w, "Key not found", http.StatusNotFound)
-		return
-	}
-
-	// Propose command to Raft
-	cmd := raft.KVCommand{
-		Op:  "delete",
-		Key: key,
-	}
-
-	if err := s.raft.Apply(cmd); err != nil {
-		http.Error(w, "Failed to apply command: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusNoContent)
-}
-
+package http
+
+import (
+	"context"
+	"distributed_cloud_service/internal/auth"
+	"distributed_cloud_service/internal/cluster"
+	"distributed_cloud_service/internal/metrics"
+	"distributed_cloud_service/internal/raft"
+	"distributed_cloud_service/internal/store"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	hraft "github.com/hashicorp/raft"
+)
+
+// Server handles HTTP requests for the key-value store
+type Server struct {
+	store  *store.Store
+	raft   RaftNode
+	limits cluster.LimitsConfig
+	rbac   cluster.RBACConfig
+	jwt    *auth.JWTValidator
+}
+
+// NewServer creates a new HTTP server
+func NewServer(s *store.Store, r RaftNode) *Server {
+	return &Server{
+		store:  s,
+		raft:   r,
+		limits: cluster.DefaultLimits(),
+	}
+}
+
+// SetLimits sets the quotas checked before a write is proposed
+func (s *Server) SetLimits(limits cluster.LimitsConfig) {
+	s.limits = limits.WithDefaults()
+}
+
+// rejectQuota counts a write refused by the HTTP layer and answers it
+func rejectQuota(w http.ResponseWriter, err error) {
+	countQuotaRejection(err)
+	writeQuotaError(w, err)
+}
+
+// countQuotaRejection counts err under the HTTP layer if it is a quota error
+func countQuotaRejection(err error) {
+	var quotaErr *store.QuotaError
+	if errors.As(err, &quotaErr) {
+		metrics.KVQuotaRejections.WithLabelValues(quotaErr.Resource, "http").Inc()
+	}
+}
+
+// writeQuotaError answers 413 for an oversized key or value and 507 when the store is full.
+// It returns false if err is not a quota error.
+func writeQuotaError(w http.ResponseWriter, err error) bool {
+	var quotaErr *store.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	status, code := http.StatusInsufficientStorage, CodeQuotaExceeded
+	if quotaErr.TooLarge() {
+		status, code = http.StatusRequestEntityTooLarge, CodeTooLarge
+	}
+	writeError(w, status, code, quotaErr.Error())
+	return true
+}
+
+// HandlePut handles PUT /kv/{key} requests
+func (s *Server) HandlePut(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	s.putKey(w, r, store.DefaultNamespace, r.URL.Path[len("/kv/"):])
+}
+
+// HandleGet handles GET and HEAD /kv/{key} requests with linearizable reads
+func (s *Server) HandleGet(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.getKey(w, r, store.DefaultNamespace, r.URL.Path[len("/kv/"):])
+	case http.MethodHead:
+		s.headKey(w, r, store.DefaultNamespace, r.URL.Path[len("/kv/"):])
+	default:
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// HandleDelete handles DELETE /kv/{key} requests
+func (s *Server) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	s.deleteKey(w, r, store.DefaultNamespace, r.URL.Path[len("/kv/"):])
+}
+
+// requireLeader answers non-leader requests with the leader's address and returns false
+func (s *Server) requireLeader(w http.ResponseWriter) bool {
+	// Only leader can accept writes
+	if !s.raft.IsLeader() {
+		leader := s.raft.Leader()
+		if leader != "" {
+			w.Header().Set("X-Leader", leader)
+		}
+		writeError(w, http.StatusBadRequest, CodeNotLeader, "Not the leader")
+		return false
+	}
+	return true
+}
+
+// putKey stores the request body under key in namespace ns
+func (s *Server) putKey(w http.ResponseWriter, r *http.Request, ns, key string) {
+	if !s.authorize(w, r, ns, auth.AccessWrite, key) {
+		return
+	}
+	if !s.requireLeader(w) {
+		return
+	}
+
+	if key == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Key is required")
+		return
+	}
+
+	contentType, headers := requestMeta(r)
+	if err := store.CheckMeta(store.Meta{ContentType: contentType, Headers: headers}); err != nil {
+		rejectQuota(w, err)
+		return
+	}
+
+	val, ok := s.readValue(w, r, key)
+	if !ok {
+		return
+	}
+
+	var nsLimits cluster.LimitsConfig
+	if namespace, ok := s.store.Namespace(ns); ok {
+		nsLimits = namespace.Limits
+	}
+	if err := s.store.CheckPutIn(s.limits, nsLimits, ns, key, int64(len(val))); err != nil {
+		rejectQuota(w, err)
+		return
+	}
+
+	// Propose command to Raft
+	cmd := raft.KVCommand{
+		Op:          "put",
+		Namespace:   ns,
+		Key:         key,
+		Value:       val,
+		ContentType: contentType,
+		Meta:        headers,
+	}
+
+	if err := s.raft.Apply(cmd); err != nil {
+		// Rejected by the FSM, which already counted it
+		if writeQuotaError(w, err) {
+			return
+		}
+		writeApplyError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readValue reads a request body of at most the maximum value size.
+// It answers the request and returns false if the body is too large or can't be read.
+func (s *Server) readValue(w http.ResponseWriter, r *http.Request, key string) ([]byte, bool) {
+	defer r.Body.Close()
+
+	// Reject oversized requests before reading the body
+	if err := store.CheckSize(s.limits, key, r.ContentLength); err != nil {
+		rejectQuota(w, err)
+		return nil, false
+	}
+
+	body := r.Body
+	if s.limits.MaxValueSize > 0 {
+		body = http.MaxBytesReader(w, r.Body, s.limits.MaxValueSize)
+	}
+	val, err := io.ReadAll(body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			rejectQuota(w, &store.QuotaError{Resource: store.ResourceValueSize, Limit: maxErr.Limit, Want: maxErr.Limit + 1})
+			return nil, false
+		}
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Failed to read body")
+		return nil, false
+	}
+	return val, true
+}
+
+// getKey serves the value of key in namespace ns after a linearizable read check
+func (s *Server) getKey(w http.ResponseWriter, r *http.Request, ns, key string) {
+	if !s.authorize(w, r, ns, auth.AccessRead, key) {
+		return
+	}
+	if key == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Key is required")
+		return
+	}
+
+	// Ensure linearizable read using ReadIndex (for followers)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := s.raft.VerifyRead(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, CodeReadUnavailable, "Failed to verify read: "+err.Error())
+		return
+	}
+
+	// Now safe to read from local store
+	val, meta, ok := s.store.GetWithMetaIn(ns, key)
+	if !ok {
+		writeError(w, http.StatusNotFound, CodeKeyNotFound, "Key not found")
+		return
+	}
+
+	// ?path= returns part of a JSON value
+	if r.URL.Query().Has("path") {
+		if val, ok = queryPath(w, val, r.URL.Query().Get("path")); !ok {
+			return
+		}
+		writeMetaHeaders(w, meta)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(val)
+		return
+	}
+
+	// /v1 clients can ask for the value and its metadata as JSON
+	if isV1(w) {
+		w.Header().Add("Vary", "Accept")
+		envelope, ok := negotiateValue(r.Header.Get("Accept"), meta.ContentType)
+		if !ok {
+			writeError(w, http.StatusNotAcceptable, CodeNotAcceptable, "Accept must allow application/json or the value's content type")
+			return
+		}
+		if envelope {
+			writeMetaHeaders(w, meta)
+			writeJSON(w, http.StatusOK, ValueResponse{Key: key, Value: val, Meta: meta})
+			return
+		}
+	}
+
+	writeMetaHeaders(w, meta)
+	w.WriteHeader(http.StatusOK)
+	w.Write(val)
+}
+
+// deleteKey removes key from namespace ns
+func (s *Server) deleteKey(w http.ResponseWriter, r *http.Request, ns, key string) {
+	if !s.authorize(w, r, ns, auth.AccessWrite, key) {
+		return
+	}
+	if !s.requireLeader(w) {
+		return
+	}
+
+	if key == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Key is required")
+		return
+	}
+
+	// Check if key exists first (read from store is okay)
+	_, ok := s.store.GetIn(ns, key)
+	if !ok {
+		writeError(w, http.StatusNotFound, CodeKeyNotFound, "Key not found")
+		return
+	}
+
+	// Propose command to Raft
+	cmd := raft.KVCommand{
+		Op:        "delete",
+		Namespace: ns,
+		Key:       key,
+	}
+
+	if err := s.raft.Apply(cmd); err != nil {
+		writeApplyError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeApplyError answers a command that failed in Raft or was rejected by the FSM
+func writeApplyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNamespaceNotFound):
+		writeError(w, http.StatusNotFound, CodeNamespaceNotFound, "Namespace not found")
+	case errors.Is(err, store.ErrNamespaceExists):
+		writeError(w, http.StatusConflict, CodeNamespaceExists, "Namespace already exists")
+	case errors.Is(err, store.ErrUserNotFound):
+		writeError(w, http.StatusNotFound, CodeUserNotFound, "User not found")
+	case errors.Is(err, store.ErrUserExists):
+		writeError(w, http.StatusConflict, CodeUserExists, "User already exists")
+	case errors.Is(err, store.ErrRoleNotFound):
+		writeError(w, http.StatusNotFound, CodeRoleNotFound, err.Error())
+	case errors.Is(err, store.ErrRoleInUse):
+		writeError(w, http.StatusConflict, CodeRoleInUse, err.Error())
+	case errors.Is(err, store.ErrTokenInUse):
+		writeError(w, http.StatusConflict, CodeTokenInUse, "Token belongs to another user")
+	case errors.Is(err, hraft.ErrNotLeader):
+		// Leadership moved before the command was proposed, so nothing was applied
+		writeError(w, http.StatusInternalServerError, CodeNotLeader, "Failed to apply command: "+err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, CodeApplyFailed, "Failed to apply command: "+err.Error())
+	}
+}
+
@@ -1,153 +1,295 @@
-package http
-
-import (
-	"bytes"
-	"context"
-	"distributed_cloud_service/internal/raft"
-	"distributed_cloud_service/internal/store"
-	"net/http"
-	"net/http/httptest"
-	"testing"
-)
-
-// mockRaftNode implements RaftNode interface for testing
-type mockRaftNode struct {
-	isLeader bool
-	leader   string
-	store    *store.Store
-}
-
-func (m *mockRaftNode) IsLeader() bool {
-	return m.isLeader
-}
-
-func (m *mockRaftNode) Leader() string {
-	return m.leader
-}
-
-func (m *mockRaftNode) Apply(cmd raft.KVCommand) error {
-	// Apply directly to store for testing
-	switch cmd.Op {
-	case "put":
-		m.store.Put(cmd.Key, cmd.Value)
-	case "delete":
-		m.store.Delete(cmd.Key)
-	}
-	return nil
-}
-
-func (m *mockRaftNode) VerifyRead(ctx context.Context) error {
-	return nil
-}
-
-func TestHandlePut(t *testing.T) {
-	kvStore := store.NewStore()
-	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
-	server := NewServer(kvStore, mockRaft)
-
-	// Test successful PUT
-	req := httptest.NewRequest("PUT", "/kv/test-key", bytes.NewBufferString("test-value"))
-	w := httptest.NewRecorder()
-	server.HandlePut(w, req)
-
-	if w.Code != http.StatusNoContent {
-		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
-	}
-
-	// Verify value was stored
-	val, ok := kvStore.Get("test-key")
-	if !ok {
-		t.Fatal("Key not found after PUT")
-	}
-	if string(val) != "test-value" {
-		t.Errorf("Expected 'test-value', got '%s'", string(val))
-	}
-}
-
-func TestHandlePut_NotLeader(t *testing.T) {
-	kvStore := store.NewStore()
-	mockRaft := &mockRaftNode{isLeader: false, leader: "127.0.0.1:9001", store: kvStore}
-	server := NewServer(kvStore, mockRaft)
-
-	req := httptest.NewRequest("PUT", "/kv/test-key", bytes.NewBufferString("test-value"))
-	w := httptest.NewRecorder()
-	server.HandlePut(w, req)
-
-	if w.Code != http.StatusBadRequest {
-		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
-	}
-
-	leader := w.Header().Get("X-Leader")
-	if leader != "127.0.0.1:9001" {
-		t.Errorf("Expected X-Leader header '127.0.0.1:9001', got '%s'", leader)
-	}
-}
-
-func TestHandleGet(t *testing.T) {
-	kvStore := store.NewStore()
-	kvStore.Put("test-key", []byte("test-value"))
-	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
-	server := NewServer(kvStore, mockRaft)
-
-	req := httptest.NewRequest("GET", "/kv/test-key", nil)
-	w := httptest.NewRecorder()
-	server.HandleGet(w, req)
-
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
-	}
-
-	if w.Body.String() != "test-value" {
-		t.Errorf("Expected body 'test-value', got '%s'", w.Body.String())
-	}
-}
-
-func TestHandleGet_NotFound(t *testing.T) {
-	kvStore := store.NewStore()
-	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
-	server := NewServer(kvStore, mockRaft)
-
-	req := httptest.NewRequest("GET", "/kv/nonexistent", nil)
-	w := httptest.NewRecorder()
-	server.HandleGet(w, req)
-
-	if w.Code != http.StatusNotFound {
-		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
-	}
-}
-
-func TestHandleDelete(t *testing.T) {
-	kvStore := store.NewStore()
-	kvStore.Put("test-key", []byte("test-value"))
-	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
-	server := NewServer(kvStore, mockRaft)
-
-	req := httptest.NewRequest("DELETE", "/kv/test-key", nil)
-	w := httptest.NewRecorder()
-	server.HandleDelete(w, req)
-
-	if w.Code != http.StatusNoContent {
-		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
-	}
-
-	// Verify key was deleted
-	_, ok := kvStore.Get("test-key")
-	if ok {
-		t.Error("Key still exists after DELETE")
-	}
-}
-
-func TestHandleDelete_NotFound(t *testing.T) {
-	kvStore := store.NewStore()
-	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
-	server := NewServer(kvStore, mockRaft)
-
-	req := httptest.NewRequest("DELETE", "/kv/nonexistent", nil)
-	w := httptest.NewRecorder()
-	server.HandleDelete(w, req)
-
-	if w.Code != http.StatusNotFound {
-		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
-	}
-}
-
+package http
+
+import (
+	"bytes"
+	"context"
+	"distributed_cloud_service/internal/cluster"
+	"distributed_cloud_service/internal/jsondoc"
+	"distributed_cloud_service/internal/raft"
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	hraft "github.com/hashicorp/raft"
+)
+
+// mockRaftNode implements RaftNode interface for testing
+type mockRaftNode struct {
+	isLeader bool
+	leader   string
+	store    *store.Store
+	events   *raft.EventBus
+	applyErr error // returned by Apply instead of applying, like an FSM rejection
+	check    *raft.HashCheck
+	index    uint64 // last log index given to a command run through the FSM
+}
+
+func (m *mockRaftNode) IsLeader() bool {
+	return m.isLeader
+}
+
+func (m *mockRaftNode) Leader() string {
+	return m.leader
+}
+
+func (m *mockRaftNode) Apply(cmd raft.KVCommand) error {
+	if m.applyErr != nil {
+		return m.applyErr
+	}
+	// Apply directly to store for testing
+	switch cmd.Op {
+	case "put", "batch", "role_put", "role_delete", "user_create", "user_update", "user_delete":
+		// Through the FSM, which stores the metadata and checks users and roles
+		_, err := m.Propose(cmd)
+		return err
+	case "delete":
+		_, err := m.store.DeleteIn(0, cmd.Namespace, cmd.Key)
+		return err
+	case "patch":
+		val, ok := m.store.GetIn(cmd.Namespace, cmd.Key)
+		if !ok {
+			return raft.ErrKeyNotFound
+		}
+		patched, err := jsondoc.Apply(cmd.Patch, val, cmd.Value)
+		if err != nil {
+			return err
+		}
+		return m.store.PutIn(0, cmd.Namespace, cmd.Key, patched)
+	case "ns_create":
+		var ns store.Namespace
+		if err := json.Unmarshal(cmd.Value, &ns); err != nil {
+			return err
+		}
+		return m.store.CreateNamespace(0, ns)
+	case "ns_delete":
+		return m.store.DeleteNamespace(0, cmd.Key)
+	}
+	return nil
+}
+
+// Propose runs commands that return a value through a real FSM
+func (m *mockRaftNode) Propose(cmd raft.KVCommand) (interface{}, error) {
+	if m.applyErr != nil {
+		return nil, m.applyErr
+	}
+	data, err := cmd.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	// Entries at or below the store's applied index would be skipped
+	m.index = max(m.index, m.store.AppliedIndex()) + 1
+	resp := raft.NewFSM(m.store).Apply(&hraft.Log{Index: m.index, Data: data, AppendedAt: time.Now()})
+	if err, ok := resp.(error); ok {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (m *mockRaftNode) VerifyRead(ctx context.Context) error {
+	return nil
+}
+
+func (m *mockRaftNode) Events() *raft.EventBus {
+	if m.events == nil {
+		m.events = raft.NewEventBus(raft.DefaultEventHistory)
+	}
+	return m.events
+}
+
+func (m *mockRaftNode) Backup() (raft.BackupInfo, store.Snapshot, error) {
+	view, err := m.store.Snapshot()
+	if err != nil {
+		return raft.BackupInfo{}, nil, err
+	}
+	return raft.BackupInfo{Index: view.AppliedIndex(), NodeID: "mock"}, view, nil
+}
+
+func (m *mockRaftNode) Restore(r io.Reader) (raft.BackupInfo, error) {
+	if err := raft.NewFSM(m.store).Restore(io.NopCloser(r)); err != nil {
+		return raft.BackupInfo{}, fmt.Errorf("%w: %v", raft.ErrInvalidBackup, err)
+	}
+	return raft.BackupInfo{Index: m.store.AppliedIndex()}, nil
+}
+
+func (m *mockRaftNode) StateHash(index uint64) (raft.StateHash, bool) {
+	if index != 0 && index != m.store.AppliedIndex() {
+		return raft.StateHash{}, false
+	}
+	return raft.StateHash{Index: m.store.AppliedIndex(), Hash: store.FormatHash(m.store.Hash())}, true
+}
+
+func (m *mockRaftNode) LastHashCheck() (raft.HashCheck, bool) {
+	if m.check == nil {
+		return raft.HashCheck{}, false
+	}
+	return *m.check, true
+}
+
+func TestHandlePut(t *testing.T) {
+	kvStore := store.NewStore()
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	// Test successful PUT
+	req := httptest.NewRequest("PUT", "/kv/test-key", bytes.NewBufferString("test-value"))
+	w := httptest.NewRecorder()
+	server.HandlePut(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	// Verify value was stored
+	val, ok := kvStore.Get("test-key")
+	if !ok {
+		t.Fatal("Key not found after PUT")
+	}
+	if string(val) != "test-value" {
+		t.Errorf("Expected 'test-value', got '%s'", string(val))
+	}
+}
+
+func TestHandlePut_NotLeader(t *testing.T) {
+	kvStore := store.NewStore()
+	mockRaft := &mockRaftNode{isLeader: false, leader: "127.0.0.1:9001", store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	req := httptest.NewRequest("PUT", "/kv/test-key", bytes.NewBufferString("test-value"))
+	w := httptest.NewRecorder()
+	server.HandlePut(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	leader := w.Header().Get("X-Leader")
+	if leader != "127.0.0.1:9001" {
+		t.Errorf("Expected X-Leader header '127.0.0.1:9001', got '%s'", leader)
+	}
+}
+
+func TestHandleGet(t *testing.T) {
+	kvStore := store.NewStore()
+	kvStore.Put("test-key", []byte("test-value"))
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	req := httptest.NewRequest("GET", "/kv/test-key", nil)
+	w := httptest.NewRecorder()
+	server.HandleGet(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if w.Body.String() != "test-value" {
+		t.Errorf("Expected body 'test-value', got '%s'", w.Body.String())
+	}
+}
+
+func TestHandleGet_NotFound(t *testing.T) {
+	kvStore := store.NewStore()
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	req := httptest.NewRequest("GET", "/kv/nonexistent", nil)
+	w := httptest.NewRecorder()
+	server.HandleGet(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHandleDelete(t *testing.T) {
+	kvStore := store.NewStore()
+	kvStore.Put("test-key", []byte("test-value"))
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	req := httptest.NewRequest("DELETE", "/kv/test-key", nil)
+	w := httptest.NewRecorder()
+	server.HandleDelete(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	// Verify key was deleted
+	_, ok := kvStore.Get("test-key")
+	if ok {
+		t.Error("Key still exists after DELETE")
+	}
+}
+
+func TestHandleDelete_NotFound(t *testing.T) {
+	kvStore := store.NewStore()
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	req := httptest.NewRequest("DELETE", "/kv/nonexistent", nil)
+	w := httptest.NewRecorder()
+	server.HandleDelete(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHandlePut_Limits(t *testing.T) {
+	kvStore := store.NewStore()
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+	server.SetLimits(cluster.LimitsConfig{MaxKeySize: 8, MaxValueSize: 16, MaxKeys: 1})
+
+	tests := []struct {
+		name   string
+		key    string
+		body   string
+		status int
+	}{
+		{"key too long", "a-very-long-key", "v", http.StatusRequestEntityTooLarge},
+		{"value too large", "key", strings.Repeat("v", 17), http.StatusRequestEntityTooLarge},
+		{"fits", "key", "value", http.StatusNoContent},
+		{"overwrite", "key", "value2", http.StatusNoContent},
+		{"too many keys", "key2", "value", http.StatusInsufficientStorage},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("PUT", "/kv/"+tt.key, bytes.NewBufferString(tt.body))
+		w := httptest.NewRecorder()
+		server.HandlePut(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, w.Code)
+		}
+	}
+
+	// A body without Content-Length is cut off at the value limit
+	req := httptest.NewRequest("PUT", "/kv/key", strings.NewReader(strings.Repeat("v", 100)))
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+	server.HandlePut(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for unsized body, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
+
+func TestHandlePut_FSMRejection(t *testing.T) {
+	kvStore := store.NewStore()
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	mockRaft.applyErr = &store.QuotaError{Resource: store.ResourceBytes, Limit: 10, Want: 20}
+	server := NewServer(kvStore, mockRaft)
+
+	req := httptest.NewRequest("PUT", "/kv/key", bytes.NewBufferString("value"))
+	w := httptest.NewRecorder()
+	server.HandlePut(w, req)
+	if w.Code != http.StatusInsufficientStorage {
+		t.Errorf("Expected status %d, got %d", http.StatusInsufficientStorage, w.Code)
+	}
+}
+
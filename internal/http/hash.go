@@ -0,0 +1,46 @@
+package http
+
+import (
+	"distributed_cloud_service/internal/raft"
+	"net/http"
+	"strconv"
+)
+
+// HashResponse is returned by GET /admin/hash
+type HashResponse struct {
+	raft.StateHash
+	LastCheck *raft.HashCheck `json:"last_check,omitempty"` // latest comparison with the leader's hash
+}
+
+// HandleHash handles GET /admin/hash, reporting this node's state hash and the index it was
+// taken at. ?index=N returns the hash after entry N while it is still in the recent history,
+// so replicas can be compared at the same index.
+func (s *Server) HandleHash(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var index uint64
+	if v := r.URL.Query().Get("index"); v != "" {
+		var err error
+		if index, err = strconv.ParseUint(v, 10, 64); err != nil || index == 0 {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "index must be a positive integer")
+			return
+		}
+	}
+	sh, ok := s.raft.StateHash(index)
+	if !ok {
+		writeError(w, http.StatusNotFound, CodeNotFound, "No state hash recorded at index "+strconv.FormatUint(index, 10))
+		return
+	}
+
+	resp := HashResponse{StateHash: sh}
+	if check, ok := s.raft.LastHashCheck(); ok {
+		resp.LastCheck = &check
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
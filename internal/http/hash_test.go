@@ -0,0 +1,49 @@
+package http
+
+import (
+	"distributed_cloud_service/internal/raft"
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleHash(t *testing.T) {
+	kvStore := store.NewStore()
+	kvStore.PutAt(1, "key1", []byte("value1"))
+	kvStore.PutAt(2, "key2", []byte("value2"))
+	mockRaft := &mockRaftNode{store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	w := httptest.NewRecorder()
+	server.HandleHash(w, httptest.NewRequest("GET", "/admin/hash", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var resp HashResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Index != 2 || resp.Hash != store.FormatHash(kvStore.Hash()) {
+		t.Errorf("Unexpected hash response %+v", resp)
+	}
+	if resp.LastCheck != nil {
+		t.Errorf("Expected no last check, got %+v", resp.LastCheck)
+	}
+
+	mockRaft.check = &raft.HashCheck{Index: 2, Expected: resp.Hash, Actual: resp.Hash, Match: true}
+	w = httptest.NewRecorder()
+	server.HandleHash(w, httptest.NewRequest("GET", "/admin/hash?index=2", nil))
+	resp = HashResponse{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || resp.LastCheck == nil || !resp.LastCheck.Match {
+		t.Errorf("Expected hash with last check, got %d %+v", w.Code, resp)
+	}
+
+	for query, status := range map[string]int{"?index=1": http.StatusNotFound, "?index=abc": http.StatusBadRequest} {
+		w = httptest.NewRecorder()
+		server.HandleHash(w, httptest.NewRequest("GET", "/admin/hash"+query, nil))
+		if w.Code != status {
+			t.Errorf("%s: expected status %d, got %d", query, status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"context"
+	"distributed_cloud_service/internal/auth"
+	"distributed_cloud_service/internal/store"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metaHeaderPrefix marks request headers stored as custom metadata and returned with the key
+const metaHeaderPrefix = "X-Meta-"
+
+// requestMeta returns the Content-Type and X-Meta-* headers of a PUT to store with the value.
+// Repeated headers are joined with ", ".
+func requestMeta(r *http.Request) (string, map[string]string) {
+	var headers map[string]string
+	for name, values := range r.Header {
+		if suffix, ok := strings.CutPrefix(name, metaHeaderPrefix); ok && suffix != "" {
+			if headers == nil {
+				headers = make(map[string]string)
+			}
+			headers[suffix] = strings.Join(values, ", ")
+		}
+	}
+	return r.Header.Get("Content-Type"), headers
+}
+
+// writeMetaHeaders describes a key in response headers: its content type (octet-stream if
+// the client didn't send one), indexes, version, timestamps and X-Meta-* headers
+func writeMetaHeaders(w http.ResponseWriter, meta store.Meta) {
+	h := w.Header()
+	contentType := meta.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	h.Set("Content-Type", contentType)
+	if meta.ModifyIndex != 0 {
+		h.Set("X-Create-Index", strconv.FormatUint(meta.CreateIndex, 10))
+		h.Set("X-Modify-Index", strconv.FormatUint(meta.ModifyIndex, 10))
+		h.Set("X-Version", strconv.FormatUint(meta.Version, 10))
+	}
+	if meta.Created != 0 {
+		h.Set("X-Created-At", time.UnixMilli(meta.Created).UTC().Format(time.RFC3339Nano))
+	}
+	if meta.Modified != 0 {
+		h.Set("Last-Modified", time.UnixMilli(meta.Modified).UTC().Format(http.TimeFormat))
+	}
+	for name, value := range meta.Headers {
+		h.Set(metaHeaderPrefix+name, value)
+	}
+}
+
+// headKey answers HEAD for key in namespace ns with its metadata, without reading the value
+func (s *Server) headKey(w http.ResponseWriter, r *http.Request, ns, key string) {
+	if !s.authorize(w, r, ns, auth.AccessRead, key) {
+		return
+	}
+	if key == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := s.raft.VerifyRead(ctx); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	meta, ok := s.store.MetaIn(ns, key)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	writeMetaHeaders(w, meta)
+	w.Header().Set("Content-Length", strconv.FormatInt(meta.Size, 10))
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,97 @@
+package http
+
+import (
+	"distributed_cloud_service/internal/store"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleGet_Meta(t *testing.T) {
+	kvStore := store.NewStore()
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	put := func(body string, headers map[string]string) {
+		t.Helper()
+		req := httptest.NewRequest("PUT", "/kv/report", strings.NewReader(body))
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		server.HandlePut(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("PUT failed with status %d: %s", w.Code, w.Body.String())
+		}
+	}
+	put("first", nil)
+	put(`{"ok":true}`, map[string]string{"Content-Type": "application/json", "X-Meta-Owner": "ops", "X-Meta-Build-Id": "42"})
+
+	w := httptest.NewRecorder()
+	server.HandleGet(w, httptest.NewRequest("GET", "/kv/report", nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"ok":true}` {
+		t.Fatalf("Unexpected GET response %d: %s", w.Code, w.Body.String())
+	}
+	want := map[string]string{
+		"Content-Type":    "application/json",
+		"X-Create-Index":  "1",
+		"X-Modify-Index":  "2",
+		"X-Version":       "2",
+		"X-Meta-Owner":    "ops",
+		"X-Meta-Build-Id": "42",
+	}
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("Expected %s %q, got %q", name, value, got)
+		}
+	}
+	if _, err := http.ParseTime(w.Header().Get("Last-Modified")); err != nil {
+		t.Errorf("Expected a Last-Modified date, got %q", w.Header().Get("Last-Modified"))
+	}
+	if _, err := time.Parse(time.RFC3339Nano, w.Header().Get("X-Created-At")); err != nil {
+		t.Errorf("Expected an X-Created-At time, got %q", w.Header().Get("X-Created-At"))
+	}
+
+	// HEAD returns the same headers and the size without a body
+	w = httptest.NewRecorder()
+	server.HandleGet(w, httptest.NewRequest("HEAD", "/kv/report", nil))
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("Unexpected HEAD response %d with %d body bytes", w.Code, w.Body.Len())
+	}
+	if w.Header().Get("Content-Length") != "11" || w.Header().Get("X-Meta-Owner") != "ops" || w.Header().Get("X-Version") != "2" {
+		t.Errorf("Unexpected HEAD headers %v", w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	server.HandleGet(w, httptest.NewRequest("HEAD", "/kv/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// A PUT without a content type serves octet-stream again and drops the old headers
+	put("plain", nil)
+	w = httptest.NewRecorder()
+	server.HandleGet(w, httptest.NewRequest("GET", "/kv/report", nil))
+	if w.Header().Get("Content-Type") != "application/octet-stream" || w.Header().Get("X-Meta-Owner") != "" {
+		t.Errorf("Unexpected headers after overwrite %v", w.Header())
+	}
+}
+
+func TestHandlePut_MetaTooLarge(t *testing.T) {
+	kvStore := store.NewStore()
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	req := httptest.NewRequest("PUT", "/kv/key", strings.NewReader("value"))
+	req.Header.Set("X-Meta-Notes", strings.Repeat("x", store.MaxMetaSize))
+	w := httptest.NewRecorder()
+	server.HandlePut(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	if _, ok := kvStore.Get("key"); ok {
+		t.Error("Expected the key not to be written")
+	}
+}
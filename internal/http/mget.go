@@ -0,0 +1,109 @@
+package http
+
+import (
+	"context"
+	"distributed_cloud_service/internal/auth"
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// mgetKey is the reserved key a multi-get is posted to
+	mgetKey = "_mget"
+
+	// maxMGetKeys caps the number of keys read by one multi-get
+	maxMGetKeys = 1000
+
+	// maxMGetBody caps the size of a multi-get request body
+	maxMGetBody = 1 << 20
+)
+
+// MGetRequest is the body of a multi-get
+type MGetRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// MGetResult is one key of a multi-get. Missing and expired keys have Found false.
+type MGetResult struct {
+	Key   string      `json:"key"`
+	Found bool        `json:"found"`
+	Value []byte      `json:"value"` // base64 in JSON, null when not found
+	Meta  *store.Meta `json:"meta,omitempty"`
+}
+
+// MGetResponse holds one result per requested key, in request order, all read at Index
+type MGetResponse struct {
+	Index   uint64       `json:"index"`
+	Results []MGetResult `json:"results"`
+}
+
+// HandleMGet handles POST /kv/_mget requests
+func (s *Server) HandleMGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	s.mgetKeys(w, r, store.DefaultNamespace)
+}
+
+// mgetKeys reads every key listed in the body from namespace ns after a single
+// linearizable read check. All values come from one view of the store, so they
+// reflect the same applied index even while writes are being applied.
+func (s *Server) mgetKeys(w http.ResponseWriter, r *http.Request, ns string) {
+	var req MGetRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMGetBody)).Decode(&req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, CodeTooLarge, "Request body too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	if len(req.Keys) == 0 {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "keys is required")
+		return
+	}
+	if len(req.Keys) > maxMGetKeys {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("At most %d keys can be read at once", maxMGetKeys))
+		return
+	}
+	for _, key := range req.Keys {
+		if key == "" {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Keys must not be empty")
+			return
+		}
+	}
+	if !s.authorize(w, r, ns, auth.AccessRead, req.Keys...) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := s.raft.VerifyRead(ctx); err != nil {
+		writeError(w, http.StatusInternalServerError, CodeReadUnavailable, "Failed to verify read: "+err.Error())
+		return
+	}
+
+	index, lookups, err := s.store.GetManyIn(ns, req.Keys)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, err.Error())
+		return
+	}
+
+	resp := MGetResponse{Index: index, Results: make([]MGetResult, len(lookups))}
+	for i, l := range lookups {
+		resp.Results[i] = MGetResult{Key: l.Key, Found: l.Found}
+		if l.Found {
+			meta := l.Meta
+			resp.Results[i].Value = l.Value
+			resp.Results[i].Meta = &meta
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
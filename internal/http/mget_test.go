@@ -0,0 +1,113 @@
+package http
+
+import (
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleMGet(t *testing.T) {
+	kvStore := store.NewStore()
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	for key, value := range map[string]string{"a": "1", "b": "2"} {
+		w := httptest.NewRecorder()
+		server.HandlePut(w, httptest.NewRequest("PUT", "/kv/"+key, strings.NewReader(value)))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("PUT %s failed with status %d", key, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	server.HandleMGet(w, httptest.NewRequest("POST", "/kv/_mget", strings.NewReader(`{"keys":["b","missing","a"]}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var resp MGetResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Index != kvStore.AppliedIndex() {
+		t.Errorf("Expected index %d, got %d", kvStore.AppliedIndex(), resp.Index)
+	}
+	if len(resp.Results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(resp.Results))
+	}
+	if r := resp.Results[0]; r.Key != "b" || !r.Found || string(r.Value) != "2" || r.Meta == nil || r.Meta.ModifyIndex == 0 {
+		t.Errorf("Expected b=2 with metadata, got %+v", r)
+	}
+	if r := resp.Results[1]; r.Key != "missing" || r.Found || r.Value != nil || r.Meta != nil {
+		t.Errorf("Expected missing to be marked not found, got %+v", r)
+	}
+	if r := resp.Results[2]; r.Key != "a" || !r.Found || string(r.Value) != "1" {
+		t.Errorf("Expected a=1, got %+v", r)
+	}
+}
+
+func TestHandleMGet_Invalid(t *testing.T) {
+	kvStore := store.NewStore()
+	server := NewServer(kvStore, &mockRaftNode{isLeader: true, store: kvStore})
+
+	tooMany := `{"keys":["k"` + strings.Repeat(`,"k"`, maxMGetKeys) + `]}`
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"not JSON", "keys"},
+		{"no keys", `{"keys":[]}`},
+		{"empty key", `{"keys":["a",""]}`},
+		{"too many keys", tooMany},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			server.HandleMGet(w, httptest.NewRequest("POST", "/kv/_mget", strings.NewReader(tt.body)))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	server.HandleMGet(w, httptest.NewRequest("GET", "/kv/_mget", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	huge := fmt.Sprintf(`{"keys":["%s"]}`, strings.Repeat("k", maxMGetBody))
+	server.HandleMGet(w, httptest.NewRequest("POST", "/kv/_mget", strings.NewReader(huge)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
+
+func TestHandleNamespace_MGet(t *testing.T) {
+	kvStore := store.NewStore()
+	server := NewServer(kvStore, &mockRaftNode{isLeader: true, store: kvStore})
+	createTestNamespace(t, server, `{"name":"team-a","tokens":["a"]}`)
+	kvStore.Put("shared", []byte("default"))
+
+	if w := namespaceRequest(server, "PUT", "/ns/team-a/kv/shared", "a", "tenant"); w.Code != http.StatusNoContent {
+		t.Fatalf("PUT failed with status %d", w.Code)
+	}
+
+	w := namespaceRequest(server, "POST", "/ns/team-a/kv/_mget", "a", `{"keys":["shared","other"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var resp MGetResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Results) != 2 || string(resp.Results[0].Value) != "tenant" || resp.Results[1].Found {
+		t.Errorf("Expected the tenant's value and a missing key, got %+v", resp.Results)
+	}
+
+	if w := namespaceRequest(server, "POST", "/ns/team-a/kv/_mget", "", `{"keys":["shared"]}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without a token, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
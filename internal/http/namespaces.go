@@ -0,0 +1,212 @@
+package http
+
+import (
+	"distributed_cloud_service/internal/auth"
+	"distributed_cloud_service/internal/cluster"
+	"distributed_cloud_service/internal/raft"
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// NamespaceInfo describes a namespace in admin and stats responses
+type NamespaceInfo struct {
+	Name   string               `json:"name"`
+	Limits cluster.LimitsConfig `json:"limits"`
+	Usage  store.Usage          `json:"usage"`
+	Tokens int                  `json:"tokens"`
+}
+
+// CreateNamespaceRequest is the body of POST /admin/namespaces
+type CreateNamespaceRequest struct {
+	Name   string               `json:"name"`
+	Tokens []string             `json:"tokens,omitempty"` // Generated when empty
+	Limits cluster.LimitsConfig `json:"limits"`
+}
+
+// CreateNamespaceResponse returns the generated token, which is not stored in clear
+type CreateNamespaceResponse struct {
+	NamespaceInfo
+	Token string `json:"token,omitempty"`
+}
+
+func (s *Server) namespaceInfo(ns store.Namespace) NamespaceInfo {
+	return NamespaceInfo{
+		Name:   ns.Name,
+		Limits: ns.Limits,
+		Usage:  s.store.Usage(ns.Name),
+		Tokens: len(ns.TokenHashes),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// authorizeNamespace accepts a bearer token issued for the namespace, which it records
+// as the caller's identity, or an admin the cluster auth middleware authenticated. Under
+// RBAC or JWTs, or with credentials the middleware left to the handlers, any other caller
+// is let through, to be checked against its permissions on each key.
+func (s *Server) authorizeNamespace(r *http.Request, ns store.Namespace) (*http.Request, bool) {
+	if token, ok := auth.BearerToken(r); ok && auth.MatchTokenHash(token, ns.TokenHashes) {
+		id := auth.Identity{Name: ns.Name, Method: auth.MethodNamespaceToken}
+		return r.WithContext(auth.WithIdentity(r.Context(), id)), true
+	}
+	if s.enforcing() || auth.Delegated(r.Context()) {
+		return r, true
+	}
+	id, ok := auth.IdentityFromContext(r.Context())
+	return r, ok && id.Access == auth.AccessAdmin
+}
+
+// HandleNamespace handles /ns/{tenant}/kv/{key} (GET, HEAD, PUT, PATCH, DELETE),
+// POST /ns/{tenant}/kv/{key}/incr and /decr, POST /ns/{tenant}/kv/_mget and
+// GET /ns/{tenant}/stats.
+// Requests are authenticated with the namespace's own tokens.
+func (s *Server) HandleNamespace(w http.ResponseWriter, r *http.Request) {
+	name, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/ns/"), "/")
+	ns, ok := s.store.Namespace(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, CodeNamespaceNotFound, "Namespace not found")
+		return
+	}
+	r, ok = s.authorizeNamespace(r, ns)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "Invalid namespace token")
+		return
+	}
+
+	if rest == "stats" {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if !s.authorize(w, r, ns.Name, auth.AccessRead, "") {
+			return
+		}
+		writeJSON(w, http.StatusOK, s.namespaceInfo(ns))
+		return
+	}
+
+	key, ok := strings.CutPrefix(rest, "kv/")
+	if !ok {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Not found")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.getKey(w, r, ns.Name, key)
+	case http.MethodHead:
+		s.headKey(w, r, ns.Name, key)
+	case http.MethodPut:
+		s.putKey(w, r, ns.Name, key)
+	case http.MethodDelete:
+		s.deleteKey(w, r, ns.Name, key)
+	case http.MethodPatch:
+		s.patchKey(w, r, ns.Name, key)
+	case http.MethodPost:
+		if key == mgetKey {
+			s.mgetKeys(w, r, ns.Name)
+			return
+		}
+		counterKey, op, ok := counterOp(key)
+		if !ok {
+			writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+			return
+		}
+		s.countKey(w, r, ns.Name, counterKey, op)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// HandleNamespaces handles the namespace admin API:
+// GET/POST /admin/namespaces and GET/DELETE /admin/namespaces/{name}
+func (s *Server) HandleNamespaces(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/namespaces"), "/")
+
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		list := []NamespaceInfo{}
+		for _, ns := range s.store.Namespaces() {
+			list = append(list, s.namespaceInfo(ns))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"namespaces": list})
+	case name == "" && r.Method == http.MethodPost:
+		s.createNamespace(w, r)
+	case name != "" && r.Method == http.MethodGet:
+		ns, ok := s.store.Namespace(name)
+		if !ok {
+			writeError(w, http.StatusNotFound, CodeNamespaceNotFound, "Namespace not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, s.namespaceInfo(ns))
+	case name != "" && r.Method == http.MethodDelete:
+		if !s.requireLeader(w) {
+			return
+		}
+		if err := s.raft.Apply(raft.KVCommand{Op: "ns_delete", Key: name}); err != nil {
+			writeApplyError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// createNamespace registers a namespace through Raft. Only token hashes are replicated.
+func (s *Server) createNamespace(w http.ResponseWriter, r *http.Request) {
+	if !s.requireLeader(w) {
+		return
+	}
+
+	var req CreateNamespaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if err := store.ValidateNamespaceName(req.Name); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	if err := req.Limits.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	var resp CreateNamespaceResponse
+	tokens := req.Tokens
+	if len(tokens) == 0 {
+		token, err := auth.GenerateToken()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to generate token")
+			return
+		}
+		tokens = []string{token}
+		resp.Token = token
+	}
+
+	ns := store.Namespace{Name: req.Name, Limits: req.Limits}
+	for _, token := range tokens {
+		ns.TokenHashes = append(ns.TokenHashes, auth.HashToken(token))
+	}
+	data, err := json.Marshal(ns)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to encode namespace")
+		return
+	}
+	if err := s.raft.Apply(raft.KVCommand{Op: "ns_create", Key: ns.Name, Value: data}); err != nil {
+		writeApplyError(w, err)
+		return
+	}
+
+	resp.NamespaceInfo = s.namespaceInfo(ns)
+	writeJSON(w, http.StatusCreated, resp)
+}
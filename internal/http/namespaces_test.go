@@ -0,0 +1,143 @@
+package http
+
+import (
+	"bytes"
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func createTestNamespace(t *testing.T, server *Server, body string) CreateNamespaceResponse {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/admin/namespaces", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	server.HandleNamespaces(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var resp CreateNamespaceResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp
+}
+
+func namespaceRequest(server *Server, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	server.HandleNamespace(w, req)
+	return w
+}
+
+func TestHandleNamespace_Isolation(t *testing.T) {
+	kvStore := store.NewStore()
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	teamA := createTestNamespace(t, server, `{"name":"team-a"}`)
+	if teamA.Token == "" {
+		t.Fatal("Expected a generated token")
+	}
+	createTestNamespace(t, server, `{"name":"team-b","tokens":["b-secret"]}`)
+
+	if w := namespaceRequest(server, "PUT", "/ns/team-a/kv/config", teamA.Token, "a-value"); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := namespaceRequest(server, "PUT", "/ns/team-b/kv/config", "b-secret", "b-value"); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+
+	// Same key, separate keyspaces
+	if w := namespaceRequest(server, "GET", "/ns/team-a/kv/config", teamA.Token, ""); w.Body.String() != "a-value" {
+		t.Errorf("Expected 'a-value', got %q", w.Body.String())
+	}
+	if _, ok := kvStore.Get("config"); ok {
+		t.Error("Namespaced key leaked into the default namespace")
+	}
+
+	// One tenant's token doesn't open another tenant's namespace
+	if w := namespaceRequest(server, "GET", "/ns/team-b/kv/config", teamA.Token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := namespaceRequest(server, "GET", "/ns/team-a/kv/config", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without a token, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := namespaceRequest(server, "GET", "/ns/missing/kv/config", "b-secret", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown namespace, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w := namespaceRequest(server, "GET", "/ns/team-b/stats", "b-secret", "")
+	var stats NamespaceInfo
+	json.NewDecoder(w.Body).Decode(&stats)
+	if stats.Name != "team-b" || stats.Usage.Keys != 1 || stats.Tokens != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestHandleNamespace_Limits(t *testing.T) {
+	kvStore := store.NewStore()
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+	createTestNamespace(t, server, `{"name":"small","tokens":["t"],"limits":{"max_keys":1}}`)
+
+	if w := namespaceRequest(server, "PUT", "/ns/small/kv/one", "t", "1"); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if w := namespaceRequest(server, "PUT", "/ns/small/kv/two", "t", "2"); w.Code != http.StatusInsufficientStorage {
+		t.Errorf("Expected status %d, got %d", http.StatusInsufficientStorage, w.Code)
+	}
+	// The default namespace is not affected by the tenant's quota
+	server.HandlePut(httptest.NewRecorder(), httptest.NewRequest("PUT", "/kv/two", bytes.NewBufferString("2")))
+	if _, ok := kvStore.Get("two"); !ok {
+		t.Error("Default namespace write was rejected by a namespace quota")
+	}
+}
+
+func TestHandleNamespaces_Admin(t *testing.T) {
+	kvStore := store.NewStore()
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+	createTestNamespace(t, server, `{"name":"team-a","tokens":["a"]}`)
+	namespaceRequest(server, "PUT", "/ns/team-a/kv/key", "a", "value")
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"POST", "/admin/namespaces", `{"name":"team-a"}`, http.StatusConflict},
+		{"POST", "/admin/namespaces", `{"name":"_system"}`, http.StatusBadRequest},
+		{"GET", "/admin/namespaces", "", http.StatusOK},
+		{"GET", "/admin/namespaces/team-a", "", http.StatusOK},
+		{"DELETE", "/admin/namespaces/team-a", "", http.StatusNoContent},
+		{"GET", "/admin/namespaces/team-a", "", http.StatusNotFound},
+		{"DELETE", "/admin/namespaces/team-a", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+		w := httptest.NewRecorder()
+		server.HandleNamespaces(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+
+	// Deleting a namespace removes its keys
+	if kvStore.Usage("team-a").Keys != 0 {
+		t.Errorf("Expected no keys left in deleted namespace, got %d", kvStore.Usage("team-a").Keys)
+	}
+
+	mockRaft.isLeader = false
+	req := httptest.NewRequest("POST", "/admin/namespaces", bytes.NewBufferString(`{"name":"team-c"}`))
+	w := httptest.NewRecorder()
+	server.HandleNamespaces(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d on a follower, got %d", http.StatusBadRequest, w.Code)
+	}
+}
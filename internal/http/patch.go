@@ -0,0 +1,122 @@
+package http
+
+import (
+	"distributed_cloud_service/internal/auth"
+	"distributed_cloud_service/internal/jsondoc"
+	"distributed_cloud_service/internal/raft"
+	"distributed_cloud_service/internal/store"
+	"errors"
+	"mime"
+	"net/http"
+)
+
+// Media types of the supported patch formats
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// HandlePatch handles PATCH /kv/{key} requests. The body is an RFC 7386 merge patch or an
+// RFC 6902 JSON Patch, chosen by Content-Type, and is applied atomically by the FSM.
+func (s *Server) HandlePatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	s.patchKey(w, r, store.DefaultNamespace, r.URL.Path[len("/kv/"):])
+}
+
+// patchKey applies the JSON patch in the request body to key in namespace ns
+func (s *Server) patchKey(w http.ResponseWriter, r *http.Request, ns, key string) {
+	if !s.authorize(w, r, ns, auth.AccessWrite, key) {
+		return
+	}
+	if !s.requireLeader(w) {
+		return
+	}
+
+	if key == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Key is required")
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var format string
+	switch mediaType {
+	case mergePatchType:
+		format = jsondoc.MergePatch
+	case jsonPatchType:
+		format = jsondoc.JSONPatch
+	default:
+		w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+		writeError(w, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Content-Type must be "+mergePatchType+" or "+jsonPatchType)
+		return
+	}
+
+	patch, ok := s.readValue(w, r, key)
+	if !ok {
+		return
+	}
+	if err := jsondoc.ValidatePatch(format, patch); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	// Check if key exists first (read from store is okay)
+	if _, ok := s.store.GetIn(ns, key); !ok {
+		writeError(w, http.StatusNotFound, CodeKeyNotFound, "Key not found")
+		return
+	}
+
+	cmd := raft.KVCommand{
+		Op:        "patch",
+		Namespace: ns,
+		Key:       key,
+		Patch:     format,
+		Value:     patch,
+	}
+
+	if err := s.raft.Apply(cmd); err != nil {
+		writePatchError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writePatchError answers a patch rejected by the FSM: 404 for a missing key, 409 when
+// the value isn't JSON or the patch doesn't apply to it
+func writePatchError(w http.ResponseWriter, err error) {
+	switch {
+	case writeQuotaError(w, err):
+	case errors.Is(err, raft.ErrKeyNotFound):
+		writeError(w, http.StatusNotFound, CodeKeyNotFound, "Key not found")
+	case errors.Is(err, jsondoc.ErrNotJSON):
+		writeError(w, http.StatusConflict, CodeNotJSON, "Value is not valid JSON")
+	case errors.Is(err, jsondoc.ErrPatchConflict):
+		writeError(w, http.StatusConflict, CodePatchConflict, err.Error())
+	case errors.Is(err, jsondoc.ErrInvalidPatch):
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	default:
+		writeApplyError(w, err)
+	}
+}
+
+// queryPath returns the part of a JSON value selected by a JSONPath expression.
+// It answers the request and returns false if the path can't be read.
+func queryPath(w http.ResponseWriter, val []byte, path string) ([]byte, bool) {
+	result, err := jsondoc.Query(val, path)
+	switch {
+	case err == nil:
+		return result, true
+	case errors.Is(err, jsondoc.ErrInvalidPath):
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	case errors.Is(err, jsondoc.ErrPathNotFound):
+		writeError(w, http.StatusNotFound, CodePathNotFound, "Path not found")
+	case errors.Is(err, jsondoc.ErrNotJSON):
+		writeError(w, http.StatusConflict, CodeNotJSON, "Value is not valid JSON")
+	default:
+		writeError(w, http.StatusInternalServerError, CodeInternal, err.Error())
+	}
+	return nil, false
+}
@@ -0,0 +1,103 @@
+package http
+
+import (
+	"distributed_cloud_service/internal/store"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHandleGet_Path(t *testing.T) {
+	kvStore := store.NewStore()
+	kvStore.Put("doc", []byte(`{"a":{"b":[1,{"c":"x"}]}}`))
+	kvStore.Put("text", []byte("plain"))
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	tests := []struct {
+		key, path string
+		status    int
+		body      string
+	}{
+		{"doc", "$.a.b[1]", http.StatusOK, `{"c":"x"}`},
+		{"doc", "$.a.b[0]", http.StatusOK, `1`},
+		{"doc", "$.a.missing", http.StatusNotFound, ""},
+		{"doc", "a.b", http.StatusBadRequest, ""},
+		{"text", "$", http.StatusConflict, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		server.HandleGet(w, httptest.NewRequest("GET", "/kv/"+tt.key+"?path="+url.QueryEscape(tt.path), nil))
+		if w.Code != tt.status {
+			t.Errorf("GET %s?path=%s: expected status %d, got %d", tt.key, tt.path, tt.status, w.Code)
+			continue
+		}
+		if tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("GET %s?path=%s: expected body %s, got %s", tt.key, tt.path, tt.body, w.Body.String())
+		}
+		if tt.status == http.StatusOK && w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("Expected Content-Type application/json, got %q", w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestHandlePatch(t *testing.T) {
+	kvStore := store.NewStore()
+	kvStore.Put("doc", []byte(`{"a":1,"b":{"c":2}}`))
+	kvStore.Put("text", []byte("plain"))
+	mockRaft := &mockRaftNode{isLeader: true, store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	patch := func(key, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/kv/"+key, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		server.HandlePatch(w, req)
+		return w
+	}
+
+	if w := patch("doc", "application/merge-patch+json", `{"a":null,"b":{"d":3}}`); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if val, _ := kvStore.Get("doc"); string(val) != `{"b":{"c":2,"d":3}}` {
+		t.Errorf("Unexpected document after merge patch: %s", val)
+	}
+
+	w := patch("doc", "application/json-patch+json; charset=utf-8", `[{"op":"move","from":"/b/d","path":"/d"}]`)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if val, _ := kvStore.Get("doc"); string(val) != `{"b":{"c":2},"d":3}` {
+		t.Errorf("Unexpected document after JSON Patch: %s", val)
+	}
+
+	tests := []struct {
+		name, key, contentType, body string
+		status                       int
+	}{
+		{"failed test", "doc", "application/json-patch+json", `[{"op":"test","path":"/d","value":4}]`, http.StatusConflict},
+		{"missing path", "doc", "application/json-patch+json", `[{"op":"remove","path":"/x"}]`, http.StatusConflict},
+		{"value not JSON", "text", "application/merge-patch+json", `{"a":1}`, http.StatusConflict},
+		{"invalid patch", "doc", "application/json-patch+json", `[{"op":"jump","path":"/a"}]`, http.StatusBadRequest},
+		{"malformed merge patch", "doc", "application/merge-patch+json", `{"a":`, http.StatusBadRequest},
+		{"missing key", "nope", "application/merge-patch+json", `{}`, http.StatusNotFound},
+		{"plain JSON", "doc", "application/json", `{}`, http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		w := patch(tt.key, tt.contentType, tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.status, w.Code, w.Body.String())
+		}
+	}
+	if val, _ := kvStore.Get("doc"); string(val) != `{"b":{"c":2},"d":3}` {
+		t.Errorf("Expected rejected patches to change nothing, got %s", val)
+	}
+
+	// Followers don't accept patches
+	mockRaft.isLeader = false
+	if w := patch("doc", "application/merge-patch+json", `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d on a follower, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -1,15 +1,23 @@
-package http
-
-import (
-	"context"
-	"distributed_cloud_service/internal/raft"
-)
-
-// RaftNode defines the interface for Raft operations needed by HTTP handlers
-type RaftNode interface {
-	IsLeader() bool
-	Leader() string
-	Apply(cmd raft.KVCommand) error
-	VerifyRead(ctx context.Context) error
-}
-
+package http
+
+import (
+	"context"
+	"distributed_cloud_service/internal/raft"
+	"distributed_cloud_service/internal/store"
+	"io"
+)
+
+// RaftNode defines the interface for Raft operations needed by HTTP handlers
+type RaftNode interface {
+	IsLeader() bool
+	Leader() string
+	Apply(cmd raft.KVCommand) error
+	Propose(cmd raft.KVCommand) (interface{}, error)
+	VerifyRead(ctx context.Context) error
+	Events() *raft.EventBus
+	Backup() (raft.BackupInfo, store.Snapshot, error)
+	Restore(r io.Reader) (raft.BackupInfo, error)
+	StateHash(index uint64) (raft.StateHash, bool)
+	LastHashCheck() (raft.HashCheck, bool)
+}
+
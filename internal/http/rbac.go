@@ -0,0 +1,341 @@
+package http
+
+import (
+	"crypto/subtle"
+	"distributed_cloud_service/internal/auth"
+	"distributed_cloud_service/internal/cluster"
+	"distributed_cloud_service/internal/raft"
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// UserInfo describes a user in admin responses, without its token hashes
+type UserInfo struct {
+	Name   string   `json:"name"`
+	Roles  []string `json:"roles"`
+	Tokens int      `json:"tokens"`
+}
+
+// CreateUserRequest is the body of POST /admin/rbac/users
+type CreateUserRequest struct {
+	Name   string   `json:"name"`
+	Roles  []string `json:"roles"`
+	Tokens []string `json:"tokens,omitempty"` // Generated when empty
+}
+
+// CreateUserResponse returns the generated token, which is not stored in clear
+type CreateUserResponse struct {
+	UserInfo
+	Token string `json:"token,omitempty"`
+}
+
+// UpdateUserRequest is the body of PUT /admin/rbac/users/{name}
+type UpdateUserRequest struct {
+	Roles  []string `json:"roles"`
+	Tokens []string `json:"tokens,omitempty"` // Replace the user's tokens when set
+}
+
+// PutRoleRequest is the body of PUT /admin/rbac/roles/{name}
+type PutRoleRequest struct {
+	Permissions []auth.Permission `json:"permissions"`
+}
+
+// SetRBAC enables role-based access control with the given root credential
+func (s *Server) SetRBAC(cfg cluster.RBACConfig) {
+	s.rbac = cfg
+}
+
+// errNoCredentials is returned by permissions for requests without a known credential
+var errNoCredentials = errors.New("no credentials")
+
+// SetJWT accepts JWTs checked by v as bearer tokens, with the permissions their claims
+// map to. Like RBAC, it makes every request need a credential.
+func (s *Server) SetJWT(v *auth.JWTValidator) {
+	s.jwt = v
+}
+
+// enforcing reports whether requests are checked against the caller's permissions
+func (s *Server) enforcing() bool {
+	return s.rbac.Enabled || s.jwt != nil
+}
+
+// scopePermissions returns the permissions of a scoped token or identity: keys of the
+// default namespace for read and write, and everything for admin
+func scopePermissions(access string) []auth.Permission {
+	if access == auth.AccessAdmin {
+		return []auth.Permission{auth.Root}
+	}
+	return []auth.Permission{{Namespace: store.DefaultNamespace, Access: access}}
+}
+
+// permissions returns what the caller of r may do, from a namespace token, a scope the
+// auth middleware granted, the root token, a user's token, a JWT, or a client certificate
+// identity with a user of the same name. It fails with errNoCredentials if r carries none
+// of them, or with the reason a JWT was rejected.
+func (s *Server) permissions(r *http.Request) ([]auth.Permission, error) {
+	id, hasID := auth.IdentityFromContext(r.Context())
+	if hasID && id.Method == auth.MethodNamespaceToken {
+		return []auth.Permission{{Namespace: id.Name, Access: auth.AccessAdmin}}, nil
+	}
+	if hasID && id.Access != "" {
+		return scopePermissions(id.Access), nil
+	}
+	if token, ok := auth.BearerToken(r); ok {
+		if s.rbac.Enabled && s.rbac.RootToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.rbac.RootToken)) == 1 {
+			return []auth.Permission{auth.Root}, nil
+		}
+		if s.jwt != nil && auth.LooksLikeJWT(token) {
+			claims, err := s.jwt.Validate(token)
+			if err != nil {
+				return nil, err
+			}
+			return s.jwt.Permissions(claims), nil
+		}
+		if s.rbac.Enabled {
+			if user, ok := s.store.UserByTokenHash(auth.HashToken(token)); ok {
+				return s.store.Permissions(user), nil
+			}
+		}
+		return nil, errNoCredentials
+	}
+	if hasID && id.Method == auth.MethodCertificate && s.rbac.Enabled {
+		if user, ok := s.store.User(id.Name); ok {
+			return s.store.Permissions(user), nil
+		}
+	}
+	return nil, errNoCredentials
+}
+
+// authorize checks that the caller may perform access on each of keys in namespace ns,
+// and answers 401 or 403 if not. Without RBAC or JWTs it allows everything the auth
+// middleware authenticated, and checks the rest against namespace tokens and scopes.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, ns, access string, keys ...string) bool {
+	if !s.enforcing() && !auth.Delegated(r.Context()) {
+		return true
+	}
+	perms, err := s.permissions(r)
+	if errors.Is(err, errNoCredentials) {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "Valid credentials required")
+		return false
+	}
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "Invalid token: "+err.Error())
+		return false
+	}
+	for _, key := range keys {
+		if !auth.Allows(perms, ns, key, access) {
+			writeError(w, http.StatusForbidden, CodeForbidden, "Permission denied")
+			return false
+		}
+	}
+	return true
+}
+
+// authorizeAdmin checks that the caller may use the cluster admin API, which takes admin
+// access on every key of every namespace
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	return s.authorize(w, r, auth.AnyNamespace, auth.AccessAdmin, "")
+}
+
+func userInfo(u store.User) UserInfo {
+	roles := u.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	return UserInfo{Name: u.Name, Roles: roles, Tokens: len(u.TokenHashes)}
+}
+
+// HandleRBAC handles the RBAC admin API:
+// GET/POST /admin/rbac/users, GET/PUT/DELETE /admin/rbac/users/{name},
+// GET /admin/rbac/roles and GET/PUT/DELETE /admin/rbac/roles/{name}
+func (s *Server) HandleRBAC(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r) {
+		return
+	}
+	kind, name, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/rbac"), "/"), "/")
+
+	switch {
+	case kind == "users" && name == "" && r.Method == http.MethodGet:
+		list := []UserInfo{}
+		for _, u := range s.store.Users() {
+			list = append(list, userInfo(u))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"users": list})
+	case kind == "users" && name == "" && r.Method == http.MethodPost:
+		s.createUser(w, r)
+	case kind == "users" && name != "" && r.Method == http.MethodGet:
+		u, ok := s.store.User(name)
+		if !ok {
+			writeError(w, http.StatusNotFound, CodeUserNotFound, "User not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, userInfo(u))
+	case kind == "users" && name != "" && r.Method == http.MethodPut:
+		s.updateUser(w, r, name)
+	case kind == "users" && name != "" && r.Method == http.MethodDelete:
+		s.applyRBAC(w, raft.KVCommand{Op: "user_delete", Key: name})
+	case kind == "roles" && name == "" && r.Method == http.MethodGet:
+		list := s.store.Roles()
+		if list == nil {
+			list = []store.Role{}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"roles": list})
+	case kind == "roles" && name != "" && r.Method == http.MethodGet:
+		role, ok := s.store.Role(name)
+		if !ok {
+			writeError(w, http.StatusNotFound, CodeRoleNotFound, "Role not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, role)
+	case kind == "roles" && name != "" && r.Method == http.MethodPut:
+		s.putRole(w, r, name)
+	case kind == "roles" && name != "" && r.Method == http.MethodDelete:
+		s.applyRBAC(w, raft.KVCommand{Op: "role_delete", Key: name})
+	case kind == "users" || kind == "roles":
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+	default:
+		writeError(w, http.StatusNotFound, CodeNotFound, "Not found")
+	}
+}
+
+// applyRBAC proposes a command without a body and answers 204 once it is applied
+func (s *Server) applyRBAC(w http.ResponseWriter, cmd raft.KVCommand) {
+	if !s.requireLeader(w) {
+		return
+	}
+	if err := s.raft.Apply(cmd); err != nil {
+		writeApplyError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// putRole creates or replaces a role through Raft
+func (s *Server) putRole(w http.ResponseWriter, r *http.Request, name string) {
+	if !s.requireLeader(w) {
+		return
+	}
+	var req PutRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	role := store.Role{Name: name, Permissions: req.Permissions}
+	if role.Permissions == nil {
+		role.Permissions = []auth.Permission{}
+	}
+	if err := role.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	data, err := json.Marshal(role)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to encode role")
+		return
+	}
+	if err := s.raft.Apply(raft.KVCommand{Op: "role_put", Key: name, Value: data}); err != nil {
+		writeApplyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, role)
+}
+
+// createUser registers a user through Raft. Only token hashes are replicated.
+func (s *Server) createUser(w http.ResponseWriter, r *http.Request) {
+	if !s.requireLeader(w) {
+		return
+	}
+	var req CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if err := store.ValidateRBACName(req.Name); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	if err := validateUserTokens(req.Tokens); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	var resp CreateUserResponse
+	tokens := req.Tokens
+	if len(tokens) == 0 {
+		token, err := auth.GenerateToken()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to generate token")
+			return
+		}
+		tokens = []string{token}
+		resp.Token = token
+	}
+
+	user := store.User{Name: req.Name, Roles: req.Roles}
+	for _, token := range tokens {
+		user.TokenHashes = append(user.TokenHashes, auth.HashToken(token))
+	}
+	if !s.applyUser(w, "user_create", user) {
+		return
+	}
+	resp.UserInfo = userInfo(user)
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// updateUser replaces a user's roles, and its tokens if the request has any
+func (s *Server) updateUser(w http.ResponseWriter, r *http.Request, name string) {
+	if !s.requireLeader(w) {
+		return
+	}
+	var req UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if err := validateUserTokens(req.Tokens); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	user := store.User{Name: name, Roles: req.Roles}
+	for _, token := range req.Tokens {
+		user.TokenHashes = append(user.TokenHashes, auth.HashToken(token))
+	}
+	if !s.applyUser(w, "user_update", user) {
+		return
+	}
+	if u, ok := s.store.User(name); ok {
+		user = u
+	}
+	writeJSON(w, http.StatusOK, userInfo(user))
+}
+
+// validateUserTokens rejects empty tokens and ones that would be taken for JWTs
+func validateUserTokens(tokens []string) error {
+	for _, token := range tokens {
+		if token == "" {
+			return errors.New("tokens must not be empty")
+		}
+		if auth.LooksLikeJWT(token) {
+			return errors.New("tokens must not contain two '.', which is reserved for JWTs")
+		}
+	}
+	return nil
+}
+
+// applyUser proposes a user command, answering the error if it fails
+func (s *Server) applyUser(w http.ResponseWriter, op string, user store.User) bool {
+	data, err := json.Marshal(user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to encode user")
+		return false
+	}
+	if err := s.raft.Apply(raft.KVCommand{Op: op, Key: user.Name, Value: data}); err != nil {
+		writeApplyError(w, err)
+		return false
+	}
+	return true
+}
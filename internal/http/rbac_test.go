@@ -0,0 +1,336 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"distributed_cloud_service/internal/auth"
+	"distributed_cloud_service/internal/cluster"
+	"distributed_cloud_service/internal/store"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveAs sends a request with an optional bearer token to handler and returns the response
+func serveAs(handler http.HandlerFunc, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestRBAC(t *testing.T) {
+	kvStore := store.NewStore()
+	server := NewServer(kvStore, &mockRaftNode{isLeader: true, store: kvStore})
+	server.SetRBAC(cluster.RBACConfig{Enabled: true, RootToken: "root-secret"})
+
+	if w := serveAs(server.HandleGet, "GET", "/kv/app/config", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without credentials, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := serveAs(server.HandleGet, "GET", "/kv/app/config", "wrong", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an unknown token, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	// The root token sets up a role and a user
+	w := serveAs(server.HandleRBAC, "PUT", "/admin/rbac/roles/app-writer", "root-secret",
+		`{"permissions":[{"prefix":"app/","access":"write"},{"prefix":"shared/","access":"read"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Creating the role failed with status %d: %s", w.Code, w.Body.String())
+	}
+	w = serveAs(server.HandleRBAC, "POST", "/admin/rbac/users", "root-secret", `{"name":"svc","roles":["app-writer"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Creating the user failed with status %d: %s", w.Code, w.Body.String())
+	}
+	var created CreateUserResponse
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.Token == "" || created.Tokens != 1 || len(created.Roles) != 1 {
+		t.Fatalf("Unexpected user %+v", created)
+	}
+	token := created.Token
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		path    string
+		body    string
+		want    int
+	}{
+		{"write in prefix", server.HandlePut, "PUT", "/kv/app/config", "v", http.StatusNoContent},
+		{"read in prefix", server.HandleGet, "GET", "/kv/app/config", "", http.StatusOK},
+		{"write outside prefix", server.HandlePut, "PUT", "/kv/other", "v", http.StatusForbidden},
+		{"write to read-only prefix", server.HandlePut, "PUT", "/kv/shared/x", "v", http.StatusForbidden},
+		{"read read-only prefix", server.HandleGet, "GET", "/kv/shared/x", "", http.StatusNotFound},
+		{"counter outside prefix", server.HandleCounter, "POST", "/kv/hits/incr", "", http.StatusForbidden},
+		{"mget with one key outside", server.HandleMGet, "POST", "/kv/_mget", `{"keys":["app/config","other"]}`, http.StatusForbidden},
+		{"mget inside", server.HandleMGet, "POST", "/kv/_mget", `{"keys":["app/config","shared/x"]}`, http.StatusOK},
+		{"admin API", server.HandleNamespaces, "GET", "/admin/namespaces", "", http.StatusForbidden},
+		{"RBAC API", server.HandleRBAC, "GET", "/admin/rbac/users", "", http.StatusForbidden},
+		{"backup", server.HandleBackup, "GET", "/admin/backup", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serveAs(tt.handler, tt.method, tt.path, token, tt.body); w.Code != tt.want {
+				t.Errorf("Expected status %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	// Client certificate identities map to the user of the same name
+	req := httptest.NewRequest("GET", "/kv/app/config", nil)
+	req = req.WithContext(auth.WithIdentity(req.Context(), auth.Identity{Name: "svc", Method: auth.MethodCertificate}))
+	w = httptest.NewRecorder()
+	server.HandleGet(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the certificate identity to read, got %d", w.Code)
+	}
+
+	// Namespace tokens keep full access to their own namespace only
+	w = serveAs(server.HandleNamespaces, "POST", "/admin/namespaces", "root-secret", `{"name":"team-a"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Creating the namespace failed with status %d", w.Code)
+	}
+	var ns CreateNamespaceResponse
+	json.NewDecoder(w.Body).Decode(&ns)
+	if w := serveAs(server.HandleNamespace, "PUT", "/ns/team-a/kv/app/config", ns.Token, "v"); w.Code != http.StatusNoContent {
+		t.Errorf("Expected the namespace token to write, got %d", w.Code)
+	}
+	if w := serveAs(server.HandleNamespace, "PUT", "/ns/team-a/kv/app/config", token, "v"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a user without permissions on team-a to be forbidden, got %d", w.Code)
+	}
+	if w := serveAs(server.HandleNamespaces, "GET", "/admin/namespaces", ns.Token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the namespace token to be refused by the admin API, got %d", w.Code)
+	}
+
+	// Removing the role from the user takes effect on the next request
+	w = serveAs(server.HandleRBAC, "PUT", "/admin/rbac/users/svc", "root-secret", `{"roles":[]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Updating the user failed with status %d: %s", w.Code, w.Body.String())
+	}
+	if w := serveAs(server.HandleGet, "GET", "/kv/app/config", token, ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d after removing the role, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestHandleRBAC_Errors(t *testing.T) {
+	kvStore := store.NewStore()
+	server := NewServer(kvStore, &mockRaftNode{isLeader: true, store: kvStore})
+	server.SetRBAC(cluster.RBACConfig{Enabled: true, RootToken: "root-secret"})
+	serveAs(server.HandleRBAC, "PUT", "/admin/rbac/roles/reader", "root-secret", `{"permissions":[{"access":"read"}]}`)
+	serveAs(server.HandleRBAC, "POST", "/admin/rbac/users", "root-secret", `{"name":"svc","roles":["reader"],"tokens":["t"]}`)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"invalid access", "PUT", "/admin/rbac/roles/bad", `{"permissions":[{"access":"all"}]}`, http.StatusBadRequest},
+		{"unknown role", "POST", "/admin/rbac/users", `{"name":"bob","roles":["nope"]}`, http.StatusNotFound},
+		{"duplicate user", "POST", "/admin/rbac/users", `{"name":"svc"}`, http.StatusConflict},
+		{"token of another user", "POST", "/admin/rbac/users", `{"name":"bob","tokens":["t"]}`, http.StatusConflict},
+		{"token like a JWT", "POST", "/admin/rbac/users", `{"name":"bob","tokens":["a.b.c"]}`, http.StatusBadRequest},
+		{"empty token", "PUT", "/admin/rbac/users/svc", `{"roles":[],"tokens":[""]}`, http.StatusBadRequest},
+		{"role in use", "DELETE", "/admin/rbac/roles/reader", "", http.StatusConflict},
+		{"missing user", "GET", "/admin/rbac/users/bob", "", http.StatusNotFound},
+		{"update missing user", "PUT", "/admin/rbac/users/bob", `{"roles":[]}`, http.StatusNotFound},
+		{"bad method", "PATCH", "/admin/rbac/users", "", http.StatusMethodNotAllowed},
+		{"unknown kind", "GET", "/admin/rbac/groups", "", http.StatusNotFound},
+		{"delete user", "DELETE", "/admin/rbac/users/svc", "", http.StatusNoContent},
+		{"delete unused role", "DELETE", "/admin/rbac/roles/reader", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serveAs(server.HandleRBAC, tt.method, tt.path, "root-secret", tt.body); w.Code != tt.want {
+				t.Errorf("Expected status %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+// hs256Token signs claims with secret
+func hs256Token(secret []byte, claims map[string]interface{}) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	payload, _ := json.Marshal(claims)
+	signed := enc([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + enc(mac.Sum(nil))
+}
+
+func TestJWT(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	jwks := filepath.Join(t.TempDir(), "jwks.json")
+	os.WriteFile(jwks, []byte(`{"keys":[{"kty":"oct","k":"`+base64.RawURLEncoding.EncodeToString(secret)+`"}]}`), 0600)
+	validator, err := auth.NewJWTValidator(cluster.JWTConfig{
+		JWKSFile: jwks,
+		Audience: "kv",
+		Claims: []cluster.ClaimMapping{
+			{Claim: "scope", Value: "kv", Permissions: []cluster.PermissionConfig{{Prefix: "users/{sub}/", Access: auth.AccessWrite}}},
+			{Claim: "groups", Value: "ops", Permissions: []cluster.PermissionConfig{{Namespace: auth.AnyNamespace, Access: auth.AccessAdmin}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewJWTValidator() failed: %v", err)
+	}
+
+	kvStore := store.NewStore()
+	server := NewServer(kvStore, &mockRaftNode{isLeader: true, store: kvStore})
+	server.SetJWT(validator)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	alice := hs256Token(secret, map[string]interface{}{"sub": "alice", "aud": "kv", "scope": "openid kv", "exp": exp})
+	ops := hs256Token(secret, map[string]interface{}{"sub": "bob", "aud": "kv", "groups": []string{"ops"}, "exp": exp})
+	expired := hs256Token(secret, map[string]interface{}{"sub": "alice", "aud": "kv", "scope": "kv", "exp": time.Now().Add(-time.Hour).Unix()})
+	forged := hs256Token([]byte("fedcba9876543210fedcba9876543210"), map[string]interface{}{"sub": "alice", "aud": "kv", "scope": "kv", "exp": exp})
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		path    string
+		token   string
+		want    int
+	}{
+		{"no token", server.HandleGet, "GET", "/kv/users/alice/x", "", http.StatusUnauthorized},
+		{"own prefix", server.HandlePut, "PUT", "/kv/users/alice/x", alice, http.StatusNoContent},
+		{"other prefix", server.HandlePut, "PUT", "/kv/users/bob/x", alice, http.StatusForbidden},
+		{"admin API without admin", server.HandleNamespaces, "GET", "/admin/namespaces", alice, http.StatusForbidden},
+		{"admin API", server.HandleNamespaces, "GET", "/admin/namespaces", ops, http.StatusOK},
+		{"expired", server.HandleGet, "GET", "/kv/users/alice/x", expired, http.StatusUnauthorized},
+		{"forged", server.HandleGet, "GET", "/kv/users/alice/x", forged, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serveAs(tt.handler, tt.method, tt.path, tt.token, "v"); w.Code != tt.want {
+				t.Errorf("Expected status %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	w := serveAs(server.HandleGet, "GET", "/kv/users/alice/x", expired, "")
+	if !strings.Contains(w.Body.String(), auth.ErrTokenExpired.Error()) {
+		t.Errorf("Expected the rejection reason in the response, got %q", w.Body.String())
+	}
+}
+
+func TestAuthMiddleware_Handlers(t *testing.T) {
+	kvStore := store.NewStore()
+	server := NewServer(kvStore, &mockRaftNode{isLeader: true, store: kvStore})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/", server.HandleV1)
+	mux.HandleFunc("/ns/", server.HandleNamespace)
+	mux.HandleFunc("/raft/status", func(w http.ResponseWriter, r *http.Request) {})
+	handler := auth.NewMiddleware(auth.Options{
+		Scopes:     map[string]string{"reader": auth.AccessRead, "ops": auth.AccessAdmin},
+		WriteError: WriteAuthError,
+	})(mux).ServeHTTP
+
+	w := serveAs(handler, "POST", "/v1/admin/namespaces", "ops", `{"name":"team-a"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Creating the namespace failed with status %d: %s", w.Code, w.Body.String())
+	}
+	var ns CreateNamespaceResponse
+	json.NewDecoder(w.Body).Decode(&ns)
+
+	type step struct {
+		method, path, token, body string
+		want                      int
+	}
+	run := func(steps []step) {
+		t.Helper()
+		for _, s := range steps {
+			w := serveAs(handler, s.method, s.path, s.token, s.body)
+			if w.Code != s.want {
+				t.Errorf("%s %s with %q: expected status %d, got %d: %s", s.method, s.path, s.token, s.want, w.Code, w.Body.String())
+			}
+		}
+	}
+	tenant := ns.Token
+
+	run([]step{
+		{"GET", "/v1/kv/app/x", "reader", "", http.StatusNotFound},
+		{"PUT", "/v1/kv/app/x", "ops", "v", http.StatusNoContent},
+		{"PUT", "/v1/ns/team-a/kv/k", tenant, "v", http.StatusNoContent},
+		{"GET", "/ns/team-a/kv/k", tenant, "", http.StatusOK},
+		{"GET", "/ns/team-a/kv/k", "ops", "", http.StatusOK},
+		// Only admin scopes reach tenant namespaces, and namespace tokens nothing else
+		{"GET", "/ns/team-a/kv/k", "reader", "", http.StatusUnauthorized},
+		{"GET", "/v1/kv/app/x", tenant, "", http.StatusUnauthorized},
+		{"GET", "/raft/status", tenant, "", http.StatusUnauthorized},
+		{"GET", "/raft/status", "reader", "", http.StatusOK},
+	})
+
+	// The middleware's errors use the /v1 envelope there, and plain text elsewhere
+	w = serveAs(handler, "PUT", "/v1/kv/app/x", "reader", "v")
+	var resp ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusForbidden || resp.Error.Code != CodeForbidden {
+		t.Errorf("Expected a %s error envelope, got %d: %+v, %v", CodeForbidden, w.Code, resp, err)
+	}
+	w = serveAs(handler, "GET", "/v1/kv/app/x", "wrong", "")
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusUnauthorized || resp.Error.Code != CodeUnauthorized {
+		t.Errorf("Expected a %s error envelope, got %d: %+v, %v", CodeUnauthorized, w.Code, resp, err)
+	}
+	if w = serveAs(handler, "GET", "/raft/status", "wrong", ""); w.Header().Get("Content-Type") == "application/json" {
+		t.Error("Expected a plain text error outside /v1")
+	}
+
+	// Under RBAC, scoped tokens keep their scope next to users and the root token
+	server.SetRBAC(cluster.RBACConfig{Enabled: true, RootToken: "root-secret"})
+	run([]step{
+		{"PUT", "/v1/admin/rbac/roles/app", "root-secret", `{"permissions":[{"prefix":"app/","access":"write"}]}`, http.StatusOK},
+		{"POST", "/v1/admin/rbac/users", "ops", `{"name":"svc","roles":["app"],"tokens":["svc-token"]}`, http.StatusCreated},
+		{"GET", "/v1/admin/namespaces", "ops", "", http.StatusOK},
+		{"GET", "/v1/kv/app/x", "reader", "", http.StatusOK},
+		{"GET", "/ns/team-a/kv/k", "reader", "", http.StatusForbidden},
+		{"PUT", "/v1/kv/app/y", "svc-token", "v", http.StatusNoContent},
+		{"PUT", "/v1/kv/other", "svc-token", "v", http.StatusForbidden},
+		{"GET", "/raft/status", "svc-token", "", http.StatusUnauthorized},
+		{"GET", "/ns/team-a/kv/k", tenant, "", http.StatusOK},
+	})
+}
+
+func TestAuthMiddleware_SharedTokenNamespaces(t *testing.T) {
+	kvStore := store.NewStore()
+	server := NewServer(kvStore, &mockRaftNode{isLeader: true, store: kvStore})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/", server.HandleV1)
+	mux.HandleFunc("/ns/", server.HandleNamespace)
+	mux.HandleFunc("/raft/status", func(w http.ResponseWriter, r *http.Request) {})
+	handler := auth.NewMiddleware(auth.Options{Token: "secret", WriteError: WriteAuthError})(mux).ServeHTTP
+
+	w := serveAs(handler, "POST", "/v1/admin/namespaces", "secret", `{"name":"team-a"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Creating the namespace failed with status %d: %s", w.Code, w.Body.String())
+	}
+	var ns CreateNamespaceResponse
+	json.NewDecoder(w.Body).Decode(&ns)
+
+	tests := []struct {
+		method, path, token, body string
+		want                      int
+	}{
+		// Namespace tokens work next to the shared token, and only in their namespace
+		{"PUT", "/ns/team-a/kv/k", ns.Token, "v", http.StatusNoContent},
+		{"GET", "/v1/ns/team-a/kv/k", ns.Token, "", http.StatusOK},
+		{"GET", "/ns/team-a/kv/k", "secret", "", http.StatusOK},
+		{"GET", "/ns/team-a/kv/k", "wrong", "", http.StatusUnauthorized},
+		{"GET", "/v1/kv/k", ns.Token, "", http.StatusUnauthorized},
+		{"GET", "/raft/status", ns.Token, "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if w := serveAs(handler, tt.method, tt.path, tt.token, tt.body); w.Code != tt.want {
+			t.Errorf("%s %s with %q: expected status %d, got %d: %s", tt.method, tt.path, tt.token, tt.want, w.Code, w.Body.String())
+		}
+	}
+}
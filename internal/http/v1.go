@@ -0,0 +1,155 @@
+package http
+
+import (
+	"distributed_cloud_service/internal/store"
+	_ "embed"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// APIPrefix is the root of the versioned API
+const APIPrefix = "/v1"
+
+// openAPISpec describes the /v1 API
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// ValueResponse is a value with its metadata, returned by GET /v1/kv/{key} to clients
+// that prefer application/json over the value's own content type
+type ValueResponse struct {
+	Key   string     `json:"key"`
+	Value []byte     `json:"value"` // base64 in JSON
+	Meta  store.Meta `json:"meta"`
+}
+
+// HandleV1 serves the versioned API under /v1: the key-value, namespace and admin routes
+// of the unversioned API, with every error answered as a JSON ErrorResponse, plus
+// GET /v1/openapi.json
+func (s *Server) HandleV1(w http.ResponseWriter, r *http.Request) {
+	w = &v1Writer{ResponseWriter: w}
+	path, ok := strings.CutPrefix(r.URL.Path, APIPrefix)
+	if !ok || path == "" {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Not found")
+		return
+	}
+
+	// The handlers parse the unversioned path
+	r2 := new(http.Request)
+	*r2 = *r
+	u := *r.URL
+	u.Path, u.RawPath = path, ""
+	r2.URL = &u
+	r = r2
+
+	switch {
+	case path == "/openapi.json":
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPISpec)
+	case strings.HasPrefix(path, "/kv/"):
+		s.handleKV(w, r)
+	case strings.HasPrefix(path, "/ns/"):
+		s.HandleNamespace(w, r)
+	case path == "/admin/namespaces" || strings.HasPrefix(path, "/admin/namespaces/"):
+		s.HandleNamespaces(w, r)
+	case path == "/admin/rbac" || strings.HasPrefix(path, "/admin/rbac/"):
+		s.HandleRBAC(w, r)
+	case path == "/admin/backup":
+		s.HandleBackup(w, r)
+	case path == "/admin/restore":
+		s.HandleRestore(w, r)
+	case path == "/admin/export":
+		s.HandleExport(w, r)
+	case path == "/admin/import":
+		s.HandleImport(w, r)
+	case path == "/admin/hash":
+		s.HandleHash(w, r)
+	case path == "/raft/events":
+		s.HandleRaftEvents(w, r)
+	default:
+		writeError(w, http.StatusNotFound, CodeNotFound, "Not found")
+	}
+}
+
+// handleKV dispatches /kv/{key} by method
+func (s *Server) handleKV(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.HandleGet(w, r)
+	case http.MethodPut:
+		s.HandlePut(w, r)
+	case http.MethodDelete:
+		s.HandleDelete(w, r)
+	case http.MethodPatch:
+		s.HandlePatch(w, r)
+	case http.MethodPost:
+		if r.URL.Path == "/kv/"+mgetKey {
+			s.HandleMGet(w, r)
+			return
+		}
+		s.HandleCounter(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// negotiateValue decides how a /v1 GET returns a value with the given content type: as
+// is, or wrapped in a ValueResponse when the Accept header prefers application/json.
+// It returns false if Accept allows neither. No Accept header means the value as is.
+func negotiateValue(accept, contentType string) (envelope, ok bool) {
+	if accept == "" {
+		return false, true
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	rawQ := acceptQuality(accept, contentType)
+	jsonQ := acceptQuality(accept, "application/json")
+	if rawQ == 0 && jsonQ == 0 {
+		return false, false
+	}
+	// A value stored as JSON already satisfies application/json
+	return jsonQ > rawQ, true
+}
+
+// acceptQuality returns the q-value an Accept header gives mediaType, from the most
+// specific range that matches it, or 0 if none does
+func acceptQuality(accept, mediaType string) float64 {
+	typ, sub, _ := strings.Cut(mediaType, "/")
+	best, q := -1, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		rng, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		rangeType, rangeSub, _ := strings.Cut(rng, "/")
+		specificity := -1
+		switch {
+		case rangeType == typ && rangeSub == sub:
+			specificity = 2
+		case rangeType == typ && rangeSub == "*":
+			specificity = 1
+		case rangeType == "*" && rangeSub == "*":
+			specificity = 0
+		}
+		if specificity <= best {
+			continue
+		}
+		best, q = specificity, 1
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 {
+				q = 0
+			}
+		}
+	}
+	return q
+}
@@ -0,0 +1,167 @@
+package http
+
+import (
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// decodeError decodes a /v1 error envelope, failing the test if the body isn't one
+func decodeError(t *testing.T, w *httptest.ResponseRecorder) ErrorBody {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Expected a JSON error, got Content-Type %q: %s", ct, w.Body.String())
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode error: %v", err)
+	}
+	return resp.Error
+}
+
+func TestHandleV1_Errors(t *testing.T) {
+	kvStore := store.NewStore()
+	mockRaft := &mockRaftNode{isLeader: false, leader: "127.0.0.1:9001", store: kvStore}
+	server := NewServer(kvStore, mockRaft)
+
+	w := httptest.NewRecorder()
+	server.HandleV1(w, httptest.NewRequest("PUT", "/v1/kv/k", strings.NewReader("v")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	e := decodeError(t, w)
+	if e.Code != CodeNotLeader || e.Leader != "127.0.0.1:9001" || !e.Retryable || e.Message != "Not the leader" {
+		t.Errorf("Unexpected not-leader error %+v", e)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		code   string
+	}{
+		{"missing key", "GET", "/v1/kv/missing", http.StatusNotFound, CodeKeyNotFound},
+		{"missing namespace", "GET", "/v1/admin/namespaces/nope", http.StatusNotFound, CodeNamespaceNotFound},
+		{"bad method", "OPTIONS", "/v1/kv/k", http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+		{"unknown route", "GET", "/v1/nothing", http.StatusNotFound, CodeNotFound},
+		{"bare prefix", "GET", "/v1", http.StatusNotFound, CodeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			server.HandleV1(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, w.Code)
+			}
+			if e := decodeError(t, w); e.Code != tt.code || e.Retryable {
+				t.Errorf("Expected code %s, got %+v", tt.code, e)
+			}
+		})
+	}
+
+	// The unversioned routes keep their plain-text errors
+	w = httptest.NewRecorder()
+	server.HandleGet(w, httptest.NewRequest("GET", "/kv/missing", nil))
+	if w.Code != http.StatusNotFound || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected a plain-text 404, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+}
+
+func TestHandleV1_ValueNegotiation(t *testing.T) {
+	kvStore := store.NewStore()
+	server := NewServer(kvStore, &mockRaftNode{isLeader: true, store: kvStore})
+
+	for key, ct := range map[string]string{"bin": "", "doc": "application/json", "text": "text/plain; charset=utf-8"} {
+		req := httptest.NewRequest("PUT", "/v1/kv/"+key, strings.NewReader(`{"a":1}`))
+		if ct != "" {
+			req.Header.Set("Content-Type", ct)
+		}
+		w := httptest.NewRecorder()
+		server.HandleV1(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("PUT %s failed with status %d: %s", key, w.Code, w.Body.String())
+		}
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		accept   string
+		envelope bool
+		status   int
+	}{
+		{"no Accept", "bin", "", false, http.StatusOK},
+		{"JSON preferred", "bin", "application/json", true, http.StatusOK},
+		{"raw preferred", "bin", "application/octet-stream, application/json;q=0.5", false, http.StatusOK},
+		{"wildcard", "text", "*/*", false, http.StatusOK},
+		{"type wildcard", "text", "text/*", false, http.StatusOK},
+		{"JSON value stays raw", "doc", "application/json", false, http.StatusOK},
+		{"nothing acceptable", "text", "image/png", false, http.StatusNotAcceptable},
+		{"refused with q=0", "bin", "application/octet-stream;q=0", false, http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/kv/"+tt.key, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			server.HandleV1(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status == http.StatusNotAcceptable {
+				if e := decodeError(t, w); e.Code != CodeNotAcceptable {
+					t.Errorf("Expected code %s, got %+v", CodeNotAcceptable, e)
+				}
+				return
+			}
+			if w.Header().Get("Vary") != "Accept" {
+				t.Errorf("Expected Vary: Accept, got %q", w.Header().Get("Vary"))
+			}
+			if !tt.envelope {
+				if w.Body.String() != `{"a":1}` {
+					t.Errorf("Expected the raw value, got %q", w.Body.String())
+				}
+				return
+			}
+			var resp ValueResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode envelope: %v", err)
+			}
+			if resp.Key != tt.key || string(resp.Value) != `{"a":1}` || resp.Meta.Version != 1 || resp.Meta.Size != 7 {
+				t.Errorf("Unexpected envelope %+v", resp)
+			}
+		})
+	}
+}
+
+func TestHandleV1_OpenAPI(t *testing.T) {
+	kvStore := store.NewStore()
+	server := NewServer(kvStore, &mockRaftNode{isLeader: true, store: kvStore})
+
+	w := httptest.NewRecorder()
+	server.HandleV1(w, httptest.NewRequest("GET", "/v1/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var doc struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+		t.Fatalf("Failed to decode OpenAPI document: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("Expected OpenAPI 3, got %q", doc.OpenAPI)
+	}
+	for _, path := range []string{"/kv/{key}", "/kv/_mget", "/ns/{tenant}/kv/{key}", "/admin/namespaces", "/admin/backup", "/openapi.json"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("Expected the document to describe %s", path)
+		}
+	}
+}
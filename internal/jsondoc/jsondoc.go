@@ -0,0 +1,227 @@
+// Package jsondoc reads and patches JSON documents stored as values: JSONPath lookups,
+// RFC 7386 merge patches and RFC 6902 JSON Patches.
+package jsondoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNotJSON is returned when a stored value is not a valid JSON document
+	ErrNotJSON = errors.New("value is not valid JSON")
+	// ErrInvalidPath is returned for a JSONPath expression that can't be parsed
+	ErrInvalidPath = errors.New("invalid JSON path")
+	// ErrPathNotFound is returned when a path doesn't exist in the document
+	ErrPathNotFound = errors.New("path not found")
+)
+
+// decode parses a single JSON document, keeping numbers exact
+func decode(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after JSON document")
+	}
+	return v, nil
+}
+
+// encode serializes v without HTML escaping. Object keys come out sorted, so every
+// replica that patches the same document produces the same bytes.
+func encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Valid reports whether data is a single JSON document
+func Valid(data []byte) bool {
+	_, err := decode(data)
+	return err == nil
+}
+
+// Query returns the part of doc selected by a JSONPath expression, encoded as JSON.
+// Only plain paths are supported: $, .name, ['name'] and [index], where a negative
+// index counts from the end of an array.
+func Query(doc []byte, path string) ([]byte, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	v, err := decode(doc)
+	if err != nil {
+		return nil, ErrNotJSON
+	}
+	for _, step := range steps {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			if step.index != nil {
+				return nil, ErrPathNotFound
+			}
+			child, ok := node[step.name]
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+			v = child
+		case []interface{}:
+			if step.index == nil {
+				return nil, ErrPathNotFound
+			}
+			i := *step.index
+			if i < 0 {
+				i += len(node)
+			}
+			if i < 0 || i >= len(node) {
+				return nil, ErrPathNotFound
+			}
+			v = node[i]
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+	return encode(v)
+}
+
+// pathStep is one member name or array index of a JSONPath expression
+type pathStep struct {
+	name  string
+	index *int
+}
+
+func parsePath(path string) ([]pathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("%w: must start with $", ErrInvalidPath)
+	}
+	var steps []pathStep
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : 1+end]
+			if name == "" || name == "*" {
+				return nil, fmt.Errorf("%w: unsupported member %q", ErrInvalidPath, name)
+			}
+			steps = append(steps, pathStep{name: name})
+			rest = rest[1+end:]
+		case '[':
+			step, n, err := parseBracket(rest)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, step)
+			rest = rest[n:]
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidPath, rest[0])
+		}
+	}
+	return steps, nil
+}
+
+// parseBracket parses ['name'], ["name"] or [index] and returns how many bytes it used
+func parseBracket(s string) (pathStep, int, error) {
+	if len(s) > 1 && (s[1] == '\'' || s[1] == '"') {
+		quote := s[1]
+		var name strings.Builder
+		for i := 2; i < len(s); i++ {
+			switch c := s[i]; {
+			case c == '\\' && i+1 < len(s):
+				i++
+				name.WriteByte(s[i])
+			case c == quote:
+				if i+1 >= len(s) || s[i+1] != ']' {
+					return pathStep{}, 0, fmt.Errorf("%w: expected ] after %s", ErrInvalidPath, s[:i+1])
+				}
+				return pathStep{name: name.String()}, i + 2, nil
+			default:
+				name.WriteByte(c)
+			}
+		}
+		return pathStep{}, 0, fmt.Errorf("%w: unterminated string", ErrInvalidPath)
+	}
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return pathStep{}, 0, fmt.Errorf("%w: missing ]", ErrInvalidPath)
+	}
+	i, err := strconv.Atoi(s[1:end])
+	if err != nil {
+		return pathStep{}, 0, fmt.Errorf("%w: unsupported selector %q", ErrInvalidPath, s[:end+1])
+	}
+	return pathStep{index: &i}, end + 1, nil
+}
+
+// equal compares two decoded JSON values; numbers are compared by value, so 1 equals 1.0
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			w, ok := b[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, okX := new(big.Rat).SetString(a.String())
+		y, okY := new(big.Rat).SetString(b.String())
+		return okX && okY && x.Cmp(y) == 0
+	default:
+		return a == b
+	}
+}
+
+// deepCopy copies a decoded JSON value so it can be modified independently
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			m[k] = deepCopy(child)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, child := range v {
+			s[i] = deepCopy(child)
+		}
+		return s
+	default:
+		return v
+	}
+}
@@ -0,0 +1,62 @@
+package jsondoc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	doc := []byte(`{"a":{"b":[10,{"c":"<x>"}],"d e":true},"n":1.50}`)
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"$", `{"a":{"b":[10,{"c":"<x>"}],"d e":true},"n":1.50}`},
+		{"$.a.b", `[10,{"c":"<x>"}]`},
+		{"$.a.b[0]", `10`},
+		{"$.a.b[-1].c", `"<x>"`},
+		{"$['a']['d e']", `true`},
+		{`$["a"].b[1]`, `{"c":"<x>"}`},
+		{"$.n", `1.50`},
+	}
+	for _, tt := range tests {
+		got, err := Query(doc, tt.path)
+		if err != nil {
+			t.Errorf("Query(%q) failed: %v", tt.path, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("Query(%q): expected %s, got %s", tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestQuery_Errors(t *testing.T) {
+	doc := []byte(`{"a":{"b":[1,2]}}`)
+	tests := []struct {
+		path string
+		want error
+	}{
+		{"$.missing", ErrPathNotFound},
+		{"$.a.b[2]", ErrPathNotFound},
+		{"$.a.b.c", ErrPathNotFound},
+		{"$.a[0]", ErrPathNotFound},
+		{"a.b", ErrInvalidPath},
+		{"$.a.*", ErrInvalidPath},
+		{"$..b", ErrInvalidPath},
+		{"$['a'", ErrInvalidPath},
+		{"$[?(@.a)]", ErrInvalidPath},
+	}
+	for _, tt := range tests {
+		if _, err := Query(doc, tt.path); !errors.Is(err, tt.want) {
+			t.Errorf("Query(%q): expected %v, got %v", tt.path, tt.want, err)
+		}
+	}
+
+	if _, err := Query([]byte("not json"), "$"); !errors.Is(err, ErrNotJSON) {
+		t.Errorf("Expected ErrNotJSON, got %v", err)
+	}
+	if _, err := Query([]byte(`{} {}`), "$"); !errors.Is(err, ErrNotJSON) {
+		t.Errorf("Expected ErrNotJSON for two documents, got %v", err)
+	}
+}
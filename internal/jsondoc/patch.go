@@ -0,0 +1,369 @@
+package jsondoc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Patch formats, named after the media types a client sends them with
+const (
+	MergePatch = "merge" // RFC 7386, application/merge-patch+json
+	JSONPatch  = "json"  // RFC 6902, application/json-patch+json
+)
+
+var (
+	// ErrInvalidPatch is returned for a patch document that is malformed whatever it is applied to
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrPatchConflict is returned when a JSON Patch doesn't fit the document: a missing
+	// path, an index out of range or a failed "test" operation
+	ErrPatchConflict = errors.New("patch does not apply")
+)
+
+// Apply applies a patch of the given format to doc and returns the patched document.
+// Either every operation applies or doc is left as it was.
+func Apply(format string, doc, patch []byte) ([]byte, error) {
+	switch format {
+	case MergePatch:
+		return ApplyMergePatch(doc, patch)
+	case JSONPatch:
+		return ApplyJSONPatch(doc, patch)
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidPatch, format)
+	}
+}
+
+// ValidatePatch checks that patch is well formed without applying it
+func ValidatePatch(format string, patch []byte) error {
+	switch format {
+	case MergePatch:
+		if _, err := decode(patch); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		return nil
+	case JSONPatch:
+		_, err := parseOperations(patch)
+		return err
+	default:
+		return fmt.Errorf("%w: unknown format %q", ErrInvalidPatch, format)
+	}
+}
+
+// ApplyMergePatch applies an RFC 7386 merge patch: objects are merged recursively,
+// null removes a member and any other value replaces the target
+func ApplyMergePatch(doc, patch []byte) ([]byte, error) {
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	target, err := decode(doc)
+	if err != nil {
+		return nil, ErrNotJSON
+	}
+	return encode(mergePatch(target, p))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{}, len(p))
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// operation is one step of an RFC 6902 JSON Patch
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+
+	path, from []string
+	value      interface{}
+}
+
+func parseOperations(patch []byte) ([]operation, error) {
+	var ops []operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	for i := range ops {
+		op := &ops[i]
+		if op.Path == nil {
+			return nil, fmt.Errorf("%w: operation %d has no path", ErrInvalidPatch, i)
+		}
+		var err error
+		if op.path, err = parsePointer(*op.Path); err != nil {
+			return nil, err
+		}
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("%w: %s operation %d has no value", ErrInvalidPatch, op.Op, i)
+			}
+			if op.value, err = decode(op.Value); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+			}
+		case "move", "copy":
+			if op.From == nil {
+				return nil, fmt.Errorf("%w: %s operation %d has no from", ErrInvalidPatch, op.Op, i)
+			}
+			if op.from, err = parsePointer(*op.From); err != nil {
+				return nil, err
+			}
+			if op.Op == "move" && len(op.from) < len(op.path) && hasPrefix(op.path, op.from) {
+				return nil, fmt.Errorf("%w: cannot move %s into itself", ErrInvalidPatch, *op.From)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, op.Op)
+		}
+	}
+	return ops, nil
+}
+
+// ApplyJSONPatch applies an RFC 6902 JSON Patch, a list of add, remove, replace, move,
+// copy and test operations
+func ApplyJSONPatch(doc, patch []byte) ([]byte, error) {
+	ops, err := parseOperations(patch)
+	if err != nil {
+		return nil, err
+	}
+	target, err := decode(doc)
+	if err != nil {
+		return nil, ErrNotJSON
+	}
+	for _, op := range ops {
+		if target, err = applyOperation(target, op); err != nil {
+			return nil, err
+		}
+	}
+	return encode(target)
+}
+
+func applyOperation(doc interface{}, op operation) (interface{}, error) {
+	switch op.Op {
+	case "add":
+		return add(doc, op.path, op.value)
+	case "remove":
+		doc, _, err := remove(doc, op.path)
+		return doc, err
+	case "replace":
+		if _, err := get(doc, op.path); err != nil {
+			return nil, err
+		}
+		if len(op.path) == 0 {
+			return op.value, nil
+		}
+		return modify(doc, op.path, func(parent interface{}, token string) (interface{}, error) {
+			switch p := parent.(type) {
+			case map[string]interface{}:
+				p[token] = op.value
+			case []interface{}:
+				i, _ := arrayIndex(token, len(p), false)
+				p[i] = op.value
+			}
+			return parent, nil
+		})
+	case "move":
+		doc, v, err := remove(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, v)
+	case "copy":
+		v, err := get(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, deepCopy(v))
+	case "test":
+		v, err := get(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(v, op.value) {
+			return nil, fmt.Errorf("%w: test failed at %s", ErrPatchConflict, formatPointer(op.path))
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, op.Op)
+}
+
+// add inserts v at path: it sets an object member, or inserts into an array ("-" appends)
+func add(doc interface{}, path []string, v interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	return modify(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			p[token] = v
+			return p, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(p), true)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", err, formatPointer(path))
+			}
+			p = append(p, nil)
+			copy(p[i+1:], p[i:])
+			p[i] = v
+			return p, nil
+		}
+		return nil, fmt.Errorf("%w: %s is not a container", ErrPatchConflict, formatPointer(path[:len(path)-1]))
+	})
+}
+
+// remove deletes the value at path and returns the document and the removed value
+func remove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: cannot remove the whole document", ErrPatchConflict)
+	}
+	var removed interface{}
+	doc, err := modify(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			v, ok := p[token]
+			if !ok {
+				break
+			}
+			removed = v
+			delete(p, token)
+			return p, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(p), false)
+			if err != nil {
+				break
+			}
+			removed = p[i]
+			return append(p[:i], p[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrPathNotFound, formatPointer(path))
+	})
+	return doc, removed, conflict(err)
+}
+
+// get returns the value at path
+func get(doc interface{}, path []string) (interface{}, error) {
+	for i, token := range path {
+		child, ok := lookup(doc, token)
+		if !ok {
+			return nil, fmt.Errorf("%w: %w: %s", ErrPatchConflict, ErrPathNotFound, formatPointer(path[:i+1]))
+		}
+		doc = child
+	}
+	return doc, nil
+}
+
+// modify walks to the parent of the last token of path, calls fn with it and stores the
+// container fn returns back into the document, since arrays can be replaced when they grow
+func modify(doc interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+	child, ok := lookup(doc, path[0])
+	if !ok {
+		return nil, fmt.Errorf("%w: %w: %s", ErrPatchConflict, ErrPathNotFound, path[0])
+	}
+	child, err := modify(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	switch p := doc.(type) {
+	case map[string]interface{}:
+		p[path[0]] = child
+	case []interface{}:
+		i, _ := arrayIndex(path[0], len(p), false)
+		p[i] = child
+	}
+	return doc, nil
+}
+
+// lookup returns the member or array element named by a pointer token
+func lookup(doc interface{}, token string) (interface{}, bool) {
+	switch p := doc.(type) {
+	case map[string]interface{}:
+		v, ok := p[token]
+		return v, ok
+	case []interface{}:
+		i, err := arrayIndex(token, len(p), false)
+		if err != nil {
+			return nil, false
+		}
+		return p[i], true
+	}
+	return nil, false
+}
+
+// arrayIndex parses an array index token. Leading zeros are not allowed, and "-" (the
+// end of the array) and n itself are only valid when inserting.
+func arrayIndex(token string, n int, insert bool) (int, error) {
+	if insert && token == "-" {
+		return n, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrPatchConflict, token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i > n || (i == n && !insert) {
+		return 0, fmt.Errorf("%w: array index %s out of range", ErrPatchConflict, token)
+	}
+	return i, nil
+}
+
+// conflict marks a missing path as a conflict, leaving other errors alone
+func conflict(err error) error {
+	if err != nil && errors.Is(err, ErrPathNotFound) && !errors.Is(err, ErrPatchConflict) {
+		return fmt.Errorf("%w: %w", ErrPatchConflict, err)
+	}
+	return err
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped tokens
+func parsePointer(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if s[0] != '/' {
+		return nil, fmt.Errorf("%w: pointer %q must start with /", ErrInvalidPatch, s)
+	}
+	tokens := strings.Split(s[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func formatPointer(tokens []string) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		b.WriteByte('/')
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(t, "~", "~0"), "/", "~1"))
+	}
+	return b.String()
+}
+
+func hasPrefix(path, prefix []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package jsondoc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	// Examples from RFC 7386 appendix A
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		got, err := ApplyMergePatch([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("ApplyMergePatch(%s, %s) failed: %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("ApplyMergePatch(%s, %s): expected %s, got %s", tt.doc, tt.patch, tt.want, got)
+		}
+	}
+
+	if _, err := ApplyMergePatch([]byte("plain text"), []byte(`{"a":1}`)); !errors.Is(err, ErrNotJSON) {
+		t.Errorf("Expected ErrNotJSON, got %v", err)
+	}
+	if _, err := ApplyMergePatch([]byte(`{}`), []byte(`{"a":`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("Expected ErrInvalidPatch, got %v", err)
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	// Mostly examples from RFC 6902 appendix A
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc"]}]`, `{"foo":["bar",["abc"]]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"baz":"qux","foo":["a",2,"c"]}`,
+			`[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`},
+		{`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"copy","from":"/~1","path":"/x"}]`, `{"/":9,"x":9,"~1":10}`},
+		{`{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{`{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+		{`{"big":12345678901234567890}`, `[{"op":"add","path":"/x","value":1}]`, `{"big":12345678901234567890,"x":1}`},
+	}
+	for _, tt := range tests {
+		got, err := ApplyJSONPatch([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("ApplyJSONPatch(%s, %s) failed: %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("ApplyJSONPatch(%s, %s): expected %s, got %s", tt.doc, tt.patch, tt.want, got)
+		}
+	}
+}
+
+func TestApplyJSONPatch_Errors(t *testing.T) {
+	tests := []struct {
+		doc, patch string
+		want       error
+	}{
+		{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ErrPatchConflict},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ErrPatchConflict},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":1}]`, ErrPatchConflict},
+		{`{"foo":["bar"]}`, `[{"op":"remove","path":"/foo/01"}]`, ErrPatchConflict},
+		{`{"foo":"bar"}`, `[{"op":"remove","path":"/missing"}]`, ErrPatchConflict},
+		{`{"foo":"bar"}`, `[{"op":"replace","path":"/missing","value":1}]`, ErrPatchConflict},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux","op":"bogus"}]`, ErrInvalidPatch},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz"}]`, ErrInvalidPatch},
+		{`{"foo":"bar"}`, `[{"op":"move","path":"/baz"}]`, ErrInvalidPatch},
+		{`{"foo":"bar"}`, `[{"op":"remove","path":"foo"}]`, ErrInvalidPatch},
+		{`{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`, ErrInvalidPatch},
+		{`{"foo":"bar"}`, `{"op":"remove","path":"/foo"}`, ErrInvalidPatch},
+		{`not json`, `[]`, ErrNotJSON},
+	}
+	for _, tt := range tests {
+		if _, err := ApplyJSONPatch([]byte(tt.doc), []byte(tt.patch)); !errors.Is(err, tt.want) {
+			t.Errorf("ApplyJSONPatch(%s, %s): expected %v, got %v", tt.doc, tt.patch, tt.want, err)
+		}
+	}
+}
+
+func TestApply_Atomic(t *testing.T) {
+	doc := []byte(`{"a":1}`)
+	patch := []byte(`[{"op":"add","path":"/b","value":2},{"op":"test","path":"/a","value":5}]`)
+	if _, err := Apply(JSONPatch, doc, patch); !errors.Is(err, ErrPatchConflict) {
+		t.Fatalf("Expected ErrPatchConflict, got %v", err)
+	}
+	if string(doc) != `{"a":1}` {
+		t.Errorf("Expected the document to be left alone, got %s", doc)
+	}
+
+	if err := ValidatePatch(MergePatch, []byte(`{"a":null}`)); err != nil {
+		t.Errorf("ValidatePatch() rejected a valid merge patch: %v", err)
+	}
+	if err := ValidatePatch("xml", []byte(`<a/>`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("Expected ErrInvalidPatch for an unknown format, got %v", err)
+	}
+}
@@ -1,78 +1,193 @@
-package metrics
-
-import (
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
-)
-
-var (
-	// HTTP request metrics
-	HTTPRequestsTotal = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "http_requests_total",
-			Help: "Total number of HTTP requests",
-		},
-		[]string{"method", "endpoint", "status"},
-	)
-
-	HTTPRequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "HTTP request duration in seconds",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"method", "endpoint"},
-	)
-
-	// KV store metrics
-	KVPutOperations = promauto.NewCounter(
-		prometheus.CounterOpts{
-			Name: "kv_put_operations_total",
-			Help: "Total number of PUT operations",
-		},
-	)
-
-	KVGetOperations = promauto.NewCounter(
-		prometheus.CounterOpts{
-			Name: "kv_get_operations_total",
-			Help: "Total number of GET operations",
-		},
-	)
-
-	KVDeleteOperations = promauto.NewCounter(
-		prometheus.CounterOpts{
-			Name: "kv_delete_operations_total",
-			Help: "Total number of DELETE operations",
-		},
-	)
-
-	KVStoreSize = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "kv_store_size",
-			Help: "Current number of keys in the store",
-		},
-	)
-
-	// Raft metrics
-	RaftIsLeader = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "raft_is_leader",
-			Help: "1 if this node is the leader, 0 otherwise",
-		},
-	)
-
-	RaftAppliedIndex = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "raft_applied_index",
-			Help: "Last applied Raft log index",
-		},
-	)
-
-	RaftCommitIndex = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "raft_commit_index",
-			Help: "Last committed Raft log index",
-		},
-	)
-)
-
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// HTTP request metrics
+	HTTPRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total number of HTTP requests",
+		},
+		[]string{"method", "endpoint", "status"},
+	)
+
+	HTTPRequestDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request duration in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method", "endpoint"},
+	)
+
+	// KV store metrics
+	KVPutOperations = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kv_put_operations_total",
+			Help: "Total number of PUT operations",
+		},
+	)
+
+	KVGetOperations = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kv_get_operations_total",
+			Help: "Total number of GET operations",
+		},
+	)
+
+	KVDeleteOperations = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kv_delete_operations_total",
+			Help: "Total number of DELETE operations",
+		},
+	)
+
+	KVStoreSize = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "kv_store_size",
+			Help: "Current number of keys in the store",
+		},
+	)
+
+	KVStoreBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "kv_store_bytes",
+			Help: "Current total size of keys and values in the store",
+		},
+	)
+
+	KVNamespaceKeys = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kv_namespace_keys",
+			Help: "Current number of keys per namespace",
+		},
+		[]string{"namespace"},
+	)
+
+	KVNamespaceBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kv_namespace_bytes",
+			Help: "Current total size of keys and values per namespace",
+		},
+		[]string{"namespace"},
+	)
+
+	// Quota metrics
+	KVQuotaLimit = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kv_quota_limit",
+			Help: "Configured limit per resource (0 means unlimited)",
+		},
+		[]string{"resource"},
+	)
+
+	KVQuotaRejections = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kv_quota_rejections_total",
+			Help: "Total number of writes rejected by a limit, by resource and layer",
+		},
+		[]string{"resource", "layer"},
+	)
+
+	KVCompressionInputBytes = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kv_compression_input_bytes_total",
+			Help: "Total size of values at or above the compression threshold before compression",
+		},
+	)
+
+	KVCompressionOutputBytes = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kv_compression_output_bytes_total",
+			Help: "Total size of values at or above the compression threshold as stored",
+		},
+	)
+
+	KVCompressionRatio = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "kv_compression_ratio",
+			Help:    "Stored size divided by original size of values at or above the compression threshold",
+			Buckets: []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.7, 0.9, 1},
+		},
+	)
+
+	// RESP (Redis protocol) metrics
+	RedisConnections = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "redis_connections",
+			Help: "Number of open RESP client connections",
+		},
+	)
+
+	RedisCommandsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "redis_commands_total",
+			Help: "Total number of RESP commands received, by command",
+		},
+		[]string{"command"},
+	)
+
+	RedisRedirectsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "redis_redirects_total",
+			Help: "Total number of RESP writes answered with MOVED or READONLY on a follower",
+		},
+	)
+
+	RedisRejectedConnectionsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "redis_rejected_connections_total",
+			Help: "Total number of RESP connections refused because max_clients was reached",
+		},
+	)
+
+	// Raft metrics
+	RaftIsLeader = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "raft_is_leader",
+			Help: "1 if this node is the leader, 0 otherwise",
+		},
+	)
+
+	RaftAppliedIndex = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "raft_applied_index",
+			Help: "Last applied Raft log index",
+		},
+	)
+
+	RaftCommitIndex = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "raft_commit_index",
+			Help: "Last committed Raft log index",
+		},
+	)
+
+	RaftEventsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "raft_events_total",
+			Help: "Total number of Raft events observed, by type",
+		},
+		[]string{"type"},
+	)
+
+	RaftStateHashChecks = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "raft_state_hash_checks_total",
+			Help: "Total number of leader state hash comparisons, by result (match, mismatch, skipped)",
+		},
+		[]string{"result"},
+	)
+
+	RaftStateDiverged = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "raft_state_diverged",
+			Help: "1 if the last state hash comparison found this node's data differs from the leader's",
+		},
+	)
+)
+
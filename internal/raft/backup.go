@@ -0,0 +1,107 @@
+package raft
+
+import (
+	"distributed_cloud_service/internal/store"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+const (
+	// backupBarrierTimeout bounds the wait for committed entries to be applied before a backup
+	backupBarrierTimeout = 10 * time.Second
+
+	// restoreTimeout bounds installing a backup and replicating it to the followers
+	restoreTimeout = 5 * time.Minute
+)
+
+// ErrInvalidBackup is returned by Restore when the upload is not a snapshot this node can load
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// BackupInfo describes where and when a backup was taken
+type BackupInfo struct {
+	Index     uint64    `json:"index"` // last Raft index included in the backup
+	Term      uint64    `json:"term"`
+	NodeID    string    `json:"node_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Backup returns a view of the store once every entry committed so far has been
+// applied, so the view holds exactly the state at info.Index. It only succeeds
+// on the leader. The caller must release the view.
+func (n *Node) Backup() (BackupInfo, store.Snapshot, error) {
+	if err := n.raft.Barrier(backupBarrierTimeout).Error(); err != nil {
+		return BackupInfo{}, nil, err
+	}
+	view, err := n.fsm.store.Snapshot()
+	if err != nil {
+		return BackupInfo{}, nil, err
+	}
+	info := BackupInfo{
+		Index:     view.AppliedIndex(),
+		Term:      n.raft.CurrentTerm(),
+		NodeID:    n.id,
+		CreatedAt: time.Now().UTC(),
+	}
+	return info, view, nil
+}
+
+// WriteBackup streams a view in the snapshot format with info in the header
+func WriteBackup(w io.Writer, info BackupInfo, view store.Snapshot) error {
+	header := snapshotHeader{Version: snapshotVersion, Index: info.Index, Backup: &info}
+	return writeSnapshot(w, header, view)
+}
+
+// Restore replaces the state of the whole cluster with a backup written by WriteBackup.
+// The leader installs it and the followers receive it as a snapshot. The current
+// membership is kept, so a backup can be restored into a freshly bootstrapped cluster.
+func (n *Node) Restore(r io.Reader) (BackupInfo, error) {
+	if !n.IsLeader() {
+		return BackupInfo{}, raft.ErrNotLeader
+	}
+
+	// raft.Restore needs the exact size up front and panics if the FSM can't load
+	// the data, so the upload is spooled to disk and checked before it is installed
+	f, err := os.CreateTemp(n.dataDir, "restore-*.tmp")
+	if err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to create restore file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	size, err := io.Copy(f, r)
+	if err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to receive backup: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return BackupInfo{}, err
+	}
+	header, err := checkSnapshot(f)
+	if err != nil {
+		return BackupInfo{}, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return BackupInfo{}, err
+	}
+
+	info := BackupInfo{Index: header.Index}
+	if header.Backup != nil {
+		info = *header.Backup
+	}
+	meta := &raft.SnapshotMeta{
+		Version: raft.SnapshotVersionMax,
+		Index:   header.Index,
+		Term:    info.Term,
+		Size:    size,
+	}
+	if err := n.raft.Restore(meta, f, restoreTimeout); err != nil {
+		return BackupInfo{}, fmt.Errorf("failed to restore backup: %w", err)
+	}
+	n.logger.Warn("cluster state replaced from backup",
+		"backup_index", info.Index, "backup_node_id", info.NodeID, "backup_created_at", info.CreatedAt, "bytes", size)
+	return info, nil
+}
@@ -0,0 +1,237 @@
+package raft
+
+import (
+	"context"
+	"distributed_cloud_service/internal/metrics"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// EventType identifies the kind of cluster event
+type EventType string
+
+const (
+	EventLeaderChange     EventType = "leader_change"
+	EventStateChange      EventType = "state_change"
+	EventPeerAdded        EventType = "peer_added"
+	EventPeerRemoved      EventType = "peer_removed"
+	EventHeartbeatFailed  EventType = "heartbeat_failed"
+	EventHeartbeatResumed EventType = "heartbeat_resumed"
+	EventVoteRequested    EventType = "vote_requested"
+	EventStateDiverged    EventType = "state_diverged"
+)
+
+// DefaultEventHistory is the number of recent events kept for late subscribers
+const DefaultEventHistory = 256
+
+// Event is a typed Raft observation as seen by this node
+type Event struct {
+	ID           uint64     `json:"id"`
+	Type         EventType  `json:"type"`
+	Time         time.Time  `json:"time"`
+	NodeID       string     `json:"node_id"` // node that observed the event
+	LeaderID     string     `json:"leader_id,omitempty"`
+	LeaderAddr   string     `json:"leader_addr,omitempty"`
+	PeerID       string     `json:"peer_id,omitempty"`
+	PeerAddr     string     `json:"peer_addr,omitempty"`
+	State        string     `json:"state,omitempty"`
+	Term         uint64     `json:"term,omitempty"`
+	LastContact  *time.Time `json:"last_contact,omitempty"`
+	Index        uint64     `json:"index,omitempty"`         // log index a state hash was compared at
+	Hash         string     `json:"hash,omitempty"`          // this node's state hash at Index
+	ExpectedHash string     `json:"expected_hash,omitempty"` // the leader's state hash at Index
+}
+
+// EventBus fans out events to subscribers and keeps a ring buffer of recent history
+type EventBus struct {
+	mu      sync.Mutex
+	nextID  uint64
+	history []Event
+	head    int // index of the oldest event in history
+	count   int
+	subs    map[chan Event]struct{}
+}
+
+// NewEventBus creates an event bus retaining up to historySize recent events
+func NewEventBus(historySize int) *EventBus {
+	if historySize <= 0 {
+		historySize = DefaultEventHistory
+	}
+	return &EventBus{
+		nextID:  1,
+		history: make([]Event, historySize),
+		subs:    make(map[chan Event]struct{}),
+	}
+}
+
+// Publish assigns the event an ID, records it in history and delivers it to subscribers.
+// Subscribers that are not keeping up miss the event rather than blocking Raft.
+func (b *EventBus) Publish(e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e.ID = b.nextID
+	b.nextID++
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	pos := (b.head + b.count) % len(b.history)
+	b.history[pos] = e
+	if b.count < len(b.history) {
+		b.count++
+	} else {
+		b.head = (b.head + 1) % len(b.history)
+	}
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+	return e
+}
+
+// Recent returns the retained events with an ID greater than afterID, oldest first
+func (b *EventBus) Recent(afterID uint64) []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.recentLocked(afterID)
+}
+
+func (b *EventBus) recentLocked(afterID uint64) []Event {
+	events := make([]Event, 0, b.count)
+	for i := 0; i < b.count; i++ {
+		e := b.history[(b.head+i)%len(b.history)]
+		if e.ID > afterID {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Subscribe returns the retained events after afterID together with a channel
+// for events published from now on. Calling cancel releases the subscription.
+func (b *EventBus) Subscribe(afterID uint64, buffer int) (backlog []Event, events <-chan Event, cancel func()) {
+	ch := make(chan Event, buffer)
+
+	b.mu.Lock()
+	backlog = b.recentLocked(afterID)
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel = func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+		})
+	}
+	return backlog, ch, cancel
+}
+
+// eventFromObservation converts a Raft observation into an Event.
+// It returns false for observations that are not part of the event stream.
+func eventFromObservation(nodeID string, o raft.Observation) (Event, bool) {
+	e := Event{NodeID: nodeID, Time: time.Now()}
+
+	switch data := o.Data.(type) {
+	case raft.LeaderObservation:
+		e.Type = EventLeaderChange
+		e.LeaderID = string(data.LeaderID)
+		e.LeaderAddr = string(data.LeaderAddr)
+	case raft.RaftState:
+		e.Type = EventStateChange
+		e.State = data.String()
+	case raft.PeerObservation:
+		e.Type = EventPeerAdded
+		if data.Removed {
+			e.Type = EventPeerRemoved
+		}
+		e.PeerID = string(data.Peer.ID)
+		e.PeerAddr = string(data.Peer.Address)
+	case raft.FailedHeartbeatObservation:
+		e.Type = EventHeartbeatFailed
+		e.PeerID = string(data.PeerID)
+		lastContact := data.LastContact
+		e.LastContact = &lastContact
+	case raft.ResumedHeartbeatObservation:
+		e.Type = EventHeartbeatResumed
+		e.PeerID = string(data.PeerID)
+	case raft.RequestVoteRequest:
+		e.Type = EventVoteRequested
+		e.PeerID = string(data.ID)
+		e.PeerAddr = string(data.Addr)
+		e.Term = data.Term
+	default:
+		return Event{}, false
+	}
+
+	if o.Raft != nil && e.Term == 0 {
+		e.Term = o.Raft.CurrentTerm()
+	}
+	return e, true
+}
+
+// logEvent writes a structured log line for an event
+func logEvent(logger *slog.Logger, e Event) {
+	attrs := []any{"id", e.ID, "type", string(e.Type), "node_id", e.NodeID}
+	if e.LeaderID != "" || e.Type == EventLeaderChange {
+		attrs = append(attrs, "leader_id", e.LeaderID, "leader_addr", e.LeaderAddr)
+	}
+	if e.PeerID != "" {
+		attrs = append(attrs, "peer_id", e.PeerID)
+	}
+	if e.PeerAddr != "" {
+		attrs = append(attrs, "peer_addr", e.PeerAddr)
+	}
+	if e.State != "" {
+		attrs = append(attrs, "state", e.State)
+	}
+	if e.Term != 0 {
+		attrs = append(attrs, "term", e.Term)
+	}
+	if e.LastContact != nil {
+		attrs = append(attrs, "last_contact", *e.LastContact)
+	}
+	if e.Type == EventStateDiverged {
+		attrs = append(attrs, "index", e.Index, "hash", e.Hash, "expected_hash", e.ExpectedHash)
+	}
+
+	level := slog.LevelInfo
+	switch e.Type {
+	case EventHeartbeatFailed:
+		level = slog.LevelWarn
+	case EventStateDiverged:
+		level = slog.LevelError
+	}
+	logger.Log(context.Background(), level, "raft event", attrs...)
+}
+
+// watchObservations turns Raft observations into events until done is closed
+func (n *Node) watchObservations(nodeID string) {
+	defer close(n.observerDone)
+	for {
+		select {
+		case o := <-n.observations:
+			e, ok := eventFromObservation(nodeID, o)
+			if !ok {
+				continue
+			}
+			if e.Type == EventLeaderChange && e.LeaderID == nodeID {
+				go n.advertise()
+				go n.proposeLimits()
+			}
+			e = n.events.Publish(e)
+			metrics.RaftEventsTotal.WithLabelValues(string(e.Type)).Inc()
+			logEvent(n.logger, e)
+		case <-n.stopObserver:
+			return
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package raft
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestEventBus_HistoryRing(t *testing.T) {
+	bus := NewEventBus(3)
+
+	for i := 0; i < 5; i++ {
+		bus.Publish(Event{Type: EventStateChange})
+	}
+
+	recent := bus.Recent(0)
+	if len(recent) != 3 {
+		t.Fatalf("Expected 3 retained events, got %d", len(recent))
+	}
+	for i, e := range recent {
+		if e.ID != uint64(i+3) {
+			t.Errorf("Expected event ID %d at position %d, got %d", i+3, i, e.ID)
+		}
+	}
+
+	recent = bus.Recent(4)
+	if len(recent) != 1 || recent[0].ID != 5 {
+		t.Errorf("Expected only event 5 after ID 4, got %+v", recent)
+	}
+}
+
+func TestEventBus_Subscribe(t *testing.T) {
+	bus := NewEventBus(10)
+	bus.Publish(Event{Type: EventLeaderChange, LeaderID: "node1"})
+
+	backlog, events, cancel := bus.Subscribe(0, 4)
+	defer cancel()
+
+	if len(backlog) != 1 || backlog[0].LeaderID != "node1" {
+		t.Fatalf("Expected backlog with leader change, got %+v", backlog)
+	}
+
+	bus.Publish(Event{Type: EventPeerAdded, PeerID: "node2"})
+
+	select {
+	case e := <-events:
+		if e.Type != EventPeerAdded || e.PeerID != "node2" || e.ID != 2 {
+			t.Errorf("Unexpected event: %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Subscriber did not receive published event")
+	}
+
+	cancel()
+	bus.Publish(Event{Type: EventPeerRemoved})
+	select {
+	case e := <-events:
+		t.Errorf("Received event after cancel: %+v", e)
+	default:
+	}
+}
+
+func TestEventFromObservation(t *testing.T) {
+	tests := []struct {
+		name string
+		data interface{}
+		want EventType
+	}{
+		{"leader", raft.LeaderObservation{LeaderID: "node1", LeaderAddr: "127.0.0.1:9011"}, EventLeaderChange},
+		{"state", raft.Candidate, EventStateChange},
+		{"peer up", raft.PeerObservation{Peer: raft.Server{ID: "node2"}}, EventPeerAdded},
+		{"peer down", raft.PeerObservation{Peer: raft.Server{ID: "node2"}, Removed: true}, EventPeerRemoved},
+		{"heartbeat", raft.FailedHeartbeatObservation{PeerID: "node3", LastContact: time.Now()}, EventHeartbeatFailed},
+		{"vote", raft.RequestVoteRequest{Term: 7}, EventVoteRequested},
+	}
+
+	for _, tt := range tests {
+		e, ok := eventFromObservation("node1", raft.Observation{Data: tt.data})
+		if !ok {
+			t.Errorf("%s: observation was not converted", tt.name)
+			continue
+		}
+		if e.Type != tt.want {
+			t.Errorf("%s: expected type %s, got %s", tt.name, tt.want, e.Type)
+		}
+		if e.NodeID != "node1" {
+			t.Errorf("%s: expected node_id node1, got %s", tt.name, e.NodeID)
+		}
+	}
+
+	if _, ok := eventFromObservation("node1", raft.Observation{Data: "other"}); ok {
+		t.Error("Unknown observation should be ignored")
+	}
+}
@@ -0,0 +1,202 @@
+package raft
+
+import (
+	"container/heap"
+	"distributed_cloud_service/internal/store"
+	"sync"
+	"time"
+)
+
+const (
+	// expirySweepInterval is how often the leader looks for keys that have expired
+	expirySweepInterval = time.Second
+	// maxEvictBatch caps the keys deleted by a single evict entry
+	maxEvictBatch = 1000
+)
+
+// expiryEntry is a key that expires at a given time (Unix milliseconds)
+type expiryEntry struct {
+	at  int64
+	ns  string
+	key string
+}
+
+// expiryQueue is a min-heap of expiry entries ordered by time
+type expiryQueue []expiryEntry
+
+func (q expiryQueue) Len() int            { return len(q) }
+func (q expiryQueue) Less(i, j int) bool  { return q[i].at < q[j].at }
+func (q expiryQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *expiryQueue) Push(x interface{}) { *q = append(*q, x.(expiryEntry)) }
+func (q *expiryQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+// expiryIndex is the queue of keys that will expire. It is derived from the store on
+// every node and not replicated; entries for keys overwritten since are dropped when due.
+type expiryIndex struct {
+	mu    sync.Mutex
+	queue expiryQueue
+
+	// rebuilding is set while rebuildExpiry scans the store; added then collects the
+	// entries queued meanwhile, which the scan may have missed
+	rebuilding bool
+	added      []expiryEntry
+}
+
+// add queues a key expiring at at; an at of 0 means the key doesn't expire
+func (x *expiryIndex) add(ns, key string, at int64) {
+	if at == 0 {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	e := expiryEntry{at: at, ns: ns, key: key}
+	heap.Push(&x.queue, e)
+	if x.rebuilding {
+		x.added = append(x.added, e)
+	}
+}
+
+// due removes and returns up to max entries expiring at or before now
+func (x *expiryIndex) due(now int64, max int) []expiryEntry {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var entries []expiryEntry
+	for len(x.queue) > 0 && x.queue[0].at <= now && len(entries) < max {
+		entries = append(entries, heap.Pop(&x.queue).(expiryEntry))
+	}
+	return entries
+}
+
+func (x *expiryIndex) len() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return len(x.queue)
+}
+
+// rebuildExpiry replaces the expiry index with every key in the store that has an expiry.
+// The store is scanned without holding the index, so writes keep applying; entries added
+// during the scan are merged in afterwards. An entry queued twice is harmless.
+func (f *FSM) rebuildExpiry() {
+	x := f.expiry
+	x.mu.Lock()
+	x.rebuilding, x.added = true, nil
+	x.mu.Unlock()
+
+	var queue expiryQueue
+	if view, err := f.store.Snapshot(); err == nil {
+		view.ForEach(func(ns, key string, enc []byte) error {
+			if at := store.ValueExpiry(enc); at != 0 {
+				queue = append(queue, expiryEntry{at: at, ns: ns, key: key})
+			}
+			return nil
+		})
+		view.Release()
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	queue = append(queue, x.added...)
+	heap.Init(&queue)
+	x.queue = queue
+	x.rebuilding, x.added = false, nil
+}
+
+// applyExpire sets the expiry of a live key and reports whether the key existed.
+// An expiry at or before the time of the entry deletes the key.
+func (f *FSM) applyExpire(index uint64, now time.Time, cmd KVCommand) interface{} {
+	if _, err := f.namespaceLimits(cmd.Namespace); err != nil {
+		return f.reject(index, err)
+	}
+	enc, ok := f.liveValue(cmd.Namespace, cmd.Key, now)
+	if !ok {
+		f.store.SetAppliedIndex(index)
+		return false
+	}
+	if cmd.ExpireAt != 0 && cmd.ExpireAt <= now.UnixMilli() {
+		if _, err := f.store.DeleteIn(index, cmd.Namespace, cmd.Key); err != nil {
+			return err
+		}
+		return true
+	}
+	value, err := store.WithExpiry(enc, cmd.ExpireAt)
+	if err != nil {
+		return f.reject(index, err)
+	}
+	if err := f.store.PutEncodedIn(index, cmd.Namespace, cmd.Key, value); err != nil {
+		return err
+	}
+	f.expiry.add(cmd.Namespace, cmd.Key, cmd.ExpireAt)
+	return true
+}
+
+// applyEvict deletes the keys in cmd.Keys that have expired by the time of the entry.
+// Keys written again since the leader found them expired are left alone.
+func (f *FSM) applyEvict(index uint64, now time.Time, cmd KVCommand) interface{} {
+	batch := make([]store.Mutation, 0, len(cmd.Keys))
+	for _, key := range cmd.Keys {
+		if enc, ok := f.store.GetEncodedIn(cmd.Namespace, key); ok && store.Expired(enc, now) {
+			batch = append(batch, store.Mutation{Namespace: cmd.Namespace, Key: key, Delete: true})
+		}
+	}
+	return f.store.WriteBatch(index, batch)
+}
+
+// expireKeys has the leader delete keys once they expire. Followers drop due entries
+// too, and rebuild their index from the store when they become leader.
+func (n *Node) expireKeys() {
+	defer close(n.expiryDone)
+	ticker := time.NewTicker(expirySweepInterval)
+	defer ticker.Stop()
+
+	wasLeader := false
+	for {
+		select {
+		case <-ticker.C:
+		case <-n.stopExpiry:
+			return
+		}
+		leader := n.IsLeader()
+		if leader && !wasLeader {
+			n.fsm.rebuildExpiry()
+		}
+		wasLeader = leader
+		if err := n.evictExpired(time.Now(), leader); err != nil {
+			n.logger.Warn("failed to evict expired keys", "error", err)
+		}
+	}
+}
+
+// evictExpired proposes the deletion of keys that expired by now. Entries whose key has
+// since been rewritten with another expiry (or none) are dropped.
+func (n *Node) evictExpired(now time.Time, leader bool) error {
+	for {
+		due := n.fsm.expiry.due(now.UnixMilli(), maxEvictBatch)
+		if len(due) == 0 || !leader {
+			return nil
+		}
+
+		keys := make(map[string][]string)
+		for _, e := range due {
+			if enc, ok := n.fsm.store.GetEncodedIn(e.ns, e.key); ok && store.ValueExpiry(enc) == e.at {
+				keys[e.ns] = append(keys[e.ns], e.key)
+			}
+		}
+		for ns, batch := range keys {
+			if _, err := n.Propose(KVCommand{Op: "evict", Namespace: ns, Keys: batch}); err != nil {
+				// Keep the keys queued for the next sweep
+				for _, e := range due {
+					n.fsm.expiry.add(e.ns, e.key, e.at)
+				}
+				return err
+			}
+		}
+		if len(due) < maxEvictBatch {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package raft
+
+import (
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// applyAt applies cmd as if the leader appended it at now and returns the response
+func applyAt(fsm *FSM, index uint64, now time.Time, cmd KVCommand) interface{} {
+	data, _ := json.Marshal(cmd)
+	return fsm.Apply(&raft.Log{Index: index, Data: data, AppendedAt: now})
+}
+
+func TestFSM_Expiry(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+	start := time.Now()
+	expireAt := start.Add(time.Minute).UnixMilli()
+
+	applyAt(fsm, 1, start, KVCommand{Op: "put", Key: "session", Value: []byte("s"), ExpireAt: expireAt})
+	applyAt(fsm, 2, start, KVCommand{Op: "put", Key: "plain", Value: []byte("p")})
+	if at, ok := kvStore.ExpiryIn(store.DefaultNamespace, "session"); !ok || at.UnixMilli() != expireAt {
+		t.Errorf("Expected expiry %d, got %v", expireAt, at)
+	}
+	if resp := applyAt(fsm, 3, start, KVCommand{Op: "expire", Key: "plain", ExpireAt: expireAt}); resp != true {
+		t.Errorf("Expected expire to find the key, got %v", resp)
+	}
+	if resp := applyAt(fsm, 4, start, KVCommand{Op: "expire", Key: "missing", ExpireAt: expireAt}); resp != false {
+		t.Errorf("Expected expire of a missing key to report false, got %v", resp)
+	}
+	if fsm.expiry.len() != 2 {
+		t.Errorf("Expected 2 queued expiries, got %d", fsm.expiry.len())
+	}
+
+	// Once the entry time passes the expiry, the key counts as missing
+	later := start.Add(2 * time.Minute)
+	if resp := applyAt(fsm, 5, later, KVCommand{Op: "put", Key: "session", Value: []byte("new"), Cond: "nx"}); resp != nil {
+		t.Errorf("Expected nx put over an expired key to succeed, got %v", resp)
+	}
+	if _, ok := kvStore.ExpiryIn(store.DefaultNamespace, "session"); !ok {
+		t.Error("Expected the rewritten key to be live without an expiry")
+	}
+
+	// Evict only removes keys that are still expired at the entry's time
+	if resp := applyAt(fsm, 6, later, KVCommand{Op: "evict", Keys: []string{"session", "plain"}}); resp != nil {
+		t.Fatalf("Evict failed: %v", resp)
+	}
+	if _, ok := kvStore.GetEncodedIn(store.DefaultNamespace, "plain"); ok {
+		t.Error("Expected the expired key to be evicted")
+	}
+	if _, ok := kvStore.Get("session"); !ok {
+		t.Error("Evict removed a key that was written again")
+	}
+
+	// An expiry in the past deletes the key right away
+	if resp := applyAt(fsm, 7, later, KVCommand{Op: "expire", Key: "session", ExpireAt: start.UnixMilli()}); resp != true {
+		t.Errorf("Expected expire to report true, got %v", resp)
+	}
+	if kvStore.Len() != 0 {
+		t.Errorf("Expected no keys left, got %d", kvStore.Len())
+	}
+}
+
+func TestFSM_RebuildExpiry(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+	now := time.Now()
+	applyAt(fsm, 1, now, KVCommand{Op: "put", Key: "a", Value: []byte("a"), ExpireAt: now.Add(time.Hour).UnixMilli()})
+	applyAt(fsm, 2, now, KVCommand{Op: "put", Key: "b", Value: []byte("b"), ExpireAt: now.Add(time.Second).UnixMilli()})
+	applyAt(fsm, 3, now, KVCommand{Op: "put", Key: "c", Value: []byte("c")})
+
+	// A new FSM over the same store finds the keys with an expiry
+	rebuilt := NewFSM(kvStore)
+	due := rebuilt.expiry.due(now.Add(time.Minute).UnixMilli(), maxEvictBatch)
+	if len(due) != 1 || due[0].key != "b" {
+		t.Errorf("Expected b to be due, got %+v", due)
+	}
+	if rebuilt.expiry.len() != 1 {
+		t.Errorf("Expected a to stay queued, got %d entries", rebuilt.expiry.len())
+	}
+}
+
+func TestFSM_RebuildExpiryKeepsConcurrentWrites(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+	now := time.Now()
+	expireAt := now.Add(time.Hour).UnixMilli()
+	const keys = 500
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= keys; i++ {
+			applyAt(fsm, uint64(i), now, KVCommand{Op: "put", Key: fmt.Sprintf("key%d", i), Value: []byte("v"), ExpireAt: expireAt})
+		}
+	}()
+	// Rebuilds racing with the writes must not drop any of them
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			fsm.rebuildExpiry()
+		}
+	}
+
+	queued := make(map[string]bool)
+	for _, e := range fsm.expiry.due(expireAt, math.MaxInt) {
+		queued[e.key] = true
+	}
+	if len(queued) != keys {
+		t.Errorf("Expected all %d keys to be queued for expiry, got %d", keys, len(queued))
+	}
+}
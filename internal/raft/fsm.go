@@ -1,81 +1,543 @@
-package raft
-
-import (
-	"distributed_cloud_service/internal/store"
-	"encoding/json"
-	"io"
-
-	"github.com/hashicorp/raft"
-)
-
-// KVCommand represents a command to be applied via Raft
-type KVCommand struct {
-	Op    string `json:"op"`    // "put", "delete"
-	Key   string `json:"key"`
-	Value []byte `json:"value,omitempty"`
-}
-
-// FSM is the finite state machine that applies commands to the store
-type FSM struct {
-	store *store.Store
-}
-
-// NewFSM creates a new FSM
-func NewFSM(s *store.Store) *FSM {
-	return &FSM{
-		store: s,
-	}
-}
-
-// Apply applies a Raft log entry to the FSM
-func (f *FSM) Apply(logEntry *raft.Log) interface{} {
-	var cmd KVCommand
-	if err := json.Unmarshal(logEntry.Data, &cmd); err != nil {
-		return err
-	}
-
-	switch cmd.Op {
-	case "put":
-		f.store.Put(cmd.Key, cmd.Value)
-		return nil
-	case "delete":
-		f.store.Delete(cmd.Key)
-		return nil
-	default:
-		return "unknown command"
-	}
-}
-
-// Snapshot returns a snapshot of the current state
-func (f *FSM) Snapshot() (raft.FSMSnapshot, error) {
-	state := f.store.Dump()
-	return &snapshot{state: state}, nil
-}
-
-// Restore restores from a snapshot
-func (f *FSM) Restore(snapshot io.ReadCloser) error {
-	defer snapshot.Close()
-	var state map[string][]byte
-	if err := json.NewDecoder(snapshot).Decode(&state); err != nil {
-		return err
-	}
-	f.store.Load(state)
-	return nil
-}
-
-// snapshot is a simple snapshot implementation
-type snapshot struct{
-	state map[string][]byte
-}
-
-func (s *snapshot) Persist(sink raft.SnapshotSink) error {
-	enc := json.NewEncoder(sink)
-	if err := enc.Encode(s.state); err != nil {
-		_ = sink.Cancel()
-		return err
-	}
-	return sink.Close()
-}
-
-func (s *snapshot) Release() {}
-
+package raft
+
+import (
+	"distributed_cloud_service/internal/cluster"
+	"distributed_cloud_service/internal/jsondoc"
+	"distributed_cloud_service/internal/metrics"
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// KVCommand represents a command to be applied via Raft
+type KVCommand struct {
+	Op          string            `json:"op"`           // "put", "delete", "batch", "del", "incr", "decr", "expire", "evict", "patch", "ns_create", "ns_delete", "role_put", "role_delete", "user_create", "user_update", "user_delete", "node_put", "limits_put", "hash_check"
+	Namespace   string            `json:"ns,omitempty"` // Empty for the default namespace
+	Key         string            `json:"key"`
+	Value       []byte            `json:"value,omitempty"`
+	Encoded     bool              `json:"encoded,omitempty"`      // Value is encoded with store.EncodeValue
+	Cond        string            `json:"cond,omitempty"`         // "nx" puts only if the key is missing, "xx" only if it exists
+	ExpireAt    int64             `json:"expire_at,omitempty"`    // Expiry set by "put" and "expire", in Unix milliseconds
+	Delta       int64             `json:"delta,omitempty"`        // Added to the integer value by "incr", subtracted by "decr"
+	Keys        []string          `json:"keys,omitempty"`         // Keys removed by "del" and "evict"
+	Patch       string            `json:"patch,omitempty"`        // Format of the patch in Value for "patch": "merge" or "json"
+	ContentType string            `json:"content_type,omitempty"` // Stored by "put" with the value
+	Meta        map[string]string `json:"meta,omitempty"`         // Custom metadata stored by "put"
+	Compress    int               `json:"compress,omitempty"`     // Compression threshold for the value "patch" writes
+	Batch       []KVCommand       `json:"batch,omitempty"`        // Puts and deletes applied atomically by "batch"
+	Check       *StateHash        `json:"check,omitempty"`        // Leader's state hash compared by "hash_check"
+}
+
+var (
+	// ErrConditionFailed is returned for a put whose key did ("nx") or didn't ("xx") exist
+	ErrConditionFailed = errors.New("condition not met")
+	// ErrNotInteger is returned by "incr" and "decr" for a value that is not a base-10 64-bit integer
+	ErrNotInteger = errors.New("value is not an integer or out of range")
+	// ErrOverflow is returned by "incr" and "decr" when the result doesn't fit in 64 bits
+	ErrOverflow = errors.New("increment or decrement would overflow")
+	// ErrKeyNotFound is returned by "patch" for a missing or expired key
+	ErrKeyNotFound = errors.New("key not found")
+)
+
+// encodedValue returns the value of a put as stored, encoding values proposed without it
+func (c KVCommand) encodedValue() ([]byte, error) {
+	if !c.Encoded {
+		return store.EncodeValue(c.Value, 0), nil
+	}
+	if err := store.ValidateValue(c.Value); err != nil {
+		return nil, err
+	}
+	return c.Value, nil
+}
+
+// FSM is the finite state machine that applies commands to the store
+type FSM struct {
+	store *store.Store
+	// limits are the store-wide limits replicated through the log, so every replica
+	// checks entries against the same ones whatever its own config says
+	limits cluster.LimitsConfig
+
+	// expiry orders keys with an expiry so the leader can delete them once they expire
+	expiry *expiryIndex
+
+	// hashes holds the state hash after each recently applied entry
+	hashes       *hashHistory
+	checkMu      sync.Mutex
+	lastCheck    *HashCheck
+	onDivergence func(HashCheck) // called when the leader's hash differs from ours
+}
+
+// NewFSM creates a new FSM. Writes are checked against the store-wide limits held in
+// the store; until a leader has replicated some, only namespace limits apply.
+func NewFSM(s *store.Store) *FSM {
+	f := &FSM{
+		store:  s,
+		expiry: &expiryIndex{},
+		hashes: newHashHistory(DefaultHashHistory),
+	}
+	f.loadLimits()
+	f.rebuildExpiry()
+	// A persistent store starts out with whatever it held at shutdown
+	f.recordHash(s.AppliedIndex())
+	return f
+}
+
+// loadLimits picks up the store-wide limits replicated into the store
+func (f *FSM) loadLimits() {
+	f.limits, _ = f.store.ClusterLimits()
+	metrics.KVQuotaLimit.WithLabelValues(store.ResourceKeySize).Set(float64(f.limits.MaxKeySize))
+	metrics.KVQuotaLimit.WithLabelValues(store.ResourceValueSize).Set(float64(f.limits.MaxValueSize))
+	metrics.KVQuotaLimit.WithLabelValues(store.ResourceKeys).Set(float64(f.limits.MaxKeys))
+	metrics.KVQuotaLimit.WithLabelValues(store.ResourceBytes).Set(float64(f.limits.MaxTotalBytes))
+}
+
+// Apply applies a Raft log entry to the FSM
+func (f *FSM) Apply(logEntry *raft.Log) interface{} {
+	// A persistent store may already contain this entry from before a restart
+	if logEntry.Index != 0 && logEntry.Index <= f.store.AppliedIndex() {
+		return nil
+	}
+	defer f.recordHash(logEntry.Index)
+	// Expiry is judged by the leader's clock when it appended the entry, so every replica
+	// decides the same way. Entries without that time see no key as expired.
+	now := logEntry.AppendedAt
+
+	var cmd KVCommand
+	if err := json.Unmarshal(logEntry.Data, &cmd); err != nil {
+		f.store.SetAppliedIndex(logEntry.Index)
+		return err
+	}
+
+	switch cmd.Op {
+	case "put":
+		defer f.updateUsage(cmd.Namespace)
+		var nsLimits cluster.LimitsConfig
+		if cmd.Namespace != store.DefaultNamespace {
+			ns, ok := f.store.Namespace(cmd.Namespace)
+			if !ok {
+				return f.reject(logEntry.Index, store.ErrNamespaceNotFound)
+			}
+			nsLimits = ns.Limits
+		}
+		value, err := cmd.encodedValue()
+		if err != nil {
+			return f.reject(logEntry.Index, err)
+		}
+		if cmd.ExpireAt != 0 {
+			if value, err = store.WithExpiry(value, cmd.ExpireAt); err != nil {
+				return f.reject(logEntry.Index, err)
+			}
+		}
+		prev, exists := f.liveValue(cmd.Namespace, cmd.Key, now)
+		if cmd.Cond != "" {
+			if cmd.Cond != "nx" && cmd.Cond != "xx" {
+				return f.reject(logEntry.Index, fmt.Errorf("unknown put condition %q", cmd.Cond))
+			}
+			if exists != (cmd.Cond == "xx") {
+				return f.reject(logEntry.Index, ErrConditionFailed)
+			}
+		}
+		if value, err = withMeta(value, logEntry.Index, now, prev, cmd); err != nil {
+			return f.reject(logEntry.Index, err)
+		}
+		if err := f.store.CheckPutIn(f.limits, nsLimits, cmd.Namespace, cmd.Key, int64(store.ValueSize(value))); err != nil {
+			var quotaErr *store.QuotaError
+			if errors.As(err, &quotaErr) {
+				metrics.KVQuotaRejections.WithLabelValues(quotaErr.Resource, "fsm").Inc()
+			}
+			return f.reject(logEntry.Index, err)
+		}
+		if err := f.store.PutEncodedIn(logEntry.Index, cmd.Namespace, cmd.Key, value); err != nil {
+			return err
+		}
+		f.expiry.add(cmd.Namespace, cmd.Key, cmd.ExpireAt)
+		return nil
+	case "delete":
+		defer f.updateUsage(cmd.Namespace)
+		if cmd.Namespace != store.DefaultNamespace {
+			if _, ok := f.store.Namespace(cmd.Namespace); !ok {
+				return f.reject(logEntry.Index, store.ErrNamespaceNotFound)
+			}
+		}
+		_, err := f.store.DeleteIn(logEntry.Index, cmd.Namespace, cmd.Key)
+		return err
+	case "batch":
+		return f.applyBatch(logEntry.Index, now, cmd.Batch)
+	case "del":
+		defer f.updateUsage(cmd.Namespace)
+		return f.applyDel(logEntry.Index, now, cmd)
+	case "incr", "decr":
+		defer f.updateUsage(cmd.Namespace)
+		return f.applyIncr(logEntry.Index, now, cmd)
+	case "expire":
+		defer f.updateUsage(cmd.Namespace)
+		return f.applyExpire(logEntry.Index, now, cmd)
+	case "evict":
+		defer f.updateUsage(cmd.Namespace)
+		return f.applyEvict(logEntry.Index, now, cmd)
+	case "patch":
+		defer f.updateUsage(cmd.Namespace)
+		return f.applyPatch(logEntry.Index, now, cmd)
+	case "ns_create":
+		var ns store.Namespace
+		if err := json.Unmarshal(cmd.Value, &ns); err != nil {
+			return f.reject(logEntry.Index, err)
+		}
+		if err := f.store.CreateNamespace(logEntry.Index, ns); err != nil {
+			return f.reject(logEntry.Index, err)
+		}
+		f.updateUsage(ns.Name)
+		return nil
+	case "ns_delete":
+		if err := f.store.DeleteNamespace(logEntry.Index, cmd.Key); err != nil {
+			return f.reject(logEntry.Index, err)
+		}
+		f.updateUsage(store.DefaultNamespace)
+		metrics.KVNamespaceKeys.DeleteLabelValues(cmd.Key)
+		metrics.KVNamespaceBytes.DeleteLabelValues(cmd.Key)
+		return nil
+	case "role_put":
+		var role store.Role
+		if err := json.Unmarshal(cmd.Value, &role); err != nil {
+			return f.reject(logEntry.Index, err)
+		}
+		if err := f.store.PutRole(logEntry.Index, role); err != nil {
+			return f.reject(logEntry.Index, err)
+		}
+		return nil
+	case "role_delete":
+		if err := f.store.DeleteRole(logEntry.Index, cmd.Key); err != nil {
+			return f.reject(logEntry.Index, err)
+		}
+		return nil
+	case "user_create", "user_update":
+		var user store.User
+		if err := json.Unmarshal(cmd.Value, &user); err != nil {
+			return f.reject(logEntry.Index, err)
+		}
+		apply := f.store.CreateUser
+		if cmd.Op == "user_update" {
+			apply = f.store.UpdateUser
+		}
+		if err := apply(logEntry.Index, user); err != nil {
+			return f.reject(logEntry.Index, err)
+		}
+		return nil
+	case "user_delete":
+		if err := f.store.DeleteUser(logEntry.Index, cmd.Key); err != nil {
+			return f.reject(logEntry.Index, err)
+		}
+		return nil
+	case "node_put":
+		var info store.NodeInfo
+		if err := json.Unmarshal(cmd.Value, &info); err != nil {
+			return f.reject(logEntry.Index, err)
+		}
+		if err := f.store.PutNodeInfo(logEntry.Index, info); err != nil {
+			return f.reject(logEntry.Index, err)
+		}
+		return nil
+	case "limits_put":
+		var limits cluster.LimitsConfig
+		if err := json.Unmarshal(cmd.Value, &limits); err != nil {
+			return f.reject(logEntry.Index, err)
+		}
+		if err := limits.Validate(); err != nil {
+			return f.reject(logEntry.Index, err)
+		}
+		if err := f.store.PutClusterLimits(logEntry.Index, limits); err != nil {
+			return f.reject(logEntry.Index, err)
+		}
+		f.loadLimits()
+		return nil
+	case "hash_check":
+		if cmd.Check != nil {
+			f.checkHash(*cmd.Check)
+		}
+		f.store.SetAppliedIndex(logEntry.Index)
+		return nil
+	default:
+		f.store.SetAppliedIndex(logEntry.Index)
+		return "unknown command"
+	}
+}
+
+// applyBatch applies the puts and deletes of a batch command all together, or none of them
+func (f *FSM) applyBatch(index uint64, now time.Time, cmds []KVCommand) interface{} {
+	nsLimits := make(map[string]cluster.LimitsConfig)
+	batch := make([]store.Mutation, 0, len(cmds))
+	// Values written earlier in the batch, nil once deleted, so a key written twice
+	// gets the metadata of two writes
+	written := make(map[[2]string][]byte)
+	for _, cmd := range cmds {
+		if cmd.Op != "put" && cmd.Op != "delete" {
+			return f.reject(index, fmt.Errorf("unsupported op %q in batch", cmd.Op))
+		}
+		if _, seen := nsLimits[cmd.Namespace]; !seen {
+			var limits cluster.LimitsConfig
+			if cmd.Namespace != store.DefaultNamespace {
+				ns, ok := f.store.Namespace(cmd.Namespace)
+				if !ok {
+					return f.reject(index, store.ErrNamespaceNotFound)
+				}
+				limits = ns.Limits
+			}
+			nsLimits[cmd.Namespace] = limits
+		}
+		mut := store.Mutation{Namespace: cmd.Namespace, Key: cmd.Key, Delete: cmd.Op == "delete"}
+		if !mut.Delete {
+			value, err := cmd.encodedValue()
+			if err != nil {
+				return f.reject(index, err)
+			}
+			if cmd.ExpireAt != 0 {
+				if value, err = store.WithExpiry(value, cmd.ExpireAt); err != nil {
+					return f.reject(index, err)
+				}
+			}
+			prev, seen := written[[2]string{cmd.Namespace, cmd.Key}]
+			if !seen {
+				prev, _ = f.liveValue(cmd.Namespace, cmd.Key, now)
+			}
+			if mut.Value, err = withMeta(value, index, now, prev, cmd); err != nil {
+				return f.reject(index, err)
+			}
+		}
+		written[[2]string{cmd.Namespace, cmd.Key}] = mut.Value
+		batch = append(batch, mut)
+	}
+
+	if err := f.store.CheckBatch(f.limits, nsLimits, batch); err != nil {
+		var quotaErr *store.QuotaError
+		if errors.As(err, &quotaErr) {
+			metrics.KVQuotaRejections.WithLabelValues(quotaErr.Resource, "fsm").Inc()
+		}
+		return f.reject(index, err)
+	}
+	if err := f.store.WriteBatch(index, batch); err != nil {
+		return err
+	}
+	for _, cmd := range cmds {
+		if cmd.Op == "put" {
+			f.expiry.add(cmd.Namespace, cmd.Key, cmd.ExpireAt)
+		}
+	}
+	for ns := range nsLimits {
+		f.updateUsage(ns)
+	}
+	return nil
+}
+
+// namespaceLimits returns the limits of namespace ns, which must exist unless it is the default one
+func (f *FSM) namespaceLimits(ns string) (cluster.LimitsConfig, error) {
+	if ns == store.DefaultNamespace {
+		return cluster.LimitsConfig{}, nil
+	}
+	n, ok := f.store.Namespace(ns)
+	if !ok {
+		return cluster.LimitsConfig{}, store.ErrNamespaceNotFound
+	}
+	return n.Limits, nil
+}
+
+// liveValue returns the encoded value of a key unless it is missing or expired at now
+func (f *FSM) liveValue(ns, key string, now time.Time) ([]byte, bool) {
+	enc, ok := f.store.GetEncodedIn(ns, key)
+	if !ok || store.Expired(enc, now) {
+		return nil, false
+	}
+	return enc, true
+}
+
+// withMeta adds the metadata of a write at index to value. prev is the key's live value
+// before the write, or nil: an existing key keeps its create index and time and its
+// version goes up. Puts set the content type and headers; other writes keep prev's.
+func withMeta(value []byte, index uint64, now time.Time, prev []byte, cmd KVCommand) ([]byte, error) {
+	meta := store.Meta{CreateIndex: index, ModifyIndex: index, Version: 1}
+	if !now.IsZero() {
+		meta.Created = now.UnixMilli()
+		meta.Modified = meta.Created
+	}
+	var old store.Meta
+	if prev != nil {
+		old, _ = store.ValueMeta(prev)
+		// Keys written before metadata was kept start over as if created now
+		if old.CreateIndex != 0 {
+			meta.CreateIndex, meta.Created, meta.Version = old.CreateIndex, old.Created, old.Version+1
+		}
+	}
+	if cmd.Op == "put" {
+		meta.ContentType, meta.Headers = cmd.ContentType, cmd.Meta
+	} else {
+		meta.ContentType, meta.Headers = old.ContentType, old.Headers
+	}
+	return store.WithMeta(value, meta)
+}
+
+// applyDel removes cmd.Keys and returns how many of them were live keys
+func (f *FSM) applyDel(index uint64, now time.Time, cmd KVCommand) interface{} {
+	if _, err := f.namespaceLimits(cmd.Namespace); err != nil {
+		return f.reject(index, err)
+	}
+	removed := 0
+	seen := make(map[string]bool, len(cmd.Keys))
+	batch := make([]store.Mutation, 0, len(cmd.Keys))
+	for _, key := range cmd.Keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if _, ok := f.liveValue(cmd.Namespace, key, now); ok {
+			removed++
+		}
+		batch = append(batch, store.Mutation{Namespace: cmd.Namespace, Key: key, Delete: true})
+	}
+	if err := f.store.WriteBatch(index, batch); err != nil {
+		return err
+	}
+	return removed
+}
+
+// applyIncr adds cmd.Delta to the integer stored under the key ("decr" subtracts it) and
+// returns the result. A missing or expired key counts as 0; an existing expiry is kept.
+func (f *FSM) applyIncr(index uint64, now time.Time, cmd KVCommand) interface{} {
+	nsLimits, err := f.namespaceLimits(cmd.Namespace)
+	if err != nil {
+		return f.reject(index, err)
+	}
+	delta := cmd.Delta
+	if cmd.Op == "decr" {
+		if delta == math.MinInt64 {
+			return f.reject(index, ErrOverflow)
+		}
+		delta = -delta
+	}
+	var current, expireAt int64
+	prev, ok := f.liveValue(cmd.Namespace, cmd.Key, now)
+	if ok {
+		val, err := store.DecodeValue(prev)
+		if err != nil {
+			return f.reject(index, err)
+		}
+		if current, err = strconv.ParseInt(string(val), 10, 64); err != nil {
+			return f.reject(index, ErrNotInteger)
+		}
+		expireAt = store.ValueExpiry(prev)
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return f.reject(index, ErrOverflow)
+	}
+	next := current + delta
+
+	value, err := store.WithExpiry(store.EncodeValue([]byte(strconv.FormatInt(next, 10)), 0), expireAt)
+	if err != nil {
+		return f.reject(index, err)
+	}
+	if value, err = withMeta(value, index, now, prev, cmd); err != nil {
+		return f.reject(index, err)
+	}
+	if err := f.store.CheckPutIn(f.limits, nsLimits, cmd.Namespace, cmd.Key, int64(store.ValueSize(value))); err != nil {
+		var quotaErr *store.QuotaError
+		if errors.As(err, &quotaErr) {
+			metrics.KVQuotaRejections.WithLabelValues(quotaErr.Resource, "fsm").Inc()
+		}
+		return f.reject(index, err)
+	}
+	if err := f.store.PutEncodedIn(index, cmd.Namespace, cmd.Key, value); err != nil {
+		return err
+	}
+	return next
+}
+
+// applyPatch applies the JSON patch in cmd.Value to the document stored under the key.
+// The patch is rejected as a whole if the value isn't JSON or any operation fails; the
+// patched document keeps the key's expiry.
+func (f *FSM) applyPatch(index uint64, now time.Time, cmd KVCommand) interface{} {
+	nsLimits, err := f.namespaceLimits(cmd.Namespace)
+	if err != nil {
+		return f.reject(index, err)
+	}
+	enc, ok := f.liveValue(cmd.Namespace, cmd.Key, now)
+	if !ok {
+		return f.reject(index, ErrKeyNotFound)
+	}
+	doc, err := store.DecodeValue(enc)
+	if err != nil {
+		return f.reject(index, err)
+	}
+	patched, err := jsondoc.Apply(cmd.Patch, doc, cmd.Value)
+	if err != nil {
+		return f.reject(index, err)
+	}
+
+	value, err := store.WithExpiry(store.EncodeValue(patched, cmd.Compress), store.ValueExpiry(enc))
+	if err != nil {
+		return f.reject(index, err)
+	}
+	if value, err = withMeta(value, index, now, enc, cmd); err != nil {
+		return f.reject(index, err)
+	}
+	if err := f.store.CheckPutIn(f.limits, nsLimits, cmd.Namespace, cmd.Key, int64(store.ValueSize(value))); err != nil {
+		var quotaErr *store.QuotaError
+		if errors.As(err, &quotaErr) {
+			metrics.KVQuotaRejections.WithLabelValues(quotaErr.Resource, "fsm").Inc()
+		}
+		return f.reject(index, err)
+	}
+	return f.store.PutEncodedIn(index, cmd.Namespace, cmd.Key, value)
+}
+
+// reject records a command that changed nothing as applied and returns its error
+func (f *FSM) reject(index uint64, err error) error {
+	f.store.SetAppliedIndex(index)
+	return err
+}
+
+// updateUsage publishes the store's key count and size, and those of namespace ns
+func (f *FSM) updateUsage(ns string) {
+	metrics.KVStoreSize.Set(float64(f.store.Len()))
+	metrics.KVStoreBytes.Set(float64(f.store.Bytes()))
+	if ns != store.DefaultNamespace {
+		usage := f.store.Usage(ns)
+		metrics.KVNamespaceKeys.WithLabelValues(ns).Set(float64(usage.Keys))
+		metrics.KVNamespaceBytes.WithLabelValues(ns).Set(float64(usage.Bytes))
+	}
+}
+
+// Snapshot returns a point-in-time view of the store without copying it.
+// Raft calls Persist from its own goroutine, so Apply keeps running while the view is written out.
+func (f *FSM) Snapshot() (raft.FSMSnapshot, error) {
+	view, err := f.store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{view: view}, nil
+}
+
+// Restore restores from a snapshot
+func (f *FSM) Restore(snapshot io.ReadCloser) error {
+	defer snapshot.Close()
+	if err := restoreSnapshot(f.store, snapshot); err != nil {
+		return err
+	}
+	f.loadLimits()
+	f.rebuildExpiry()
+	f.hashes.reset()
+	f.recordHash(f.store.AppliedIndex())
+
+	metrics.KVNamespaceKeys.Reset()
+	metrics.KVNamespaceBytes.Reset()
+	f.updateUsage(store.DefaultNamespace)
+	for _, ns := range f.store.Namespaces() {
+		f.updateUsage(ns.Name)
+	}
+	return nil
+}
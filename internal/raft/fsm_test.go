@@ -1,157 +1,738 @@
-package raft
-
-import (
-	"distributed_cloud_service/internal/store"
-	"encoding/json"
-	"testing"
-
-	"github.com/hashicorp/raft"
-)
-
-func TestFSM_Apply(t *testing.T) {
-	kvStore := store.NewStore()
-	fsm := NewFSM(kvStore)
-
-	// Test PUT operation
-	putCmd := KVCommand{
-		Op:    "put",
-		Key:   "test-key",
-		Value: []byte("test-value"),
-	}
-	putData, _ := json.Marshal(putCmd)
-	
-	logEntry := &raft.Log{
-		Index: 1,
-		Term:  1,
-		Type:  raft.LogCommand,
-		Data:  putData,
-	}
-
-	result := fsm.Apply(logEntry)
-	if result != nil {
-		t.Errorf("Apply() returned error: %v", result)
-	}
-
-	// Verify value was stored
-	val, ok := kvStore.Get("test-key")
-	if !ok {
-		t.Fatal("Key not found after Apply(PUT)")
-	}
-	if string(val) != "test-value" {
-		t.Errorf("Expected 'test-value', got '%s'", string(val))
-	}
-
-	// Test DELETE operation
-	deleteCmd := KVCommand{
-		Op:  "delete",
-		Key: "test-key",
-	}
-	deleteData, _ := json.Marshal(deleteCmd)
-	
-	logEntry2 := &raft.Log{
-		Index: 2,
-		Term:  1,
-		Type:  raft.LogCommand,
-		Data:  deleteData,
-	}
-
-	result = fsm.Apply(logEntry2)
-	if result != nil {
-		t.Errorf("Apply() returned error: %v", result)
-	}
-
-	// Verify key was deleted
-	_, ok = kvStore.Get("test-key")
-	if ok {
-		t.Error("Key still exists after Apply(DELETE)")
-	}
-
-	// Test unknown operation
-	unknownCmd := KVCommand{
-		Op:  "unknown",
-		Key: "test-key",
-	}
-	unknownData, _ := json.Marshal(unknownCmd)
-	
-	logEntry3 := &raft.Log{
-		Index: 3,
-		Term:  1,
-		Type:  raft.LogCommand,
-		Data:  unknownData,
-	}
-
-	result = fsm.Apply(logEntry3)
-	if result == nil {
-		t.Error("Apply() should return error for unknown operation")
-	}
-}
-
-func TestFSM_Snapshot(t *testing.T) {
-	kvStore := store.NewStore()
-	fsm := NewFSM(kvStore)
-
-	// Add some data
-	kvStore.Put("key1", []byte("value1"))
-	kvStore.Put("key2", []byte("value2"))
-
-	// Create snapshot
-	snapshot, err := fsm.Snapshot()
-	if err != nil {
-		t.Fatalf("Snapshot() failed: %v", err)
-	}
-	if snapshot == nil {
-		t.Fatal("Snapshot() returned nil")
-	}
-}
-
-func TestFSM_Restore(t *testing.T) {
-	kvStore := store.NewStore()
-	fsm := NewFSM(kvStore)
-
-	// Create state to restore
-	state := map[string][]byte{
-		"key1": []byte("value1"),
-		"key2": []byte("value2"),
-	}
-	stateData, _ := json.Marshal(state)
-
-	// Create a mock ReadCloser
-	reader := &mockReadCloser{data: stateData}
-
-	// Restore
-	err := fsm.Restore(reader)
-	if err != nil {
-		t.Fatalf("Restore() failed: %v", err)
-	}
-
-	// Verify restored data
-	val1, ok := kvStore.Get("key1")
-	if !ok || string(val1) != "value1" {
-		t.Error("key1 not restored correctly")
-	}
-
-	val2, ok := kvStore.Get("key2")
-	if !ok || string(val2) != "value2" {
-		t.Error("key2 not restored correctly")
-	}
-}
-
-// mockReadCloser implements io.ReadCloser for testing
-type mockReadCloser struct {
-	data []byte
-	pos  int
-}
-
-func (m *mockReadCloser) Read(p []byte) (n int, err error) {
-	if m.pos >= len(m.data) {
-		return 0, nil // EOF
-	}
-	n = copy(p, m.data[m.pos:])
-	m.pos += n
-	return n, nil
-}
-
-func (m *mockReadCloser) Close() error {
-	return nil
-}
-
+package raft
+
+import (
+	"bytes"
+	"distributed_cloud_service/internal/acl"
+	"distributed_cloud_service/internal/cluster"
+	"distributed_cloud_service/internal/jsondoc"
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestFSM_Apply(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+
+	// Test PUT operation
+	putCmd := KVCommand{
+		Op:    "put",
+		Key:   "test-key",
+		Value: []byte("test-value"),
+	}
+	putData, _ := json.Marshal(putCmd)
+	
+	logEntry := &raft.Log{
+		Index: 1,
+		Term:  1,
+		Type:  raft.LogCommand,
+		Data:  putData,
+	}
+
+	result := fsm.Apply(logEntry)
+	if result != nil {
+		t.Errorf("Apply() returned error: %v", result)
+	}
+
+	// Verify value was stored
+	val, ok := kvStore.Get("test-key")
+	if !ok {
+		t.Fatal("Key not found after Apply(PUT)")
+	}
+	if string(val) != "test-value" {
+		t.Errorf("Expected 'test-value', got '%s'", string(val))
+	}
+
+	// Test DELETE operation
+	deleteCmd := KVCommand{
+		Op:  "delete",
+		Key: "test-key",
+	}
+	deleteData, _ := json.Marshal(deleteCmd)
+	
+	logEntry2 := &raft.Log{
+		Index: 2,
+		Term:  1,
+		Type:  raft.LogCommand,
+		Data:  deleteData,
+	}
+
+	result = fsm.Apply(logEntry2)
+	if result != nil {
+		t.Errorf("Apply() returned error: %v", result)
+	}
+
+	// Verify key was deleted
+	_, ok = kvStore.Get("test-key")
+	if ok {
+		t.Error("Key still exists after Apply(DELETE)")
+	}
+
+	// Test unknown operation
+	unknownCmd := KVCommand{
+		Op:  "unknown",
+		Key: "test-key",
+	}
+	unknownData, _ := json.Marshal(unknownCmd)
+	
+	logEntry3 := &raft.Log{
+		Index: 3,
+		Term:  1,
+		Type:  raft.LogCommand,
+		Data:  unknownData,
+	}
+
+	result = fsm.Apply(logEntry3)
+	if result == nil {
+		t.Error("Apply() should return error for unknown operation")
+	}
+}
+
+func TestFSM_Snapshot(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+
+	// Add some data
+	kvStore.Put("key1", []byte("value1"))
+	kvStore.Put("key2", []byte("value2"))
+
+	// Create snapshot
+	snapshot, err := fsm.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() failed: %v", err)
+	}
+	if snapshot == nil {
+		t.Fatal("Snapshot() returned nil")
+	}
+}
+
+func TestFSM_Restore(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+
+	// Create state to restore
+	state := map[string][]byte{
+		"key1": []byte("value1"),
+		"key2": []byte("value2"),
+	}
+	stateData, _ := json.Marshal(state)
+
+	// Create a mock ReadCloser
+	reader := &mockReadCloser{data: stateData}
+
+	// Restore
+	err := fsm.Restore(reader)
+	if err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+
+	// Verify restored data
+	val1, ok := kvStore.Get("key1")
+	if !ok || string(val1) != "value1" {
+		t.Error("key1 not restored correctly")
+	}
+
+	val2, ok := kvStore.Get("key2")
+	if !ok || string(val2) != "value2" {
+		t.Error("key2 not restored correctly")
+	}
+}
+
+// mockReadCloser implements io.ReadCloser for testing
+type mockReadCloser struct {
+	data []byte
+	pos  int
+}
+
+func (m *mockReadCloser) Read(p []byte) (n int, err error) {
+	if m.pos >= len(m.data) {
+		return 0, nil // EOF
+	}
+	n = copy(p, m.data[m.pos:])
+	m.pos += n
+	return n, nil
+}
+
+func (m *mockReadCloser) Close() error {
+	return nil
+}
+
+// mockSnapshotSink collects a persisted snapshot in memory
+type mockSnapshotSink struct {
+	bytes.Buffer
+	cancelled bool
+}
+
+func (m *mockSnapshotSink) ID() string    { return "mock" }
+func (m *mockSnapshotSink) Cancel() error { m.cancelled = true; return nil }
+func (m *mockSnapshotSink) Close() error  { return nil }
+
+func TestFSM_SnapshotRoundTrip(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+
+	for i, key := range []string{"key1", "key2", "key3"} {
+		data, _ := json.Marshal(KVCommand{Op: "put", Key: key, Value: []byte("value-" + key)})
+		if result := fsm.Apply(&raft.Log{Index: uint64(i + 1), Data: data}); result != nil {
+			t.Fatalf("Apply() returned error: %v", result)
+		}
+	}
+
+	snapshot, err := fsm.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() failed: %v", err)
+	}
+	sink := &mockSnapshotSink{}
+	if err := snapshot.Persist(sink); err != nil {
+		t.Fatalf("Persist() failed: %v", err)
+	}
+	snapshot.Release()
+
+	restored := store.NewStore()
+	if err := NewFSM(restored).Restore(io.NopCloser(&sink.Buffer)); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+
+	if restored.Len() != 3 {
+		t.Errorf("Expected 3 keys after restore, got %d", restored.Len())
+	}
+	if restored.AppliedIndex() != 3 {
+		t.Errorf("Expected applied index 3 after restore, got %d", restored.AppliedIndex())
+	}
+	val, ok := restored.Get("key2")
+	if !ok || string(val) != "value-key2" {
+		t.Error("key2 not restored correctly")
+	}
+}
+
+func TestFSM_CompressedValues(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := newLimitedFSM(kvStore, cluster.LimitsConfig{MaxValueSize: 4096})
+	blob := bytes.Repeat([]byte(`{"field":"value"},`), 200)
+
+	// Values are compressed once when proposed and stored as they are in the log
+	node := &Node{compressThreshold: 64}
+	cmd := node.encodeValues(KVCommand{Op: "put", Key: "blob", Value: blob})
+	if !cmd.Encoded || len(cmd.Value) >= len(blob) {
+		t.Fatalf("Expected the proposed value to be compressed, got %d of %d bytes", len(cmd.Value), len(blob))
+	}
+	data, _ := json.Marshal(cmd)
+	if resp := fsm.Apply(&raft.Log{Index: 1, Data: data}); resp != nil {
+		t.Fatalf("Apply() returned error: %v", resp)
+	}
+	if val, ok := kvStore.Get("blob"); !ok || !bytes.Equal(val, blob) {
+		t.Error("Expected the stored value to decompress to the original")
+	}
+
+	// Limits apply to the original size, not the compressed one
+	tooLarge := node.encodeValues(KVCommand{Op: "put", Key: "big", Value: bytes.Repeat([]byte("a"), 5000)})
+	data, _ = json.Marshal(tooLarge)
+	var quotaErr *store.QuotaError
+	if resp, _ := fsm.Apply(&raft.Log{Index: 2, Data: data}).(error); !errors.As(resp, &quotaErr) {
+		t.Errorf("Expected value size quota error, got %v", resp)
+	}
+
+	// Snapshots carry the compressed bytes
+	snapshot, _ := fsm.Snapshot()
+	sink := &mockSnapshotSink{}
+	snapshot.Persist(sink)
+	snapshot.Release()
+	if sink.Len() >= len(blob) {
+		t.Errorf("Expected a compressed snapshot, got %d bytes", sink.Len())
+	}
+	restored := store.NewStore()
+	if err := NewFSM(restored).Restore(io.NopCloser(&sink.Buffer)); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	if val, ok := restored.Get("blob"); !ok || !bytes.Equal(val, blob) {
+		t.Error("Expected blob to survive a snapshot round trip")
+	}
+}
+
+func TestFSM_RestoresPlainValueSnapshot(t *testing.T) {
+	// Version 2 snapshots hold values without the flag byte
+	data := "{\"snapshot_version\":2,\"index\":7}\n{\"k\":\"key1\",\"v\":\"dmFsdWUx\"}\n"
+	kvStore := store.NewStore()
+	if err := NewFSM(kvStore).Restore(io.NopCloser(strings.NewReader(data))); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	if val, ok := kvStore.Get("key1"); !ok || string(val) != "value1" || kvStore.AppliedIndex() != 7 {
+		t.Errorf("Expected value1 at index 7, got %q at %d", val, kvStore.AppliedIndex())
+	}
+}
+
+func TestFSM_SkipsAppliedEntries(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+
+	data, _ := json.Marshal(KVCommand{Op: "put", Key: "key", Value: []byte("new")})
+	fsm.Apply(&raft.Log{Index: 5, Data: data})
+
+	// Replaying an older entry (as after a restart) must not overwrite newer state
+	stale, _ := json.Marshal(KVCommand{Op: "put", Key: "key", Value: []byte("old")})
+	fsm.Apply(&raft.Log{Index: 4, Data: stale})
+
+	val, _ := kvStore.Get("key")
+	if string(val) != "new" {
+		t.Errorf("Expected already-applied entry to be skipped, got %q", val)
+	}
+	if kvStore.AppliedIndex() != 5 {
+		t.Errorf("Expected applied index 5, got %d", kvStore.AppliedIndex())
+	}
+}
+
+// newLimitedFSM returns an FSM over a store that already holds replicated limits
+func newLimitedFSM(kvStore *store.Store, limits cluster.LimitsConfig) *FSM {
+	kvStore.PutClusterLimits(0, limits)
+	return NewFSM(kvStore)
+}
+
+func TestFSM_EnforcesLimits(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := newLimitedFSM(kvStore, cluster.LimitsConfig{MaxValueSize: 4, MaxKeys: 1})
+
+	// A leader with looser limits could still propose these entries
+	tooLarge, _ := json.Marshal(KVCommand{Op: "put", Key: "big", Value: []byte("12345")})
+	resp := fsm.Apply(&raft.Log{Index: 1, Data: tooLarge})
+	var quotaErr *store.QuotaError
+	if err, ok := resp.(error); !ok || !errors.As(err, &quotaErr) || quotaErr.Resource != store.ResourceValueSize {
+		t.Errorf("Expected value size quota error, got %v", resp)
+	}
+
+	ok1, _ := json.Marshal(KVCommand{Op: "put", Key: "key1", Value: []byte("1")})
+	if resp := fsm.Apply(&raft.Log{Index: 2, Data: ok1}); resp != nil {
+		t.Errorf("Expected put within limits to succeed, got %v", resp)
+	}
+	ok2, _ := json.Marshal(KVCommand{Op: "put", Key: "key2", Value: []byte("2")})
+	resp = fsm.Apply(&raft.Log{Index: 3, Data: ok2})
+	if err, ok := resp.(error); !ok || !errors.As(err, &quotaErr) || quotaErr.Resource != store.ResourceKeys {
+		t.Errorf("Expected key count quota error, got %v", resp)
+	}
+
+	if kvStore.Len() != 1 {
+		t.Errorf("Expected only key1 to be stored, got %d keys", kvStore.Len())
+	}
+	// Rejected entries still advance the applied index
+	if kvStore.AppliedIndex() != 3 {
+		t.Errorf("Expected applied index 3, got %d", kvStore.AppliedIndex())
+	}
+}
+
+func TestFSM_ReplicatedLimits(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+	apply := func(index uint64, cmd KVCommand) interface{} {
+		data, _ := json.Marshal(cmd)
+		return fsm.Apply(&raft.Log{Index: index, Data: data})
+	}
+
+	limits, _ := json.Marshal(cluster.LimitsConfig{MaxKeys: 1})
+	if resp := apply(1, KVCommand{Op: "limits_put", Value: limits}); resp != nil {
+		t.Fatalf("limits_put failed: %v", resp)
+	}
+	apply(2, KVCommand{Op: "put", Key: "key1", Value: []byte("1")})
+	var quotaErr *store.QuotaError
+	resp := apply(3, KVCommand{Op: "put", Key: "key2", Value: []byte("2")})
+	if err, ok := resp.(error); !ok || !errors.As(err, &quotaErr) || quotaErr.Resource != store.ResourceKeys {
+		t.Errorf("Expected the replicated key quota to reject key2, got %v", resp)
+	}
+
+	invalid, _ := json.Marshal(cluster.LimitsConfig{MaxKeys: -1})
+	if resp := apply(4, KVCommand{Op: "limits_put", Value: invalid}); resp == nil {
+		t.Error("Expected negative limits to be rejected")
+	}
+
+	// Replicas restored from a snapshot check entries against the same limits
+	snap, _ := fsm.Snapshot()
+	sink := &mockSnapshotSink{}
+	snap.Persist(sink)
+	restored := NewFSM(store.NewStore())
+	if err := restored.Restore(io.NopCloser(bytes.NewReader(sink.Bytes()))); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if restored.limits != (cluster.LimitsConfig{MaxKeys: 1}) {
+		t.Errorf("Expected the limits to be restored, got %+v", restored.limits)
+	}
+}
+
+func TestFSM_Batch(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := newLimitedFSM(kvStore, cluster.LimitsConfig{MaxKeys: 2})
+
+	batch, _ := json.Marshal(KVCommand{Op: "batch", Batch: []KVCommand{
+		{Op: "put", Key: "key1", Value: []byte("1")},
+		{Op: "put", Key: "key2", Value: []byte("2")},
+	}})
+	if resp := fsm.Apply(&raft.Log{Index: 1, Data: batch}); resp != nil {
+		t.Fatalf("Expected batch to apply, got %v", resp)
+	}
+	if kvStore.Len() != 2 || kvStore.AppliedIndex() != 1 {
+		t.Errorf("Expected 2 keys at index 1, got %d at %d", kvStore.Len(), kvStore.AppliedIndex())
+	}
+
+	// A batch over quota is rejected as a whole
+	overQuota, _ := json.Marshal(KVCommand{Op: "batch", Batch: []KVCommand{
+		{Op: "delete", Key: "key1"},
+		{Op: "put", Key: "key3", Value: []byte("3")},
+		{Op: "put", Key: "key4", Value: []byte("4")},
+	}})
+	var quotaErr *store.QuotaError
+	resp := fsm.Apply(&raft.Log{Index: 2, Data: overQuota})
+	if err, ok := resp.(error); !ok || !errors.As(err, &quotaErr) || quotaErr.Resource != store.ResourceKeys {
+		t.Errorf("Expected key count quota error, got %v", resp)
+	}
+	if _, ok := kvStore.Get("key1"); !ok || kvStore.Len() != 2 {
+		t.Errorf("Expected rejected batch to change nothing, got %d keys", kvStore.Len())
+	}
+
+	unknownNS, _ := json.Marshal(KVCommand{Op: "batch", Batch: []KVCommand{{Op: "put", Namespace: "missing", Key: "k"}}})
+	if resp := fsm.Apply(&raft.Log{Index: 3, Data: unknownNS}); resp != store.ErrNamespaceNotFound {
+		t.Errorf("Expected ErrNamespaceNotFound, got %v", resp)
+	}
+	if kvStore.AppliedIndex() != 3 {
+		t.Errorf("Expected applied index 3, got %d", kvStore.AppliedIndex())
+	}
+}
+
+func TestFSM_Namespaces(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+	apply := func(index uint64, cmd KVCommand) interface{} {
+		data, _ := json.Marshal(cmd)
+		return fsm.Apply(&raft.Log{Index: index, Data: data})
+	}
+
+	// Writes into a namespace that doesn't exist are rejected
+	resp := apply(1, KVCommand{Op: "put", Namespace: "team-a", Key: "key", Value: []byte("v")})
+	if err, ok := resp.(error); !ok || !errors.Is(err, store.ErrNamespaceNotFound) {
+		t.Errorf("Expected ErrNamespaceNotFound, got %v", resp)
+	}
+
+	spec, _ := json.Marshal(store.Namespace{Name: "team-a", Limits: cluster.LimitsConfig{MaxKeys: 1}})
+	if resp := apply(2, KVCommand{Op: "ns_create", Key: "team-a", Value: spec}); resp != nil {
+		t.Fatalf("ns_create failed: %v", resp)
+	}
+	if resp := apply(3, KVCommand{Op: "put", Namespace: "team-a", Key: "key", Value: []byte("v")}); resp != nil {
+		t.Fatalf("Namespaced put failed: %v", resp)
+	}
+	resp = apply(4, KVCommand{Op: "put", Namespace: "team-a", Key: "key2", Value: []byte("v")})
+	if _, ok := resp.(error); !ok {
+		t.Error("Expected the namespace key quota to reject a second key")
+	}
+
+	// Namespaces and their keys survive a snapshot
+	snap, _ := fsm.Snapshot()
+	sink := &mockSnapshotSink{}
+	snap.Persist(sink)
+	restored := store.NewStore()
+	if err := NewFSM(restored).Restore(io.NopCloser(bytes.NewReader(sink.Bytes()))); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if _, ok := restored.Namespace("team-a"); !ok {
+		t.Error("Namespace not restored")
+	}
+	if val, ok := restored.GetIn("team-a", "key"); !ok || string(val) != "v" {
+		t.Error("Namespaced key not restored")
+	}
+
+	if resp := apply(5, KVCommand{Op: "ns_delete", Key: "team-a"}); resp != nil {
+		t.Fatalf("ns_delete failed: %v", resp)
+	}
+	if kvStore.Len() != 0 {
+		t.Errorf("Expected an empty store after deleting the namespace, got %d keys", kvStore.Len())
+	}
+}
+
+func TestFSM_RBAC(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+	apply := func(index uint64, cmd KVCommand) interface{} {
+		data, _ := json.Marshal(cmd)
+		return fsm.Apply(&raft.Log{Index: index, Data: data})
+	}
+
+	user, _ := json.Marshal(store.User{Name: "alice", TokenHashes: []string{"h1"}, Roles: []string{"reader"}})
+	resp := apply(1, KVCommand{Op: "user_create", Key: "alice", Value: user})
+	if err, ok := resp.(error); !ok || !errors.Is(err, store.ErrRoleNotFound) {
+		t.Errorf("Expected a user with an unknown role to be rejected, got %v", resp)
+	}
+
+	role, _ := json.Marshal(store.Role{Name: "reader", Permissions: []acl.Permission{{Prefix: "app/", Access: acl.AccessRead}}})
+	if resp := apply(2, KVCommand{Op: "role_put", Key: "reader", Value: role}); resp != nil {
+		t.Fatalf("role_put failed: %v", resp)
+	}
+	if resp := apply(3, KVCommand{Op: "user_create", Key: "alice", Value: user}); resp != nil {
+		t.Fatalf("user_create failed: %v", resp)
+	}
+	if resp := apply(4, KVCommand{Op: "user_create", Key: "alice", Value: user}); !errors.Is(resp.(error), store.ErrUserExists) {
+		t.Errorf("Expected ErrUserExists, got %v", resp)
+	}
+	if resp := apply(5, KVCommand{Op: "role_delete", Key: "reader"}); !errors.Is(resp.(error), store.ErrRoleInUse) {
+		t.Errorf("Expected ErrRoleInUse, got %v", resp)
+	}
+
+	// An update without token hashes keeps the user's tokens
+	update, _ := json.Marshal(store.User{Name: "alice"})
+	if resp := apply(6, KVCommand{Op: "user_update", Key: "alice", Value: update}); resp != nil {
+		t.Fatalf("user_update failed: %v", resp)
+	}
+	if u, _ := kvStore.User("alice"); len(u.Roles) != 0 || len(u.TokenHashes) != 1 {
+		t.Errorf("Unexpected user after update: %+v", u)
+	}
+	if resp := apply(7, KVCommand{Op: "role_delete", Key: "reader"}); resp != nil {
+		t.Errorf("role_delete failed: %v", resp)
+	}
+	if resp := apply(8, KVCommand{Op: "user_delete", Key: "alice"}); resp != nil {
+		t.Errorf("user_delete failed: %v", resp)
+	}
+	if len(kvStore.Users()) != 0 || len(kvStore.Roles()) != 0 || kvStore.AppliedIndex() != 8 {
+		t.Errorf("Expected no users or roles at index 8, got %v, %v at %d", kvStore.Users(), kvStore.Roles(), kvStore.AppliedIndex())
+	}
+}
+
+func TestFSM_SystemNamespacesOutsideQuota(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := newLimitedFSM(kvStore, cluster.LimitsConfig{MaxKeys: 2, MaxTotalBytes: 32})
+	apply := func(index uint64, cmd KVCommand) interface{} {
+		data, _ := json.Marshal(cmd)
+		return fsm.Apply(&raft.Log{Index: index, Data: data})
+	}
+
+	if resp := apply(1, KVCommand{Op: "put", Key: "key1", Value: []byte("1")}); resp != nil {
+		t.Fatalf("put failed: %v", resp)
+	}
+
+	// Admin writes land in system namespaces and leave the tenant quota alone
+	spec, _ := json.Marshal(store.Namespace{Name: "team-a"})
+	if resp := apply(2, KVCommand{Op: "ns_create", Key: "team-a", Value: spec}); resp != nil {
+		t.Fatalf("ns_create failed: %v", resp)
+	}
+	role, _ := json.Marshal(store.Role{Name: "reader", Permissions: []acl.Permission{{Prefix: "app/", Access: acl.AccessRead}}})
+	if resp := apply(3, KVCommand{Op: "role_put", Key: "reader", Value: role}); resp != nil {
+		t.Fatalf("role_put failed: %v", resp)
+	}
+	user, _ := json.Marshal(store.User{Name: "alice", TokenHashes: []string{"h1"}, Roles: []string{"reader"}})
+	if resp := apply(4, KVCommand{Op: "user_create", Key: "alice", Value: user}); resp != nil {
+		t.Fatalf("user_create failed: %v", resp)
+	}
+	if kvStore.Len() != 1 || kvStore.Bytes() != int64(len("key1")+1) {
+		t.Errorf("Expected usage of key1 only, got %d keys, %d bytes", kvStore.Len(), kvStore.Bytes())
+	}
+
+	if resp := apply(5, KVCommand{Op: "put", Namespace: "team-a", Key: "key2", Value: []byte("2")}); resp != nil {
+		t.Errorf("Expected a tenant write within max_keys to succeed, got %v", resp)
+	}
+	var quotaErr *store.QuotaError
+	resp := apply(6, KVCommand{Op: "put", Key: "key3", Value: []byte("3")})
+	if err, ok := resp.(error); !ok || !errors.As(err, &quotaErr) || quotaErr.Resource != store.ResourceKeys {
+		t.Errorf("Expected key count quota error, got %v", resp)
+	}
+}
+
+
+func TestFSM_ConditionalPut(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+
+	if resp := applyAt(fsm, 1, time.Now(), KVCommand{Op: "put", Key: "key", Value: []byte("1"), Cond: "xx"}); !errors.Is(resp.(error), ErrConditionFailed) {
+		t.Errorf("Expected xx put of a missing key to fail, got %v", resp)
+	}
+	if resp := applyAt(fsm, 2, time.Now(), KVCommand{Op: "put", Key: "key", Value: []byte("1"), Cond: "nx"}); resp != nil {
+		t.Errorf("Expected nx put of a missing key to succeed, got %v", resp)
+	}
+	if resp := applyAt(fsm, 3, time.Now(), KVCommand{Op: "put", Key: "key", Value: []byte("2"), Cond: "nx"}); !errors.Is(resp.(error), ErrConditionFailed) {
+		t.Errorf("Expected nx put of an existing key to fail, got %v", resp)
+	}
+	if val, _ := kvStore.Get("key"); string(val) != "1" || kvStore.AppliedIndex() != 3 {
+		t.Errorf("Expected value 1 at index 3, got %q at %d", val, kvStore.AppliedIndex())
+	}
+}
+
+func TestFSM_IncrAndDel(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+	now := time.Now()
+
+	if resp := applyAt(fsm, 1, now, KVCommand{Op: "incr", Key: "counter", Delta: 5}); resp != int64(5) {
+		t.Errorf("Expected 5, got %v", resp)
+	}
+	if resp := applyAt(fsm, 2, now, KVCommand{Op: "incr", Key: "counter", Delta: -7}); resp != int64(-2) {
+		t.Errorf("Expected -2, got %v", resp)
+	}
+	applyAt(fsm, 3, now, KVCommand{Op: "put", Key: "max", Value: []byte("9223372036854775807")})
+	if resp := applyAt(fsm, 4, now, KVCommand{Op: "incr", Key: "max", Delta: 1}); !errors.Is(resp.(error), ErrOverflow) {
+		t.Errorf("Expected ErrOverflow, got %v", resp)
+	}
+	applyAt(fsm, 5, now, KVCommand{Op: "put", Key: "text", Value: []byte("abc")})
+	if resp := applyAt(fsm, 6, now, KVCommand{Op: "incr", Key: "text", Delta: 1}); !errors.Is(resp.(error), ErrNotInteger) {
+		t.Errorf("Expected ErrNotInteger, got %v", resp)
+	}
+
+	// Incrementing keeps the key's expiry
+	expireAt := now.Add(time.Hour).UnixMilli()
+	applyAt(fsm, 7, now, KVCommand{Op: "expire", Key: "counter", ExpireAt: expireAt})
+	applyAt(fsm, 8, now, KVCommand{Op: "incr", Key: "counter", Delta: 1})
+	if at, _ := kvStore.ExpiryIn(store.DefaultNamespace, "counter"); at.UnixMilli() != expireAt {
+		t.Errorf("Expected incr to keep the expiry, got %v", at)
+	}
+
+	if resp := applyAt(fsm, 9, now, KVCommand{Op: "del", Keys: []string{"counter", "text", "text", "missing"}}); resp != 2 {
+		t.Errorf("Expected 2 keys removed, got %v", resp)
+	}
+	if kvStore.Len() != 1 {
+		t.Errorf("Expected 1 key left, got %d", kvStore.Len())
+	}
+}
+
+func TestFSM_Patch(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+	now := time.Now()
+
+	applyAt(fsm, 1, now, KVCommand{Op: "put", Key: "doc", Value: []byte(`{"a":{"b":1},"tags":["x"]}`)})
+	if resp := applyAt(fsm, 2, now, KVCommand{Op: "patch", Key: "doc", Patch: jsondoc.MergePatch, Value: []byte(`{"a":{"b":null,"c":2}}`)}); resp != nil {
+		t.Fatalf("Merge patch failed: %v", resp)
+	}
+	if val, _ := kvStore.Get("doc"); string(val) != `{"a":{"c":2},"tags":["x"]}` {
+		t.Errorf("Unexpected document after merge patch: %s", val)
+	}
+
+	patch := []byte(`[{"op":"add","path":"/tags/-","value":"y"},{"op":"replace","path":"/a/c","value":3}]`)
+	if resp := applyAt(fsm, 3, now, KVCommand{Op: "patch", Key: "doc", Patch: jsondoc.JSONPatch, Value: patch, Compress: 1}); resp != nil {
+		t.Fatalf("JSON Patch failed: %v", resp)
+	}
+	if val, _ := kvStore.Get("doc"); string(val) != `{"a":{"c":3},"tags":["x","y"]}` {
+		t.Errorf("Unexpected document after JSON Patch: %s", val)
+	}
+
+	// A failed test leaves the document unchanged
+	patch = []byte(`[{"op":"remove","path":"/tags"},{"op":"test","path":"/a/c","value":4}]`)
+	if resp := applyAt(fsm, 4, now, KVCommand{Op: "patch", Key: "doc", Patch: jsondoc.JSONPatch, Value: patch}); !errors.Is(resp.(error), jsondoc.ErrPatchConflict) {
+		t.Errorf("Expected ErrPatchConflict, got %v", resp)
+	}
+	if val, _ := kvStore.Get("doc"); string(val) != `{"a":{"c":3},"tags":["x","y"]}` {
+		t.Errorf("Expected failed patch to change nothing, got %s", val)
+	}
+	if kvStore.AppliedIndex() != 4 {
+		t.Errorf("Expected applied index 4, got %d", kvStore.AppliedIndex())
+	}
+
+	applyAt(fsm, 5, now, KVCommand{Op: "put", Key: "text", Value: []byte("plain")})
+	if resp := applyAt(fsm, 6, now, KVCommand{Op: "patch", Key: "text", Patch: jsondoc.MergePatch, Value: []byte(`{}`)}); !errors.Is(resp.(error), jsondoc.ErrNotJSON) {
+		t.Errorf("Expected ErrNotJSON, got %v", resp)
+	}
+	if resp := applyAt(fsm, 7, now, KVCommand{Op: "patch", Key: "missing", Patch: jsondoc.MergePatch, Value: []byte(`{}`)}); !errors.Is(resp.(error), ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", resp)
+	}
+}
+
+func TestFSM_Decr(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+	now := time.Now()
+
+	if resp := applyAt(fsm, 1, now, KVCommand{Op: "decr", Key: "stock", Delta: 3}); resp != int64(-3) {
+		t.Errorf("Expected -3, got %v", resp)
+	}
+	if resp := applyAt(fsm, 2, now, KVCommand{Op: "decr", Key: "stock", Delta: -10}); resp != int64(7) {
+		t.Errorf("Expected 7, got %v", resp)
+	}
+	if val, _ := kvStore.Get("stock"); string(val) != "7" {
+		t.Errorf("Expected stored value 7, got %q", val)
+	}
+
+	applyAt(fsm, 3, now, KVCommand{Op: "put", Key: "min", Value: []byte("-9223372036854775808")})
+	if resp := applyAt(fsm, 4, now, KVCommand{Op: "decr", Key: "min", Delta: 1}); !errors.Is(resp.(error), ErrOverflow) {
+		t.Errorf("Expected ErrOverflow, got %v", resp)
+	}
+	// Negating the smallest delta would overflow too
+	if resp := applyAt(fsm, 5, now, KVCommand{Op: "decr", Key: "stock", Delta: math.MinInt64}); !errors.Is(resp.(error), ErrOverflow) {
+		t.Errorf("Expected ErrOverflow, got %v", resp)
+	}
+	if val, _ := kvStore.Get("stock"); string(val) != "7" {
+		t.Errorf("Expected rejected decrements to change nothing, got %q", val)
+	}
+}
+
+func TestFSM_Meta(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+	t1 := time.UnixMilli(1700000000000)
+	t2 := t1.Add(time.Minute)
+
+	applyAt(fsm, 1, t1, KVCommand{Op: "put", Key: "doc", Value: []byte(`{"a":1}`), ContentType: "application/json", Meta: map[string]string{"Owner": "ops"}})
+	applyAt(fsm, 2, t2, KVCommand{Op: "patch", Key: "doc", Patch: jsondoc.MergePatch, Value: []byte(`{"b":2}`)})
+	meta, ok := kvStore.MetaIn(store.DefaultNamespace, "doc")
+	if !ok {
+		t.Fatal("Expected metadata for doc")
+	}
+	if meta.CreateIndex != 1 || meta.ModifyIndex != 2 || meta.Version != 2 || meta.Created != t1.UnixMilli() || meta.Modified != t2.UnixMilli() {
+		t.Errorf("Unexpected indexes or times %+v", meta)
+	}
+	if meta.ContentType != "application/json" || meta.Headers["Owner"] != "ops" || meta.Size != int64(len(`{"a":1,"b":2}`)) {
+		t.Errorf("Expected patch to keep content type and headers, got %+v", meta)
+	}
+
+	// A put replaces the content type and headers
+	applyAt(fsm, 3, t2, KVCommand{Op: "put", Key: "doc", Value: []byte("text")})
+	if meta, _ := kvStore.MetaIn(store.DefaultNamespace, "doc"); meta.CreateIndex != 1 || meta.Version != 3 || meta.ContentType != "" || meta.Headers != nil {
+		t.Errorf("Unexpected metadata after put %+v", meta)
+	}
+
+	// Deleting the key starts it over
+	applyAt(fsm, 4, t2, KVCommand{Op: "delete", Key: "doc"})
+	applyAt(fsm, 5, t2, KVCommand{Op: "incr", Key: "doc", Delta: 1})
+	if meta, _ := kvStore.MetaIn(store.DefaultNamespace, "doc"); meta.CreateIndex != 5 || meta.Version != 1 {
+		t.Errorf("Expected a recreated key, got %+v", meta)
+	}
+
+	// A key written twice in one batch gets two versions
+	applyAt(fsm, 6, t2, KVCommand{Op: "batch", Batch: []KVCommand{
+		{Op: "put", Key: "k", Value: []byte("1")},
+		{Op: "put", Key: "k", Value: []byte("2"), ContentType: "text/plain"},
+	}})
+	if meta, _ := kvStore.MetaIn(store.DefaultNamespace, "k"); meta.CreateIndex != 6 || meta.Version != 2 || meta.ContentType != "text/plain" {
+		t.Errorf("Unexpected metadata after batch %+v", meta)
+	}
+
+	// Metadata is part of snapshots
+	snapshot, _ := fsm.Snapshot()
+	sink := &mockSnapshotSink{}
+	snapshot.Persist(sink)
+	snapshot.Release()
+	restored := store.NewStore()
+	if err := NewFSM(restored).Restore(io.NopCloser(&sink.Buffer)); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	if meta, _ := restored.MetaIn(store.DefaultNamespace, "k"); meta.ModifyIndex != 6 || meta.ContentType != "text/plain" {
+		t.Errorf("Expected metadata to survive a snapshot, got %+v", meta)
+	}
+	if restored.Hash() != kvStore.Hash() {
+		t.Error("Expected the restored store to hash the same")
+	}
+}
+
+func TestFSM_NodeInfo(t *testing.T) {
+	kvStore := store.NewStore()
+	fsm := NewFSM(kvStore)
+
+	info, _ := json.Marshal(store.NodeInfo{RaftAddr: "10.0.0.1:7000", RedisAddr: "kv-1:6379"})
+	data, _ := json.Marshal(KVCommand{Op: "node_put", Key: "10.0.0.1:7000", Value: info})
+	if resp := fsm.Apply(&raft.Log{Index: 1, Data: data}); resp != nil {
+		t.Fatalf("node_put failed: %v", resp)
+	}
+	got, ok := kvStore.NodeInfo("10.0.0.1:7000")
+	if !ok || got.RedisAddr != "kv-1:6379" {
+		t.Errorf("Expected the advertised address to be stored, got %+v", got)
+	}
+	if u := kvStore.Usage(store.DefaultNamespace); u.Keys != 0 {
+		t.Errorf("Expected node info to stay out of the default namespace, got %d keys", u.Keys)
+	}
+}
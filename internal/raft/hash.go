@@ -0,0 +1,215 @@
+package raft
+
+import (
+	"distributed_cloud_service/internal/metrics"
+	"distributed_cloud_service/internal/store"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultHashHistory is the number of recent state hashes kept for comparison by index
+const DefaultHashHistory = 1024
+
+// StateHash is the hash of the store's contents once the entry at Index was applied
+type StateHash struct {
+	Index uint64 `json:"index"`
+	Hash  string `json:"hash"`
+}
+
+// HashCheck is the result of comparing this node's state hash with the leader's
+type HashCheck struct {
+	Index    uint64    `json:"index"`
+	Expected string    `json:"expected"` // hash the leader had at Index
+	Actual   string    `json:"actual"`   // hash this node had at Index
+	Match    bool      `json:"match"`
+	Time     time.Time `json:"time"`
+}
+
+// hashHistory is a ring buffer of the state hashes after recent entries
+type hashHistory struct {
+	mu      sync.Mutex
+	entries []StateHash
+	head    int // index of the oldest entry
+	count   int
+}
+
+func newHashHistory(size int) *hashHistory {
+	if size <= 0 {
+		size = DefaultHashHistory
+	}
+	return &hashHistory{entries: make([]StateHash, size)}
+}
+
+func (h *hashHistory) record(sh StateHash) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries[(h.head+h.count)%len(h.entries)] = sh
+	if h.count < len(h.entries) {
+		h.count++
+	} else {
+		h.head = (h.head + 1) % len(h.entries)
+	}
+}
+
+// latest returns the most recently recorded hash
+func (h *hashHistory) latest() (StateHash, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 {
+		return StateHash{}, false
+	}
+	return h.entries[(h.head+h.count-1)%len(h.entries)], true
+}
+
+// at returns the hash recorded for index, searching from the newest entry
+func (h *hashHistory) at(index uint64) (StateHash, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := h.count - 1; i >= 0; i-- {
+		sh := h.entries[(h.head+i)%len(h.entries)]
+		if sh.Index == index {
+			return sh, true
+		}
+		if sh.Index < index {
+			break
+		}
+	}
+	return StateHash{}, false
+}
+
+func (h *hashHistory) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.head, h.count = 0, 0
+}
+
+// recordHash remembers the store's hash once the entry at index has been applied
+func (f *FSM) recordHash(index uint64) {
+	f.hashes.record(StateHash{Index: index, Hash: store.FormatHash(f.store.Hash())})
+}
+
+// StateHash returns this node's state hash after the entry at index, or the latest one
+// for index 0. It reports false if index is not (or no longer) in the history.
+func (f *FSM) StateHash(index uint64) (StateHash, bool) {
+	if index == 0 {
+		return f.hashes.latest()
+	}
+	return f.hashes.at(index)
+}
+
+// LastHashCheck returns the result of the most recent comparison with the leader's hash
+func (f *FSM) LastHashCheck() (HashCheck, bool) {
+	f.checkMu.Lock()
+	defer f.checkMu.Unlock()
+	if f.lastCheck == nil {
+		return HashCheck{}, false
+	}
+	return *f.lastCheck, true
+}
+
+// checkHash compares the leader's state hash with this node's hash at the same index.
+// Replicas that restored a later snapshot no longer know their hash at that index and skip the check.
+func (f *FSM) checkHash(leader StateHash) {
+	local, ok := f.hashes.at(leader.Index)
+	if !ok {
+		metrics.RaftStateHashChecks.WithLabelValues("skipped").Inc()
+		return
+	}
+
+	check := HashCheck{
+		Index:    leader.Index,
+		Expected: leader.Hash,
+		Actual:   local.Hash,
+		Match:    local.Hash == leader.Hash,
+		Time:     time.Now(),
+	}
+	f.checkMu.Lock()
+	f.lastCheck = &check
+	f.checkMu.Unlock()
+
+	if check.Match {
+		metrics.RaftStateHashChecks.WithLabelValues("match").Inc()
+		metrics.RaftStateDiverged.Set(0)
+		return
+	}
+	metrics.RaftStateHashChecks.WithLabelValues("mismatch").Inc()
+	metrics.RaftStateDiverged.Set(1)
+	if f.onDivergence != nil {
+		f.onDivergence(check)
+	}
+}
+
+// divergenceAlert returns the FSM callback that raises a state_diverged event
+func divergenceAlert(nodeID string, events *EventBus, logger *slog.Logger) func(HashCheck) {
+	return func(c HashCheck) {
+		e := events.Publish(Event{
+			Type:         EventStateDiverged,
+			NodeID:       nodeID,
+			Index:        c.Index,
+			Hash:         c.Actual,
+			ExpectedHash: c.Expected,
+		})
+		metrics.RaftEventsTotal.WithLabelValues(string(e.Type)).Inc()
+		logEvent(logger, e)
+	}
+}
+
+// StateHash returns this node's state hash after the entry at index (0 for the latest)
+func (n *Node) StateHash(index uint64) (StateHash, bool) {
+	return n.fsm.StateHash(index)
+}
+
+// LastHashCheck returns the result of this node's most recent comparison with the leader
+func (n *Node) LastHashCheck() (HashCheck, bool) {
+	return n.fsm.LastHashCheck()
+}
+
+// checkHashes has the leader propose its latest state hash every interval. Each replica
+// compares it with its own hash at the same index when it applies the entry.
+func (n *Node) checkHashes(interval time.Duration) {
+	defer close(n.hashCheckDone)
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var prev uint64
+	for {
+		select {
+		case <-ticker.C:
+		case <-n.stopHashCheck:
+			return
+		}
+		if !n.IsLeader() {
+			continue
+		}
+		index, err := n.proposeHashCheck(prev)
+		if err != nil {
+			n.logger.Warn("failed to propose state hash check", "error", err)
+			continue
+		}
+		prev = index
+	}
+}
+
+// proposeHashCheck proposes the leader's latest state hash, unless nothing was applied
+// since the check entry at index prev. It returns the index of the new check entry.
+func (n *Node) proposeHashCheck(prev uint64) (uint64, error) {
+	sh, ok := n.fsm.StateHash(0)
+	if !ok || sh.Index == prev {
+		return prev, nil
+	}
+	cmd := KVCommand{Op: "hash_check", Check: &sh}
+	data, err := cmd.Marshal()
+	if err != nil {
+		return prev, err
+	}
+	future := n.raft.Apply(data, 10*time.Second)
+	if err := future.Error(); err != nil {
+		return prev, fmt.Errorf("hash check at index %d: %w", sh.Index, err)
+	}
+	return future.Index(), nil
+}
@@ -0,0 +1,104 @@
+package raft
+
+import (
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func applyCommand(t *testing.T, fsm *FSM, index uint64, cmd KVCommand) {
+	t.Helper()
+	data, _ := json.Marshal(cmd)
+	if resp := fsm.Apply(&raft.Log{Index: index, Data: data}); resp != nil {
+		t.Fatalf("Apply(%d) returned %v", index, resp)
+	}
+}
+
+func TestFSM_StateHash(t *testing.T) {
+	a, b := NewFSM(store.NewStore()), NewFSM(store.NewStore())
+	for _, fsm := range []*FSM{a, b} {
+		applyCommand(t, fsm, 1, KVCommand{Op: "put", Key: "key1", Value: []byte("1")})
+		applyCommand(t, fsm, 2, KVCommand{Op: "put", Key: "key2", Value: []byte("2")})
+	}
+	applyCommand(t, b, 3, KVCommand{Op: "put", Key: "key1", Value: []byte("changed")})
+
+	latest, _ := a.StateHash(0)
+	if latest.Index != 2 {
+		t.Errorf("Expected latest hash at index 2, got %d", latest.Index)
+	}
+	if at2, ok := b.StateHash(2); !ok || at2 != latest {
+		t.Errorf("Expected %+v at index 2, got %+v (%v)", latest, at2, ok)
+	}
+	if at3, _ := b.StateHash(3); at3.Hash == latest.Hash {
+		t.Error("Hash should change with the data")
+	}
+	if _, ok := a.StateHash(7); ok {
+		t.Error("Expected no hash for an index that wasn't applied")
+	}
+
+	// A restored replica reports the same hash at the snapshot index
+	snap, _ := b.Snapshot()
+	sink := &mockSnapshotSink{}
+	snap.Persist(sink)
+	snap.Release()
+	restored := NewFSM(store.NewStore())
+	if err := restored.Restore(io.NopCloser(&sink.Buffer)); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	want, _ := b.StateHash(3)
+	if got, ok := restored.StateHash(3); !ok || got != want {
+		t.Errorf("Expected %+v after restore, got %+v", want, got)
+	}
+}
+
+func TestFSM_HashCheck(t *testing.T) {
+	fsm := NewFSM(store.NewStore())
+	var alerts []HashCheck
+	fsm.onDivergence = func(c HashCheck) { alerts = append(alerts, c) }
+
+	applyCommand(t, fsm, 1, KVCommand{Op: "put", Key: "key1", Value: []byte("1")})
+	own, _ := fsm.StateHash(1)
+
+	applyCommand(t, fsm, 2, KVCommand{Op: "hash_check", Check: &own})
+	if check, ok := fsm.LastHashCheck(); !ok || !check.Match || check.Index != 1 {
+		t.Errorf("Expected a matching check at index 1, got %+v", check)
+	}
+	if len(alerts) != 0 {
+		t.Errorf("Unexpected divergence alert: %+v", alerts)
+	}
+	if fsm.store.AppliedIndex() != 2 {
+		t.Errorf("Expected applied index 2, got %d", fsm.store.AppliedIndex())
+	}
+
+	applyCommand(t, fsm, 3, KVCommand{Op: "hash_check", Check: &StateHash{Index: 1, Hash: "0123456789abcdef"}})
+	if len(alerts) != 1 || alerts[0].Expected != "0123456789abcdef" || alerts[0].Actual != own.Hash {
+		t.Errorf("Expected one divergence alert, got %+v", alerts)
+	}
+
+	// An index this node has no hash for is skipped, keeping the last result
+	applyCommand(t, fsm, 4, KVCommand{Op: "hash_check", Check: &StateHash{Index: 100, Hash: "x"}})
+	if check, _ := fsm.LastHashCheck(); check.Match || check.Index != 1 || len(alerts) != 1 {
+		t.Errorf("Unknown index should be skipped, got %+v", check)
+	}
+}
+
+func TestHashHistory_Ring(t *testing.T) {
+	h := newHashHistory(3)
+	for i := uint64(1); i <= 5; i++ {
+		h.record(StateHash{Index: i})
+	}
+	if _, ok := h.at(2); ok {
+		t.Error("Index 2 should have been evicted")
+	}
+	for _, i := range []uint64{3, 4, 5} {
+		if sh, ok := h.at(i); !ok || sh.Index != i {
+			t.Errorf("Expected index %d in history, got %+v", i, sh)
+		}
+	}
+	if sh, _ := h.latest(); sh.Index != 5 {
+		t.Errorf("Expected latest index 5, got %d", sh.Index)
+	}
+}
@@ -1,203 +1,496 @@
-package raft
-
-import (
-	"context"
-	"distributed_cloud_service/internal/cluster"
-	"distributed_cloud_service/internal/store"
-	"encoding/json"
-	"fmt"
-	"net"
-	"os"
-	"path/filepath"
-	"strconv"
-	"time"
-
-	"github.com/hashicorp/raft"
-	raftboltdb "github.com/hashicorp/raft-boltdb"
-)
-
-// Node wraps a Raft node
-type Node struct {
-	raft *raft.Raft
-	fsm  *FSM
-}
-
-// NewNode creates and initializes a new Raft node
-func NewNode(store *store.Store, config *cluster.Config, dataDir string) (*Node, error) {
-	// Create FSM
-	fsm := NewFSM(store)
-
-	// Create Raft configuration
-	raftConfig := raft.DefaultConfig()
-	raftConfig.LocalID = raft.ServerID(config.NodeID)
-	// Reduce timeouts for faster leader election during testing
-	// Default: HeartbeatTimeout=1s, ElectionTimeout=1s, but randomized
-	raftConfig.HeartbeatTimeout = 500 * time.Millisecond
-	raftConfig.ElectionTimeout = 500 * time.Millisecond
-	raftConfig.LeaderLeaseTimeout = 250 * time.Millisecond
-
-	// Create log store
-	logStore, err := raftboltdb.NewBoltStore(filepath.Join(dataDir, "raft.db"))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create log store: %w", err)
-	}
-
-	// Create stable store
-	stableStore, err := raftboltdb.NewBoltStore(filepath.Join(dataDir, "stable.db"))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create stable store: %w", err)
-	}
-
-	// Create snapshot store
-	snapshotStore, err := raft.NewFileSnapshotStore(dataDir, 3, os.Stderr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create snapshot store: %w", err)
-	}
-
-	// Detect existing Raft state to decide whether to bootstrap
-	existingState, err := raft.HasExistingState(logStore, stableStore, snapshotStore)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check existing raft state: %w", err)
-	}
-
-	// Determine Raft address
-	raftAddr := config.RaftAddr
-	if raftAddr == "" {
-		host, port, err := net.SplitHostPort(config.ListenAddr)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse listen address: %w", err)
-		}
-		raftAddr = fmt.Sprintf("%s:%d", host, portToInt(port)+10)
-	}
-	raftTCPAddr, err := net.ResolveTCPAddr("tcp", raftAddr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to resolve Raft address: %w", err)
-	}
-
-	transport, err := raft.NewTCPTransport(raftAddr, raftTCPAddr, 3, 10*time.Second, os.Stderr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create transport: %w", err)
-	}
-
-	// Create Raft instance
-	r, err := raft.NewRaft(raftConfig, fsm, logStore, stableStore, snapshotStore, transport)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create raft: %w", err)
-	}
-
-	// Bootstrap cluster only if there is no existing state and Bootstrap is true
-	if !existingState && config.Bootstrap {
-		future := r.BootstrapCluster(raft.Configuration{
-			Servers: []raft.Server{
-				{
-					ID:      raft.ServerID(config.NodeID),
-					Address: raft.ServerAddress(raftAddr),
-				},
-			},
-		})
-		if err := future.Error(); err != nil {
-			fmt.Printf("Bootstrap note: %v (cluster may already exist)\n", err)
-		} else {
-			fmt.Printf("Bootstrap successful: %s\n", config.NodeID)
-		}
-	} else if existingState {
-		fmt.Printf("Existing Raft state detected, joining as %s\n", config.NodeID)
-	}
-
-	return &Node{
-		raft: r,
-		fsm:  fsm,
-	}, nil
-}
-
-// Apply proposes a command to the Raft cluster
-func (n *Node) Apply(cmd KVCommand) error {
-	data, err := cmd.Marshal()
-	if err != nil {
-		return err
-	}
-
-	future := n.raft.Apply(data, 10*time.Second)
-	if err := future.Error(); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// IsLeader returns true if this node is the leader
-func (n *Node) IsLeader() bool {
-	return n.raft.State() == raft.Leader
-}
-
-// Leader returns the address of the current leader
-func (n *Node) Leader() string {
-	return string(n.raft.Leader())
-}
-
-// GetRaft returns the underlying Raft instance
-func (n *Node) GetRaft() *raft.Raft {
-	return n.raft
-}
-
-// Join adds a new voter to the Raft cluster using the provided node ID and raft address.
-func (n *Node) Join(nodeID string, raftAddress string) error {
-	srvID := raft.ServerID(nodeID)
-	srvAddr := raft.ServerAddress(raftAddress)
-	future := n.raft.AddVoter(srvID, srvAddr, 0, 0)
-	return future.Error()
-}
-
-// Remove removes a node from the Raft cluster
-func (n *Node) Remove(nodeID string) error {
-	srvID := raft.ServerID(nodeID)
-	future := n.raft.RemoveServer(srvID, 0, 0)
-	return future.Error()
-}
-
-// VerifyRead ensures linearizable reads
-// For leaders: reads are always linearizable
-// For followers: validates node state (true ReadIndex would require library support)
-func (n *Node) VerifyRead(ctx context.Context) error {
-	if n.IsLeader() {
-		// Leader can read directly (leader read is always linearizable)
-		return nil
-	}
-	
-	// For followers, ensure node is in a valid state
-	// Note: HashiCorp Raft doesn't expose ReadIndex directly in this version
-	// For true linearizability, clients should read from the leader
-	// This validates the node is operational, but doesn't guarantee linearizability
-	state := n.raft.State()
-	if state != raft.Follower && state != raft.Leader {
-		return fmt.Errorf("node not in valid state for reads: %s", state.String())
-	}
-	
-	// In production, you would:
-	// 1. Implement ReadIndex if library supports it
-	// 2. Or redirect follower reads to leader
-	// 3. Or use barrier/barrierFuture to ensure catch-up
-	
-	return nil
-}
-
-// Shutdown gracefully shuts down the Raft node
-func (n *Node) Shutdown() error {
-	future := n.raft.Shutdown()
-	return future.Error()
-}
-
-// Marshal serializes a KVCommand to JSON
-func (c *KVCommand) Marshal() ([]byte, error) {
-	return json.Marshal(c)
-}
-
-// portToInt converts a port string to int
-func portToInt(port string) int {
-	p, err := strconv.Atoi(port)
-	if err != nil {
-		return 0
-	}
-	return p
-}
-
+package raft
+
+import (
+	"context"
+	"distributed_cloud_service/internal/cluster"
+	"distributed_cloud_service/internal/metrics"
+	"distributed_cloud_service/internal/store"
+	"distributed_cloud_service/internal/wal"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+)
+
+// logStore is a Raft log store that holds files open until closed
+type logStore interface {
+	raft.LogStore
+	io.Closer
+}
+
+// openLogStore opens the Raft log store selected by the storage config
+func openLogStore(cfg cluster.StorageConfig, dataDir string) (logStore, error) {
+	if cfg.LogStore == "wal" {
+		return wal.Open(filepath.Join(dataDir, "wal"), wal.Options{SegmentSize: cfg.WALSegmentSize})
+	}
+	return raftboltdb.NewBoltStore(filepath.Join(dataDir, "raft.db"))
+}
+
+// Node wraps a Raft node
+type Node struct {
+	raft    *raft.Raft
+	fsm     *FSM
+	id      string
+	dataDir string
+
+	// compressThreshold is the value size from which puts are compressed before they are proposed
+	compressThreshold int
+
+	// redisAddr is the RESP address advertised to followers while this node leads
+	redisAddr string
+
+	// limits are replicated to the cluster while this node leads
+	limits cluster.LimitsConfig
+
+	tuningMu sync.Mutex
+	tuning   cluster.RaftConfig
+
+	// Observer plumbing feeding the event bus
+	observer     *raft.Observer
+	observations chan raft.Observation
+	stopObserver chan struct{}
+	observerDone chan struct{}
+	events       *EventBus
+	logger       *slog.Logger
+
+	// Leader loop proposing state hash checks
+	stopHashCheck chan struct{}
+	hashCheckDone chan struct{}
+
+	// Leader loop deleting expired keys
+	stopExpiry chan struct{}
+	expiryDone chan struct{}
+
+	// Log and stable stores, closed after Raft shuts down
+	closers []io.Closer
+}
+
+// NewNode creates and initializes a new Raft node
+func NewNode(store *store.Store, config *cluster.Config, dataDir string) (*Node, error) {
+	// Create FSM
+	limits := config.Limits.WithDefaults()
+	if err := limits.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid limits: %w", err)
+	}
+	fsm := NewFSM(store)
+
+	// Create Raft configuration from the (defaulted) tuning in the node config
+	tuning := config.Raft.WithDefaults()
+	if err := tuning.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid raft config: %w", err)
+	}
+	raftConfig := raft.DefaultConfig()
+	raftConfig.LocalID = raft.ServerID(config.NodeID)
+	applyTuning(raftConfig, tuning)
+
+	// Create log store
+	logStore, err := openLogStore(config.Storage, dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log store: %w", err)
+	}
+
+	// Create stable store
+	stableStore, err := raftboltdb.NewBoltStore(filepath.Join(dataDir, "stable.db"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stable store: %w", err)
+	}
+
+	// Create snapshot store
+	snapshotStore, err := raft.NewFileSnapshotStore(dataDir, tuning.SnapshotRetain, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot store: %w", err)
+	}
+
+	// A persistent store that already holds everything up to the latest snapshot
+	// doesn't need the snapshot restored; Apply skips entries it has already seen
+	if store.Persistent() {
+		snapshots, err := snapshotStore.List()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list snapshots: %w", err)
+		}
+		if len(snapshots) == 0 || store.AppliedIndex() >= snapshots[0].Index {
+			raftConfig.NoSnapshotRestoreOnStart = true
+		}
+	}
+
+	// Detect existing Raft state to decide whether to bootstrap
+	existingState, err := raft.HasExistingState(logStore, stableStore, snapshotStore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing raft state: %w", err)
+	}
+
+	// Determine Raft address
+	raftAddr := config.RaftAddr
+	if raftAddr == "" {
+		host, port, err := net.SplitHostPort(config.ListenAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse listen address: %w", err)
+		}
+		raftAddr = fmt.Sprintf("%s:%d", host, portToInt(port)+10)
+	}
+	raftTCPAddr, err := net.ResolveTCPAddr("tcp", raftAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve Raft address: %w", err)
+	}
+
+	if err := config.RaftTLS.Validate("raft_tls"); err != nil {
+		return nil, err
+	}
+	transport, err := newTransport(config, raftAddr, raftTCPAddr, os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transport: %w", err)
+	}
+
+	// Rewrite the membership from peers.json if an operator is recovering from quorum loss
+	logger := slog.Default().With("component", "raft")
+	events := NewEventBus(DefaultEventHistory)
+	fsm.onDivergence = divergenceAlert(config.NodeID, events, logger)
+	if _, err := recoverFromPeersFile(dataDir, raftConfig, fsm, logStore, stableStore, snapshotStore, transport, logger); err != nil {
+		return nil, err
+	}
+
+	// Create Raft instance
+	r, err := raft.NewRaft(raftConfig, fsm, logStore, stableStore, snapshotStore, transport)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create raft: %w", err)
+	}
+
+	// Bootstrap cluster only if there is no existing state and Bootstrap is true
+	if !existingState && config.Bootstrap {
+		future := r.BootstrapCluster(raft.Configuration{
+			Servers: []raft.Server{
+				{
+					ID:      raft.ServerID(config.NodeID),
+					Address: raft.ServerAddress(raftAddr),
+				},
+			},
+		})
+		if err := future.Error(); err != nil {
+			fmt.Printf("Bootstrap note: %v (cluster may already exist)\n", err)
+		} else {
+			fmt.Printf("Bootstrap successful: %s\n", config.NodeID)
+		}
+	} else if existingState {
+		fmt.Printf("Existing Raft state detected, joining as %s\n", config.NodeID)
+	}
+
+	node := &Node{
+		raft:              r,
+		fsm:               fsm,
+		id:                config.NodeID,
+		dataDir:           dataDir,
+		compressThreshold: compressionThreshold(config.Storage),
+		redisAddr:         config.Redis.Advertised(),
+		limits:            limits,
+		tuning:            tuning,
+		observations:      make(chan raft.Observation, 64),
+		stopObserver:      make(chan struct{}),
+		observerDone:      make(chan struct{}),
+		events:            events,
+		logger:            logger,
+		stopHashCheck:     make(chan struct{}),
+		hashCheckDone:     make(chan struct{}),
+		stopExpiry:        make(chan struct{}),
+		expiryDone:        make(chan struct{}),
+		closers:           []io.Closer{logStore, stableStore},
+	}
+
+	// Register an observer so leadership, peer and election changes reach the event bus
+	node.observer = raft.NewObserver(node.observations, false, nil)
+	r.RegisterObserver(node.observer)
+	go node.watchObservations(config.NodeID)
+	go node.checkHashes(tuning.HashCheckInterval)
+	go node.expireKeys()
+
+	return node, nil
+}
+
+// compressionThreshold resolves the configured threshold; 0 or less disables compression
+func compressionThreshold(cfg cluster.StorageConfig) int {
+	if cfg.CompressionThreshold == 0 {
+		return store.DefaultCompressionThreshold
+	}
+	return cfg.CompressionThreshold
+}
+
+// Apply proposes a command to the Raft cluster
+func (n *Node) Apply(cmd KVCommand) error {
+	_, err := n.Propose(cmd)
+	return err
+}
+
+// Propose proposes a command to the Raft cluster and returns the FSM's response,
+// such as the new value of "incr" or the number of keys removed by "del"
+func (n *Node) Propose(cmd KVCommand) (interface{}, error) {
+	cmd = n.encodeValues(cmd)
+	data, err := cmd.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	future := n.raft.Apply(data, 10*time.Second)
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+
+	// The FSM reports rejected commands (e.g. quota errors) through the response
+	if err, ok := future.Response().(error); ok {
+		return nil, err
+	}
+	return future.Response(), nil
+}
+
+// encodeValues compresses the values of puts before they are proposed, so the log,
+// the store and snapshots all carry the same compressed bytes. Patches carry the
+// threshold instead, since the FSM builds their value.
+func (n *Node) encodeValues(cmd KVCommand) KVCommand {
+	switch cmd.Op {
+	case "patch":
+		cmd.Compress = n.compressThreshold
+	case "put":
+		if !cmd.Encoded {
+			cmd.Value = n.encodeValue(cmd.Value)
+			cmd.Encoded = true
+		}
+	case "batch":
+		batch := make([]KVCommand, len(cmd.Batch))
+		for i, c := range cmd.Batch {
+			batch[i] = n.encodeValues(c)
+		}
+		cmd.Batch = batch
+	}
+	return cmd
+}
+
+func (n *Node) encodeValue(val []byte) []byte {
+	enc := store.EncodeValue(val, n.compressThreshold)
+	if n.compressThreshold > 0 && len(val) >= n.compressThreshold {
+		metrics.KVCompressionInputBytes.Add(float64(len(val)))
+		metrics.KVCompressionOutputBytes.Add(float64(len(enc)))
+		metrics.KVCompressionRatio.Observe(float64(len(enc)) / float64(len(val)))
+	}
+	return enc
+}
+
+// IsLeader returns true if this node is the leader
+func (n *Node) IsLeader() bool {
+	return n.raft.State() == raft.Leader
+}
+
+// Leader returns the address of the current leader
+func (n *Node) Leader() string {
+	return string(n.raft.Leader())
+}
+
+// advertise records this node's client addresses under its Raft address, so followers
+// can redirect clients to it while it leads. Nothing is proposed if they are unchanged.
+func (n *Node) advertise() {
+	addr, id := n.raft.LeaderWithID()
+	if string(id) != n.id || addr == "" {
+		return
+	}
+	info := store.NodeInfo{RaftAddr: string(addr), RedisAddr: n.redisAddr}
+	if old, ok := n.fsm.store.NodeInfo(info.RaftAddr); (ok && old == info) || (!ok && info.RedisAddr == "") {
+		return
+	}
+	value, err := json.Marshal(info)
+	if err != nil {
+		return
+	}
+	if err := n.Apply(KVCommand{Op: "node_put", Key: info.RaftAddr, Value: value}); err != nil {
+		n.logger.Warn("failed to advertise node addresses", "error", err)
+	}
+}
+
+// proposeLimits replicates this node's configured limits when they differ from the
+// cluster's, so they apply on every replica while it leads
+func (n *Node) proposeLimits() {
+	if !n.IsLeader() {
+		return
+	}
+	if current, ok := n.fsm.store.ClusterLimits(); ok && current == n.limits {
+		return
+	}
+	value, err := json.Marshal(n.limits)
+	if err != nil {
+		return
+	}
+	if err := n.Apply(KVCommand{Op: "limits_put", Value: value}); err != nil {
+		n.logger.Warn("failed to replicate limits", "error", err)
+	}
+}
+
+// Events returns the bus carrying this node's Raft events
+func (n *Node) Events() *EventBus {
+	return n.events
+}
+
+// GetRaft returns the underlying Raft instance
+func (n *Node) GetRaft() *raft.Raft {
+	return n.raft
+}
+
+// Join adds a new voter to the Raft cluster using the provided node ID and raft address.
+func (n *Node) Join(nodeID string, raftAddress string) error {
+	srvID := raft.ServerID(nodeID)
+	srvAddr := raft.ServerAddress(raftAddress)
+	future := n.raft.AddVoter(srvID, srvAddr, 0, 0)
+	return future.Error()
+}
+
+// Remove removes a node from the Raft cluster
+func (n *Node) Remove(nodeID string) error {
+	srvID := raft.ServerID(nodeID)
+	future := n.raft.RemoveServer(srvID, 0, 0)
+	return future.Error()
+}
+
+// VerifyRead ensures linearizable reads
+// For leaders: reads are always linearizable
+// For followers: validates node state (true ReadIndex would require library support)
+func (n *Node) VerifyRead(ctx context.Context) error {
+	if n.IsLeader() {
+		// Leader can read directly (leader read is always linearizable)
+		return nil
+	}
+	
+	// For followers, ensure node is in a valid state
+	// Note: HashiCorp Raft doesn't expose ReadIndex directly in this version
+	// For true linearizability, clients should read from the leader
+	// This validates the node is operational, but doesn't guarantee linearizability
+	state := n.raft.State()
+	if state != raft.Follower && state != raft.Leader {
+		return fmt.Errorf("node not in valid state for reads: %s", state.String())
+	}
+	
+	// In production, you would:
+	// 1. Implement ReadIndex if library supports it
+	// 2. Or redirect follower reads to leader
+	// 3. Or use barrier/barrierFuture to ensure catch-up
+	
+	return nil
+}
+
+// ReloadConfig applies new Raft tuning to the running node. Heartbeat and election
+// timeouts, snapshot threshold/interval and trailing logs take effect immediately;
+// the remaining fields are only read at startup and are reported as needing a restart.
+func (n *Node) ReloadConfig(rc cluster.RaftConfig) error {
+	rc = rc.WithDefaults()
+	if err := rc.Validate(); err != nil {
+		return fmt.Errorf("invalid raft config: %w", err)
+	}
+
+	n.tuningMu.Lock()
+	defer n.tuningMu.Unlock()
+
+	// The lease timeout is not reloadable, so the new heartbeat must also suit the running lease
+	current := n.tuning
+	if current.LeaderLeaseTimeout >= rc.HeartbeatTimeout {
+		return fmt.Errorf("raft.heartbeat_timeout (%s) must be > running leader_lease_timeout (%s)", rc.HeartbeatTimeout, current.LeaderLeaseTimeout)
+	}
+
+	err := n.raft.ReloadConfig(raft.ReloadableConfig{
+		TrailingLogs:      rc.TrailingLogs,
+		SnapshotInterval:  rc.SnapshotInterval,
+		SnapshotThreshold: rc.SnapshotThreshold,
+		HeartbeatTimeout:  rc.HeartbeatTimeout,
+		ElectionTimeout:   rc.ElectionTimeout,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reload raft config: %w", err)
+	}
+
+	var pending []string
+	if rc.LeaderLeaseTimeout != current.LeaderLeaseTimeout {
+		pending = append(pending, "leader_lease_timeout")
+	}
+	if rc.CommitTimeout != current.CommitTimeout {
+		pending = append(pending, "commit_timeout")
+	}
+	if rc.SnapshotRetain != current.SnapshotRetain {
+		pending = append(pending, "snapshot_retain")
+	}
+	if rc.MaxAppendEntries != current.MaxAppendEntries {
+		pending = append(pending, "max_append_entries")
+	}
+	if rc.HashCheckInterval != current.HashCheckInterval {
+		pending = append(pending, "hash_check_interval")
+	}
+	if len(pending) > 0 {
+		n.logger.Warn("raft settings require a restart to take effect", "fields", pending)
+	}
+
+	// Only record what is actually live so later reloads compare against reality
+	current.TrailingLogs = rc.TrailingLogs
+	current.SnapshotInterval = rc.SnapshotInterval
+	current.SnapshotThreshold = rc.SnapshotThreshold
+	current.HeartbeatTimeout = rc.HeartbeatTimeout
+	current.ElectionTimeout = rc.ElectionTimeout
+	n.tuning = current
+	n.logger.Info("raft config reloaded",
+		"heartbeat_timeout", rc.HeartbeatTimeout,
+		"election_timeout", rc.ElectionTimeout,
+		"snapshot_threshold", rc.SnapshotThreshold,
+		"snapshot_interval", rc.SnapshotInterval,
+		"trailing_logs", rc.TrailingLogs)
+	return nil
+}
+
+// Shutdown gracefully shuts down the Raft node
+func (n *Node) Shutdown() error {
+	n.raft.DeregisterObserver(n.observer)
+	close(n.stopObserver)
+	<-n.observerDone
+	close(n.stopHashCheck)
+	<-n.hashCheckDone
+	close(n.stopExpiry)
+	<-n.expiryDone
+
+	future := n.raft.Shutdown()
+	if err := future.Error(); err != nil {
+		return err
+	}
+
+	for _, c := range n.closers {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marshal serializes a KVCommand to JSON
+func (c *KVCommand) Marshal() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+// applyTuning copies the configured tuning onto a library config
+func applyTuning(rc *raft.Config, tuning cluster.RaftConfig) {
+	rc.HeartbeatTimeout = tuning.HeartbeatTimeout
+	rc.ElectionTimeout = tuning.ElectionTimeout
+	rc.LeaderLeaseTimeout = tuning.LeaderLeaseTimeout
+	rc.CommitTimeout = tuning.CommitTimeout
+	rc.SnapshotThreshold = tuning.SnapshotThreshold
+	rc.SnapshotInterval = tuning.SnapshotInterval
+	rc.TrailingLogs = tuning.TrailingLogs
+	rc.MaxAppendEntries = tuning.MaxAppendEntries
+}
+
+// portToInt converts a port string to int
+func portToInt(port string) int {
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return 0
+	}
+	return p
+}
+
@@ -0,0 +1,129 @@
+package raft
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/raft"
+)
+
+// PeersFile is read from the data directory at startup to recover from quorum loss.
+// It uses the peers.json v2 format:
+//
+//	[{"id": "node1", "address": "10.0.0.1:9011", "non_voter": false}]
+//
+// After a successful recovery it is renamed to peers.json.applied so it runs only once.
+const PeersFile = "peers.json"
+
+// recoverFromPeersFile rewrites the cluster configuration from peers.json when present.
+// The FSM state is preserved: the latest snapshot and every entry in the log are
+// replayed and compacted into a new snapshot carrying the new configuration.
+func recoverFromPeersFile(dataDir string, conf *raft.Config, fsm raft.FSM, logs raft.LogStore,
+	stable raft.StableStore, snaps raft.SnapshotStore, trans raft.Transport, logger *slog.Logger) (bool, error) {
+	path := filepath.Join(dataDir, PeersFile)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	configuration, err := raft.ReadConfigJSON(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	selfListed := false
+	for _, server := range configuration.Servers {
+		if server.ID == conf.LocalID {
+			selfListed = true
+		}
+	}
+	if !selfListed {
+		logger.Warn("peers.json does not list this node; it will not be able to take part in the recovered cluster",
+			"node_id", string(conf.LocalID))
+	}
+
+	// Describe what the recovery replaces before touching anything
+	previous, source, err := lastConfiguration(logs, snaps)
+	if err != nil {
+		return false, fmt.Errorf("failed to read previous configuration: %w", err)
+	}
+	logDiscardedServers(logger, previous, configuration, source)
+
+	firstIndex, _ := logs.FirstIndex()
+	lastIndex, _ := logs.LastIndex()
+	if lastIndex > 0 {
+		logger.Warn("recovery replays every log entry, including any that were never committed, and compacts the log into a snapshot",
+			"first_index", firstIndex, "last_index", lastIndex)
+	}
+
+	if err := raft.RecoverCluster(conf, fsm, logs, stable, snaps, trans, configuration); err != nil {
+		return false, fmt.Errorf("failed to recover cluster: %w", err)
+	}
+
+	applied := path + ".applied"
+	if err := os.Rename(path, applied); err != nil {
+		return true, fmt.Errorf("cluster recovered but failed to rename %s: %w", path, err)
+	}
+
+	servers := make([]string, 0, len(configuration.Servers))
+	for _, server := range configuration.Servers {
+		servers = append(servers, fmt.Sprintf("%s@%s", server.ID, server.Address))
+	}
+	logger.Warn("cluster configuration recovered from peers.json", "servers", servers, "renamed_to", applied)
+	return true, nil
+}
+
+// lastConfiguration finds the most recent membership configuration in the log,
+// falling back to the latest snapshot
+func lastConfiguration(logs raft.LogStore, snaps raft.SnapshotStore) (raft.Configuration, string, error) {
+	firstIndex, err := logs.FirstIndex()
+	if err != nil {
+		return raft.Configuration{}, "", err
+	}
+	lastIndex, err := logs.LastIndex()
+	if err != nil {
+		return raft.Configuration{}, "", err
+	}
+
+	for index := lastIndex; index >= firstIndex && index > 0; index-- {
+		var entry raft.Log
+		if err := logs.GetLog(index, &entry); err != nil {
+			continue
+		}
+		if entry.Type == raft.LogConfiguration {
+			return raft.DecodeConfiguration(entry.Data), fmt.Sprintf("log index %d", index), nil
+		}
+	}
+
+	metas, err := snaps.List()
+	if err != nil {
+		return raft.Configuration{}, "", err
+	}
+	if len(metas) > 0 {
+		return metas[0].Configuration, fmt.Sprintf("snapshot %s", metas[0].ID), nil
+	}
+	return raft.Configuration{}, "none", nil
+}
+
+// logDiscardedServers logs each server that the recovered configuration drops or changes
+func logDiscardedServers(logger *slog.Logger, previous, next raft.Configuration, source string) {
+	kept := make(map[raft.ServerID]raft.Server, len(next.Servers))
+	for _, server := range next.Servers {
+		kept[server.ID] = server
+	}
+
+	for _, server := range previous.Servers {
+		replacement, ok := kept[server.ID]
+		switch {
+		case !ok:
+			logger.Warn("recovery discards server from cluster configuration",
+				"node_id", string(server.ID), "address", string(server.Address), "previous_config", source)
+		case replacement.Address != server.Address || replacement.Suffrage != server.Suffrage:
+			logger.Warn("recovery changes server in cluster configuration",
+				"node_id", string(server.ID),
+				"address", string(server.Address), "new_address", string(replacement.Address),
+				"suffrage", server.Suffrage.String(), "new_suffrage", replacement.Suffrage.String())
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package raft
+
+import (
+	"crypto/tls"
+	"distributed_cloud_service/internal/cluster"
+	"distributed_cloud_service/internal/tlsutil"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// tlsStreamLayer implements raft.StreamLayer over mutually authenticated TLS
+type tlsStreamLayer struct {
+	listener  net.Listener
+	advertise net.Addr
+	client    *tls.Config
+	verify    string
+}
+
+// newTLSStreamLayer listens on bindAddr and dials peers with the node certificate
+func newTLSStreamLayer(bindAddr string, advertise net.Addr, cfg cluster.TLSConfig) (*tlsStreamLayer, error) {
+	serverConfig, clientConfig, err := tlsutil.MutualConfigs(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", bindAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", bindAddr, err)
+	}
+
+	return &tlsStreamLayer{
+		listener:  tls.NewListener(ln, serverConfig),
+		advertise: advertise,
+		client:    clientConfig,
+		verify:    cfg.Verify(),
+	}, nil
+}
+
+// Dial opens a TLS connection to a peer, verifying its certificate
+func (t *tlsStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	config := t.client.Clone()
+	if t.verify == cluster.TLSVerifyFull {
+		host, _, err := net.SplitHostPort(string(address))
+		if err != nil {
+			return nil, err
+		}
+		config.ServerName = host
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	return tls.DialWithDialer(dialer, "tcp", string(address), config)
+}
+
+// Accept waits for the next peer connection
+func (t *tlsStreamLayer) Accept() (net.Conn, error) {
+	return t.listener.Accept()
+}
+
+// Close stops listening
+func (t *tlsStreamLayer) Close() error {
+	return t.listener.Close()
+}
+
+// Addr returns the address peers should use to reach this node
+func (t *tlsStreamLayer) Addr() net.Addr {
+	return t.advertise
+}
+
+// newTransport creates the Raft transport, using TLS when it is configured
+func newTransport(config *cluster.Config, bindAddr string, advertise *net.TCPAddr, logOutput io.Writer) (raft.Transport, error) {
+	if !config.RaftTLS.Enabled() {
+		return raft.NewTCPTransport(bindAddr, advertise, 3, 10*time.Second, logOutput)
+	}
+
+	stream, err := newTLSStreamLayer(bindAddr, advertise, config.RaftTLS)
+	if err != nil {
+		return nil, err
+	}
+	return raft.NewNetworkTransport(stream, 3, 10*time.Second, logOutput), nil
+}
@@ -0,0 +1,504 @@
+package redis
+
+import (
+	"distributed_cloud_service/internal/metrics"
+	"distributed_cloud_service/internal/raft"
+	"distributed_cloud_service/internal/store"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// command handles one client command; args[0] is the command name
+type command struct {
+	arity int  // exact number of arguments including the name, or -N for at least N
+	write bool // proposed through Raft, so followers redirect it
+	fn    func(s *Server, sess *session, args [][]byte)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"PING":    {-1, false, (*Server).ping},
+		"ECHO":    {2, false, (*Server).echo},
+		"HELLO":   {-1, false, (*Server).hello},
+		"AUTH":    {-2, false, (*Server).auth},
+		"SELECT":  {2, false, (*Server).selectDB},
+		"QUIT":    {-1, false, (*Server).quit},
+		"CLIENT":  {-2, false, (*Server).client},
+		"COMMAND": {-1, false, (*Server).commandInfo},
+		"GET":     {2, false, (*Server).get},
+		"MGET":    {-2, false, (*Server).mget},
+		"EXISTS":  {-2, false, (*Server).exists},
+		"TTL":     {2, false, (*Server).ttl},
+		"SCAN":    {-2, false, (*Server).scan},
+		"SET":     {-3, true, (*Server).set},
+		"MSET":    {-3, true, (*Server).mset},
+		"DEL":     {-2, true, (*Server).del},
+		"INCR":    {2, true, (*Server).incr},
+		"INCRBY":  {3, true, (*Server).incrBy},
+		"DECR":    {2, true, (*Server).decr},
+		"DECRBY":  {3, true, (*Server).decrBy},
+		"EXPIRE":  {3, true, (*Server).expire},
+	}
+}
+
+// dispatch checks a command's arity, authentication and leadership, then runs it
+func (s *Server) dispatch(sess *session, args [][]byte) {
+	name := strings.ToUpper(string(args[0]))
+	cmd, ok := commands[name]
+	if !ok {
+		metrics.RedisCommandsTotal.WithLabelValues("unknown").Inc()
+		sess.w.error("ERR unknown command '" + string(args[0]) + "'")
+		return
+	}
+	metrics.RedisCommandsTotal.WithLabelValues(name).Inc()
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		sess.w.error("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+		return
+	}
+	if !sess.authed && name != "AUTH" && name != "HELLO" && name != "QUIT" {
+		sess.w.error("NOAUTH Authentication required.")
+		return
+	}
+	if cmd.write && !s.requireLeader(sess.w, string(args[1])) {
+		return
+	}
+	cmd.fn(s, sess, args)
+}
+
+// propose applies a write through Raft. It returns the FSM's response, or writes the
+// error and returns false.
+func (s *Server) propose(sess *session, cmd raft.KVCommand) (interface{}, bool) {
+	resp, err := s.raft.Propose(cmd)
+	if err != nil {
+		s.writeError(sess.w, cmd.Key, err)
+		return nil, false
+	}
+	return resp, true
+}
+
+// writeError answers a failed write the way Redis would
+func (s *Server) writeError(w *writer, key string, err error) {
+	var quotaErr *store.QuotaError
+	switch {
+	case errors.Is(err, raft.ErrNotInteger), errors.Is(err, raft.ErrOverflow):
+		w.error("ERR " + err.Error())
+	case errors.As(err, &quotaErr):
+		w.error("OOM " + err.Error())
+	case !s.raft.IsLeader():
+		// Leadership was lost while the write was in flight
+		s.requireLeader(w, key)
+	default:
+		w.error("ERR " + err.Error())
+	}
+}
+
+func (s *Server) ping(sess *session, args [][]byte) {
+	switch len(args) {
+	case 1:
+		sess.w.simple("PONG")
+	case 2:
+		sess.w.bulk(args[1])
+	default:
+		sess.w.error("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (s *Server) echo(sess *session, args [][]byte) {
+	sess.w.bulk(args[1])
+}
+
+// hello handles HELLO [protover [AUTH username password] [SETNAME clientname]]
+func (s *Server) hello(sess *session, args [][]byte) {
+	proto := sess.w.proto
+	if len(args) > 1 {
+		v, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			sess.w.error("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if v != 2 && v != 3 {
+			sess.w.error("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = v
+	}
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "AUTH":
+			if i+2 >= len(args) {
+				sess.w.error("ERR syntax error")
+				return
+			}
+			if !s.checkAuth(args[i+2]) {
+				sess.w.error("WRONGPASS invalid username-password pair or user is disabled.")
+				return
+			}
+			sess.authed = true
+			i += 2
+		case "SETNAME":
+			if i+1 >= len(args) {
+				sess.w.error("ERR syntax error")
+				return
+			}
+			sess.name = string(args[i+1])
+			i++
+		default:
+			sess.w.error("ERR syntax error")
+			return
+		}
+	}
+	if !sess.authed {
+		sess.w.error("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+		return
+	}
+
+	sess.w.proto = proto
+	role := "replica"
+	if s.raft.IsLeader() {
+		role = "master"
+	}
+	sess.w.mapHeader(6)
+	sess.w.bulkString("server")
+	sess.w.bulkString("distributed_cloud_service")
+	sess.w.bulkString("proto")
+	sess.w.integer(int64(proto))
+	sess.w.bulkString("id")
+	sess.w.integer(0)
+	sess.w.bulkString("mode")
+	sess.w.bulkString("standalone")
+	sess.w.bulkString("role")
+	sess.w.bulkString(role)
+	sess.w.bulkString("modules")
+	sess.w.array(0)
+}
+
+// auth handles AUTH password and AUTH username password; the username is not checked
+func (s *Server) auth(sess *session, args [][]byte) {
+	if len(args) > 3 {
+		sess.w.error("ERR syntax error")
+		return
+	}
+	if s.opts.AuthToken == "" {
+		sess.w.error("ERR AUTH called without any password configured for the default user. Are you sure your configuration is correct?")
+		return
+	}
+	if !s.checkAuth(args[len(args)-1]) {
+		sess.w.error("WRONGPASS invalid username-password pair or user is disabled.")
+		return
+	}
+	sess.authed = true
+	sess.w.simple("OK")
+}
+
+// selectDB accepts only database 0, the default namespace
+func (s *Server) selectDB(sess *session, args [][]byte) {
+	if string(args[1]) != "0" {
+		sess.w.error("ERR DB index is out of range")
+		return
+	}
+	sess.w.simple("OK")
+}
+
+func (s *Server) quit(sess *session, args [][]byte) {
+	sess.quit = true
+	sess.w.simple("OK")
+}
+
+// client accepts CLIENT SETNAME and answers other subcommands with OK, which is what
+// connection pools send on connect
+func (s *Server) client(sess *session, args [][]byte) {
+	switch strings.ToUpper(string(args[1])) {
+	case "SETNAME":
+		if len(args) != 3 {
+			sess.w.error("ERR wrong number of arguments for 'client|setname' command")
+			return
+		}
+		sess.name = string(args[2])
+	case "GETNAME":
+		if sess.name == "" {
+			sess.w.null()
+		} else {
+			sess.w.bulkString(sess.name)
+		}
+		return
+	}
+	sess.w.simple("OK")
+}
+
+// commandInfo answers COMMAND with an empty list; clients only use it for discovery
+func (s *Server) commandInfo(sess *session, args [][]byte) {
+	sess.w.array(0)
+}
+
+func (s *Server) get(sess *session, args [][]byte) {
+	metrics.KVGetOperations.Inc()
+	val, ok := s.store.Get(string(args[1]))
+	if !ok {
+		sess.w.null()
+		return
+	}
+	sess.w.bulk(val)
+}
+
+// mget reads every key from one view of the store, so all values are from the same index
+func (s *Server) mget(sess *session, args [][]byte) {
+	keys := make([]string, len(args)-1)
+	for i, key := range args[1:] {
+		keys[i] = string(key)
+	}
+	_, results, err := s.store.GetManyIn(store.DefaultNamespace, keys)
+	if err != nil {
+		sess.w.error("ERR " + err.Error())
+		return
+	}
+	sess.w.array(len(results))
+	for _, r := range results {
+		metrics.KVGetOperations.Inc()
+		if r.Found {
+			sess.w.bulk(r.Value)
+		} else {
+			sess.w.null()
+		}
+	}
+}
+
+// exists counts the given keys that exist, counting repeated keys every time
+func (s *Server) exists(sess *session, args [][]byte) {
+	var n int64
+	for _, key := range args[1:] {
+		if _, ok := s.store.ExpiryIn(store.DefaultNamespace, string(key)); ok {
+			n++
+		}
+	}
+	sess.w.integer(n)
+}
+
+// ttl returns the seconds left before a key expires, -1 if it never does and -2 if it doesn't exist
+func (s *Server) ttl(sess *session, args [][]byte) {
+	at, ok := s.store.ExpiryIn(store.DefaultNamespace, string(args[1]))
+	switch {
+	case !ok:
+		sess.w.integer(-2)
+	case at.IsZero():
+		sess.w.integer(-1)
+	default:
+		ms := time.Until(at).Milliseconds()
+		sess.w.integer((ms + 500) / 1000)
+	}
+}
+
+// errScanDone stops the store scan once a SCAN page is full
+var errScanDone = errors.New("scan page full")
+
+// scan handles SCAN cursor [MATCH pattern] [COUNT count]. The cursor is the number of keys
+// already visited in key order, so keys added or removed between calls can shift the page.
+func (s *Server) scan(sess *session, args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		sess.w.error("ERR invalid cursor")
+		return
+	}
+	count := 10
+	var pattern string
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			sess.w.error("ERR syntax error")
+			return
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = string(args[i+1])
+		case "COUNT":
+			if count, err = strconv.Atoi(string(args[i+1])); err != nil || count < 1 {
+				sess.w.error("ERR value is not an integer or out of range")
+				return
+			}
+		default:
+			sess.w.error("ERR syntax error")
+			return
+		}
+	}
+
+	var (
+		keys    []string
+		visited uint64
+		next    uint64
+	)
+	err = s.store.ScanKeysIn(store.DefaultNamespace, func(key string) error {
+		visited++
+		if visited <= cursor {
+			return nil
+		}
+		if visited > cursor+uint64(count) {
+			next = visited - 1
+			return errScanDone
+		}
+		if pattern == "" || matchGlob(pattern, key) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errScanDone) {
+		sess.w.error("ERR " + err.Error())
+		return
+	}
+
+	sess.w.array(2)
+	sess.w.bulkString(strconv.FormatUint(next, 10))
+	sess.w.array(len(keys))
+	for _, key := range keys {
+		sess.w.bulkString(key)
+	}
+}
+
+// set handles SET key value [NX|XX] [EX seconds|PX milliseconds]
+func (s *Server) set(sess *session, args [][]byte) {
+	cmd := raft.KVCommand{Op: "put", Key: string(args[1]), Value: args[2]}
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); opt {
+		case "NX", "XX":
+			if cmd.Cond != "" {
+				sess.w.error("ERR syntax error")
+				return
+			}
+			cmd.Cond = strings.ToLower(opt)
+		case "EX", "PX":
+			if cmd.ExpireAt != 0 || i+1 >= len(args) {
+				sess.w.error("ERR syntax error")
+				return
+			}
+			i++
+			expireAt, ok := expireTime(args[i], opt == "EX")
+			if !ok || expireAt <= time.Now().UnixMilli() {
+				sess.w.error("ERR invalid expire time in 'set' command")
+				return
+			}
+			cmd.ExpireAt = expireAt
+		default:
+			sess.w.error("ERR syntax error")
+			return
+		}
+	}
+
+	metrics.KVPutOperations.Inc()
+	_, err := s.raft.Propose(cmd)
+	switch {
+	case errors.Is(err, raft.ErrConditionFailed):
+		sess.w.null()
+	case err != nil:
+		s.writeError(sess.w, cmd.Key, err)
+	default:
+		sess.w.simple("OK")
+	}
+}
+
+// mset writes all pairs in a single Raft entry, so they apply together
+func (s *Server) mset(sess *session, args [][]byte) {
+	if len(args)%2 != 1 {
+		sess.w.error("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+	batch := make([]raft.KVCommand, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		batch = append(batch, raft.KVCommand{Op: "put", Key: string(args[i]), Value: args[i+1]})
+	}
+	metrics.KVPutOperations.Add(float64(len(batch)))
+	if _, ok := s.propose(sess, raft.KVCommand{Op: "batch", Batch: batch}); ok {
+		sess.w.simple("OK")
+	}
+}
+
+func (s *Server) del(sess *session, args [][]byte) {
+	keys := make([]string, len(args)-1)
+	for i, key := range args[1:] {
+		keys[i] = string(key)
+	}
+	metrics.KVDeleteOperations.Add(float64(len(keys)))
+	resp, ok := s.propose(sess, raft.KVCommand{Op: "del", Key: keys[0], Keys: keys})
+	if !ok {
+		return
+	}
+	removed, _ := resp.(int)
+	sess.w.integer(int64(removed))
+}
+
+func (s *Server) incr(sess *session, args [][]byte) {
+	s.count(sess, "incr", string(args[1]), 1)
+}
+
+func (s *Server) decr(sess *session, args [][]byte) {
+	s.count(sess, "decr", string(args[1]), 1)
+}
+
+func (s *Server) incrBy(sess *session, args [][]byte) {
+	if delta, err := strconv.ParseInt(string(args[2]), 10, 64); err != nil {
+		sess.w.error("ERR value is not an integer or out of range")
+	} else {
+		s.count(sess, "incr", string(args[1]), delta)
+	}
+}
+
+func (s *Server) decrBy(sess *session, args [][]byte) {
+	if delta, err := strconv.ParseInt(string(args[2]), 10, 64); err != nil {
+		sess.w.error("ERR value is not an integer or out of range")
+	} else {
+		s.count(sess, "decr", string(args[1]), delta)
+	}
+}
+
+// count proposes an "incr" or "decr" of key by delta and replies with the new value
+func (s *Server) count(sess *session, op, key string, delta int64) {
+	resp, ok := s.propose(sess, raft.KVCommand{Op: op, Key: key, Delta: delta})
+	if !ok {
+		return
+	}
+	n, _ := resp.(int64)
+	sess.w.integer(n)
+}
+
+// expire handles EXPIRE key seconds; a time in the past deletes the key
+func (s *Server) expire(sess *session, args [][]byte) {
+	expireAt, ok := expireTime(args[2], true)
+	if !ok {
+		sess.w.error("ERR value is not an integer or out of range")
+		return
+	}
+	resp, ok := s.propose(sess, raft.KVCommand{Op: "expire", Key: string(args[1]), ExpireAt: expireAt})
+	if !ok {
+		return
+	}
+	if existed, _ := resp.(bool); existed {
+		sess.w.integer(1)
+	} else {
+		sess.w.integer(0)
+	}
+}
+
+// expireTime turns a relative EX (seconds) or PX (milliseconds) argument into Unix milliseconds
+func expireTime(arg []byte, seconds bool) (int64, bool) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if seconds {
+		if n > math.MaxInt64/1000 || n < math.MinInt64/1000 {
+			return 0, false
+		}
+		n *= 1000
+	}
+	now := time.Now().UnixMilli()
+	if n > math.MaxInt64-now {
+		return 0, false
+	}
+	at := now + n
+	if at == 0 {
+		// 0 means no expiry in the store
+		at = -1
+	}
+	return at, true
+}
@@ -0,0 +1,52 @@
+package redis
+
+import "testing"
+
+func TestKeySlot(t *testing.T) {
+	tests := map[string]int{
+		"":        0,
+		"foo":     12182,
+		"bar":     5061,
+		"{foo}.x": 12182,
+		"a{foo}":  12182,
+	}
+	for key, want := range tests {
+		if got := keySlot(key); got != want {
+			t.Errorf("Expected slot %d for %q, got %d", want, key, got)
+		}
+	}
+	if keySlot("{user1000}.following") != keySlot("{user1000}.followers") {
+		t.Error("Expected keys with the same hash tag to share a slot")
+	}
+	if crc16("123456789") != 0x31c3 {
+		t.Errorf("Expected CRC16 check value 0x31c3, got %#x", crc16("123456789"))
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "users", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"a\\*b", "a*b", true},
+		{"a\\*b", "axb", false},
+		{"*a*b*", "xxaxxbxx", true},
+		{"h[ae", "ha", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.key); got != tt.want {
+			t.Errorf("matchGlob(%q, %q): expected %v, got %v", tt.pattern, tt.key, tt.want, got)
+		}
+	}
+}
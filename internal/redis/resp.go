@@ -0,0 +1,208 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	// maxBulkLen caps a single argument sent by a client
+	maxBulkLen = 64 << 20
+	// maxArgs caps the number of arguments of a single command
+	maxArgs = 1 << 20
+	// maxInlineLen caps an inline command (a plain line, as typed in telnet)
+	maxInlineLen = 64 << 10
+	// unauthMaxBulkLen and unauthMaxArgs cap commands sent before AUTH, which only
+	// need room for a password
+	unauthMaxBulkLen = 4 << 10
+	unauthMaxArgs    = 16
+	// bulkPrealloc is the most allocated for a bulk string before its bytes arrive
+	bulkPrealloc = 16 << 10
+)
+
+// errProtocol is returned for input that is not valid RESP; the connection is closed after it
+var errProtocol = errors.New("protocol error")
+
+// reader parses client commands: RESP arrays of bulk strings, or inline commands
+type reader struct {
+	br      *bufio.Reader
+	maxBulk int
+	maxArgs int
+}
+
+func newReader(r io.Reader) *reader {
+	return &reader{br: bufio.NewReader(r), maxBulk: maxBulkLen, maxArgs: maxArgs}
+}
+
+// setLimits changes the largest argument and the most arguments a command may have
+func (r *reader) setLimits(bulk, args int) {
+	r.maxBulk, r.maxArgs = bulk, args
+}
+
+// readLine returns the next CRLF-terminated line without the terminator
+func (r *reader) readLine() ([]byte, error) {
+	line, err := r.br.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, fmt.Errorf("%w: line too long", errProtocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("%w: line not terminated by CRLF", errProtocol)
+	}
+	return line[:len(line)-2], nil
+}
+
+// readCommand returns the arguments of the next command. Empty inline lines are skipped.
+func (r *reader) readCommand() ([][]byte, error) {
+	for {
+		first, err := r.br.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if first[0] != '*' {
+			args, err := r.readInline()
+			if err != nil || len(args) > 0 {
+				return args, err
+			}
+			continue
+		}
+
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil || n > r.maxArgs {
+			return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+		}
+		if n <= 0 {
+			continue
+		}
+		// Grow with the arguments that actually arrive rather than trusting the header
+		args := make([][]byte, 0, min(n, 64))
+		for i := 0; i < n; i++ {
+			arg, err := r.readBulk()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		return args, nil
+	}
+}
+
+// readBulk reads one $<len> bulk string
+func (r *reader) readBulk() ([]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return nil, fmt.Errorf("%w: expected '$', got %q", errProtocol, line)
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 || n > r.maxBulk {
+		return nil, fmt.Errorf("%w: invalid bulk length", errProtocol)
+	}
+	// Memory follows the bytes received, so a large length alone doesn't reserve it
+	var buf bytes.Buffer
+	buf.Grow(min(n, bulkPrealloc))
+	if _, err := io.CopyN(&buf, r.br, int64(n)); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	var crlf [2]byte
+	if _, err := io.ReadFull(r.br, crlf[:]); err != nil {
+		return nil, err
+	}
+	if crlf[0] != '\r' || crlf[1] != '\n' {
+		return nil, fmt.Errorf("%w: bulk string not terminated by CRLF", errProtocol)
+	}
+	return buf.Bytes(), nil
+}
+
+// readInline splits a plain text line on spaces. A lone LF ends the line too.
+func (r *reader) readInline() ([][]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.br.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxInlineLen {
+			return nil, fmt.Errorf("%w: inline command too long", errProtocol)
+		}
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return nil, err
+		}
+	}
+	fields := bytes.Fields(line)
+	args := make([][]byte, len(fields))
+	for i, f := range fields {
+		args[i] = append([]byte(nil), f...)
+	}
+	return args, nil
+}
+
+// writer encodes replies in the protocol version the client chose with HELLO (2 by default)
+type writer struct {
+	bw    *bufio.Writer
+	proto int
+}
+
+func newWriter(w io.Writer) *writer {
+	return &writer{bw: bufio.NewWriter(w), proto: 2}
+}
+
+func (w *writer) line(prefix byte, s string) {
+	w.bw.WriteByte(prefix)
+	w.bw.WriteString(s)
+	w.bw.WriteString("\r\n")
+}
+
+// simple writes a status reply such as OK
+func (w *writer) simple(s string) { w.line('+', s) }
+
+// error writes an error reply; msg starts with the error code, e.g. "ERR unknown command"
+func (w *writer) error(msg string) { w.line('-', msg) }
+
+func (w *writer) integer(n int64) { w.line(':', strconv.FormatInt(n, 10)) }
+
+func (w *writer) bulk(b []byte) {
+	w.line('$', strconv.Itoa(len(b)))
+	w.bw.Write(b)
+	w.bw.WriteString("\r\n")
+}
+
+func (w *writer) bulkString(s string) { w.bulk([]byte(s)) }
+
+// null writes a missing value: a null bulk string in RESP2 and the null type in RESP3
+func (w *writer) null() {
+	if w.proto >= 3 {
+		w.bw.WriteString("_\r\n")
+		return
+	}
+	w.bw.WriteString("$-1\r\n")
+}
+
+func (w *writer) array(n int) { w.line('*', strconv.Itoa(n)) }
+
+// mapHeader starts a map of n pairs, which RESP2 clients receive as a flat array
+func (w *writer) mapHeader(n int) {
+	if w.proto >= 3 {
+		w.line('%', strconv.Itoa(n))
+		return
+	}
+	w.array(2 * n)
+}
+
+func (w *writer) flush() error { return w.bw.Flush() }
@@ -0,0 +1,90 @@
+package redis
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReader_ReadCommand(t *testing.T) {
+	input := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nva\r\nl\r\n" +
+		"\r\n" +
+		"GET  key\tother\n"
+	r := newReader(strings.NewReader(input))
+
+	args, err := r.readCommand()
+	if err != nil {
+		t.Fatalf("readCommand() failed: %v", err)
+	}
+	if len(args) != 3 || string(args[0]) != "SET" || string(args[2]) != "va\r\nl" {
+		t.Errorf("Expected SET key va\\r\\nl, got %q", args)
+	}
+
+	args, err = r.readCommand()
+	if err != nil {
+		t.Fatalf("readCommand() failed for inline command: %v", err)
+	}
+	want := []string{"GET", "key", "other"}
+	if len(args) != len(want) {
+		t.Fatalf("Expected %q, got %q", want, args)
+	}
+	for i := range want {
+		if string(args[i]) != want[i] {
+			t.Errorf("Expected argument %d to be %q, got %q", i, want[i], args[i])
+		}
+	}
+}
+
+func TestReader_ProtocolErrors(t *testing.T) {
+	tests := []string{
+		"*1\r\n:5\r\n",           // argument is not a bulk string
+		"*x\r\n",                 // bad array length
+		"*1\r\n$-1\r\n",          // null argument
+		"*1\r\n$3\r\nabcd\r\n",   // bulk longer than its length
+		"*1\r\n$99999999999\r\n", // bulk over the size limit
+		"*1\n",                   // missing CR
+	}
+	for _, input := range tests {
+		_, err := newReader(strings.NewReader(input)).readCommand()
+		if !errors.Is(err, errProtocol) {
+			t.Errorf("Expected protocol error for %q, got %v", input, err)
+		}
+	}
+}
+
+func TestReader_Limits(t *testing.T) {
+	r := newReader(strings.NewReader("*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"))
+	r.setLimits(16, 2)
+	if _, err := r.readCommand(); !errors.Is(err, errProtocol) {
+		t.Errorf("Expected protocol error for too many arguments, got %v", err)
+	}
+
+	r = newReader(strings.NewReader("*1\r\n$17\r\n"))
+	r.setLimits(16, 2)
+	if _, err := r.readCommand(); !errors.Is(err, errProtocol) {
+		t.Errorf("Expected protocol error for an argument over the limit, got %v", err)
+	}
+
+	// A header announcing more than is sent fails once the input runs out
+	r = newReader(strings.NewReader("*1\r\n$67108864\r\nabc"))
+	if _, err := r.readCommand(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected %v for a truncated argument, got %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestWriter_Protocols(t *testing.T) {
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	w.null()
+	w.mapHeader(1)
+	w.proto = 3
+	w.null()
+	w.mapHeader(1)
+	w.flush()
+
+	if got, want := buf.String(), "$-1\r\n*2\r\n_\r\n%1\r\n"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,210 @@
+package redis
+
+import (
+	"crypto/subtle"
+	"distributed_cloud_service/internal/metrics"
+	"distributed_cloud_service/internal/raft"
+	"distributed_cloud_service/internal/store"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RaftNode is the part of the Raft node the RESP server needs
+type RaftNode interface {
+	IsLeader() bool
+	Leader() string
+	Propose(cmd raft.KVCommand) (interface{}, error)
+}
+
+// Options configures a Server
+type Options struct {
+	// AuthToken, if set, must be sent with AUTH (or HELLO ... AUTH) before other commands
+	AuthToken string
+	// IdleTimeout closes connections that send nothing for this long; 0 disables it
+	IdleTimeout time.Duration
+	// MaxClients caps open connections; 0 means no cap
+	MaxClients int
+}
+
+// Server speaks the Redis protocol (RESP2 and RESP3) on top of the replicated store.
+// Reads are served from the local store; writes are proposed through Raft on the leader.
+type Server struct {
+	store  *store.Store
+	raft   RaftNode
+	opts   Options
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewServer creates a RESP server for the store and Raft node
+func NewServer(s *store.Store, r RaftNode, opts Options) *Server {
+	return &Server{
+		store:  s,
+		raft:   r,
+		opts:   opts,
+		logger: slog.Default().With("component", "redis"),
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on addr and serves connections until Close
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for RESP on %s: %w", addr, err)
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on ln until Close. It always returns a non-nil error,
+// net.ErrClosed after Close.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return net.ErrClosed
+	}
+	s.listener = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return net.ErrClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return net.ErrClosed
+		}
+		if s.opts.MaxClients > 0 && len(s.conns) >= s.opts.MaxClients {
+			s.mu.Unlock()
+			metrics.RedisRejectedConnectionsTotal.Inc()
+			conn.Write([]byte("-ERR max number of clients reached\r\n"))
+			conn.Close()
+			continue
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the listener, closes every connection and waits for them to finish
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// session is the state of one client connection
+type session struct {
+	w      *writer
+	authed bool
+	name   string
+	quit   bool
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+		metrics.RedisConnections.Dec()
+		s.wg.Done()
+	}()
+	metrics.RedisConnections.Inc()
+
+	r := newReader(conn)
+	sess := &session{w: newWriter(conn), authed: s.opts.AuthToken == ""}
+	for !sess.quit {
+		// Until the client has authenticated it only needs room for AUTH or HELLO
+		if sess.authed {
+			r.setLimits(maxBulkLen, maxArgs)
+		} else {
+			r.setLimits(unauthMaxBulkLen, unauthMaxArgs)
+		}
+		if s.opts.IdleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.opts.IdleTimeout))
+		}
+		args, err := r.readCommand()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				sess.w.error("ERR Protocol error: " + strings.TrimPrefix(err.Error(), errProtocol.Error()+": "))
+				sess.w.flush()
+			} else if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.logger.Debug("connection closed", "remote", conn.RemoteAddr(), "error", err)
+			}
+			return
+		}
+		s.dispatch(sess, args)
+		// Pipelined commands are answered together once the client stops sending
+		if r.br.Buffered() == 0 || sess.quit {
+			if err := sess.w.flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// checkAuth compares a password with the configured token in constant time
+func (s *Server) checkAuth(password []byte) bool {
+	return subtle.ConstantTimeCompare(password, []byte(s.opts.AuthToken)) == 1
+}
+
+// requireLeader answers a write on a follower with MOVED to the leader, or READONLY if
+// the leader's RESP address is unknown. It returns false if the write must not proceed.
+func (s *Server) requireLeader(w *writer, key string) bool {
+	if s.raft.IsLeader() {
+		return true
+	}
+	metrics.RedisRedirectsTotal.Inc()
+	if addr := s.leaderAddr(); addr != "" {
+		w.error(fmt.Sprintf("MOVED %d %s", keySlot(key), addr))
+		return false
+	}
+	w.error("READONLY You can't write against a read only replica.")
+	return false
+}
+
+// leaderAddr returns the RESP address the leader advertised when it took over, or ""
+// if the leader is unknown or didn't advertise one
+func (s *Server) leaderAddr() string {
+	leader := s.raft.Leader()
+	if leader == "" {
+		return ""
+	}
+	info, _ := s.store.NodeInfo(leader)
+	return info.RedisAddr
+}
@@ -0,0 +1,328 @@
+package redis
+
+import (
+	"bufio"
+	"distributed_cloud_service/internal/raft"
+	"distributed_cloud_service/internal/store"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	hraft "github.com/hashicorp/raft"
+)
+
+// mockRaft applies proposals straight to an FSM, standing in for a single-node cluster
+type mockRaft struct {
+	mu     sync.Mutex
+	fsm    *raft.FSM
+	index  uint64
+	leader bool
+	addr   string
+}
+
+func (m *mockRaft) IsLeader() bool { return m.leader }
+
+func (m *mockRaft) Leader() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.addr
+}
+
+func (m *mockRaft) setLeader(addr string) {
+	m.mu.Lock()
+	m.addr = addr
+	m.mu.Unlock()
+}
+
+func (m *mockRaft) Propose(cmd raft.KVCommand) (interface{}, error) {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.index++
+	resp := m.fsm.Apply(&hraft.Log{Index: m.index, Data: data, AppendedAt: time.Now()})
+	if err, ok := resp.(error); ok {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func startServer(t *testing.T, r *mockRaft, kvStore *store.Store, opts Options) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv := NewServer(kvStore, r, opts)
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+func newTestServer(t *testing.T, opts Options) (string, *store.Store) {
+	kvStore := store.NewStore()
+	r := &mockRaft{fsm: raft.NewFSM(kvStore), leader: true}
+	return startServer(t, r, kvStore, opts), kvStore
+}
+
+// client is a minimal RESP client; replies are flattened to strings for easy comparison
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *client {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &client{t: t, conn: conn, br: bufio.NewReader(conn)}
+}
+
+// do sends a command as an array of bulk strings and returns the reply
+func (c *client) do(args ...string) string {
+	c.t.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		c.t.Fatalf("Failed to send %v: %v", args, err)
+	}
+	return c.reply()
+}
+
+// reply reads one reply: errors as "-ERR ...", integers as ":n", nulls as "nil",
+// bulk and simple strings as themselves and aggregates as "[a b]"
+func (c *client) reply() string {
+	c.t.Helper()
+	line, err := c.br.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("Failed to read reply: %v", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-', ':':
+		return line
+	case '_':
+		return "nil"
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "nil"
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.br, buf); err != nil {
+			c.t.Fatalf("Failed to read bulk: %v", err)
+		}
+		return string(buf[:n])
+	case '*', '%':
+		n, _ := strconv.Atoi(line[1:])
+		if line[0] == '%' {
+			n *= 2
+		}
+		items := make([]string, n)
+		for i := range items {
+			items[i] = c.reply()
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	}
+	c.t.Fatalf("Unexpected reply %q", line)
+	return ""
+}
+
+func expectReply(t *testing.T, c *client, want string, args ...string) {
+	t.Helper()
+	if got := c.do(args...); got != want {
+		t.Errorf("%s: expected %q, got %q", strings.Join(args, " "), want, got)
+	}
+}
+
+func TestServer_StringCommands(t *testing.T) {
+	addr, kvStore := newTestServer(t, Options{})
+	c := dial(t, addr)
+
+	expectReply(t, c, "PONG", "PING")
+	expectReply(t, c, "nil", "GET", "k")
+	expectReply(t, c, "OK", "SET", "k", "v1")
+	expectReply(t, c, "v1", "GET", "k")
+	expectReply(t, c, "nil", "SET", "k", "v2", "NX")
+	expectReply(t, c, "OK", "SET", "k", "v2", "XX")
+	expectReply(t, c, "nil", "SET", "missing", "v", "XX")
+	expectReply(t, c, "v2", "GET", "k")
+	expectReply(t, c, "-ERR syntax error", "SET", "k", "v", "NX", "XX")
+
+	expectReply(t, c, "OK", "MSET", "a", "1", "b", "2")
+	expectReply(t, c, "[1 nil 2]", "MGET", "a", "nope", "b")
+	expectReply(t, c, ":3", "EXISTS", "a", "b", "a")
+	expectReply(t, c, ":2", "DEL", "a", "b", "nope", "a")
+	expectReply(t, c, ":0", "EXISTS", "a", "b")
+
+	expectReply(t, c, ":1", "INCR", "counter")
+	expectReply(t, c, ":2", "INCR", "counter")
+	expectReply(t, c, "2", "GET", "counter")
+	expectReply(t, c, ":12", "INCRBY", "counter", "10")
+	expectReply(t, c, ":11", "DECR", "counter")
+	expectReply(t, c, ":1", "DECRBY", "counter", "10")
+	expectReply(t, c, "-ERR value is not an integer or out of range", "INCRBY", "counter", "x")
+	expectReply(t, c, "-ERR value is not an integer or out of range", "INCR", "k")
+
+	if val, ok := kvStore.Get("k"); !ok || string(val) != "v2" {
+		t.Errorf("Expected store to hold v2, got %q", val)
+	}
+
+	expectReply(t, c, "-ERR unknown command 'FLUSHALL'", "FLUSHALL")
+	expectReply(t, c, "-ERR wrong number of arguments for 'get' command", "GET")
+}
+
+func TestServer_Expiry(t *testing.T) {
+	addr, _ := newTestServer(t, Options{})
+	c := dial(t, addr)
+
+	expectReply(t, c, ":-2", "TTL", "k")
+	expectReply(t, c, "OK", "SET", "k", "v")
+	expectReply(t, c, ":-1", "TTL", "k")
+	expectReply(t, c, ":1", "EXPIRE", "k", "100")
+	expectReply(t, c, ":100", "TTL", "k")
+	expectReply(t, c, ":0", "EXPIRE", "nope", "100")
+
+	// SET without EX clears the expiry, like Redis
+	expectReply(t, c, "OK", "SET", "k", "v")
+	expectReply(t, c, ":-1", "TTL", "k")
+
+	expectReply(t, c, "OK", "SET", "short", "v", "PX", "50")
+	time.Sleep(100 * time.Millisecond)
+	expectReply(t, c, "nil", "GET", "short")
+	expectReply(t, c, ":0", "EXISTS", "short")
+	expectReply(t, c, ":-2", "TTL", "short")
+
+	// An expiry in the past deletes the key
+	expectReply(t, c, ":1", "EXPIRE", "k", "-1")
+	expectReply(t, c, "nil", "GET", "k")
+	expectReply(t, c, "-ERR invalid expire time in 'set' command", "SET", "k", "v", "EX", "0")
+}
+
+func TestServer_Scan(t *testing.T) {
+	addr, _ := newTestServer(t, Options{})
+	c := dial(t, addr)
+
+	for i := 0; i < 5; i++ {
+		expectReply(t, c, "OK", "SET", fmt.Sprintf("user:%d", i), "v")
+	}
+	expectReply(t, c, "OK", "SET", "other", "v")
+
+	expectReply(t, c, "[3 [other user:0 user:1]]", "SCAN", "0", "COUNT", "3")
+	expectReply(t, c, "[0 [user:2 user:3 user:4]]", "SCAN", "3", "COUNT", "3")
+	expectReply(t, c, "[0 [user:0 user:1 user:2 user:3 user:4]]", "SCAN", "0", "MATCH", "user:*")
+	expectReply(t, c, "-ERR invalid cursor", "SCAN", "x")
+}
+
+func TestServer_HelloAndAuth(t *testing.T) {
+	addr, _ := newTestServer(t, Options{AuthToken: "secret"})
+	c := dial(t, addr)
+
+	expectReply(t, c, "-NOAUTH Authentication required.", "GET", "k")
+	expectReply(t, c, "-WRONGPASS invalid username-password pair or user is disabled.", "AUTH", "wrong")
+	expectReply(t, c, "OK", "AUTH", "secret")
+	expectReply(t, c, "nil", "GET", "k")
+
+	c = dial(t, addr)
+	expectReply(t, c, "[server distributed_cloud_service proto :3 id :0 mode standalone role master modules []]",
+		"HELLO", "3", "AUTH", "default", "secret")
+	// RESP3 sends nulls as their own type
+	if _, err := c.conn.Write([]byte("*2\r\n$3\r\nGET\r\n$1\r\nk\r\n")); err != nil {
+		t.Fatalf("Failed to send GET: %v", err)
+	}
+	if line, _ := c.br.ReadString('\n'); line != "_\r\n" {
+		t.Errorf("Expected RESP3 null, got %q", line)
+	}
+}
+
+func TestServer_InlineAndPipeline(t *testing.T) {
+	addr, _ := newTestServer(t, Options{})
+	c := dial(t, addr)
+
+	if _, err := c.conn.Write([]byte("SET k v\r\nGET k\r\nPING\r\n")); err != nil {
+		t.Fatalf("Failed to send commands: %v", err)
+	}
+	for _, want := range []string{"OK", "v", "PONG"} {
+		if got := c.reply(); got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+
+	if _, err := c.conn.Write([]byte("*1\r\n:1\r\n")); err != nil {
+		t.Fatalf("Failed to send bad command: %v", err)
+	}
+	if got := c.reply(); !strings.HasPrefix(got, "-ERR Protocol error") {
+		t.Errorf("Expected protocol error, got %q", got)
+	}
+}
+
+func TestServer_FollowerRedirects(t *testing.T) {
+	kvStore := store.NewStore()
+	follower := &mockRaft{fsm: raft.NewFSM(kvStore)}
+	addr := startServer(t, follower, kvStore, Options{})
+	c := dial(t, addr)
+
+	// Leader unknown: READONLY
+	expectReply(t, c, "-READONLY You can't write against a read only replica.", "SET", "foo", "v")
+
+	// Leader known but it advertised no RESP address: READONLY rather than a guess
+	follower.setLeader("10.0.0.2:7100")
+	expectReply(t, c, "-READONLY You can't write against a read only replica.", "SET", "foo", "v")
+
+	// Leader advertised its address: MOVED there
+	if err := kvStore.PutNodeInfo(1, store.NodeInfo{RaftAddr: "10.0.0.2:7100", RedisAddr: "kv-2.internal:6380"}); err != nil {
+		t.Fatalf("PutNodeInfo() failed: %v", err)
+	}
+	expectReply(t, c, "-MOVED 12182 kv-2.internal:6380", "SET", "foo", "v")
+	expectReply(t, c, "-MOVED 12182 kv-2.internal:6380", "DEL", "foo")
+
+	// Reads are served locally
+	expectReply(t, c, "nil", "GET", "foo")
+}
+
+func TestServer_ConnectionLimits(t *testing.T) {
+	addr, _ := newTestServer(t, Options{AuthToken: "secret", IdleTimeout: 100 * time.Millisecond, MaxClients: 1})
+
+	// Before AUTH, a large argument is refused before any of it is read
+	c := dial(t, addr)
+	if _, err := c.conn.Write([]byte("*1\r\n$67108864\r\n")); err != nil {
+		t.Fatalf("Failed to send header: %v", err)
+	}
+	if got := c.reply(); !strings.HasPrefix(got, "-ERR Protocol error") {
+		t.Errorf("Expected protocol error for a large argument before AUTH, got %q", got)
+	}
+
+	// Idle connections are closed
+	c = dial(t, addr)
+	expectReply(t, c, "OK", "AUTH", "secret")
+	time.Sleep(300 * time.Millisecond)
+	if _, err := c.br.ReadByte(); err == nil {
+		t.Error("Expected the idle connection to be closed")
+	}
+
+	// Only MaxClients connections are served at once
+	c = dial(t, addr)
+	expectReply(t, c, "OK", "AUTH", "secret")
+	other := dial(t, addr)
+	if got := other.reply(); got != "-ERR max number of clients reached" {
+		t.Errorf("Expected the second connection to be refused, got %q", got)
+	}
+}
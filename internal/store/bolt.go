@@ -0,0 +1,389 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	dataBucket      = []byte("kv") // default namespace
+	namespaceBucket = []byte("ns") // one nested bucket per other namespace
+	metaBucket      = []byte("meta")
+
+	appliedIndexKey = []byte("applied_index")
+	valueFormatKey  = []byte("value_format")
+)
+
+// boltValueFormat is stored under valueFormatKey once every value carries the
+// flag byte of EncodeValue. Files written before compression hold plain values.
+const boltValueFormat = 1
+
+// DefaultBoltMmapSize is the address space mapped for the bolt file up front. Bolt can't
+// remap the file while a read transaction is open, so a write that grows the file past the
+// mapping waits for every open snapshot to be released. Mapping ahead reserves address
+// space only; pages are read in as they are used.
+const DefaultBoltMmapSize = 1 << 30
+
+// BoltOptions tunes the bolt engine
+type BoltOptions struct {
+	// MmapSize is the initial size of the memory map; 0 uses DefaultBoltMmapSize
+	MmapSize int
+}
+
+// boltEngine stores keys in a BoltDB file so the keyspace is not bounded by RAM
+type boltEngine struct {
+	db *bolt.DB
+
+	// usage is rebuilt on open and kept in memory so quota checks don't scan the file
+	mu    sync.RWMutex
+	usage map[string]Usage
+	total Usage
+}
+
+// OpenBoltEngine opens (or creates) a BoltDB-backed engine at path
+func OpenBoltEngine(path string) (Engine, error) {
+	return OpenBoltEngineWithOptions(path, BoltOptions{})
+}
+
+// OpenBoltEngineWithOptions opens (or creates) a BoltDB-backed engine at path with opts
+func OpenBoltEngineWithOptions(path string, opts BoltOptions) (Engine, error) {
+	if opts.MmapSize == 0 {
+		opts.MmapSize = DefaultBoltMmapSize
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second, InitialMmapSize: opts.MmapSize})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt engine: %w", err)
+	}
+
+	e := &boltEngine{db: db, usage: make(map[string]Usage)}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{dataBucket, namespaceBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if err := migrateValueFormat(tx); err != nil {
+			return err
+		}
+		return forEachNamespace(tx, func(ns string, b *bolt.Bucket) error {
+			var u Usage
+			b.ForEach(func(k, v []byte) error {
+				u.Keys++
+				u.Bytes += int64(len(k) + ValueSize(v))
+				u.Hash += entryHash(ns, string(k), v)
+				return nil
+			})
+			e.addUsage(ns, u)
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize bolt engine: %w", err)
+	}
+	return e, nil
+}
+
+// migrateValueFormat adds the flag byte to the values of a file written before compression
+func migrateValueFormat(tx *bolt.Tx) error {
+	meta := tx.Bucket(metaBucket)
+	if v := meta.Get(valueFormatKey); len(v) == 1 && v[0] == boltValueFormat {
+		return nil
+	}
+	err := forEachNamespace(tx, func(_ string, b *bolt.Bucket) error {
+		// Bolt doesn't allow writes while iterating, so collect the bucket first
+		var keys, values [][]byte
+		b.ForEach(func(k, v []byte) error {
+			keys = append(keys, append([]byte(nil), k...))
+			values = append(values, EncodeValue(v, 0))
+			return nil
+		})
+		for i, k := range keys {
+			if err := b.Put(k, values[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return meta.Put(valueFormatKey, []byte{boltValueFormat})
+}
+
+// bucketFor returns the bucket holding namespace ns, or nil if it has no keys
+func bucketFor(tx *bolt.Tx, ns string) *bolt.Bucket {
+	if ns == DefaultNamespace {
+		return tx.Bucket(dataBucket)
+	}
+	return tx.Bucket(namespaceBucket).Bucket([]byte(ns))
+}
+
+// forEachNamespace calls fn with the bucket of every namespace, starting with the default one
+func forEachNamespace(tx *bolt.Tx, fn func(ns string, b *bolt.Bucket) error) error {
+	if err := fn(DefaultNamespace, tx.Bucket(dataBucket)); err != nil {
+		return err
+	}
+	parent := tx.Bucket(namespaceBucket)
+	return parent.ForEach(func(name, _ []byte) error {
+		return fn(string(name), parent.Bucket(name))
+	})
+}
+
+// addUsage adjusts the in-memory usage of ns and the total
+func (e *boltEngine) addUsage(ns string, delta Usage) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	u := e.usage[ns]
+	u.Keys += delta.Keys
+	u.Bytes += delta.Bytes
+	u.Hash += delta.Hash
+	if u.Keys == 0 {
+		delete(e.usage, ns)
+	} else {
+		e.usage[ns] = u
+	}
+	e.total.Keys += delta.Keys
+	e.total.Bytes += delta.Bytes
+	e.total.Hash += delta.Hash
+}
+
+func (e *boltEngine) Get(ns, key string) ([]byte, bool) {
+	var val []byte
+	var ok bool
+	e.db.View(func(tx *bolt.Tx) error {
+		b := bucketFor(tx, ns)
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(key))
+		if v != nil {
+			// Bolt values are only valid inside the transaction
+			val = make([]byte, len(v))
+			copy(val, v)
+			ok = true
+		}
+		return nil
+	})
+	return val, ok
+}
+
+func (e *boltEngine) Len() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.total.Keys
+}
+
+func (e *boltEngine) Bytes() int64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.total.Bytes
+}
+
+func (e *boltEngine) Hash() uint64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.total.Hash
+}
+
+func (e *boltEngine) Usage(ns string) Usage {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.usage[ns]
+}
+
+func (e *boltEngine) Scan(ns string, fn func(key string, val []byte) error) error {
+	return e.db.View(func(tx *bolt.Tx) error {
+		b := bucketFor(tx, ns)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
+
+func (e *boltEngine) AppliedIndex() uint64 {
+	var index uint64
+	e.db.View(func(tx *bolt.Tx) error {
+		index = readAppliedIndex(tx)
+		return nil
+	})
+	return index
+}
+
+func (e *boltEngine) Write(index uint64, batch []Mutation) ([]bool, error) {
+	existed := make([]bool, len(batch))
+	deltas := make(map[string]Usage)
+	err := e.db.Update(func(tx *bolt.Tx) error {
+		for i, mut := range batch {
+			b := bucketFor(tx, mut.Namespace)
+			if b == nil {
+				if mut.Delete {
+					continue
+				}
+				var err error
+				if b, err = tx.Bucket(namespaceBucket).CreateBucket([]byte(mut.Namespace)); err != nil {
+					return err
+				}
+			}
+
+			key := []byte(mut.Key)
+			old := b.Get(key)
+			existed[i] = old != nil
+			delta := deltas[mut.Namespace]
+			if existed[i] {
+				delta.Keys--
+				delta.Bytes -= int64(len(key) + ValueSize(old))
+				delta.Hash -= entryHash(mut.Namespace, mut.Key, old)
+			}
+			if mut.Delete {
+				if err := b.Delete(key); err != nil {
+					return err
+				}
+				deltas[mut.Namespace] = delta
+				continue
+			}
+			// Bolt rejects nil values, so store empty values as a zero-length slice
+			val := mut.Value
+			if val == nil {
+				val = []byte{}
+			}
+			if err := b.Put(key, val); err != nil {
+				return err
+			}
+			delta.Keys++
+			delta.Bytes += int64(len(key) + ValueSize(val))
+			delta.Hash += entryHash(mut.Namespace, mut.Key, val)
+			deltas[mut.Namespace] = delta
+		}
+		if index != 0 {
+			return writeAppliedIndex(tx, index)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt write failed: %w", err)
+	}
+	for ns, delta := range deltas {
+		e.addUsage(ns, delta)
+	}
+	return existed, nil
+}
+
+func (e *boltEngine) DropNamespace(index uint64, ns string) error {
+	err := e.db.Update(func(tx *bolt.Tx) error {
+		if ns == DefaultNamespace {
+			if err := tx.DeleteBucket(dataBucket); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(dataBucket); err != nil {
+				return err
+			}
+		} else if bucketFor(tx, ns) != nil {
+			if err := tx.Bucket(namespaceBucket).DeleteBucket([]byte(ns)); err != nil {
+				return err
+			}
+		}
+		if index != 0 {
+			return writeAppliedIndex(tx, index)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to drop namespace %q: %w", ns, err)
+	}
+	u := e.Usage(ns)
+	e.addUsage(ns, Usage{Keys: -u.Keys, Bytes: -u.Bytes, Hash: -u.Hash})
+	return nil
+}
+
+// Snapshot opens a read transaction that stays open until Release. Writes that need the
+// file to grow beyond the memory map wait for it, so size the map with BoltOptions.MmapSize.
+func (e *boltEngine) Snapshot() (Snapshot, error) {
+	tx, err := e.db.Begin(false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin snapshot: %w", err)
+	}
+	return &boltSnapshot{tx: tx}, nil
+}
+
+func (e *boltEngine) Reset() error {
+	err := e.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{dataBucket, namespaceBucket} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return writeAppliedIndex(tx, 0)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reset bolt engine: %w", err)
+	}
+	e.mu.Lock()
+	e.usage = make(map[string]Usage)
+	e.total = Usage{}
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *boltEngine) Persistent() bool { return true }
+
+func (e *boltEngine) Close() error {
+	return e.db.Close()
+}
+
+func readAppliedIndex(tx *bolt.Tx) uint64 {
+	v := tx.Bucket(metaBucket).Get(appliedIndexKey)
+	if len(v) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+func writeAppliedIndex(tx *bolt.Tx, index uint64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, index)
+	return tx.Bucket(metaBucket).Put(appliedIndexKey, buf)
+}
+
+// boltSnapshot streams from a read-only bolt transaction
+type boltSnapshot struct {
+	tx *bolt.Tx
+}
+
+func (s *boltSnapshot) AppliedIndex() uint64 {
+	return readAppliedIndex(s.tx)
+}
+
+func (s *boltSnapshot) Get(ns, key string) ([]byte, bool) {
+	b := bucketFor(s.tx, ns)
+	if b == nil {
+		return nil, false
+	}
+	v := b.Get([]byte(key))
+	if v == nil {
+		return nil, false
+	}
+	return append([]byte(nil), v...), true
+}
+
+func (s *boltSnapshot) ForEach(fn func(ns, key string, val []byte) error) error {
+	return forEachNamespace(s.tx, func(ns string, b *bolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			return fn(ns, string(k), v)
+		})
+	})
+}
+
+func (s *boltSnapshot) Release() {
+	s.tx.Rollback()
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltEngine_PersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fsm.db")
+
+	engine, err := OpenBoltEngine(path)
+	if err != nil {
+		t.Fatalf("OpenBoltEngine() failed: %v", err)
+	}
+	store := NewStoreWithEngine(engine)
+
+	if err := store.PutAt(1, "key1", []byte("value1")); err != nil {
+		t.Fatalf("PutAt() failed: %v", err)
+	}
+	if err := store.PutAt(2, "key2", []byte("value2")); err != nil {
+		t.Fatalf("PutAt() failed: %v", err)
+	}
+	if deleted, err := store.DeleteAt(3, "key1"); err != nil || !deleted {
+		t.Fatalf("DeleteAt() = %v, %v", deleted, err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	engine, err = OpenBoltEngine(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	store = NewStoreWithEngine(engine)
+	defer store.Close()
+
+	if store.AppliedIndex() != 3 {
+		t.Errorf("Expected applied index 3 after reopen, got %d", store.AppliedIndex())
+	}
+	if store.Len() != 1 {
+		t.Errorf("Expected 1 key after reopen, got %d", store.Len())
+	}
+	if _, ok := store.Get("key1"); ok {
+		t.Error("Deleted key present after reopen")
+	}
+	val, ok := store.Get("key2")
+	if !ok || string(val) != "value2" {
+		t.Error("key2 not persisted")
+	}
+}
+
+func TestBoltEngine_SnapshotIsolation(t *testing.T) {
+	engine, err := OpenBoltEngine(filepath.Join(t.TempDir(), "fsm.db"))
+	if err != nil {
+		t.Fatalf("OpenBoltEngine() failed: %v", err)
+	}
+	store := NewStoreWithEngine(engine)
+	defer store.Close()
+
+	store.PutAt(1, "key1", []byte("before"))
+
+	snap, err := store.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() failed: %v", err)
+	}
+
+	// Writes after the snapshot must not show up in it
+	done := make(chan error, 1)
+	go func() { done <- store.PutAt(2, "key2", []byte("after")) }()
+
+	seen := map[string]string{}
+	snap.ForEach(func(_, k string, v []byte) error {
+		val, _ := DecodeValue(v)
+		seen[k] = string(val)
+		return nil
+	})
+	if _, ok := snap.Get(DefaultNamespace, "key2"); ok {
+		t.Error("Snapshot Get() found a key written after the snapshot")
+	}
+	if snap.AppliedIndex() != 1 {
+		t.Errorf("Expected snapshot index 1, got %d", snap.AppliedIndex())
+	}
+	snap.Release()
+
+	if err := <-done; err != nil {
+		t.Fatalf("PutAt() during snapshot failed: %v", err)
+	}
+	if len(seen) != 1 || seen["key1"] != "before" {
+		t.Errorf("Snapshot saw later writes: %v", seen)
+	}
+	if store.Len() != 2 {
+		t.Errorf("Expected 2 keys, got %d", store.Len())
+	}
+}
+
+func TestBoltEngine_MigratesPlainValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fsm.db")
+
+	// A file written before values carried a flag byte
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("bolt.Open() failed: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		kv, _ := tx.CreateBucketIfNotExists(dataBucket)
+		kv.Put([]byte("key1"), []byte("value1"))
+		ns, _ := tx.CreateBucketIfNotExists(namespaceBucket)
+		team, _ := ns.CreateBucket([]byte("team-a"))
+		return team.Put([]byte("key2"), []byte("value2"))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to write old format: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		engine, err := OpenBoltEngine(path)
+		if err != nil {
+			t.Fatalf("OpenBoltEngine() failed: %v", err)
+		}
+		store := NewStoreWithEngine(engine)
+		if val, ok := store.Get("key1"); !ok || string(val) != "value1" {
+			t.Errorf("Expected value1 after migration, got %q", val)
+		}
+		if val, ok := store.GetIn("team-a", "key2"); !ok || string(val) != "value2" {
+			t.Errorf("Expected value2 after migration, got %q", val)
+		}
+		if store.Bytes() != int64(len("key1value1key2value2")) {
+			t.Errorf("Expected usage of the original sizes, got %d bytes", store.Bytes())
+		}
+		store.Close()
+	}
+}
+
+func TestOpen_UnknownEngine(t *testing.T) {
+	if _, err := Open("rocksdb", t.TempDir()); err == nil {
+		t.Error("Open() should reject unknown engines")
+	}
+}
+
+func TestBoltEngine_WritesDuringSnapshot(t *testing.T) {
+	engine, err := OpenBoltEngineWithOptions(filepath.Join(t.TempDir(), "fsm.db"), BoltOptions{MmapSize: 64 << 20})
+	if err != nil {
+		t.Fatalf("OpenBoltEngineWithOptions() failed: %v", err)
+	}
+	store := NewStoreWithEngine(engine)
+	defer store.Close()
+
+	snap, err := engine.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() failed: %v", err)
+	}
+	defer snap.Release()
+
+	// Grow the file well past bolt's default mapping while the snapshot is open
+	done := make(chan error, 1)
+	go func() {
+		val := bytes.Repeat([]byte("x"), 64<<10)
+		for i := 0; i < 128; i++ {
+			if err := store.PutAt(uint64(i+1), fmt.Sprintf("key%d", i), val); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("PutAt() failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Writes blocked behind the open snapshot")
+	}
+}
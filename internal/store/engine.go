@@ -0,0 +1,74 @@
+package store
+
+// Storage engine names accepted by Open
+const (
+	EngineMemory = "memory"
+	EngineBolt   = "bolt"
+)
+
+// DefaultNamespace holds keys written without a namespace (the /kv/ API)
+const DefaultNamespace = ""
+
+// Mutation is a single change applied as part of a batch
+type Mutation struct {
+	Namespace string
+	Key       string
+	Value     []byte
+	Delete    bool
+}
+
+// Usage is the number of keys and bytes of keys and uncompressed values held by a namespace,
+// together with the sum of its entry hashes
+type Usage struct {
+	Keys  int    `json:"keys"`
+	Bytes int64  `json:"bytes"`
+	Hash  uint64 `json:"-"`
+}
+
+// Engine is the storage backend behind Store. Keys live in namespaces, which are
+// independent keyspaces; the default namespace is the empty string.
+// Values are stored as encoded by EncodeValue and sized with ValueSize.
+// Writes record the Raft index they belong to in the same atomic step as the data,
+// so a persistent engine knows exactly which log entries it already contains.
+type Engine interface {
+	// Get returns the value stored under key in namespace ns. It may share memory with
+	// the engine, so callers must not modify it.
+	Get(ns, key string) ([]byte, bool)
+	// Len returns the number of keys across all namespaces
+	Len() int
+	// Bytes returns the total size of all keys and values
+	Bytes() int64
+	// Usage returns the key count and size of namespace ns
+	Usage(ns string) Usage
+	// Hash returns the sum of the hashes of every key and value across all namespaces
+	Hash() uint64
+	// Scan calls fn for every key in namespace ns; fn must not retain val or write to the engine
+	Scan(ns string, fn func(key string, val []byte) error) error
+	// AppliedIndex returns the Raft index of the last write (0 if unknown)
+	AppliedIndex() uint64
+	// Write applies the batch atomically; a non-zero index is recorded as applied.
+	// It reports which keys in the batch existed before it was applied.
+	Write(index uint64, batch []Mutation) ([]bool, error)
+	// DropNamespace removes every key in ns; a non-zero index is recorded as applied
+	DropNamespace(index uint64, ns string) error
+	// Snapshot returns a point-in-time view of the data
+	Snapshot() (Snapshot, error)
+	// Reset removes all keys and clears the applied index
+	Reset() error
+	// Persistent reports whether data survives a restart
+	Persistent() bool
+	// Close releases the engine's resources
+	Close() error
+}
+
+// Snapshot is a point-in-time, read-only view of an engine
+type Snapshot interface {
+	// AppliedIndex returns the Raft index the view reflects
+	AppliedIndex() uint64
+	// Get returns the encoded value of a key as of the view; callers must not modify it
+	Get(ns, key string) ([]byte, bool)
+	// ForEach calls fn for every key in the view; fn must not retain val
+	ForEach(fn func(ns, key string, val []byte) error) error
+	// Release frees resources held by the view
+	Release()
+}
@@ -0,0 +1,27 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// entryHash hashes one key and its encoded value. The hash of a namespace (and of the
+// store) is the sum of the hashes of its entries, so a write updates it from the old and
+// new value alone and the result doesn't depend on the order keys were written in.
+func entryHash(ns, key string, val []byte) uint64 {
+	h := sha256.New()
+	var n [binary.MaxVarintLen64]byte
+	h.Write(n[:binary.PutUvarint(n[:], uint64(len(ns)))])
+	h.Write([]byte(ns))
+	h.Write(n[:binary.PutUvarint(n[:], uint64(len(key)))])
+	h.Write([]byte(key))
+	h.Write(val)
+	var sum [sha256.Size]byte
+	return binary.BigEndian.Uint64(h.Sum(sum[:0]))
+}
+
+// FormatHash renders a store hash the way it is reported and compared between nodes
+func FormatHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStore_HashIsOrderIndependent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fsm.db")
+	engine, err := OpenBoltEngine(path)
+	if err != nil {
+		t.Fatalf("OpenBoltEngine() failed: %v", err)
+	}
+	a, b := NewStore(), NewStoreWithEngine(engine)
+
+	a.PutIn(1, "", "key1", []byte("value1"))
+	a.PutIn(2, "team-a", "key2", []byte("value2"))
+	b.PutIn(1, "team-a", "key2", []byte("value2"))
+	b.PutIn(2, "", "key1", []byte("other"))
+	if a.Hash() == b.Hash() {
+		t.Error("Stores with different values should have different hashes")
+	}
+	b.PutIn(3, "", "key1", []byte("value1"))
+	if a.Hash() != b.Hash() {
+		t.Errorf("Expected equal hashes, got %s and %s", FormatHash(a.Hash()), FormatHash(b.Hash()))
+	}
+
+	// The same key in another namespace is a different entry
+	before := a.Hash()
+	a.PutIn(3, "team-b", "key1", []byte("value1"))
+	if a.Hash() == before {
+		t.Error("Adding a key should change the hash")
+	}
+	a.DeleteIn(4, "team-b", "key1")
+	if a.Hash() != before {
+		t.Error("Deleting the key should restore the previous hash")
+	}
+
+	a.PutIn(5, "team-a", "key3", []byte("value3"))
+	a.engine.DropNamespace(6, "team-a")
+	b.engine.DropNamespace(4, "team-a")
+	if a.Hash() != b.Hash() || a.Hash() != entryHash("", "key1", EncodeValue([]byte("value1"), 0)) {
+		t.Error("DropNamespace should remove the namespace's entries from the hash")
+	}
+
+	// The bolt engine rebuilds the hash on open
+	want := b.Hash()
+	b.Close()
+	engine, err = OpenBoltEngine(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer engine.Close()
+	if engine.Hash() != want {
+		t.Errorf("Expected hash %s after reopen, got %s", FormatHash(want), FormatHash(engine.Hash()))
+	}
+}
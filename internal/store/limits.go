@@ -0,0 +1,226 @@
+package store
+
+import (
+	"distributed_cloud_service/internal/cluster"
+	"encoding/json"
+	"fmt"
+)
+
+// ClusterNamespace holds settings replicated to every node through the Raft log
+const ClusterNamespace = "_cluster"
+
+// limitsKey holds the store-wide limits in ClusterNamespace
+const limitsKey = "limits"
+
+// Quota resources, also used as metric labels
+const (
+	ResourceKeySize   = "key_size"
+	ResourceValueSize = "value_size"
+	ResourceKeys      = "keys"
+	ResourceBytes     = "bytes"
+	ResourceMetaSize  = "meta_size"
+)
+
+// QuotaError reports a write rejected by a configured limit
+type QuotaError struct {
+	Resource  string
+	Namespace string // set when a namespace's own limit was hit
+	Limit     int64
+	Want      int64 // size of the key or value, or usage after the write
+}
+
+func (e *QuotaError) Error() string {
+	if e.Namespace != "" {
+		return fmt.Sprintf("namespace %q: %s", e.Namespace, e.message())
+	}
+	return e.message()
+}
+
+func (e *QuotaError) message() string {
+	switch e.Resource {
+	case ResourceKeySize:
+		return fmt.Sprintf("key exceeds the %d byte limit", e.Limit)
+	case ResourceValueSize:
+		return fmt.Sprintf("value exceeds the %d byte limit", e.Limit)
+	case ResourceKeys:
+		return fmt.Sprintf("key quota exceeded: limit is %d keys", e.Limit)
+	case ResourceMetaSize:
+		return fmt.Sprintf("metadata exceeds the %d byte limit", e.Limit)
+	default:
+		return fmt.Sprintf("storage quota exceeded: write needs %d bytes, limit is %d", e.Want, e.Limit)
+	}
+}
+
+// TooLarge reports whether the write itself is oversized, as opposed to the store being full
+func (e *QuotaError) TooLarge() bool {
+	return e.Resource == ResourceKeySize || e.Resource == ResourceValueSize || e.Resource == ResourceMetaSize
+}
+
+// ClusterLimits returns the store-wide limits replicated through the log, if any were
+func (s *Store) ClusterLimits() (cluster.LimitsConfig, bool) {
+	var limits cluster.LimitsConfig
+	ok := s.getJSON(ClusterNamespace, limitsKey, &limits)
+	return limits, ok
+}
+
+// PutClusterLimits records the store-wide limits as part of the Raft entry at index
+func (s *Store) PutClusterLimits(index uint64, limits cluster.LimitsConfig) error {
+	data, err := json.Marshal(limits)
+	if err != nil {
+		return err
+	}
+	return s.PutIn(index, ClusterNamespace, limitsKey, data)
+}
+
+// CheckSize checks a key and value against the per-entry limits
+func CheckSize(limits cluster.LimitsConfig, key string, valueSize int64) error {
+	if err := checkSize(limits, key, valueSize); err != nil {
+		return err
+	}
+	return nil
+}
+
+func checkSize(limits cluster.LimitsConfig, key string, valueSize int64) *QuotaError {
+	if limits.MaxKeySize > 0 && len(key) > limits.MaxKeySize {
+		return &QuotaError{Resource: ResourceKeySize, Limit: int64(limits.MaxKeySize), Want: int64(len(key))}
+	}
+	if limits.MaxValueSize > 0 && valueSize > limits.MaxValueSize {
+		return &QuotaError{Resource: ResourceValueSize, Limit: limits.MaxValueSize, Want: valueSize}
+	}
+	return nil
+}
+
+// CheckPut checks whether storing valueSize bytes under key in the default namespace
+// stays within limits, taking into account the value it would replace
+func (s *Store) CheckPut(limits cluster.LimitsConfig, key string, valueSize int64) error {
+	return s.CheckPutIn(limits, cluster.LimitsConfig{}, DefaultNamespace, key, valueSize)
+}
+
+// CheckPutIn checks a put into namespace ns against the store-wide limits and the
+// namespace's own limits, taking into account the value it would replace
+func (s *Store) CheckPutIn(limits, nsLimits cluster.LimitsConfig, ns, key string, valueSize int64) error {
+	if err := checkSize(limits, key, valueSize); err != nil {
+		return err
+	}
+	if err := checkSize(nsLimits, key, valueSize); err != nil {
+		err.Namespace = ns
+		return err
+	}
+
+	var delta Usage
+	delta.Bytes = int64(len(key)) + valueSize
+	if old, ok := s.engine.Get(ns, key); ok {
+		delta.Bytes -= int64(len(key) + ValueSize(old))
+	} else {
+		delta.Keys = 1
+	}
+
+	total := Usage{Keys: s.Len(), Bytes: s.Bytes()}
+	if err := checkUsage(limits, total, delta); err != nil {
+		return err
+	}
+	if err := checkUsage(nsLimits, s.Usage(ns), delta); err != nil {
+		err.Namespace = ns
+		return err
+	}
+	return nil
+}
+
+// CheckBatch checks a batch of encoded values against the store-wide limits and the limits of each
+// namespace in nsLimits, as if every mutation in it were applied at once
+func (s *Store) CheckBatch(limits cluster.LimitsConfig, nsLimits map[string]cluster.LimitsConfig, batch []Mutation) error {
+	return s.CheckBatchAfter(limits, nsLimits, nil, batch)
+}
+
+// CheckBatchAfter checks batch as if the per-namespace usage in pending had already been
+// added to the store, and adds the batch's own usage to pending when it passes. Dry runs
+// use it to check batches they never apply. A key written by several batches is counted
+// once per batch, so the check errs on the side of rejecting.
+func (s *Store) CheckBatchAfter(limits cluster.LimitsConfig, nsLimits map[string]cluster.LimitsConfig, pending map[string]Usage, batch []Mutation) error {
+	type nsKey struct{ ns, key string }
+	written := make(map[nsKey]int) // value size of keys the batch already wrote, -1 once deleted
+	deltas := make(map[string]Usage)
+	var total Usage
+
+	for _, mut := range batch {
+		size := ValueSize(mut.Value)
+		if !mut.Delete {
+			if err := checkSize(limits, mut.Key, int64(size)); err != nil {
+				return err
+			}
+			if err := checkSize(nsLimits[mut.Namespace], mut.Key, int64(size)); err != nil {
+				err.Namespace = mut.Namespace
+				return err
+			}
+		}
+
+		k := nsKey{mut.Namespace, mut.Key}
+		oldSize, ok := written[k]
+		if !ok {
+			oldSize = -1
+			if old, exists := s.engine.Get(mut.Namespace, mut.Key); exists {
+				oldSize = ValueSize(old)
+			}
+		}
+
+		var delta Usage
+		if oldSize >= 0 {
+			delta.Keys--
+			delta.Bytes -= int64(len(mut.Key) + oldSize)
+		}
+		written[k] = -1
+		if !mut.Delete {
+			delta.Keys++
+			delta.Bytes += int64(len(mut.Key) + size)
+			written[k] = size
+		}
+
+		d := deltas[mut.Namespace]
+		d.Keys += delta.Keys
+		d.Bytes += delta.Bytes
+		deltas[mut.Namespace] = d
+		total.Keys += delta.Keys
+		total.Bytes += delta.Bytes
+	}
+
+	usage := Usage{Keys: s.Len(), Bytes: s.Bytes()}
+	for _, p := range pending {
+		usage.Keys += p.Keys
+		usage.Bytes += p.Bytes
+	}
+	if err := checkUsage(limits, usage, total); err != nil {
+		return err
+	}
+	for ns, delta := range deltas {
+		nsUsage := s.Usage(ns)
+		nsUsage.Keys += pending[ns].Keys
+		nsUsage.Bytes += pending[ns].Bytes
+		if err := checkUsage(nsLimits[ns], nsUsage, delta); err != nil {
+			err.Namespace = ns
+			return err
+		}
+	}
+
+	if pending != nil {
+		for ns, delta := range deltas {
+			p := pending[ns]
+			p.Keys += delta.Keys
+			p.Bytes += delta.Bytes
+			pending[ns] = p
+		}
+	}
+	return nil
+}
+
+// checkUsage checks the key count and total bytes after applying delta to usage
+func checkUsage(limits cluster.LimitsConfig, usage, delta Usage) *QuotaError {
+	keys := int64(usage.Keys + delta.Keys)
+	bytes := usage.Bytes + delta.Bytes
+	if limits.MaxKeys > 0 && delta.Keys > 0 && keys > limits.MaxKeys {
+		return &QuotaError{Resource: ResourceKeys, Limit: limits.MaxKeys, Want: keys}
+	}
+	if limits.MaxTotalBytes > 0 && delta.Bytes > 0 && bytes > limits.MaxTotalBytes {
+		return &QuotaError{Resource: ResourceBytes, Limit: limits.MaxTotalBytes, Want: bytes}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"distributed_cloud_service/internal/cluster"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStore_Bytes(t *testing.T) {
+	engine, err := OpenBoltEngine(filepath.Join(t.TempDir(), "fsm.db"))
+	if err != nil {
+		t.Fatalf("OpenBoltEngine() failed: %v", err)
+	}
+	defer engine.Close()
+
+	for name, store := range map[string]*Store{"memory": NewStore(), "bolt": NewStoreWithEngine(engine)} {
+		store.Put("key1", []byte("12345"))
+		store.Put("key2", []byte("123"))
+		store.Put("key1", []byte("1"))
+		store.Delete("key2")
+
+		if store.Bytes() != int64(len("key1")+1) {
+			t.Errorf("%s: expected %d bytes, got %d", name, len("key1")+1, store.Bytes())
+		}
+	}
+}
+
+func TestStore_CheckPut(t *testing.T) {
+	store := NewStore()
+	store.Put("existing", []byte("0123456789"))
+	limits := cluster.LimitsConfig{MaxKeySize: 16, MaxValueSize: 32, MaxKeys: 2, MaxTotalBytes: 48}
+
+	tests := []struct {
+		name     string
+		key      string
+		size     int64
+		resource string
+	}{
+		{"fits", "new", 10, ""},
+		{"key too long", strings.Repeat("k", 17), 1, ResourceKeySize},
+		{"value too large", "new", 33, ResourceValueSize},
+		{"total bytes", "new", 32, ResourceBytes},
+		{"overwrite frees old value", "existing", 32, ""},
+	}
+	for _, tt := range tests {
+		err := store.CheckPut(limits, tt.key, tt.size)
+		if tt.resource == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+		var quotaErr *QuotaError
+		if !errors.As(err, &quotaErr) || quotaErr.Resource != tt.resource {
+			t.Errorf("%s: expected %s quota error, got %v", tt.name, tt.resource, err)
+		}
+	}
+
+	store.Put("second", nil)
+	err := store.CheckPut(limits, "third", 1)
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.Resource != ResourceKeys || quotaErr.TooLarge() {
+		t.Errorf("Expected key count quota error, got %v", err)
+	}
+	if err := store.CheckPut(limits, "second", 1); err != nil {
+		t.Errorf("Overwriting an existing key should not count against max_keys: %v", err)
+	}
+}
+
+func TestStore_CheckBatch(t *testing.T) {
+	store := NewStore()
+	store.Put("existing", []byte("0123456789"))
+	limits := cluster.LimitsConfig{MaxKeys: 3}
+	nsLimits := map[string]cluster.LimitsConfig{"team-a": {MaxKeys: 1}}
+
+	// Two new keys fit, a third doesn't, and rewriting a key in the same batch counts once
+	fits := []Mutation{{Key: "a", Value: []byte("1")}, {Key: "b", Value: []byte("2")}, {Key: "a", Value: []byte("3")}}
+	if err := store.CheckBatch(limits, nil, fits); err != nil {
+		t.Errorf("Expected batch to fit, got %v", err)
+	}
+	tooMany := append(fits, Mutation{Key: "c", Value: []byte("4")})
+	var quotaErr *QuotaError
+	if err := store.CheckBatch(limits, nil, tooMany); !errors.As(err, &quotaErr) || quotaErr.Resource != ResourceKeys {
+		t.Errorf("Expected keys quota error, got %v", err)
+	}
+	// Deleting a key in the batch makes room for another
+	withDelete := append(tooMany, Mutation{Key: "existing", Delete: true})
+	if err := store.CheckBatch(limits, nil, withDelete); err != nil {
+		t.Errorf("Expected batch with a delete to fit, got %v", err)
+	}
+
+	// Namespace limits apply to the keys of that namespace only
+	nsBatch := []Mutation{{Namespace: "team-a", Key: "a", Value: []byte("1")}, {Namespace: "team-a", Key: "b", Value: []byte("2")}}
+	if err := store.CheckBatch(limits, nsLimits, nsBatch); !errors.As(err, &quotaErr) || quotaErr.Namespace != "team-a" {
+		t.Errorf("Expected team-a quota error, got %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package store
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	iradix "github.com/hashicorp/go-immutable-radix"
+)
+
+// memoryState is one immutable version of the memory engine's data.
+// Writers build a new state and publish it; readers and snapshots keep using
+// whichever state they loaded, so they never block or observe a partial batch.
+type memoryState struct {
+	tree    *iradix.Tree // treeKey(ns, key) -> []byte
+	usage   *iradix.Tree // namespace -> Usage
+	total   Usage
+	applied uint64
+}
+
+// memoryEngine keeps everything in an immutable radix tree behind an atomic pointer
+type memoryEngine struct {
+	writeMu sync.Mutex // serializes writers; readers don't lock
+	state   atomic.Pointer[memoryState]
+}
+
+// NewMemoryEngine creates an engine that keeps all data in memory
+func NewMemoryEngine() Engine {
+	m := &memoryEngine{}
+	m.state.Store(emptyMemoryState())
+	return m
+}
+
+func emptyMemoryState() *memoryState {
+	return &memoryState{tree: iradix.New(), usage: iradix.New()}
+}
+
+// treeKey places a key under its namespace. Namespace names can't contain a
+// zero byte, so the prefix of one namespace never matches another.
+func treeKey(ns, key string) []byte {
+	k := make([]byte, 0, len(ns)+1+len(key))
+	k = append(k, ns...)
+	k = append(k, 0)
+	return append(k, key...)
+}
+
+func namespacePrefix(ns string) []byte {
+	return append([]byte(ns), 0)
+}
+
+func splitTreeKey(k []byte) (ns, key string) {
+	ns, key, _ = strings.Cut(string(k), "\x00")
+	return ns, key
+}
+
+func (m *memoryEngine) Get(ns, key string) ([]byte, bool) {
+	v, ok := m.state.Load().tree.Get(treeKey(ns, key))
+	if !ok {
+		return nil, false
+	}
+	return v.([]byte), true
+}
+
+func (m *memoryEngine) Len() int {
+	return m.state.Load().total.Keys
+}
+
+func (m *memoryEngine) Bytes() int64 {
+	return m.state.Load().total.Bytes
+}
+
+func (m *memoryEngine) Hash() uint64 {
+	return m.state.Load().total.Hash
+}
+
+func (m *memoryEngine) Usage(ns string) Usage {
+	return m.state.Load().namespaceUsage(ns)
+}
+
+func (st *memoryState) namespaceUsage(ns string) Usage {
+	if u, ok := st.usage.Get([]byte(ns)); ok {
+		return u.(Usage)
+	}
+	return Usage{}
+}
+
+// Scan walks the namespace as it was when Scan was called, in key order
+func (m *memoryEngine) Scan(ns string, fn func(key string, val []byte) error) error {
+	var err error
+	m.state.Load().tree.Root().WalkPrefix(namespacePrefix(ns), func(k []byte, v interface{}) bool {
+		_, key := splitTreeKey(k)
+		err = fn(key, v.([]byte))
+		return err != nil
+	})
+	return err
+}
+
+func (m *memoryEngine) AppliedIndex() uint64 {
+	return m.state.Load().applied
+}
+
+// Write applies the batch to a new version of the tree and publishes it in one step
+func (m *memoryEngine) Write(index uint64, batch []Mutation) ([]bool, error) {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+
+	st := m.state.Load()
+	next := *st
+	txn := st.tree.Txn()
+
+	existed := make([]bool, len(batch))
+	var deltaBuf [1]namespaceDelta // batches rarely span more than one namespace
+	deltas := deltaBuf[:0]
+	for i, mut := range batch {
+		k := treeKey(mut.Namespace, mut.Key)
+		var old interface{}
+		if mut.Delete {
+			old, existed[i] = txn.Delete(k)
+		} else {
+			old, existed[i] = txn.Insert(k, mut.Value)
+		}
+
+		var delta Usage
+		if existed[i] {
+			delta.Keys--
+			delta.Bytes -= int64(len(mut.Key) + ValueSize(old.([]byte)))
+			delta.Hash -= entryHash(mut.Namespace, mut.Key, old.([]byte))
+		}
+		if !mut.Delete {
+			delta.Keys++
+			delta.Bytes += int64(len(mut.Key) + ValueSize(mut.Value))
+			delta.Hash += entryHash(mut.Namespace, mut.Key, mut.Value)
+		}
+		deltas = addDelta(deltas, mut.Namespace, delta)
+	}
+
+	next.tree = txn.Commit()
+	next.addUsage(deltas...)
+	if index != 0 {
+		next.applied = index
+	}
+	m.state.Store(&next)
+	return existed, nil
+}
+
+// namespaceDelta accumulates the usage change of one namespace within a batch
+type namespaceDelta struct {
+	ns    string
+	delta Usage
+}
+
+func addDelta(deltas []namespaceDelta, ns string, delta Usage) []namespaceDelta {
+	for i := range deltas {
+		if deltas[i].ns == ns {
+			deltas[i].delta.Keys += delta.Keys
+			deltas[i].delta.Bytes += delta.Bytes
+			deltas[i].delta.Hash += delta.Hash
+			return deltas
+		}
+	}
+	return append(deltas, namespaceDelta{ns: ns, delta: delta})
+}
+
+// addUsage adjusts the namespace usage and the total of a state that is not yet published
+func (st *memoryState) addUsage(deltas ...namespaceDelta) {
+	txn := st.usage.Txn()
+	for _, d := range deltas {
+		u := st.namespaceUsage(d.ns)
+		u.Keys += d.delta.Keys
+		u.Bytes += d.delta.Bytes
+		u.Hash += d.delta.Hash
+		if u.Keys == 0 {
+			txn.Delete([]byte(d.ns))
+		} else {
+			txn.Insert([]byte(d.ns), u)
+		}
+		st.total.Keys += d.delta.Keys
+		st.total.Bytes += d.delta.Bytes
+		st.total.Hash += d.delta.Hash
+	}
+	st.usage = txn.Commit()
+}
+
+func (m *memoryEngine) DropNamespace(index uint64, ns string) error {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+
+	st := m.state.Load()
+	next := *st
+	txn := st.tree.Txn()
+	txn.DeletePrefix(namespacePrefix(ns))
+	next.tree = txn.Commit()
+	u := st.namespaceUsage(ns)
+	next.addUsage(namespaceDelta{ns: ns, delta: Usage{Keys: -u.Keys, Bytes: -u.Bytes, Hash: -u.Hash}})
+	if index != 0 {
+		next.applied = index
+	}
+	m.state.Store(&next)
+	return nil
+}
+
+// Snapshot grabs the current version of the tree, which later writes never modify
+func (m *memoryEngine) Snapshot() (Snapshot, error) {
+	return &memorySnapshot{state: m.state.Load()}, nil
+}
+
+func (m *memoryEngine) Reset() error {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	m.state.Store(emptyMemoryState())
+	return nil
+}
+
+func (m *memoryEngine) Persistent() bool { return false }
+
+func (m *memoryEngine) Close() error { return nil }
+
+// memorySnapshot is a published, immutable version of the memory engine
+type memorySnapshot struct {
+	state *memoryState
+}
+
+func (s *memorySnapshot) AppliedIndex() uint64 { return s.state.applied }
+
+func (s *memorySnapshot) Get(ns, key string) ([]byte, bool) {
+	v, ok := s.state.tree.Get(treeKey(ns, key))
+	if !ok {
+		return nil, false
+	}
+	return v.([]byte), true
+}
+
+// ForEach visits every key in namespace and key order
+func (s *memorySnapshot) ForEach(fn func(ns, key string, val []byte) error) error {
+	var err error
+	s.state.tree.Root().Walk(func(k []byte, v interface{}) bool {
+		ns, key := splitTreeKey(k)
+		err = fn(ns, key, v.([]byte))
+		return err != nil
+	})
+	return err
+}
+
+func (s *memorySnapshot) Release() {}
@@ -0,0 +1,172 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestMemoryEngine_BatchIsAtomic(t *testing.T) {
+	engine := NewMemoryEngine()
+
+	// Readers must see every key of a batch or none of them
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			snap, _ := engine.Snapshot()
+			values := map[string]bool{}
+			snap.ForEach(func(_, _ string, val []byte) error {
+				values[string(val)] = true
+				return nil
+			})
+			snap.Release()
+			if len(values) > 1 {
+				t.Errorf("Snapshot saw a partially applied batch: %v", values)
+				return
+			}
+		}
+	}()
+
+	for round := 0; round < 200; round++ {
+		batch := make([]Mutation, 32)
+		for i := range batch {
+			batch[i] = Mutation{Key: "key" + strconv.Itoa(i), Value: []byte(strconv.Itoa(round))}
+		}
+		if _, err := engine.Write(uint64(round+1), batch); err != nil {
+			t.Fatalf("Write() failed: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if engine.Len() != 32 || engine.AppliedIndex() != 200 {
+		t.Errorf("Expected 32 keys at index 200, got %d at %d", engine.Len(), engine.AppliedIndex())
+	}
+}
+
+func TestMemoryEngine_SnapshotIsolation(t *testing.T) {
+	engine := NewMemoryEngine()
+	engine.Write(1, []Mutation{{Key: "a", Value: []byte("1")}, {Key: "b", Value: []byte("2")}})
+
+	snap, _ := engine.Snapshot()
+	defer snap.Release()
+
+	// Writes after the snapshot must not show up in it
+	engine.Write(2, []Mutation{{Key: "a", Value: []byte("changed")}, {Key: "b", Delete: true}, {Key: "c", Value: []byte("3")}})
+	engine.DropNamespace(3, DefaultNamespace)
+
+	got := map[string]string{}
+	snap.ForEach(func(_, key string, val []byte) error {
+		got[key] = string(val)
+		return nil
+	})
+	if len(got) != 2 || got["a"] != "1" || got["b"] != "2" {
+		t.Errorf("Expected snapshot {a:1 b:2}, got %v", got)
+	}
+	if val, ok := snap.Get(DefaultNamespace, "a"); !ok || string(val) != "1" {
+		t.Errorf("Expected snapshot Get(a) = 1, got %q (found %v)", val, ok)
+	}
+	if _, ok := snap.Get(DefaultNamespace, "c"); ok {
+		t.Error("Snapshot Get() found a key written after the snapshot")
+	}
+	if snap.AppliedIndex() != 1 {
+		t.Errorf("Expected snapshot index 1, got %d", snap.AppliedIndex())
+	}
+	if engine.Len() != 0 || engine.AppliedIndex() != 3 {
+		t.Errorf("Expected empty engine at index 3, got %d keys at %d", engine.Len(), engine.AppliedIndex())
+	}
+}
+
+// lockedMap is the single-mutex design the memory engine replaced, kept as a benchmark baseline
+type lockedMap struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+func (l *lockedMap) get(key string) ([]byte, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	v, ok := l.data[key]
+	return v, ok
+}
+
+func (l *lockedMap) put(key string, val []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.data[key] = val
+}
+
+const benchKeys = 10000
+
+var benchKeyNames = func() []string {
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	return keys
+}()
+
+// benchmarkParallel runs a read/write mix with writePercent of operations writing.
+// Run with -cpu 1,2,4,8 to see how each design scales.
+func benchmarkParallel(b *testing.B, writePercent int, get func(string) ([]byte, bool), put func(string, []byte)) {
+	value := []byte("value")
+	for _, key := range benchKeyNames {
+		put(key, value)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := benchKeyNames[(i*7919)%benchKeys]
+			if i%100 < writePercent {
+				put(key, value)
+			} else {
+				get(key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkParallel(b *testing.B) {
+	for _, writePercent := range []int{0, 10, 50} {
+		b.Run(fmt.Sprintf("writes=%d%%/engine", writePercent), func(b *testing.B) {
+			engine := NewMemoryEngine()
+			get := func(key string) ([]byte, bool) { return engine.Get(DefaultNamespace, key) }
+			put := func(key string, val []byte) { engine.Write(0, []Mutation{{Key: key, Value: val}}) }
+			benchmarkParallel(b, writePercent, get, put)
+		})
+		b.Run(fmt.Sprintf("writes=%d%%/single-lock", writePercent), func(b *testing.B) {
+			l := &lockedMap{data: make(map[string][]byte)}
+			benchmarkParallel(b, writePercent, l.get, l.put)
+		})
+	}
+}
+
+// BenchmarkSnapshot shows that taking a snapshot costs the same regardless of store size
+func BenchmarkSnapshot(b *testing.B) {
+	for _, size := range []int{1000, 100000} {
+		b.Run(fmt.Sprintf("keys=%d", size), func(b *testing.B) {
+			engine := NewMemoryEngine()
+			batch := make([]Mutation, size)
+			for i := range batch {
+				batch[i] = Mutation{Key: "key" + strconv.Itoa(i), Value: make([]byte, 64)}
+			}
+			engine.Write(1, batch)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				snap, _ := engine.Snapshot()
+				snap.Release()
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// MaxMetaSize caps the encoded metadata kept with a value (content type and headers)
+const MaxMetaSize = 8 << 10
+
+// metaVersion is the first byte of encoded metadata, so fields can be added later
+const metaVersion byte = 1
+
+// Meta describes a stored value. The FSM sets it on every write: indexes are Raft log
+// indexes and times are the leader's clock when it appended the entry, so every replica
+// stores the same metadata.
+type Meta struct {
+	CreateIndex uint64            `json:"create_index"`           // Index of the write that created the key
+	ModifyIndex uint64            `json:"modify_index"`           // Index of the latest write
+	Version     uint64            `json:"version"`                // Number of writes since the key was created
+	Created     int64             `json:"created,omitempty"`      // Unix milliseconds, 0 if unknown
+	Modified    int64             `json:"modified,omitempty"`     // Unix milliseconds, 0 if unknown
+	ContentType string            `json:"content_type,omitempty"` // As sent by the client
+	Headers     map[string]string `json:"headers,omitempty"`      // Custom metadata, e.g. from X-Meta-* headers
+
+	// Size is the original size of the value. It is filled in when metadata is read
+	// and not stored.
+	Size int64 `json:"size"`
+}
+
+// encodeMeta serializes m with its headers in name order, so equal metadata always
+// encodes to the same bytes
+func encodeMeta(m Meta) []byte {
+	buf := []byte{metaVersion}
+	buf = binary.AppendUvarint(buf, m.CreateIndex)
+	buf = binary.AppendUvarint(buf, m.ModifyIndex)
+	buf = binary.AppendUvarint(buf, m.Version)
+	buf = binary.AppendVarint(buf, m.Created)
+	buf = binary.AppendVarint(buf, m.Modified)
+	buf = appendString(buf, m.ContentType)
+
+	names := make([]string, 0, len(m.Headers))
+	for name := range m.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf = binary.AppendUvarint(buf, uint64(len(names)))
+	for _, name := range names {
+		buf = appendString(buf, name)
+		buf = appendString(buf, m.Headers[name])
+	}
+	return buf
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// decodeMeta parses metadata written by encodeMeta
+func decodeMeta(data []byte) (Meta, error) {
+	r := metaReader{data: data}
+	if v := r.byte(); v != metaVersion {
+		return Meta{}, fmt.Errorf("%w: unknown metadata version %d", ErrInvalidValue, v)
+	}
+	m := Meta{
+		CreateIndex: r.uvarint(),
+		ModifyIndex: r.uvarint(),
+		Version:     r.uvarint(),
+		Created:     r.varint(),
+		Modified:    r.varint(),
+		ContentType: r.string(),
+	}
+	if n := r.uvarint(); n > 0 && r.err == nil {
+		if n > uint64(len(r.data)) {
+			return Meta{}, fmt.Errorf("%w: truncated metadata", ErrInvalidValue)
+		}
+		m.Headers = make(map[string]string, n)
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			name := r.string()
+			m.Headers[name] = r.string()
+		}
+	}
+	if r.err != nil || len(r.data) != 0 {
+		return Meta{}, fmt.Errorf("%w: corrupt metadata", ErrInvalidValue)
+	}
+	return m, nil
+}
+
+// metaReader reads encoded metadata, remembering the first error
+type metaReader struct {
+	data []byte
+	err  error
+}
+
+func (r *metaReader) byte() byte {
+	if len(r.data) == 0 {
+		r.err = ErrInvalidValue
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *metaReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = ErrInvalidValue
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *metaReader) varint() int64 {
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = ErrInvalidValue
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *metaReader) string() string {
+	n := r.uvarint()
+	if r.err != nil || n > uint64(len(r.data)) {
+		r.err = ErrInvalidValue
+		return ""
+	}
+	s := string(r.data[:n])
+	r.data = r.data[n:]
+	return s
+}
+
+// WithMeta returns a copy of an encoded value carrying metadata m. Size is not stored.
+func WithMeta(enc []byte, m Meta) ([]byte, error) {
+	h, body, err := splitValue(enc)
+	if err != nil {
+		return nil, err
+	}
+	h.meta = encodeMeta(m)
+	if len(h.meta) > MaxMetaSize {
+		return nil, &QuotaError{Resource: ResourceMetaSize, Limit: MaxMetaSize, Want: int64(len(h.meta))}
+	}
+	return h.join(body), nil
+}
+
+// ValueMeta returns the metadata of an encoded value with its Size filled in.
+// Values written before metadata was kept only report their size.
+func ValueMeta(enc []byte) (Meta, error) {
+	h, _, err := splitValue(enc)
+	if err != nil {
+		return Meta{}, err
+	}
+	var m Meta
+	if h.meta != nil {
+		if m, err = decodeMeta(h.meta); err != nil {
+			return Meta{}, err
+		}
+	}
+	m.Size = int64(ValueSize(enc))
+	return m, nil
+}
+
+// CheckMeta checks that metadata fits in MaxMetaSize once encoded
+func CheckMeta(m Meta) error {
+	if size := len(encodeMeta(m)); size > MaxMetaSize {
+		return &QuotaError{Resource: ResourceMetaSize, Limit: MaxMetaSize, Want: int64(size)}
+	}
+	return nil
+}
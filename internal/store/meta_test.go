@@ -0,0 +1,122 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithMeta(t *testing.T) {
+	meta := Meta{
+		CreateIndex: 3,
+		ModifyIndex: 9,
+		Version:     4,
+		Created:     1700000000000,
+		Modified:    1700000005000,
+		ContentType: "application/json",
+		Headers:     map[string]string{"Owner": "team-a", "Build": "42"},
+	}
+	for name, enc := range map[string][]byte{
+		"raw":        EncodeValue([]byte("hello"), 0),
+		"compressed": EncodeValue([]byte(strings.Repeat("hello ", 100)), 1),
+	} {
+		expiring, _ := WithExpiry(enc, 1800000000000)
+		withMeta, err := WithMeta(expiring, meta)
+		if err != nil {
+			t.Fatalf("%s: WithMeta() failed: %v", name, err)
+		}
+		if err := ValidateValue(withMeta); err != nil {
+			t.Errorf("%s: ValidateValue() failed: %v", name, err)
+		}
+		if ValueExpiry(withMeta) != 1800000000000 {
+			t.Errorf("%s: Expected metadata to keep the expiry, got %d", name, ValueExpiry(withMeta))
+		}
+		orig, _ := DecodeValue(enc)
+		if val, err := DecodeValue(withMeta); err != nil || string(val) != string(orig) {
+			t.Errorf("%s: Expected value to survive, got %q, %v", name, val, err)
+		}
+
+		got, err := ValueMeta(withMeta)
+		if err != nil {
+			t.Fatalf("%s: ValueMeta() failed: %v", name, err)
+		}
+		if got.CreateIndex != 3 || got.ModifyIndex != 9 || got.Version != 4 || got.Created != meta.Created ||
+			got.Modified != meta.Modified || got.ContentType != meta.ContentType || got.Headers["Owner"] != "team-a" ||
+			got.Headers["Build"] != "42" || got.Size != int64(len(orig)) {
+			t.Errorf("%s: Metadata did not round-trip: %+v", name, got)
+		}
+
+		// Changing the expiry keeps the metadata
+		noExpiry, _ := WithExpiry(withMeta, 0)
+		if got, _ := ValueMeta(noExpiry); got.ModifyIndex != 9 {
+			t.Errorf("%s: Expected WithExpiry to keep metadata, got %+v", name, got)
+		}
+	}
+
+	// Header order doesn't change the encoding
+	a := encodeMeta(Meta{Headers: map[string]string{"A": "1", "B": "2", "C": "3"}})
+	for i := 0; i < 10; i++ {
+		if b := encodeMeta(Meta{Headers: map[string]string{"C": "3", "B": "2", "A": "1"}}); string(a) != string(b) {
+			t.Fatal("Expected metadata encoding to be deterministic")
+		}
+	}
+
+	// Values without metadata only report their size
+	if got, err := ValueMeta(EncodeValue([]byte("abc"), 0)); err != nil || got.Size != 3 || got.ModifyIndex != 0 {
+		t.Errorf("Expected only the size, got %+v, %v", got, err)
+	}
+
+	_, err := WithMeta(EncodeValue(nil, 0), Meta{Headers: map[string]string{"Big": strings.Repeat("x", MaxMetaSize)}})
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.Resource != ResourceMetaSize || !quotaErr.TooLarge() {
+		t.Errorf("Expected a meta_size quota error, got %v", err)
+	}
+}
+
+func TestValueMeta_Corrupt(t *testing.T) {
+	enc, _ := WithMeta(EncodeValue([]byte("v"), 0), Meta{ModifyIndex: 1, Headers: map[string]string{"A": "b"}})
+	metaLen := int(enc[1])
+	meta, body := enc[2:2+metaLen], enc[2+metaLen:]
+
+	// Metadata cut short at any point is rejected, never read past its end
+	for i := 0; i < metaLen; i++ {
+		bad := append(append([]byte{enc[0], byte(i)}, meta[:i]...), body...)
+		if _, err := ValueMeta(bad); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("Expected ErrInvalidValue for metadata cut at %d, got %v", i, err)
+		}
+		if err := ValidateValue(bad); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("Expected ValidateValue to reject metadata cut at %d, got %v", i, err)
+		}
+	}
+	if _, err := ValueMeta([]byte{enc[0], 50}); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected ErrInvalidValue for a length past the end, got %v", err)
+	}
+}
+
+func TestStore_Meta(t *testing.T) {
+	s := NewStore()
+	enc, _ := WithMeta(EncodeValue([]byte("value"), 0), Meta{CreateIndex: 1, ModifyIndex: 1, Version: 1, ContentType: "text/plain"})
+	s.PutEncodedIn(1, DefaultNamespace, "key", enc)
+
+	meta, ok := s.MetaIn(DefaultNamespace, "key")
+	if !ok || meta.ContentType != "text/plain" || meta.Size != 5 {
+		t.Errorf("Unexpected metadata %+v", meta)
+	}
+	val, meta, ok := s.GetWithMetaIn(DefaultNamespace, "key")
+	if !ok || string(val) != "value" || meta.Version != 1 {
+		t.Errorf("Unexpected value %q and metadata %+v", val, meta)
+	}
+	if s.Bytes() != int64(len("key")+len("value")) {
+		t.Errorf("Expected metadata not to count towards the store size, got %d bytes", s.Bytes())
+	}
+
+	expired, _ := WithExpiry(enc, time.Now().Add(-time.Second).UnixMilli())
+	s.PutEncodedIn(2, DefaultNamespace, "gone", expired)
+	if _, ok := s.MetaIn(DefaultNamespace, "gone"); ok {
+		t.Error("Expected no metadata for an expired key")
+	}
+	if _, ok := s.MetaIn(DefaultNamespace, "missing"); ok {
+		t.Error("Expected no metadata for a missing key")
+	}
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"distributed_cloud_service/internal/cluster"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// SystemNamespace holds the namespace registry. Tenant names can't start with "_",
+// so it never clashes with a tenant keyspace.
+const SystemNamespace = "_namespaces"
+
+var (
+	ErrNamespaceNotFound = errors.New("namespace not found")
+	ErrNamespaceExists   = errors.New("namespace already exists")
+)
+
+var namespaceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Namespace describes a tenant keyspace together with its credentials and quotas
+type Namespace struct {
+	Name        string               `json:"name"`
+	TokenHashes []string             `json:"token_hashes,omitempty"` // SHA-256 (hex) of the tenant's bearer tokens
+	Limits      cluster.LimitsConfig `json:"limits"`                 // Applied on top of the cluster-wide limits
+}
+
+// ValidateNamespaceName checks that name can be used for a tenant namespace
+func ValidateNamespaceName(name string) error {
+	if !namespaceNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid namespace name %q: use 1-63 lowercase letters, digits, '-' or '_', starting with a letter or digit", name)
+	}
+	return nil
+}
+
+// Namespace returns the registered namespace called name
+func (s *Store) Namespace(name string) (Namespace, bool) {
+	data, ok := s.GetIn(SystemNamespace, name)
+	if !ok {
+		return Namespace{}, false
+	}
+	var ns Namespace
+	if err := json.Unmarshal(data, &ns); err != nil {
+		return Namespace{}, false
+	}
+	return ns, true
+}
+
+// Namespaces returns every registered namespace, sorted by name
+func (s *Store) Namespaces() []Namespace {
+	var list []Namespace
+	s.engine.Scan(SystemNamespace, func(_ string, enc []byte) error {
+		val, err := DecodeValue(enc)
+		if err != nil {
+			return nil
+		}
+		var ns Namespace
+		if err := json.Unmarshal(val, &ns); err == nil {
+			list = append(list, ns)
+		}
+		return nil
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// CreateNamespace registers ns as part of the Raft entry at index
+func (s *Store) CreateNamespace(index uint64, ns Namespace) error {
+	if err := ValidateNamespaceName(ns.Name); err != nil {
+		return err
+	}
+	if _, ok := s.Namespace(ns.Name); ok {
+		return ErrNamespaceExists
+	}
+	data, err := json.Marshal(ns)
+	if err != nil {
+		return err
+	}
+	return s.PutIn(index, SystemNamespace, ns.Name, data)
+}
+
+// DeleteNamespace removes a namespace and all of its keys as part of the Raft entry at index
+func (s *Store) DeleteNamespace(index uint64, name string) error {
+	if _, ok := s.Namespace(name); !ok {
+		return ErrNamespaceNotFound
+	}
+	// The registry entry goes last: if we stop in between, replaying the entry finishes the job
+	if err := s.engine.DropNamespace(0, name); err != nil {
+		return err
+	}
+	_, err := s.DeleteIn(index, SystemNamespace, name)
+	return err
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"distributed_cloud_service/internal/cluster"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore_NamespaceIsolation(t *testing.T) {
+	engine, err := OpenBoltEngine(filepath.Join(t.TempDir(), "fsm.db"))
+	if err != nil {
+		t.Fatalf("OpenBoltEngine() failed: %v", err)
+	}
+	defer engine.Close()
+
+	for name, store := range map[string]*Store{"memory": NewStore(), "bolt": NewStoreWithEngine(engine)} {
+		store.Put("key", []byte("default"))
+		store.PutIn(1, "team-a", "key", []byte("a"))
+		store.PutIn(2, "team-b", "key", []byte("bb"))
+
+		if val, _ := store.Get("key"); string(val) != "default" {
+			t.Errorf("%s: expected default value, got %q", name, val)
+		}
+		if val, _ := store.GetIn("team-a", "key"); string(val) != "a" {
+			t.Errorf("%s: expected team-a value, got %q", name, val)
+		}
+		if u := store.Usage("team-b"); u.Keys != 1 || u.Bytes != int64(len("key")+2) {
+			t.Errorf("%s: unexpected team-b usage %+v", name, u)
+		}
+		if store.Len() != 3 {
+			t.Errorf("%s: expected 3 keys in total, got %d", name, store.Len())
+		}
+
+		seen := map[string]string{}
+		snap, _ := store.Snapshot()
+		snap.ForEach(func(ns, key string, enc []byte) error {
+			val, _ := DecodeValue(enc)
+			seen[ns+"/"+key] = string(val)
+			return nil
+		})
+		snap.Release()
+		if len(seen) != 3 || seen["team-b/key"] != "bb" {
+			t.Errorf("%s: snapshot missed namespaced keys: %v", name, seen)
+		}
+
+		if err := store.engine.DropNamespace(3, "team-a"); err != nil {
+			t.Fatalf("%s: DropNamespace() failed: %v", name, err)
+		}
+		if _, ok := store.GetIn("team-a", "key"); ok {
+			t.Errorf("%s: key survived DropNamespace", name)
+		}
+		if store.Len() != 2 || store.Usage("team-a").Keys != 0 {
+			t.Errorf("%s: usage not updated after drop: len=%d", name, store.Len())
+		}
+	}
+}
+
+func TestStore_NamespaceRegistry(t *testing.T) {
+	store := NewStore()
+
+	if err := store.CreateNamespace(1, Namespace{Name: "team-a", TokenHashes: []string{"h"}}); err != nil {
+		t.Fatalf("CreateNamespace() failed: %v", err)
+	}
+	if err := store.CreateNamespace(2, Namespace{Name: "team-a"}); !errors.Is(err, ErrNamespaceExists) {
+		t.Errorf("Expected ErrNamespaceExists, got %v", err)
+	}
+	for _, name := range []string{"", "_hidden", "Upper", "has/slash"} {
+		if err := store.CreateNamespace(3, Namespace{Name: name}); err == nil {
+			t.Errorf("CreateNamespace(%q) should fail", name)
+		}
+	}
+	store.CreateNamespace(4, Namespace{Name: "team-b"})
+
+	list := store.Namespaces()
+	if len(list) != 2 || list[0].Name != "team-a" || list[0].TokenHashes[0] != "h" {
+		t.Errorf("Unexpected namespace list: %+v", list)
+	}
+
+	store.PutIn(5, "team-a", "key", []byte("value"))
+	if err := store.DeleteNamespace(6, "team-a"); err != nil {
+		t.Fatalf("DeleteNamespace() failed: %v", err)
+	}
+	if _, ok := store.Namespace("team-a"); ok {
+		t.Error("Namespace still registered after delete")
+	}
+	if store.Usage("team-a").Keys != 0 {
+		t.Error("Keys survived DeleteNamespace")
+	}
+	if err := store.DeleteNamespace(7, "team-a"); !errors.Is(err, ErrNamespaceNotFound) {
+		t.Errorf("Expected ErrNamespaceNotFound, got %v", err)
+	}
+	if store.AppliedIndex() != 6 {
+		t.Errorf("Expected applied index 6, got %d", store.AppliedIndex())
+	}
+}
+
+func TestStore_CheckPutIn(t *testing.T) {
+	store := NewStore()
+	store.PutIn(1, "team-a", "one", []byte("1"))
+	nsLimits := cluster.LimitsConfig{MaxKeys: 1}
+
+	err := store.CheckPutIn(cluster.LimitsConfig{}, nsLimits, "team-a", "two", 1)
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.Namespace != "team-a" || quotaErr.Resource != ResourceKeys {
+		t.Errorf("Expected team-a key quota error, got %v", err)
+	}
+	if err := store.CheckPutIn(cluster.LimitsConfig{}, nsLimits, "team-b", "two", 1); err != nil {
+		t.Errorf("Other namespaces have their own usage: %v", err)
+	}
+
+	// Cluster-wide limits count every namespace
+	err = store.CheckPutIn(cluster.LimitsConfig{MaxKeys: 1}, cluster.LimitsConfig{}, "team-b", "two", 1)
+	if !errors.As(err, &quotaErr) || quotaErr.Namespace != "" {
+		t.Errorf("Expected cluster-wide key quota error, got %v", err)
+	}
+}
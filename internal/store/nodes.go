@@ -0,0 +1,28 @@
+package store
+
+import "encoding/json"
+
+// NodesNamespace holds what each node advertises to the others, keyed by Raft address
+const NodesNamespace = "_nodes"
+
+// NodeInfo is what a node advertises to the cluster when it becomes leader
+type NodeInfo struct {
+	RaftAddr  string `json:"raft_addr"`
+	RedisAddr string `json:"redis_addr,omitempty"` // Where RESP clients reach the node
+}
+
+// NodeInfo returns what the node at raftAddr advertised
+func (s *Store) NodeInfo(raftAddr string) (NodeInfo, bool) {
+	var info NodeInfo
+	ok := s.getJSON(NodesNamespace, raftAddr, &info)
+	return info, ok
+}
+
+// PutNodeInfo records what a node advertises as part of the Raft entry at index
+func (s *Store) PutNodeInfo(index uint64, info NodeInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return s.PutIn(index, NodesNamespace, info.RaftAddr, data)
+}
@@ -0,0 +1,249 @@
+package store
+
+import (
+	"distributed_cloud_service/internal/acl"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// System namespaces holding the RBAC users and roles. UserTokensNamespace indexes users
+// by token hash so requests don't scan every user.
+const (
+	UsersNamespace      = "_users"
+	RolesNamespace      = "_roles"
+	UserTokensNamespace = "_user_tokens"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("user already exists")
+	ErrRoleNotFound = errors.New("role not found")
+	ErrRoleInUse    = errors.New("role is assigned to a user")
+	ErrTokenInUse   = errors.New("token belongs to another user")
+)
+
+var rbacNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.@-]{0,127}$`)
+
+// Role is a named set of permissions
+type Role struct {
+	Name        string           `json:"name"`
+	Permissions []acl.Permission `json:"permissions"`
+}
+
+// User is a caller known to RBAC, authenticated by one of its bearer tokens or by a
+// client certificate identity of the same name
+type User struct {
+	Name        string   `json:"name"`
+	TokenHashes []string `json:"token_hashes,omitempty"` // SHA-256 (hex) of the user's bearer tokens
+	Roles       []string `json:"roles"`
+}
+
+// systemNamespaces lists every namespace IsSystemNamespace matches
+var systemNamespaces = []string{SystemNamespace, UsersNamespace, RolesNamespace, UserTokensNamespace, NodesNamespace, ClusterNamespace}
+
+// IsSystemNamespace reports whether ns holds cluster state rather than tenant keys
+func IsSystemNamespace(ns string) bool {
+	return strings.HasPrefix(ns, "_")
+}
+
+// ValidateRBACName checks that name can be used for a user or role
+func ValidateRBACName(name string) error {
+	if !rbacNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid name %q: use 1-128 letters, digits, '.', '@', '-' or '_', starting with a letter or digit", name)
+	}
+	return nil
+}
+
+// Validate checks the name and permissions of r
+func (r Role) Validate() error {
+	if err := ValidateRBACName(r.Name); err != nil {
+		return err
+	}
+	for _, p := range r.Permissions {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getJSON decodes the value of key in namespace ns into v
+func (s *Store) getJSON(ns, key string, v interface{}) bool {
+	data, ok := s.GetIn(ns, key)
+	return ok && json.Unmarshal(data, v) == nil
+}
+
+// scanJSON calls fn with every value of namespace ns
+func (s *Store) scanJSON(ns string, fn func([]byte)) {
+	s.engine.Scan(ns, func(_ string, enc []byte) error {
+		if val, err := DecodeValue(enc); err == nil {
+			fn(val)
+		}
+		return nil
+	})
+}
+
+// Role returns the role called name
+func (s *Store) Role(name string) (Role, bool) {
+	var role Role
+	ok := s.getJSON(RolesNamespace, name, &role)
+	return role, ok
+}
+
+// Roles returns every role, sorted by name
+func (s *Store) Roles() []Role {
+	var list []Role
+	s.scanJSON(RolesNamespace, func(data []byte) {
+		var role Role
+		if json.Unmarshal(data, &role) == nil {
+			list = append(list, role)
+		}
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// PutRole creates or replaces a role as part of the Raft entry at index
+func (s *Store) PutRole(index uint64, role Role) error {
+	if err := role.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(role)
+	if err != nil {
+		return err
+	}
+	return s.PutIn(index, RolesNamespace, role.Name, data)
+}
+
+// DeleteRole removes a role no user is assigned, as part of the Raft entry at index
+func (s *Store) DeleteRole(index uint64, name string) error {
+	if _, ok := s.Role(name); !ok {
+		return ErrRoleNotFound
+	}
+	for _, user := range s.Users() {
+		for _, r := range user.Roles {
+			if r == name {
+				return fmt.Errorf("%w: %s", ErrRoleInUse, user.Name)
+			}
+		}
+	}
+	_, err := s.DeleteIn(index, RolesNamespace, name)
+	return err
+}
+
+// User returns the user called name
+func (s *Store) User(name string) (User, bool) {
+	var user User
+	ok := s.getJSON(UsersNamespace, name, &user)
+	return user, ok
+}
+
+// Users returns every user, sorted by name
+func (s *Store) Users() []User {
+	var list []User
+	s.scanJSON(UsersNamespace, func(data []byte) {
+		var user User
+		if json.Unmarshal(data, &user) == nil {
+			list = append(list, user)
+		}
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// UserByTokenHash returns the user holding the token whose SHA-256 (hex) is hash
+func (s *Store) UserByTokenHash(hash string) (User, bool) {
+	name, ok := s.GetIn(UserTokensNamespace, hash)
+	if !ok {
+		return User{}, false
+	}
+	return s.User(string(name))
+}
+
+// CreateUser registers a new user as part of the Raft entry at index
+func (s *Store) CreateUser(index uint64, user User) error {
+	if _, ok := s.User(user.Name); ok {
+		return ErrUserExists
+	}
+	return s.putUser(index, user)
+}
+
+// UpdateUser replaces the roles of an existing user as part of the Raft entry at index.
+// Its token hashes are replaced too, unless user has none.
+func (s *Store) UpdateUser(index uint64, user User) error {
+	prev, ok := s.User(user.Name)
+	if !ok {
+		return ErrUserNotFound
+	}
+	if user.TokenHashes == nil {
+		user.TokenHashes = prev.TokenHashes
+	}
+	return s.putUser(index, user)
+}
+
+func (s *Store) putUser(index uint64, user User) error {
+	if err := ValidateRBACName(user.Name); err != nil {
+		return err
+	}
+	for _, name := range user.Roles {
+		if _, ok := s.Role(name); !ok {
+			return fmt.Errorf("%w: %s", ErrRoleNotFound, name)
+		}
+	}
+	for _, hash := range user.TokenHashes {
+		if owner, ok := s.GetIn(UserTokensNamespace, hash); ok && string(owner) != user.Name {
+			return fmt.Errorf("%w: %s", ErrTokenInUse, owner)
+		}
+	}
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	batch := []Mutation{{Namespace: UsersNamespace, Key: user.Name, Value: EncodeValue(data, 0)}}
+	for _, hash := range user.TokenHashes {
+		batch = append(batch, Mutation{Namespace: UserTokensNamespace, Key: hash, Value: EncodeValue([]byte(user.Name), 0)})
+	}
+	if prev, ok := s.User(user.Name); ok {
+		batch = append(batch, unindexTokens(prev, user.TokenHashes)...)
+	}
+	_, err = s.engine.Write(index, batch)
+	return err
+}
+
+// unindexTokens returns the deletions of the token index entries of user that aren't in keep
+func unindexTokens(user User, keep []string) []Mutation {
+	var batch []Mutation
+	for _, hash := range user.TokenHashes {
+		if !slices.Contains(keep, hash) {
+			batch = append(batch, Mutation{Namespace: UserTokensNamespace, Key: hash, Delete: true})
+		}
+	}
+	return batch
+}
+
+// DeleteUser removes a user as part of the Raft entry at index
+func (s *Store) DeleteUser(index uint64, name string) error {
+	user, ok := s.User(name)
+	if !ok {
+		return ErrUserNotFound
+	}
+	batch := append(unindexTokens(user, nil), Mutation{Namespace: UsersNamespace, Key: name, Delete: true})
+	_, err := s.engine.Write(index, batch)
+	return err
+}
+
+// Permissions returns the permissions granted by the roles of user
+func (s *Store) Permissions(user User) []acl.Permission {
+	var perms []acl.Permission
+	for _, name := range user.Roles {
+		if role, ok := s.Role(name); ok {
+			perms = append(perms, role.Permissions...)
+		}
+	}
+	return perms
+}
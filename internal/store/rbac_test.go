@@ -0,0 +1,85 @@
+package store
+
+import (
+	"crypto/sha256"
+	"distributed_cloud_service/internal/acl"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestStore_RBAC(t *testing.T) {
+	store := NewStore()
+
+	reader := Role{Name: "reader", Permissions: []acl.Permission{{Prefix: "app/", Access: acl.AccessRead}}}
+	if err := store.PutRole(1, reader); err != nil {
+		t.Fatalf("PutRole() failed: %v", err)
+	}
+	if err := store.PutRole(2, Role{Name: "bad", Permissions: []acl.Permission{{Access: "everything"}}}); err == nil {
+		t.Error("Expected a role with an invalid permission to be rejected")
+	}
+	if err := store.CreateUser(3, User{Name: "alice", TokenHashes: []string{hashToken("t1")}, Roles: []string{"reader"}}); err != nil {
+		t.Fatalf("CreateUser() failed: %v", err)
+	}
+	if err := store.CreateUser(4, User{Name: "bob", Roles: []string{"writer"}}); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("Expected ErrRoleNotFound, got %v", err)
+	}
+	if err := store.CreateUser(5, User{Name: "-alice"}); err == nil {
+		t.Error("Expected an invalid user name to be rejected")
+	}
+	if err := store.CreateUser(5, User{Name: "bob", TokenHashes: []string{hashToken("t1")}}); !errors.Is(err, ErrTokenInUse) {
+		t.Errorf("Expected ErrTokenInUse, got %v", err)
+	}
+
+	user, ok := store.UserByTokenHash(hashToken("t1"))
+	if !ok || user.Name != "alice" {
+		t.Fatalf("Expected t1 to belong to alice, got %+v, %v", user, ok)
+	}
+	if _, ok := store.UserByTokenHash(hashToken("t2")); ok {
+		t.Error("Unexpected user for an unknown token")
+	}
+	perms := store.Permissions(user)
+	if !acl.Allows(perms, DefaultNamespace, "app/x", acl.AccessRead) || acl.Allows(perms, DefaultNamespace, "app/x", acl.AccessWrite) {
+		t.Errorf("Unexpected permissions %+v", perms)
+	}
+
+	// Replacing the role changes what its users may do
+	reader.Permissions = append(reader.Permissions, acl.Permission{Prefix: "app/", Access: acl.AccessWrite})
+	store.PutRole(6, reader)
+	if !acl.Allows(store.Permissions(user), DefaultNamespace, "app/x", acl.AccessWrite) {
+		t.Error("Expected the updated role to grant write access")
+	}
+
+	if err := store.UpdateUser(7, User{Name: "alice", TokenHashes: []string{hashToken("t2")}}); err != nil {
+		t.Fatalf("UpdateUser() failed: %v", err)
+	}
+	if _, ok := store.UserByTokenHash(hashToken("t1")); ok {
+		t.Error("Expected the old token to be replaced")
+	}
+	if err := store.UpdateUser(8, User{Name: "carol"}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	if err := store.UpdateUser(9, User{Name: "alice", Roles: []string{"reader"}}); err != nil {
+		t.Fatalf("UpdateUser() failed: %v", err)
+	}
+	if user, ok := store.UserByTokenHash(hashToken("t2")); !ok || len(user.Roles) != 1 {
+		t.Errorf("Expected t2 to be kept when only the roles change, got %+v, %v", user, ok)
+	}
+	if err := store.DeleteUser(10, "alice"); err != nil {
+		t.Errorf("DeleteUser() failed: %v", err)
+	}
+	if _, ok := store.UserByTokenHash(hashToken("t2")); ok {
+		t.Error("Expected the token of a deleted user to be removed from the index")
+	}
+	if err := store.DeleteRole(11, "reader"); err != nil {
+		t.Errorf("DeleteRole() failed: %v", err)
+	}
+	if len(store.Users()) != 0 || len(store.Roles()) != 0 {
+		t.Error("Expected no users or roles left")
+	}
+}
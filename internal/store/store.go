@@ -1,70 +1,317 @@
-package store
-
-import (
-	"sync"
-)
-
-// Store is a thread-safe in-memory key-value store
-type Store struct {
-	mu   sync.RWMutex
-	data map[string][]byte
-}
-
-// NewStore creates a new in-memory store
-func NewStore() *Store {
-	return &Store{
-		data: make(map[string][]byte),
-	}
-}
-
-// Put stores a key-value pair
-func (s *Store) Put(key string, val []byte) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.data[key] = val
-}
-
-// Get retrieves a value by key
-func (s *Store) Get(key string) ([]byte, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	v, ok := s.data[key]
-	return v, ok
-}
-
-// Delete removes a key-value pair
-func (s *Store) Delete(key string) bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	_, ok := s.data[key]
-	if ok {
-		delete(s.data, key)
-	}
-	return ok
-}
-
-// Dump returns a deep copy of the current store for snapshotting
-func (s *Store) Dump() map[string][]byte {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	copyMap := make(map[string][]byte, len(s.data))
-	for k, v := range s.data {
-		vv := make([]byte, len(v))
-		copy(vv, v)
-		copyMap[k] = vv
-	}
-	return copyMap
-}
-
-// Load replaces the store content with the provided state
-func (s *Store) Load(state map[string][]byte) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.data = make(map[string][]byte, len(state))
-	for k, v := range state {
-		vv := make([]byte, len(v))
-		copy(vv, v)
-		s.data[k] = vv
-	}
-}
-
+package store
+
+import (
+	"distributed_cloud_service/internal/cluster"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Store is a thread-safe key-value store backed by a pluggable Engine
+type Store struct {
+	engine Engine
+}
+
+// NewStore creates a new in-memory store
+func NewStore() *Store {
+	return NewStoreWithEngine(NewMemoryEngine())
+}
+
+// NewStoreWithEngine creates a store on top of the given engine
+func NewStoreWithEngine(engine Engine) *Store {
+	return &Store{
+		engine: engine,
+	}
+}
+
+// Open creates a store using the named engine ("memory" or "bolt").
+// Persistent engines keep their files in dataDir.
+func Open(engine string, dataDir string) (*Store, error) {
+	return OpenWithConfig(cluster.StorageConfig{Engine: engine}, dataDir)
+}
+
+// OpenWithConfig creates a store for the storage config, keeping persistent engines' files in dataDir
+func OpenWithConfig(cfg cluster.StorageConfig, dataDir string) (*Store, error) {
+	switch cfg.Engine {
+	case "", EngineMemory:
+		return NewStore(), nil
+	case EngineBolt:
+		e, err := OpenBoltEngineWithOptions(filepath.Join(dataDir, "fsm.db"), BoltOptions{MmapSize: cfg.BoltMmapSize})
+		if err != nil {
+			return nil, err
+		}
+		return NewStoreWithEngine(e), nil
+	default:
+		return nil, fmt.Errorf("unknown storage engine %q", cfg.Engine)
+	}
+}
+
+// Put stores a key-value pair
+func (s *Store) Put(key string, val []byte) error {
+	return s.PutAt(0, key, val)
+}
+
+// PutAt stores a key-value pair as part of the Raft entry at index
+func (s *Store) PutAt(index uint64, key string, val []byte) error {
+	return s.PutIn(index, DefaultNamespace, key, val)
+}
+
+// PutIn stores a key-value pair in namespace ns as part of the Raft entry at index
+func (s *Store) PutIn(index uint64, ns, key string, val []byte) error {
+	return s.PutEncodedIn(index, ns, key, EncodeValue(val, 0))
+}
+
+// PutEncodedIn stores a value already encoded with EncodeValue, as carried in the Raft log
+func (s *Store) PutEncodedIn(index uint64, ns, key string, enc []byte) error {
+	if err := ValidateValue(enc); err != nil {
+		return err
+	}
+	_, err := s.engine.Write(index, []Mutation{{Namespace: ns, Key: key, Value: enc}})
+	return err
+}
+
+// Get retrieves a value by key
+func (s *Store) Get(key string) ([]byte, bool) {
+	return s.GetIn(DefaultNamespace, key)
+}
+
+// GetIn retrieves a value by key from namespace ns.
+// Expired values and values that fail to decompress are reported as missing.
+// The value may share memory with the store and must not be modified.
+func (s *Store) GetIn(ns, key string) ([]byte, bool) {
+	enc, ok := s.engine.Get(ns, key)
+	if !ok || Expired(enc, time.Now()) {
+		return nil, false
+	}
+	val, err := DecodeValue(enc)
+	if err != nil {
+		return nil, false
+	}
+	return val, true
+}
+
+// GetEncodedIn returns a value as stored, with its flag byte and expiry, even if it has expired.
+// Like GetIn's, the value must not be modified.
+func (s *Store) GetEncodedIn(ns, key string) ([]byte, bool) {
+	return s.engine.Get(ns, key)
+}
+
+// ExpiryIn returns when a key in namespace ns expires, or the zero time if it never does.
+// It reports false for missing and expired keys.
+func (s *Store) ExpiryIn(ns, key string) (time.Time, bool) {
+	enc, ok := s.engine.Get(ns, key)
+	if !ok || Expired(enc, time.Now()) {
+		return time.Time{}, false
+	}
+	if expireAt := ValueExpiry(enc); expireAt != 0 {
+		return time.UnixMilli(expireAt), true
+	}
+	return time.Time{}, true
+}
+
+// MetaIn returns the metadata of a key in namespace ns without decoding its value.
+// It reports false for missing and expired keys.
+func (s *Store) MetaIn(ns, key string) (Meta, bool) {
+	enc, ok := s.engine.Get(ns, key)
+	if !ok || Expired(enc, time.Now()) {
+		return Meta{}, false
+	}
+	meta, err := ValueMeta(enc)
+	if err != nil {
+		return Meta{}, false
+	}
+	return meta, true
+}
+
+// GetWithMetaIn returns a value and its metadata, read together from namespace ns
+func (s *Store) GetWithMetaIn(ns, key string) ([]byte, Meta, bool) {
+	enc, ok := s.engine.Get(ns, key)
+	if !ok || Expired(enc, time.Now()) {
+		return nil, Meta{}, false
+	}
+	val, err := DecodeValue(enc)
+	if err != nil {
+		return nil, Meta{}, false
+	}
+	meta, err := ValueMeta(enc)
+	if err != nil {
+		return nil, Meta{}, false
+	}
+	return val, meta, true
+}
+
+// Lookup is one key read by GetManyIn
+type Lookup struct {
+	Key   string
+	Value []byte
+	Meta  Meta
+	Found bool
+}
+
+// GetManyIn reads keys from namespace ns in a single view of the store, so every value
+// reflects the same applied index, which is returned with one Lookup per key in order.
+// Expired values and values that fail to decode are reported as missing.
+func (s *Store) GetManyIn(ns string, keys []string) (uint64, []Lookup, error) {
+	view, err := s.engine.Snapshot()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer view.Release()
+
+	now := time.Now()
+	results := make([]Lookup, len(keys))
+	for i, key := range keys {
+		results[i].Key = key
+		enc, ok := view.Get(ns, key)
+		if !ok || Expired(enc, now) {
+			continue
+		}
+		val, err := DecodeValue(enc)
+		if err != nil {
+			continue
+		}
+		meta, err := ValueMeta(enc)
+		if err != nil {
+			continue
+		}
+		results[i] = Lookup{Key: key, Value: val, Meta: meta, Found: true}
+	}
+	return view.AppliedIndex(), results, nil
+}
+
+// ScanKeysIn calls fn for every key in namespace ns that has not expired, in key order
+func (s *Store) ScanKeysIn(ns string, fn func(key string) error) error {
+	now := time.Now()
+	return s.engine.Scan(ns, func(key string, enc []byte) error {
+		if Expired(enc, now) {
+			return nil
+		}
+		return fn(key)
+	})
+}
+
+// Delete removes a key-value pair
+func (s *Store) Delete(key string) bool {
+	ok, err := s.DeleteAt(0, key)
+	return ok && err == nil
+}
+
+// DeleteAt removes a key-value pair as part of the Raft entry at index
+func (s *Store) DeleteAt(index uint64, key string) (bool, error) {
+	return s.DeleteIn(index, DefaultNamespace, key)
+}
+
+// DeleteIn removes a key-value pair from namespace ns as part of the Raft entry at index
+func (s *Store) DeleteIn(index uint64, ns, key string) (bool, error) {
+	existed, err := s.engine.Write(index, []Mutation{{Namespace: ns, Key: key, Delete: true}})
+	if err != nil {
+		return false, err
+	}
+	return existed[0], nil
+}
+
+// WriteBatch applies several mutations atomically as part of the Raft entry at index.
+// Values must be encoded with EncodeValue.
+func (s *Store) WriteBatch(index uint64, batch []Mutation) error {
+	_, err := s.engine.Write(index, batch)
+	return err
+}
+
+// SetAppliedIndex records index as applied without changing any keys
+func (s *Store) SetAppliedIndex(index uint64) error {
+	_, err := s.engine.Write(index, nil)
+	return err
+}
+
+// AppliedIndex returns the Raft index of the last applied write
+func (s *Store) AppliedIndex() uint64 {
+	return s.engine.AppliedIndex()
+}
+
+// Len returns the number of tenant keys in the store, across all namespaces. Keys in
+// system namespaces are cluster state and count towards neither quotas nor metrics.
+func (s *Store) Len() int {
+	n := s.engine.Len()
+	for _, ns := range systemNamespaces {
+		n -= s.engine.Usage(ns).Keys
+	}
+	return n
+}
+
+// Usage returns the number of keys and bytes held by namespace ns
+func (s *Store) Usage(ns string) Usage {
+	return s.engine.Usage(ns)
+}
+
+// Hash returns a hash of every key and value in the store. It is kept up to date by
+// every write, and replicas that applied the same entries report the same hash.
+func (s *Store) Hash() uint64 {
+	return s.engine.Hash()
+}
+
+// Bytes returns the total size of all tenant keys and values in the store
+func (s *Store) Bytes() int64 {
+	n := s.engine.Bytes()
+	for _, ns := range systemNamespaces {
+		n -= s.engine.Usage(ns).Bytes
+	}
+	return n
+}
+
+// Persistent reports whether the store survives restarts without a snapshot
+func (s *Store) Persistent() bool {
+	return s.engine.Persistent()
+}
+
+// Snapshot returns a point-in-time view for snapshotting
+func (s *Store) Snapshot() (Snapshot, error) {
+	return s.engine.Snapshot()
+}
+
+// Reset removes every key, ahead of a restore
+func (s *Store) Reset() error {
+	return s.engine.Reset()
+}
+
+// Close releases the underlying engine
+func (s *Store) Close() error {
+	return s.engine.Close()
+}
+
+// Dump returns a deep copy of the default namespace
+func (s *Store) Dump() map[string][]byte {
+	snap, err := s.engine.Snapshot()
+	if err != nil {
+		return map[string][]byte{}
+	}
+	defer snap.Release()
+
+	copyMap := make(map[string][]byte, s.engine.Usage(DefaultNamespace).Keys)
+	snap.ForEach(func(ns, k string, v []byte) error {
+		if ns != DefaultNamespace {
+			return nil
+		}
+		val, err := DecodeValue(v)
+		if err != nil {
+			return nil
+		}
+		vv := make([]byte, len(val))
+		copy(vv, val)
+		copyMap[k] = vv
+		return nil
+	})
+	return copyMap
+}
+
+// Load replaces the store content with the provided state in the default namespace
+func (s *Store) Load(state map[string][]byte) error {
+	if err := s.engine.Reset(); err != nil {
+		return err
+	}
+	batch := make([]Mutation, 0, len(state))
+	for k, v := range state {
+		batch = append(batch, Mutation{Key: k, Value: EncodeValue(v, 0)})
+	}
+	_, err := s.engine.Write(0, batch)
+	return err
+}
@@ -0,0 +1,231 @@
+package store
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Stored values start with a flag byte saying how the rest is encoded. The low bits
+// select the encoding; valueExpires means an 8-byte big-endian expiry time (Unix
+// milliseconds) comes right after the flag byte, and valueMeta that the key's metadata
+// follows as a uvarint length and the encoded Meta.
+const (
+	valueRaw     byte = 0 // followed by the value as is
+	valueDeflate byte = 1 // followed by the uvarint original size and a raw DEFLATE stream
+
+	valueEncodingMask byte = 0x3f
+	valueMeta         byte = 0x40
+	valueExpires      byte = 0x80
+)
+
+// DefaultCompressionThreshold is the value size in bytes from which compression is tried
+const DefaultCompressionThreshold = 1024
+
+// ErrInvalidValue is returned for encoded values with an unknown flag or a corrupt payload
+var ErrInvalidValue = errors.New("invalid encoded value")
+
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	},
+}
+
+// EncodeValue adds the flag byte to val, compressing it when it is at least threshold
+// bytes long and compression makes it smaller. A threshold <= 0 disables compression.
+func EncodeValue(val []byte, threshold int) []byte {
+	if threshold > 0 && len(val) >= threshold {
+		if enc, ok := deflateValue(val); ok {
+			return enc
+		}
+	}
+	enc := make([]byte, 1+len(val))
+	enc[0] = valueRaw
+	copy(enc[1:], val)
+	return enc
+}
+
+// deflateValue compresses val, reporting false if that doesn't save anything
+func deflateValue(val []byte) ([]byte, bool) {
+	var buf bytes.Buffer
+	buf.WriteByte(valueDeflate)
+	var size [binary.MaxVarintLen64]byte
+	buf.Write(size[:binary.PutUvarint(size[:], uint64(len(val)))])
+
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(val); err != nil {
+		return nil, false
+	}
+	if err := w.Close(); err != nil {
+		return nil, false
+	}
+	if buf.Len() >= 1+len(val) {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// valueHeader is what comes before the value itself in an encoded value
+type valueHeader struct {
+	kind     byte
+	expireAt int64  // Unix milliseconds, 0 if the value doesn't expire
+	meta     []byte // encoded Meta, nil if there is none
+}
+
+// splitValue parses the flag byte, expiry and metadata of an encoded value, returning
+// them and the bytes that follow
+func splitValue(enc []byte) (valueHeader, []byte, error) {
+	if len(enc) == 0 {
+		return valueHeader{}, nil, ErrInvalidValue
+	}
+	h, body := valueHeader{kind: enc[0] & valueEncodingMask}, enc[1:]
+	if enc[0]&valueExpires != 0 {
+		if len(body) < 8 {
+			return valueHeader{}, nil, fmt.Errorf("%w: truncated expiry", ErrInvalidValue)
+		}
+		h.expireAt, body = int64(binary.BigEndian.Uint64(body)), body[8:]
+	}
+	if enc[0]&valueMeta != 0 {
+		size, n := binary.Uvarint(body)
+		if n <= 0 || size > uint64(len(body)-n) {
+			return valueHeader{}, nil, fmt.Errorf("%w: truncated metadata", ErrInvalidValue)
+		}
+		h.meta, body = body[n:n+int(size)], body[n+int(size):]
+	}
+	return h, body, nil
+}
+
+// join encodes the header in front of body
+func (h valueHeader) join(body []byte) []byte {
+	out := make([]byte, 1, 1+8+binary.MaxVarintLen64+len(h.meta)+len(body))
+	out[0] = h.kind
+	if h.expireAt != 0 {
+		out[0] |= valueExpires
+		out = binary.BigEndian.AppendUint64(out, uint64(h.expireAt))
+	}
+	if h.meta != nil {
+		out[0] |= valueMeta
+		out = binary.AppendUvarint(out, uint64(len(h.meta)))
+		out = append(out, h.meta...)
+	}
+	return append(out, body...)
+}
+
+// DecodeValue returns the original value of an encoded one. An uncompressed value
+// shares memory with enc.
+func DecodeValue(enc []byte) ([]byte, error) {
+	h, body, err := splitValue(enc)
+	if err != nil {
+		return nil, err
+	}
+	switch h.kind {
+	case valueRaw:
+		return body, nil
+	case valueDeflate:
+		size, payload, err := deflateHeader(body)
+		if err != nil {
+			return nil, err
+		}
+		val := make([]byte, size)
+		r := flate.NewReader(bytes.NewReader(payload))
+		if _, err := io.ReadFull(r, val); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidValue, err)
+		}
+		return val, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown flag %d", ErrInvalidValue, enc[0])
+	}
+}
+
+// ValidateValue checks the flag byte and header of an encoded value without decompressing it
+func ValidateValue(enc []byte) error {
+	h, body, err := splitValue(enc)
+	if err != nil {
+		return err
+	}
+	if h.meta != nil {
+		if _, err := decodeMeta(h.meta); err != nil {
+			return err
+		}
+	}
+	switch h.kind {
+	case valueRaw:
+		return nil
+	case valueDeflate:
+		_, _, err := deflateHeader(body)
+		return err
+	default:
+		return fmt.Errorf("%w: unknown flag %d", ErrInvalidValue, enc[0])
+	}
+}
+
+// maxDeflateRatio is the best compression DEFLATE can reach, used to reject
+// headers claiming a size the payload can't possibly hold
+const maxDeflateRatio = 1032
+
+// deflateHeader parses the original size in front of a compressed value's DEFLATE stream
+func deflateHeader(body []byte) (uint64, []byte, error) {
+	size, n := binary.Uvarint(body)
+	if n <= 0 {
+		return 0, nil, ErrInvalidValue
+	}
+	payload := body[n:]
+	if size > uint64(len(payload))*maxDeflateRatio {
+		return 0, nil, fmt.Errorf("%w: size %d does not fit in %d compressed bytes", ErrInvalidValue, size, len(payload))
+	}
+	return size, payload, nil
+}
+
+// ValueSize returns the original size of an encoded value, which is what quotas count
+func ValueSize(enc []byte) int {
+	h, body, err := splitValue(enc)
+	if err != nil {
+		return 0
+	}
+	if h.kind == valueDeflate {
+		if size, n := binary.Uvarint(body); n > 0 {
+			return int(size)
+		}
+	}
+	return len(body)
+}
+
+// IsCompressed reports whether an encoded value was compressed
+func IsCompressed(enc []byte) bool {
+	h, _, err := splitValue(enc)
+	return err == nil && h.kind == valueDeflate
+}
+
+// WithExpiry returns a copy of an encoded value that expires at expireAt (Unix milliseconds).
+// An expireAt of 0 removes the expiry.
+func WithExpiry(enc []byte, expireAt int64) ([]byte, error) {
+	h, body, err := splitValue(enc)
+	if err != nil {
+		return nil, err
+	}
+	h.expireAt = expireAt
+	return h.join(body), nil
+}
+
+// ValueExpiry returns when an encoded value expires in Unix milliseconds, or 0 if it doesn't
+func ValueExpiry(enc []byte) int64 {
+	h, _, err := splitValue(enc)
+	if err != nil {
+		return 0
+	}
+	return h.expireAt
+}
+
+// Expired reports whether an encoded value has an expiry at or before now
+func Expired(enc []byte, now time.Time) bool {
+	expireAt := ValueExpiry(enc)
+	return expireAt != 0 && expireAt <= now.UnixMilli()
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEncodeValue(t *testing.T) {
+	blob := bytes.Repeat([]byte(`{"name":"example","tags":["a","b"]},`), 100)
+	random := make([]byte, 4096)
+	rand.Read(random)
+
+	tests := []struct {
+		name       string
+		val        []byte
+		threshold  int
+		compressed bool
+	}{
+		{"empty", []byte{}, 16, false},
+		{"below threshold", []byte("short"), 16, false},
+		{"compressible", blob, 16, true},
+		{"compression disabled", blob, 0, false},
+		{"incompressible", random, 16, false},
+	}
+	for _, tt := range tests {
+		enc := EncodeValue(tt.val, tt.threshold)
+		if IsCompressed(enc) != tt.compressed {
+			t.Errorf("%s: expected compressed=%v, got %v", tt.name, tt.compressed, IsCompressed(enc))
+		}
+		if tt.compressed && len(enc) >= len(tt.val) {
+			t.Errorf("%s: expected compression to save space, got %d -> %d bytes", tt.name, len(tt.val), len(enc))
+		}
+		if ValueSize(enc) != len(tt.val) {
+			t.Errorf("%s: expected size %d, got %d", tt.name, len(tt.val), ValueSize(enc))
+		}
+		val, err := DecodeValue(enc)
+		if err != nil || !bytes.Equal(val, tt.val) {
+			t.Errorf("%s: value did not round-trip: %v", tt.name, err)
+		}
+	}
+}
+
+func TestDecodeValue_Invalid(t *testing.T) {
+	truncated := EncodeValue(bytes.Repeat([]byte("0123456789abcdef"), 64), 1)
+	cases := map[string][]byte{
+		"empty":        {},
+		"unknown flag": {7, 'x'},
+		"bad header":   {valueDeflate, 0xff},
+		"bomb":         {valueDeflate, 0xff, 0xff, 0xff, 0xff, 0x0f, 0x00},
+		"truncated":    truncated[:len(truncated)/2],
+	}
+	for name, enc := range cases {
+		if _, err := DecodeValue(enc); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("%s: expected ErrInvalidValue, got %v", name, err)
+		}
+	}
+	if err := ValidateValue(cases["bomb"]); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected oversized header to fail validation, got %v", err)
+	}
+}
+
+func TestStore_CompressedValues(t *testing.T) {
+	store := NewStore()
+	blob := bytes.Repeat([]byte("compress me "), 200)
+	if err := store.PutEncodedIn(1, DefaultNamespace, "blob", EncodeValue(blob, 64)); err != nil {
+		t.Fatalf("PutEncodedIn() failed: %v", err)
+	}
+	if val, ok := store.Get("blob"); !ok || !bytes.Equal(val, blob) {
+		t.Errorf("Expected Get to decompress the value")
+	}
+	// Quotas and usage count the original size
+	if store.Bytes() != int64(len("blob")+len(blob)) {
+		t.Errorf("Expected %d bytes, got %d", len("blob")+len(blob), store.Bytes())
+	}
+	if err := store.PutEncodedIn(2, DefaultNamespace, "bad", []byte{9}); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected ErrInvalidValue, got %v", err)
+	}
+}
+
+func TestWithExpiry(t *testing.T) {
+	blob := bytes.Repeat([]byte("expire me "), 200)
+	for _, enc := range [][]byte{EncodeValue([]byte("short"), 0), EncodeValue(blob, 64)} {
+		expiring, err := WithExpiry(enc, 1700000000000)
+		if err != nil {
+			t.Fatalf("WithExpiry() failed: %v", err)
+		}
+		if ValueExpiry(expiring) != 1700000000000 || ValueExpiry(enc) != 0 {
+			t.Errorf("Unexpected expiry %d", ValueExpiry(expiring))
+		}
+		if IsCompressed(expiring) != IsCompressed(enc) || ValueSize(expiring) != ValueSize(enc) {
+			t.Error("Expiry should not change the encoding or size")
+		}
+		want, _ := DecodeValue(enc)
+		if val, err := DecodeValue(expiring); err != nil || !bytes.Equal(val, want) {
+			t.Errorf("Value did not round-trip through an expiry: %v", err)
+		}
+		if !Expired(expiring, time.UnixMilli(1700000000000)) || Expired(expiring, time.UnixMilli(1699999999999)) {
+			t.Error("Expired() disagrees with the expiry time")
+		}
+		if cleared, _ := WithExpiry(expiring, 0); !bytes.Equal(cleared, enc) {
+			t.Error("WithExpiry(0) should remove the expiry")
+		}
+	}
+	if _, err := DecodeValue([]byte{valueExpires, 1, 2}); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("Expected truncated expiry to fail, got %v", err)
+	}
+}
+
+func TestStore_ExpiredKeys(t *testing.T) {
+	store := NewStore()
+	past, _ := WithExpiry(EncodeValue([]byte("old"), 0), time.Now().Add(-time.Second).UnixMilli())
+	future := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	live, _ := WithExpiry(EncodeValue([]byte("new"), 0), future.UnixMilli())
+	store.PutEncodedIn(1, DefaultNamespace, "expired", past)
+	store.PutEncodedIn(2, DefaultNamespace, "live", live)
+	store.Put("plain", []byte("x"))
+
+	if _, ok := store.Get("expired"); ok {
+		t.Error("Expired key should read as missing")
+	}
+	if _, ok := store.GetEncodedIn(DefaultNamespace, "expired"); !ok {
+		t.Error("GetEncodedIn should still return the expired value")
+	}
+	if at, ok := store.ExpiryIn(DefaultNamespace, "live"); !ok || !at.Equal(future) {
+		t.Errorf("Expected expiry %v, got %v (%v)", future, at, ok)
+	}
+	if at, ok := store.ExpiryIn(DefaultNamespace, "plain"); !ok || !at.IsZero() {
+		t.Errorf("Expected no expiry, got %v", at)
+	}
+	var keys []string
+	store.ScanKeysIn(DefaultNamespace, func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if len(keys) != 2 || keys[0] != "live" || keys[1] != "plain" {
+		t.Errorf("Expected live keys in order, got %v", keys)
+	}
+}
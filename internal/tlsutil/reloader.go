@@ -0,0 +1,148 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"distributed_cloud_service/internal/cluster"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval is the minimum time between checks of the certificate files
+const DefaultReloadInterval = 5 * time.Second
+
+// Reloader serves the HTTPS certificate and client CA pool, reloading them when
+// the files change on disk so certificates can be rotated without a restart.
+type Reloader struct {
+	cfg      cluster.HTTPTLSConfig
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+	lastCheck time.Time
+}
+
+// NewReloader loads the configured certificate (and client CA) and returns a reloader for them
+func NewReloader(cfg cluster.HTTPTLSConfig) (*Reloader, error) {
+	r := &Reloader{
+		cfg:      cfg,
+		interval: DefaultReloadInterval,
+		logger:   slog.Default().With("component", "tls"),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetInterval changes how often the files are checked for changes
+func (r *Reloader) SetInterval(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interval = d
+}
+
+// TLSConfig returns a server config that always uses the latest certificate and client CAs
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.maybeReload()
+
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+			}
+			switch r.cfg.ClientAuthMode() {
+			case cluster.ClientAuthRequest:
+				config.ClientAuth = tls.VerifyClientCertIfGiven
+				config.ClientCAs = r.clientCAs
+			case cluster.ClientAuthRequire:
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+				config.ClientCAs = r.clientCAs
+			}
+			return config, nil
+		},
+	}
+}
+
+// Certificate returns the certificate currently being served
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.maybeReload()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// maybeReload reloads the files if they changed since the last load.
+// Failed reloads keep serving the previous certificate.
+func (r *Reloader) maybeReload() {
+	r.mu.Lock()
+	if time.Since(r.lastCheck) < r.interval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastCheck = time.Now()
+	changed := false
+	for path, modTime := range r.modTimes {
+		info, err := os.Stat(path)
+		if err == nil && !info.ModTime().Equal(modTime) {
+			changed = true
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	if changed {
+		if err := r.load(); err != nil {
+			r.logger.Warn("TLS reload failed, keeping previous certificate", "error", err)
+		}
+	}
+}
+
+// load reads the certificate, key and client CA files
+func (r *Reloader) load() error {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile}
+	if r.cfg.ClientCAFile != "" {
+		files = append(files, r.cfg.ClientCAFile)
+	}
+
+	// Record modification times first so a write racing with the load is picked up next time
+	modTimes := make(map[string]time.Time, len(files))
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		modTimes[path] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		pool, err = LoadCAPool(r.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = pool
+	r.modTimes = modTimes
+	r.lastCheck = time.Now()
+	return nil
+}
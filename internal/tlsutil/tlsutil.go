@@ -0,0 +1,84 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"distributed_cloud_service/internal/cluster"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// LoadCAPool reads a PEM bundle into a certificate pool
+func LoadCAPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", path)
+	}
+	return pool, nil
+}
+
+// MutualConfigs builds the server and client sides of a mutually authenticated
+// TLS setup: both ends present the node certificate and both verify the peer
+// against the configured CA.
+func MutualConfigs(cfg cluster.TLSConfig) (server *tls.Config, client *tls.Config, err error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	pool, err := LoadCAPool(cfg.CAFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	server = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	client = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+	}
+
+	if cfg.Verify() == cluster.TLSVerifyCA {
+		// Skip the hostname check but still require a chain to our CA
+		client.InsecureSkipVerify = true
+		client.VerifyPeerCertificate = VerifyChain(pool, x509.ExtKeyUsageServerAuth)
+	}
+	return server, client, nil
+}
+
+// VerifyChain returns a VerifyPeerCertificate callback that checks the presented
+// chain against pool without checking names
+func VerifyChain(pool *x509.CertPool, usage x509.ExtKeyUsage) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("peer presented no certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("failed to parse peer certificate: %w", err)
+			}
+			certs[i] = cert
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         pool,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{usage},
+		})
+		return err
+	}
+}
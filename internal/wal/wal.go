@@ -0,0 +1,587 @@
+// Package wal implements an append-only, segmented write-ahead log that can be
+// used as a raft.LogStore in place of raft-boltdb.
+//
+// Each segment file is named after the index of its first entry and holds
+// CRC-framed records:
+//
+//	magic (8 bytes) | record | record | ...
+//	record: length (4 bytes) | crc32c of payload (4 bytes) | payload
+//
+// Appends only ever write to the tail segment. Truncating the head removes
+// whole segment files and truncating the tail cuts the file at a record
+// boundary, so neither rewrites existing data.
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// DefaultSegmentSize is the size at which the tail segment is sealed and a new one started
+const DefaultSegmentSize = 64 << 20
+
+const (
+	segmentSuffix = ".seg"
+	frameHeader   = 8  // length + crc
+	payloadHeader = 29 // index, term, type, appended_at, data length
+)
+
+var (
+	segmentMagic = []byte("KVWAL001")
+	crcTable     = crc32.MakeTable(crc32.Castagnoli)
+
+	// ErrCorrupt is returned when a record fails its checksum outside the tail of the log
+	ErrCorrupt = errors.New("wal: corrupt record")
+)
+
+// Options configures a Log
+type Options struct {
+	// SegmentSize is the approximate maximum size of a segment file in bytes
+	SegmentSize int64
+	// NoSync skips fsync after appends (only for tests and benchmarks)
+	NoSync bool
+}
+
+// segment is one file of the log holding a contiguous run of entries
+type segment struct {
+	path    string
+	file    *os.File
+	first   uint64  // index of the first entry in the file
+	offsets []int64 // file offset of each entry's frame
+	size    int64
+}
+
+func (s *segment) last() uint64 {
+	return s.first + uint64(len(s.offsets)) - 1
+}
+
+// Log is a segmented write-ahead log implementing raft.LogStore
+type Log struct {
+	dir  string
+	opts Options
+
+	mu       sync.RWMutex
+	segments []*segment // ordered by first index; the last one is open for appends
+	first    uint64     // logical first index (entries before it were truncated)
+	buf      []byte
+}
+
+var _ raft.LogStore = (*Log)(nil)
+
+// Open opens or creates a log in dir, recovering from a torn write at the tail
+func Open(dir string, opts Options) (*Log, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("wal: failed to create directory: %w", err)
+	}
+
+	l := &Log{dir: dir, opts: opts}
+	if err := l.load(); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// load opens every segment in the directory and rebuilds the offset index
+func (l *Log) load() error {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return fmt.Errorf("wal: failed to read directory: %w", err)
+	}
+
+	var firsts []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		firsts = append(firsts, first)
+	}
+	sort.Slice(firsts, func(i, j int) bool { return firsts[i] < firsts[j] })
+
+	for i, first := range firsts {
+		isTail := i == len(firsts)-1
+		seg, err := l.openSegment(first, isTail)
+		if err != nil {
+			return err
+		}
+		if len(seg.offsets) == 0 && !isTail {
+			return fmt.Errorf("%w: empty sealed segment %s", ErrCorrupt, seg.path)
+		}
+		if n := len(l.segments); n > 0 && l.segments[n-1].last()+1 != seg.first {
+			return fmt.Errorf("%w: gap before segment %s", ErrCorrupt, seg.path)
+		}
+		l.segments = append(l.segments, seg)
+	}
+
+	// An empty tail left behind by a crash right after rotation carries no entries
+	if n := len(l.segments); n > 0 && len(l.segments[n-1].offsets) == 0 {
+		seg := l.segments[n-1]
+		seg.file.Close()
+		os.Remove(seg.path)
+		l.segments = l.segments[:n-1]
+	}
+	if len(l.segments) > 0 {
+		l.first = l.segments[0].first
+	}
+	return nil
+}
+
+// openSegment scans a segment file; a torn or corrupt record at the end of the
+// tail segment is truncated away, anywhere else it is an error
+func (l *Log) openSegment(first uint64, isTail bool) (*segment, error) {
+	path := l.segmentPath(first)
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("wal: failed to open segment: %w", err)
+	}
+	seg := &segment{path: path, file: file, first: first}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	magic := make([]byte, len(segmentMagic))
+	if _, err := file.ReadAt(magic, 0); err != nil || string(magic) != string(segmentMagic) {
+		file.Close()
+		return nil, fmt.Errorf("%w: bad header in %s", ErrCorrupt, path)
+	}
+
+	offset := int64(len(segmentMagic))
+	for offset < info.Size() {
+		entry, n, err := readFrame(file, offset, info.Size())
+		if err == nil && entry.Index != first+uint64(len(seg.offsets)) {
+			err = fmt.Errorf("%w: unexpected index %d in %s", ErrCorrupt, entry.Index, path)
+		}
+		if err != nil {
+			if !isTail {
+				file.Close()
+				return nil, fmt.Errorf("%w: %s at offset %d: %v", ErrCorrupt, path, offset, err)
+			}
+			// Crash during an append: drop the partial record
+			if err := file.Truncate(offset); err != nil {
+				file.Close()
+				return nil, fmt.Errorf("wal: failed to truncate torn write: %w", err)
+			}
+			break
+		}
+		seg.offsets = append(seg.offsets, offset)
+		offset += n
+	}
+	seg.size = offset
+	return seg, nil
+}
+
+// createSegment starts a new, empty segment whose first entry will be first
+func (l *Log) createSegment(first uint64) (*segment, error) {
+	path := l.segmentPath(first)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("wal: failed to create segment: %w", err)
+	}
+	if _, err := file.Write(segmentMagic); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := l.syncDir(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &segment{path: path, file: file, first: first, size: int64(len(segmentMagic))}, nil
+}
+
+func (l *Log) segmentPath(first uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%020d%s", first, segmentSuffix))
+}
+
+// FirstIndex returns the first index in the log, or 0 if it is empty
+func (l *Log) FirstIndex() (uint64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if len(l.segments) == 0 {
+		return 0, nil
+	}
+	return l.first, nil
+}
+
+// LastIndex returns the last index in the log, or 0 if it is empty
+func (l *Log) LastIndex() (uint64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.lastIndex(), nil
+}
+
+func (l *Log) lastIndex() uint64 {
+	if len(l.segments) == 0 {
+		return 0
+	}
+	return l.segments[len(l.segments)-1].last()
+}
+
+// GetLog reads the entry at index
+func (l *Log) GetLog(index uint64, log *raft.Log) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if len(l.segments) == 0 || index < l.first || index > l.lastIndex() {
+		return raft.ErrLogNotFound
+	}
+	seg := l.findSegment(index)
+	entry, _, err := readFrame(seg.file, seg.offsets[index-seg.first], seg.size)
+	if err != nil {
+		return fmt.Errorf("%w: index %d: %v", ErrCorrupt, index, err)
+	}
+	*log = *entry
+	return nil
+}
+
+// findSegment returns the segment containing index, which must be in range
+func (l *Log) findSegment(index uint64) *segment {
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].last() >= index
+	})
+	return l.segments[i]
+}
+
+// StoreLog appends a single entry
+func (l *Log) StoreLog(log *raft.Log) error {
+	return l.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs appends entries, which must continue directly from the last index. A batch
+// is all or nothing: every frame is written and synced before any of it is published,
+// so a failed append leaves the log as it was and Raft can retry it.
+func (l *Log) StoreLogs(logs []*raft.Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.segments) > 0 && logs[0].Index != l.lastIndex()+1 {
+		return fmt.Errorf("wal: non-contiguous append: got index %d, last index is %d", logs[0].Index, l.lastIndex())
+	}
+	for i := 1; i < len(logs); i++ {
+		if logs[i].Index != logs[i-1].Index+1 {
+			return fmt.Errorf("wal: non-contiguous batch at index %d", logs[i].Index)
+		}
+	}
+
+	// Segments created by this batch are only added to the log once it is written
+	var created []*segment
+	var tail *segment
+	if len(l.segments) > 0 {
+		tail = l.segments[len(l.segments)-1]
+	} else {
+		seg, err := l.createSegment(logs[0].Index)
+		if err != nil {
+			return err
+		}
+		created = append(created, seg)
+		tail = seg
+	}
+
+	l.buf = l.buf[:0]
+	parts := []appendPart{{seg: tail}}
+	for _, log := range logs {
+		part := &parts[len(parts)-1]
+		written := int64(len(l.buf) - part.start)
+
+		// Seal the tail once it is full and continue in a fresh segment
+		if part.seg.size+written >= l.opts.SegmentSize && len(part.seg.offsets)+len(part.offsets) > 0 {
+			next, err := l.createSegment(log.Index)
+			if err != nil {
+				l.discard(created)
+				return err
+			}
+			created = append(created, next)
+			parts = append(parts, appendPart{seg: next, start: len(l.buf)})
+			part, written = &parts[len(parts)-1], 0
+		}
+
+		part.offsets = append(part.offsets, part.seg.size+written)
+		l.buf = appendFrame(l.buf, log)
+	}
+
+	for i := range parts {
+		end := len(l.buf)
+		if i+1 < len(parts) {
+			end = parts[i+1].start
+		}
+		parts[i].data = l.buf[parts[i].start:end]
+		if err := l.write(parts[i].seg, parts[i].data); err != nil {
+			if len(created) == 0 || created[0] != tail {
+				// Cut off what was written, so a restart doesn't bring it back
+				tail.file.Truncate(tail.size)
+			}
+			l.discard(created)
+			return err
+		}
+	}
+
+	for _, part := range parts {
+		part.seg.offsets = append(part.seg.offsets, part.offsets...)
+		part.seg.size += int64(len(part.data))
+	}
+	if len(l.segments) == 0 {
+		l.first = created[0].first
+	}
+	l.segments = append(l.segments, created...)
+	return nil
+}
+
+// appendPart is the run of frames a batch appends to one segment
+type appendPart struct {
+	seg     *segment
+	start   int     // position of the first frame in Log.buf
+	data    []byte  // the frames, once the batch is encoded
+	offsets []int64 // file offset of each frame
+}
+
+// write appends data at the end of seg and syncs it
+func (l *Log) write(seg *segment, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if _, err := seg.file.WriteAt(data, seg.size); err != nil {
+		return fmt.Errorf("wal: append failed: %w", err)
+	}
+	if !l.opts.NoSync {
+		if err := seg.file.Sync(); err != nil {
+			return fmt.Errorf("wal: sync failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// discard removes segments created for a batch that failed
+func (l *Log) discard(created []*segment) {
+	for _, seg := range created {
+		seg.file.Close()
+		os.Remove(seg.path)
+	}
+	if len(created) > 0 {
+		l.syncDir()
+	}
+}
+
+// DeleteRange removes entries min through max inclusive. Raft only ever
+// removes a prefix (after a snapshot) or a suffix (conflicting entries).
+func (l *Log) DeleteRange(min, max uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.segments) == 0 || min > max {
+		return nil
+	}
+	last := l.lastIndex()
+	if max < l.first || min > last {
+		return nil
+	}
+
+	switch {
+	case min <= l.first && max >= last:
+		return l.truncateAll()
+	case min <= l.first:
+		return l.truncateHead(max)
+	case max >= last:
+		return l.truncateTail(min)
+	default:
+		return fmt.Errorf("wal: cannot delete range [%d, %d] from the middle of the log [%d, %d]", min, max, l.first, last)
+	}
+}
+
+// truncateAll removes every segment
+func (l *Log) truncateAll() error {
+	for _, seg := range l.segments {
+		seg.file.Close()
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("wal: failed to remove segment: %w", err)
+		}
+	}
+	l.segments = nil
+	l.first = 0
+	return l.syncDir()
+}
+
+// truncateHead drops entries up to and including max. Segments that become
+// empty are deleted; a partially covered segment is kept and its remaining
+// prefix is hidden (it may reappear after a restart, which Raft tolerates).
+func (l *Log) truncateHead(max uint64) error {
+	removed := 0
+	for _, seg := range l.segments[:len(l.segments)-1] {
+		if seg.last() > max {
+			break
+		}
+		seg.file.Close()
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("wal: failed to remove segment: %w", err)
+		}
+		removed++
+	}
+	l.segments = l.segments[removed:]
+	l.first = max + 1
+	if removed > 0 {
+		return l.syncDir()
+	}
+	return nil
+}
+
+// truncateTail drops entries from min onwards by deleting later segments and
+// cutting the segment that contains min at that record
+func (l *Log) truncateTail(min uint64) error {
+	keep := len(l.segments)
+	for keep > 0 && l.segments[keep-1].first >= min {
+		seg := l.segments[keep-1]
+		seg.file.Close()
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("wal: failed to remove segment: %w", err)
+		}
+		keep--
+	}
+	l.segments = l.segments[:keep]
+	if keep == 0 {
+		l.first = 0
+		return l.syncDir()
+	}
+
+	tail := l.segments[keep-1]
+	if min <= tail.last() {
+		cut := tail.offsets[min-tail.first]
+		if err := tail.file.Truncate(cut); err != nil {
+			return fmt.Errorf("wal: failed to truncate segment: %w", err)
+		}
+		if !l.opts.NoSync {
+			if err := tail.file.Sync(); err != nil {
+				return err
+			}
+		}
+		tail.offsets = tail.offsets[:min-tail.first]
+		tail.size = cut
+	}
+	return l.syncDir()
+}
+
+// Close closes all segment files
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var firstErr error
+	for _, seg := range l.segments {
+		if err := seg.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	l.segments = nil
+	return firstErr
+}
+
+// syncDir makes segment creation and removal durable
+func (l *Log) syncDir() error {
+	if l.opts.NoSync {
+		return nil
+	}
+	dir, err := os.Open(l.dir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	// Some platforms (e.g. Windows) can't sync directories; that is not fatal
+	_ = dir.Sync()
+	return nil
+}
+
+// appendFrame encodes log as a CRC-framed record onto buf
+func appendFrame(buf []byte, log *raft.Log) []byte {
+	payloadLen := payloadHeader + len(log.Data) + 4 + len(log.Extensions)
+	start := len(buf)
+	buf = append(buf, make([]byte, frameHeader+payloadLen)...)
+	frame := buf[start:]
+
+	p := frame[frameHeader:]
+	binary.BigEndian.PutUint64(p[0:], log.Index)
+	binary.BigEndian.PutUint64(p[8:], log.Term)
+	p[16] = byte(log.Type)
+	var appendedAt int64
+	if !log.AppendedAt.IsZero() {
+		appendedAt = log.AppendedAt.UnixNano()
+	}
+	binary.BigEndian.PutUint64(p[17:], uint64(appendedAt))
+	binary.BigEndian.PutUint32(p[25:], uint32(len(log.Data)))
+	n := payloadHeader + copy(p[payloadHeader:], log.Data)
+	binary.BigEndian.PutUint32(p[n:], uint32(len(log.Extensions)))
+	copy(p[n+4:], log.Extensions)
+
+	binary.BigEndian.PutUint32(frame[0:], uint32(payloadLen))
+	binary.BigEndian.PutUint32(frame[4:], crc32.Checksum(p, crcTable))
+	return buf
+}
+
+// readFrame decodes the record at offset of a file of size bytes, returning it and the frame size
+func readFrame(r io.ReaderAt, offset, size int64) (*raft.Log, int64, error) {
+	var header [frameHeader]byte
+	if _, err := r.ReadAt(header[:], offset); err != nil {
+		return nil, 0, fmt.Errorf("short frame header: %w", err)
+	}
+	length := binary.BigEndian.Uint32(header[0:])
+	sum := binary.BigEndian.Uint32(header[4:])
+	if length < payloadHeader+4 {
+		return nil, 0, fmt.Errorf("invalid record length %d", length)
+	}
+	// Check against the file before allocating, so a corrupt header can't ask for 4 GiB
+	if int64(length) > size-offset-frameHeader {
+		return nil, 0, fmt.Errorf("record length %d exceeds the file", length)
+	}
+
+	p := make([]byte, length)
+	if _, err := r.ReadAt(p, offset+frameHeader); err != nil {
+		return nil, 0, fmt.Errorf("short record: %w", err)
+	}
+	if crc32.Checksum(p, crcTable) != sum {
+		return nil, 0, errors.New("checksum mismatch")
+	}
+
+	log := &raft.Log{
+		Index: binary.BigEndian.Uint64(p[0:]),
+		Term:  binary.BigEndian.Uint64(p[8:]),
+		Type:  raft.LogType(p[16]),
+	}
+	if appendedAt := int64(binary.BigEndian.Uint64(p[17:])); appendedAt != 0 {
+		log.AppendedAt = time.Unix(0, appendedAt)
+	}
+	dataLen := int(binary.BigEndian.Uint32(p[25:]))
+	if payloadHeader+dataLen+4 > len(p) {
+		return nil, 0, errors.New("data length exceeds record")
+	}
+	log.Data = p[payloadHeader : payloadHeader+dataLen]
+	ext := p[payloadHeader+dataLen:]
+	extLen := int(binary.BigEndian.Uint32(ext))
+	if 4+extLen != len(ext) {
+		return nil, 0, errors.New("extensions length mismatch")
+	}
+	if extLen > 0 {
+		log.Extensions = ext[4:]
+	}
+	return log, frameHeader + int64(length), nil
+}
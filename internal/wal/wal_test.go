@@ -0,0 +1,314 @@
+package wal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+)
+
+func makeLogs(first, count uint64, size int) []*raft.Log {
+	logs := make([]*raft.Log, count)
+	for i := range logs {
+		index := first + uint64(i)
+		logs[i] = &raft.Log{
+			Index:      index,
+			Term:       1,
+			Type:       raft.LogCommand,
+			Data:       bytes.Repeat([]byte{byte(index)}, size),
+			AppendedAt: time.Unix(0, int64(index)),
+		}
+	}
+	return logs
+}
+
+func openTestLog(t *testing.T, dir string, segmentSize int64) *Log {
+	t.Helper()
+	l, err := Open(dir, Options{SegmentSize: segmentSize})
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	return l
+}
+
+func checkRange(t *testing.T, l *Log, first, last uint64) {
+	t.Helper()
+	gotFirst, _ := l.FirstIndex()
+	gotLast, _ := l.LastIndex()
+	if gotFirst != first || gotLast != last {
+		t.Fatalf("Expected range [%d, %d], got [%d, %d]", first, last, gotFirst, gotLast)
+	}
+}
+
+func TestLog_StoreAndGet(t *testing.T) {
+	dir := t.TempDir()
+	l := openTestLog(t, dir, 1024)
+
+	if err := l.StoreLogs(makeLogs(1, 100, 100)); err != nil {
+		t.Fatalf("StoreLogs() failed: %v", err)
+	}
+	checkRange(t, l, 1, 100)
+
+	var log raft.Log
+	if err := l.GetLog(42, &log); err != nil {
+		t.Fatalf("GetLog() failed: %v", err)
+	}
+	if log.Index != 42 || log.Term != 1 || len(log.Data) != 100 || log.Data[0] != 42 {
+		t.Errorf("Unexpected entry: %+v", log)
+	}
+	if log.AppendedAt.UnixNano() != 42 {
+		t.Errorf("AppendedAt not preserved: %v", log.AppendedAt)
+	}
+	if err := l.GetLog(101, &log); err != raft.ErrLogNotFound {
+		t.Errorf("Expected ErrLogNotFound past the tail, got %v", err)
+	}
+
+	// Small segments force rotation
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if len(segments) < 2 {
+		t.Errorf("Expected several segments, got %d", len(segments))
+	}
+
+	if err := l.StoreLog(makeLogs(102, 1, 10)[0]); err == nil {
+		t.Error("StoreLog() should reject a gap in indexes")
+	}
+	l.Close()
+
+	// Everything is recovered on reopen
+	l = openTestLog(t, dir, 1024)
+	defer l.Close()
+	checkRange(t, l, 1, 100)
+	if err := l.GetLog(99, &log); err != nil || log.Data[0] != 99 {
+		t.Errorf("GetLog() after reopen = %+v, %v", log, err)
+	}
+}
+
+func TestLog_DeleteRange(t *testing.T) {
+	dir := t.TempDir()
+	l := openTestLog(t, dir, 1024)
+	defer l.Close()
+
+	l.StoreLogs(makeLogs(1, 100, 100))
+
+	// Head truncation (after a snapshot) drops whole segments
+	before, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if err := l.DeleteRange(1, 50); err != nil {
+		t.Fatalf("DeleteRange(head) failed: %v", err)
+	}
+	checkRange(t, l, 51, 100)
+	after, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if len(after) >= len(before) {
+		t.Errorf("Expected head truncation to remove segments (%d -> %d)", len(before), len(after))
+	}
+	var log raft.Log
+	if err := l.GetLog(50, &log); err != raft.ErrLogNotFound {
+		t.Errorf("Expected truncated entry to be gone, got %v", err)
+	}
+
+	// Tail truncation (conflicting entries) cuts back to a record boundary
+	if err := l.DeleteRange(80, 100); err != nil {
+		t.Fatalf("DeleteRange(tail) failed: %v", err)
+	}
+	checkRange(t, l, 51, 79)
+
+	// Appends continue from the new tail
+	if err := l.StoreLogs(makeLogs(80, 5, 10)); err != nil {
+		t.Fatalf("StoreLogs() after tail truncation failed: %v", err)
+	}
+	if err := l.GetLog(82, &log); err != nil || len(log.Data) != 10 {
+		t.Errorf("GetLog() after re-append = %+v, %v", log, err)
+	}
+
+	if err := l.DeleteRange(60, 70); err == nil {
+		t.Error("DeleteRange() from the middle should fail")
+	}
+
+	// Removing everything (snapshot install) allows a fresh start at any index
+	if err := l.DeleteRange(51, 84); err != nil {
+		t.Fatalf("DeleteRange(all) failed: %v", err)
+	}
+	checkRange(t, l, 0, 0)
+	if err := l.StoreLogs(makeLogs(500, 3, 10)); err != nil {
+		t.Fatalf("StoreLogs() after full truncation failed: %v", err)
+	}
+	checkRange(t, l, 500, 502)
+}
+
+func TestLog_StoreLogsAtomic(t *testing.T) {
+	dir := t.TempDir()
+	l := openTestLog(t, dir, 1)
+	if err := l.StoreLogs(makeLogs(1, 1, 10)); err != nil {
+		t.Fatalf("StoreLogs() failed: %v", err)
+	}
+
+	// A directory where the third segment goes makes the batch fail after its first part
+	blocker := l.segmentPath(3)
+	if err := os.Mkdir(blocker, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.StoreLogs(makeLogs(2, 2, 10)); err == nil {
+		t.Fatal("Expected StoreLogs() to fail")
+	}
+	checkRange(t, l, 1, 1)
+	if _, err := os.Stat(l.segmentPath(2)); !os.IsNotExist(err) {
+		t.Errorf("Expected the segment created for the failed batch to be removed, got %v", err)
+	}
+
+	// The retry Raft makes succeeds and survives a restart
+	os.Remove(blocker)
+	if err := l.StoreLogs(makeLogs(2, 2, 10)); err != nil {
+		t.Fatalf("StoreLogs() retry failed: %v", err)
+	}
+	l.Close()
+	l = openTestLog(t, dir, 1)
+	defer l.Close()
+	checkRange(t, l, 1, 3)
+}
+
+func TestLog_RecoversTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	l := openTestLog(t, dir, DefaultSegmentSize)
+	l.StoreLogs(makeLogs(1, 10, 50))
+	l.Close()
+
+	// Simulate a crash halfway through appending the last record
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	path := segments[len(segments)-1]
+	info, _ := os.Stat(path)
+	if err := os.Truncate(path, info.Size()-20); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+
+	l = openTestLog(t, dir, DefaultSegmentSize)
+	defer l.Close()
+	checkRange(t, l, 1, 9)
+	if err := l.StoreLogs(makeLogs(10, 1, 50)); err != nil {
+		t.Fatalf("StoreLogs() after recovery failed: %v", err)
+	}
+}
+
+func TestLog_RejectsOversizedFrame(t *testing.T) {
+	dir := t.TempDir()
+	l := openTestLog(t, dir, DefaultSegmentSize)
+	l.StoreLogs(makeLogs(1, 3, 50))
+	l.Close()
+
+	// A corrupt header at the tail claiming a 4 GiB record
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	f, _ := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write([]byte{0xff, 0xff, 0xff, 0xf0, 0, 0, 0, 0, 1, 2, 3})
+	f.Close()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	l = openTestLog(t, dir, DefaultSegmentSize)
+	defer l.Close()
+	runtime.ReadMemStats(&after)
+	checkRange(t, l, 1, 3)
+	if grown := after.TotalAlloc - before.TotalAlloc; grown > 1<<20 {
+		t.Errorf("Expected Open() to reject the header before allocating, allocated %d bytes", grown)
+	}
+}
+
+func TestLog_DetectsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	l := openTestLog(t, dir, 1024)
+	l.StoreLogs(makeLogs(1, 50, 100))
+	l.Close()
+
+	// Flip a byte inside the first (sealed) segment
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	data, _ := os.ReadFile(segments[0])
+	data[len(segmentMagic)+frameHeader+40] ^= 0xff
+	os.WriteFile(segments[0], data, 0644)
+
+	if _, err := Open(dir, Options{SegmentSize: 1024}); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt, got %v", err)
+	}
+}
+
+// logStore is the part of the raft stores exercised by the benchmarks
+type logStore interface {
+	raft.LogStore
+	Close() error
+}
+
+func benchStores(b *testing.B, fn func(b *testing.B, store logStore)) {
+	b.Run("wal", func(b *testing.B) {
+		l, err := Open(b.TempDir(), Options{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer l.Close()
+		fn(b, l)
+	})
+	b.Run("bolt", func(b *testing.B) {
+		s, err := raftboltdb.NewBoltStore(filepath.Join(b.TempDir(), "raft.db"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer s.Close()
+		fn(b, s)
+	})
+}
+
+func BenchmarkStoreLogs(b *testing.B) {
+	for _, batch := range []int{1, 64} {
+		b.Run(fmt.Sprintf("batch=%d", batch), func(b *testing.B) {
+			benchStores(b, func(b *testing.B, store logStore) {
+				b.SetBytes(int64(batch * 256))
+				for i := 0; i < b.N; i++ {
+					if err := store.StoreLogs(makeLogs(uint64(i*batch+1), uint64(batch), 256)); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkGetLog(b *testing.B) {
+	benchStores(b, func(b *testing.B, store logStore) {
+		const n = 10000
+		for i := uint64(0); i < n; i += 100 {
+			store.StoreLogs(makeLogs(i+1, 100, 256))
+		}
+		b.ResetTimer()
+		var log raft.Log
+		for i := 0; i < b.N; i++ {
+			if err := store.GetLog(uint64(i%n)+1, &log); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkTruncateHead(b *testing.B) {
+	benchStores(b, func(b *testing.B, store logStore) {
+		const chunk = 1000
+		next := uint64(1)
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			for j := uint64(0); j < chunk; j += 100 {
+				store.StoreLogs(makeLogs(next+j, 100, 256))
+			}
+			first, err := store.FirstIndex()
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.StartTimer()
+			// Compact everything but the most recent entries, as Raft does after a snapshot
+			if err := store.DeleteRange(first, next+chunk-10); err != nil {
+				b.Fatal(err)
+			}
+			next += chunk
+		}
+	})
+}
@@ -0,0 +1,193 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"distributed_cloud_service/client"
+	"distributed_cloud_service/internal/cluster"
+	kvhttp "distributed_cloud_service/internal/http"
+	"distributed_cloud_service/internal/raft"
+	"distributed_cloud_service/internal/store"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testNode is a Raft node with the HTTP API in front of it
+type testNode struct {
+	raft *raft.Node
+	http *http.Server
+	url  string
+	once sync.Once
+}
+
+func (n *testNode) stop() {
+	n.once.Do(func() {
+		n.http.Close()
+		n.raft.Shutdown()
+	})
+}
+
+// apiHandler routes the HTTP API the way a node does
+func apiHandler(s *kvhttp.Server) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/kv/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			s.HandlePut(w, r)
+		case http.MethodDelete:
+			s.HandleDelete(w, r)
+		case http.MethodPatch:
+			s.HandlePatch(w, r)
+		case http.MethodPost:
+			if r.URL.Path == "/kv/_mget" {
+				s.HandleMGet(w, r)
+			} else {
+				s.HandleCounter(w, r)
+			}
+		default:
+			s.HandleGet(w, r)
+		}
+	})
+	mux.HandleFunc("/ns/", s.HandleNamespace)
+	mux.HandleFunc("/admin/namespaces", s.HandleNamespaces)
+	mux.HandleFunc("/admin/namespaces/", s.HandleNamespaces)
+	mux.HandleFunc("/admin/rbac/", s.HandleRBAC)
+	mux.HandleFunc("/admin/backup", s.HandleBackup)
+	mux.HandleFunc("/admin/restore", s.HandleRestore)
+	mux.HandleFunc("/admin/export", s.HandleExport)
+	mux.HandleFunc("/admin/import", s.HandleImport)
+	mux.HandleFunc("/admin/hash", s.HandleHash)
+	mux.HandleFunc(kvhttp.APIPrefix+"/", s.HandleV1)
+	return mux
+}
+
+func startTestNode(t *testing.T, id, listenAddr, raftAddr string, bootstrap bool) *testNode {
+	t.Helper()
+	dataDir := filepath.Join("testdata", id)
+	os.MkdirAll(dataDir, 0755)
+	s := store.NewStore()
+	node, err := raft.NewNode(s, &cluster.Config{
+		NodeID:     id,
+		ListenAddr: listenAddr,
+		RaftAddr:   raftAddr,
+		Bootstrap:  bootstrap,
+	}, dataDir)
+	if err != nil {
+		t.Fatalf("Failed to create %s: %v", id, err)
+	}
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		node.Shutdown()
+		t.Fatalf("Failed to listen on %s: %v", listenAddr, err)
+	}
+	server := &http.Server{Handler: apiHandler(kvhttp.NewServer(s, node))}
+	go server.Serve(ln)
+	return &testNode{raft: node, http: server, url: "http://" + listenAddr}
+}
+
+// TestClientFailover runs the client against a three-node cluster and kills the leader
+func TestClientFailover(t *testing.T) {
+	defer os.RemoveAll("testdata")
+
+	node1 := startTestNode(t, "client-node1", "127.0.0.1:19041", "127.0.0.1:19051", true)
+	defer node1.stop()
+	node2 := startTestNode(t, "client-node2", "127.0.0.1:19042", "127.0.0.1:19052", false)
+	defer node2.stop()
+	node3 := startTestNode(t, "client-node3", "127.0.0.1:19043", "127.0.0.1:19053", false)
+	defer node3.stop()
+
+	time.Sleep(2 * time.Second)
+	if !node1.raft.IsLeader() {
+		t.Fatal("client-node1 did not become leader")
+	}
+	if err := node1.raft.Join("client-node2", "127.0.0.1:19052"); err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+	if err := node1.raft.Join("client-node3", "127.0.0.1:19053"); err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+
+	// The leader is listed last, so the client has to find it
+	c, err := client.New(client.Config{Endpoints: []string{node3.url, node2.url, node1.url}})
+	if err != nil {
+		t.Fatalf("client.New failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	if err := c.PutWithOptions(ctx, "greeting", []byte("hello"), client.PutOptions{ContentType: "text/plain", Headers: map[string]string{"Owner": "ops"}}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if c.Leader() != node1.url {
+		t.Errorf("Expected leader %s, got %q", node1.url, c.Leader())
+	}
+	val, meta, err := c.GetWithMeta(ctx, "greeting")
+	if err != nil || string(val) != "hello" {
+		t.Fatalf("Expected hello, got %q, %v", val, err)
+	}
+	if meta.ContentType != "text/plain" || meta.Headers["Owner"] != "ops" || meta.Version != 1 {
+		t.Errorf("Unexpected metadata %+v", meta)
+	}
+	if _, err := c.Get(ctx, "missing"); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if n, err := c.Incr(ctx, "hits", 5); err != nil || n != 5 {
+		t.Errorf("Expected Incr to return 5, got %d, %v", n, err)
+	}
+	if err := c.Put(ctx, "doc", []byte(`{"a":1}`)); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := c.MergePatch(ctx, "doc", []byte(`{"b":2}`)); err != nil {
+		t.Errorf("MergePatch failed: %v", err)
+	}
+	if err := c.JSONPatch(ctx, "doc", []byte(`[{"op":"test","path":"/a","value":2}]`)); !errors.Is(err, client.ErrConflict) {
+		t.Errorf("Expected ErrConflict from a failed test, got %v", err)
+	}
+	if part, err := c.GetPath(ctx, "doc", "$.b"); err != nil || string(part) != "2" {
+		t.Errorf("Expected $.b = 2, got %q, %v", part, err)
+	}
+	index, values, err := c.MGet(ctx, []string{"greeting", "missing"})
+	if err != nil || index == 0 || len(values) != 2 || !values[0].Found || values[1].Found {
+		t.Errorf("Unexpected MGet result at %d: %+v, %v", index, values, err)
+	}
+
+	// Namespaced keys go through the same leader cache
+	_, token, err := c.CreateNamespace(ctx, "team-a", nil, client.Limits{MaxKeys: 10})
+	if err != nil {
+		t.Fatalf("CreateNamespace failed: %v", err)
+	}
+	tenant := c.Namespace("team-a", token)
+	if err := tenant.Put(ctx, "greeting", []byte("tenant")); err != nil {
+		t.Fatalf("Namespaced Put failed: %v", err)
+	}
+	if info, err := c.GetNamespace(ctx, "team-a"); err != nil || info.Usage.Keys != 1 {
+		t.Errorf("Expected team-a to hold 1 key, got %+v, %v", info, err)
+	}
+
+	var backup bytes.Buffer
+	info, err := c.Backup(ctx, &backup)
+	if err != nil || info.Index == 0 || info.NodeID != "client-node1" {
+		t.Errorf("Unexpected backup %+v, %v", info, err)
+	}
+
+	// Kill the leader; the client fails over to whichever node wins the election
+	node1.stop()
+	if err := c.Put(ctx, "after-failover", []byte("ok")); err != nil {
+		t.Fatalf("Put after failover failed: %v", err)
+	}
+	if c.Leader() != node2.url && c.Leader() != node3.url {
+		t.Errorf("Expected node2 or node3 to lead, got %q", c.Leader())
+	}
+	if val, err := c.Get(ctx, "greeting"); err != nil || string(val) != "hello" {
+		t.Errorf("Expected hello after failover, got %q, %v", val, err)
+	}
+	if val, err := tenant.Get(ctx, "greeting"); err != nil || string(val) != "tenant" {
+		t.Errorf("Expected tenant after failover, got %q, %v", val, err)
+	}
+}
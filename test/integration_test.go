@@ -1,260 +1,757 @@
-package test
-
-import (
-	"context"
-	"distributed_cloud_service/internal/cluster"
-	"distributed_cloud_service/internal/raft"
-	"distributed_cloud_service/internal/store"
-	"os"
-	"path/filepath"
-	"testing"
-	"time"
-)
-
-// TestMultiNodeCluster tests basic multi-node cluster operations
-func TestMultiNodeCluster(t *testing.T) {
-	// This is a simplified integration test
-	// Full integration tests would require actual network setup
-	
-	// Create test data directories
-	dataDir1 := filepath.Join("testdata", "node1")
-	dataDir2 := filepath.Join("testdata", "node2")
-	os.MkdirAll(dataDir1, 0755)
-	os.MkdirAll(dataDir2, 0755)
-	defer os.RemoveAll("testdata")
-
-	// Create stores
-	store1 := store.NewStore()
-	store2 := store.NewStore()
-
-	// Create configs
-	config1 := &cluster.Config{
-		NodeID:     "node1",
-		ListenAddr: "127.0.0.1:19001",
-		RaftAddr:   "127.0.0.1:19011",
-		Bootstrap:  true,
-	}
-
-	config2 := &cluster.Config{
-		NodeID:     "node2",
-		ListenAddr: "127.0.0.1:19002",
-		RaftAddr:   "127.0.0.1:19012",
-		Bootstrap:  false,
-		JoinURL:    "http://127.0.0.1:19001",
-	}
-
-	// Initialize Raft nodes
-	raftNode1, err := raft.NewNode(store1, config1, dataDir1)
-	if err != nil {
-		t.Fatalf("Failed to create node1: %v", err)
-	}
-	defer raftNode1.Shutdown()
-
-	raftNode2, err := raft.NewNode(store2, config2, dataDir2)
-	if err != nil {
-		t.Fatalf("Failed to create node2: %v", err)
-	}
-	defer raftNode2.Shutdown()
-
-	// Wait for leader election
-	time.Sleep(2 * time.Second)
-
-	// Test that we have a leader
-	leader1 := raftNode1.IsLeader()
-	leader2 := raftNode2.IsLeader()
-	
-	if !leader1 && !leader2 {
-		t.Error("No leader elected")
-	}
-
-	// Test that only one is leader
-	if leader1 && leader2 {
-		t.Error("Multiple leaders elected")
-	}
-
-	// Test join operation (if node1 is leader)
-	if leader1 {
-		err := raftNode1.Join("node2", "127.0.0.1:19012")
-		if err != nil {
-			t.Logf("Join failed (expected if already joined): %v", err)
-		}
-	}
-
-	// Test apply operation
-	cmd := raft.KVCommand{
-		Op:    "put",
-		Key:   "test-key",
-		Value: []byte("test-value"),
-	}
-
-	if leader1 {
-		err = raftNode1.Apply(cmd)
-	} else {
-		err = raftNode2.Apply(cmd)
-	}
-
-	if err != nil {
-		t.Fatalf("Apply failed: %v", err)
-	}
-
-	// Wait for replication
-	time.Sleep(1 * time.Second)
-
-	// Verify value in both stores
-	val1, ok1 := store1.Get("test-key")
-	val2, ok2 := store2.Get("test-key")
-
-	if !ok1 || string(val1) != "test-value" {
-		t.Error("Value not found in store1")
-	}
-
-	if !ok2 || string(val2) != "test-value" {
-		t.Error("Value not replicated to store2")
-	}
-}
-
-// TestSnapshotRestore tests snapshot and restore functionality
-func TestSnapshotRestore(t *testing.T) {
-	dataDir := filepath.Join("testdata", "snapshot")
-	os.MkdirAll(dataDir, 0755)
-	defer os.RemoveAll("testdata")
-
-	store1 := store.NewStore()
-	config := &cluster.Config{
-		NodeID:     "snapshot-node",
-		ListenAddr: "127.0.0.1:19003",
-		RaftAddr:   "127.0.0.1:19013",
-		Bootstrap:  true,
-	}
-
-	raftNode, err := raft.NewNode(store1, config, dataDir)
-	if err != nil {
-		t.Fatalf("Failed to create node: %v", err)
-	}
-	defer raftNode.Shutdown()
-
-	// Wait for leader
-	time.Sleep(1 * time.Second)
-
-	// Add some data
-	cmd := raft.KVCommand{
-		Op:    "put",
-		Key:   "snapshot-key",
-		Value: []byte("snapshot-value"),
-	}
-
-	if raftNode.IsLeader() {
-		err = raftNode.Apply(cmd)
-		if err != nil {
-			t.Fatalf("Apply failed: %v", err)
-		}
-		
-		// Wait for apply to complete and be committed
-		time.Sleep(2 * time.Second)
-
-		// Verify data exists
-		val, ok := store1.Get("snapshot-key")
-		if !ok || string(val) != "snapshot-value" {
-			t.Error("Data not stored before snapshot")
-		}
-	} else {
-		t.Skip("Node is not leader, skipping snapshot test")
-	}
-
-	// Snapshot is handled automatically by Raft
-	// In a real test, we'd trigger a snapshot and verify restore
-}
-
-// TestReadVerification tests read verification
-func TestReadVerification(t *testing.T) {
-	dataDir := filepath.Join("testdata", "read")
-	os.MkdirAll(dataDir, 0755)
-	defer os.RemoveAll("testdata")
-
-	store1 := store.NewStore()
-	config := &cluster.Config{
-		NodeID:     "read-node",
-		ListenAddr: "127.0.0.1:19004",
-		RaftAddr:   "127.0.0.1:19014",
-		Bootstrap:  true,
-	}
-
-	raftNode, err := raft.NewNode(store1, config, dataDir)
-	if err != nil {
-		t.Fatalf("Failed to create node: %v", err)
-	}
-	defer raftNode.Shutdown()
-
-	// Wait for leader
-	time.Sleep(1 * time.Second)
-
-	// Test read verification
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	err = raftNode.VerifyRead(ctx)
-	if err != nil {
-		t.Errorf("VerifyRead failed: %v", err)
-	}
-}
-
-// TestJoinRemove tests join and remove operations
-func TestJoinRemove(t *testing.T) {
-	dataDir1 := filepath.Join("testdata", "join1")
-	dataDir2 := filepath.Join("testdata", "join2")
-	os.MkdirAll(dataDir1, 0755)
-	os.MkdirAll(dataDir2, 0755)
-	defer os.RemoveAll("testdata")
-
-	store1 := store.NewStore()
-	store2 := store.NewStore()
-
-	config1 := &cluster.Config{
-		NodeID:     "join-node1",
-		ListenAddr: "127.0.0.1:19005",
-		RaftAddr:   "127.0.0.1:19015",
-		Bootstrap:  true,
-	}
-
-	config2 := &cluster.Config{
-		NodeID:     "join-node2",
-		ListenAddr: "127.0.0.1:19006",
-		RaftAddr:   "127.0.0.1:19016",
-		Bootstrap:  false,
-	}
-
-	raftNode1, err := raft.NewNode(store1, config1, dataDir1)
-	if err != nil {
-		t.Fatalf("Failed to create node1: %v", err)
-	}
-	defer raftNode1.Shutdown()
-
-	raftNode2, err := raft.NewNode(store2, config2, dataDir2)
-	if err != nil {
-		t.Fatalf("Failed to create node2: %v", err)
-	}
-	defer raftNode2.Shutdown()
-
-	// Wait for leader
-	time.Sleep(2 * time.Second)
-
-	// Test join
-	if raftNode1.IsLeader() {
-		err = raftNode1.Join("join-node2", "127.0.0.1:19016")
-		if err != nil {
-			t.Logf("Join failed (may already be joined): %v", err)
-		}
-	}
-
-	// Wait for join to complete
-	time.Sleep(1 * time.Second)
-
-	// Test remove (if node1 is leader)
-	if raftNode1.IsLeader() {
-		err = raftNode1.Remove("join-node2")
-		if err != nil {
-			t.Logf("Remove failed (expected if not joined): %v", err)
-		}
-	}
-}
-
+package test
+
+import (
+	"bytes"
+	"context"
+	"distributed_cloud_service/internal/cluster"
+	"distributed_cloud_service/internal/raft"
+	"distributed_cloud_service/internal/store"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMultiNodeCluster tests basic multi-node cluster operations
+func TestMultiNodeCluster(t *testing.T) {
+	// This is a simplified integration test
+	// Full integration tests would require actual network setup
+	
+	// Create test data directories
+	dataDir1 := filepath.Join("testdata", "node1")
+	dataDir2 := filepath.Join("testdata", "node2")
+	os.MkdirAll(dataDir1, 0755)
+	os.MkdirAll(dataDir2, 0755)
+	defer os.RemoveAll("testdata")
+
+	// Create stores
+	store1 := store.NewStore()
+	store2 := store.NewStore()
+
+	// Create configs
+	config1 := &cluster.Config{
+		NodeID:     "node1",
+		ListenAddr: "127.0.0.1:19001",
+		RaftAddr:   "127.0.0.1:19011",
+		Bootstrap:  true,
+	}
+
+	config2 := &cluster.Config{
+		NodeID:     "node2",
+		ListenAddr: "127.0.0.1:19002",
+		RaftAddr:   "127.0.0.1:19012",
+		Bootstrap:  false,
+		JoinURL:    "http://127.0.0.1:19001",
+	}
+
+	// Initialize Raft nodes
+	raftNode1, err := raft.NewNode(store1, config1, dataDir1)
+	if err != nil {
+		t.Fatalf("Failed to create node1: %v", err)
+	}
+	defer raftNode1.Shutdown()
+
+	raftNode2, err := raft.NewNode(store2, config2, dataDir2)
+	if err != nil {
+		t.Fatalf("Failed to create node2: %v", err)
+	}
+	defer raftNode2.Shutdown()
+
+	// Wait for leader election
+	time.Sleep(2 * time.Second)
+
+	// Test that we have a leader
+	leader1 := raftNode1.IsLeader()
+	leader2 := raftNode2.IsLeader()
+	
+	if !leader1 && !leader2 {
+		t.Error("No leader elected")
+	}
+
+	// Test that only one is leader
+	if leader1 && leader2 {
+		t.Error("Multiple leaders elected")
+	}
+
+	// Test join operation (if node1 is leader)
+	if leader1 {
+		err := raftNode1.Join("node2", "127.0.0.1:19012")
+		if err != nil {
+			t.Logf("Join failed (expected if already joined): %v", err)
+		}
+	}
+
+	// Test apply operation
+	cmd := raft.KVCommand{
+		Op:    "put",
+		Key:   "test-key",
+		Value: []byte("test-value"),
+	}
+
+	if leader1 {
+		err = raftNode1.Apply(cmd)
+	} else {
+		err = raftNode2.Apply(cmd)
+	}
+
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	// Wait for replication
+	time.Sleep(1 * time.Second)
+
+	// Verify value in both stores
+	val1, ok1 := store1.Get("test-key")
+	val2, ok2 := store2.Get("test-key")
+
+	if !ok1 || string(val1) != "test-value" {
+		t.Error("Value not found in store1")
+	}
+
+	if !ok2 || string(val2) != "test-value" {
+		t.Error("Value not replicated to store2")
+	}
+}
+
+// TestSnapshotRestore tests snapshot and restore functionality
+func TestSnapshotRestore(t *testing.T) {
+	dataDir := filepath.Join("testdata", "snapshot")
+	os.MkdirAll(dataDir, 0755)
+	defer os.RemoveAll("testdata")
+
+	store1 := store.NewStore()
+	config := &cluster.Config{
+		NodeID:     "snapshot-node",
+		ListenAddr: "127.0.0.1:19003",
+		RaftAddr:   "127.0.0.1:19013",
+		Bootstrap:  true,
+	}
+
+	raftNode, err := raft.NewNode(store1, config, dataDir)
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+	defer raftNode.Shutdown()
+
+	// Wait for leader
+	time.Sleep(1 * time.Second)
+
+	// Add some data
+	cmd := raft.KVCommand{
+		Op:    "put",
+		Key:   "snapshot-key",
+		Value: []byte("snapshot-value"),
+	}
+
+	if raftNode.IsLeader() {
+		err = raftNode.Apply(cmd)
+		if err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		
+		// Wait for apply to complete and be committed
+		time.Sleep(2 * time.Second)
+
+		// Verify data exists
+		val, ok := store1.Get("snapshot-key")
+		if !ok || string(val) != "snapshot-value" {
+			t.Error("Data not stored before snapshot")
+		}
+	} else {
+		t.Skip("Node is not leader, skipping snapshot test")
+	}
+
+	// Snapshot is handled automatically by Raft
+	// In a real test, we'd trigger a snapshot and verify restore
+}
+
+// TestReadVerification tests read verification
+func TestReadVerification(t *testing.T) {
+	dataDir := filepath.Join("testdata", "read")
+	os.MkdirAll(dataDir, 0755)
+	defer os.RemoveAll("testdata")
+
+	store1 := store.NewStore()
+	config := &cluster.Config{
+		NodeID:     "read-node",
+		ListenAddr: "127.0.0.1:19004",
+		RaftAddr:   "127.0.0.1:19014",
+		Bootstrap:  true,
+	}
+
+	raftNode, err := raft.NewNode(store1, config, dataDir)
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+	defer raftNode.Shutdown()
+
+	// Wait for leader
+	time.Sleep(1 * time.Second)
+
+	// Test read verification
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = raftNode.VerifyRead(ctx)
+	if err != nil {
+		t.Errorf("VerifyRead failed: %v", err)
+	}
+}
+
+// TestJoinRemove tests join and remove operations
+func TestJoinRemove(t *testing.T) {
+	dataDir1 := filepath.Join("testdata", "join1")
+	dataDir2 := filepath.Join("testdata", "join2")
+	os.MkdirAll(dataDir1, 0755)
+	os.MkdirAll(dataDir2, 0755)
+	defer os.RemoveAll("testdata")
+
+	store1 := store.NewStore()
+	store2 := store.NewStore()
+
+	config1 := &cluster.Config{
+		NodeID:     "join-node1",
+		ListenAddr: "127.0.0.1:19005",
+		RaftAddr:   "127.0.0.1:19015",
+		Bootstrap:  true,
+	}
+
+	config2 := &cluster.Config{
+		NodeID:     "join-node2",
+		ListenAddr: "127.0.0.1:19006",
+		RaftAddr:   "127.0.0.1:19016",
+		Bootstrap:  false,
+	}
+
+	raftNode1, err := raft.NewNode(store1, config1, dataDir1)
+	if err != nil {
+		t.Fatalf("Failed to create node1: %v", err)
+	}
+	defer raftNode1.Shutdown()
+
+	raftNode2, err := raft.NewNode(store2, config2, dataDir2)
+	if err != nil {
+		t.Fatalf("Failed to create node2: %v", err)
+	}
+	defer raftNode2.Shutdown()
+
+	// Wait for leader
+	time.Sleep(2 * time.Second)
+
+	// Test join
+	if raftNode1.IsLeader() {
+		err = raftNode1.Join("join-node2", "127.0.0.1:19016")
+		if err != nil {
+			t.Logf("Join failed (may already be joined): %v", err)
+		}
+	}
+
+	// Wait for join to complete
+	time.Sleep(1 * time.Second)
+
+	// Test remove (if node1 is leader)
+	if raftNode1.IsLeader() {
+		err = raftNode1.Remove("join-node2")
+		if err != nil {
+			t.Logf("Remove failed (expected if not joined): %v", err)
+		}
+	}
+}
+
+// TestReloadConfig tests live updates of Raft tuning
+func TestReloadConfig(t *testing.T) {
+	dataDir := filepath.Join("testdata", "reload")
+	os.MkdirAll(dataDir, 0755)
+	defer os.RemoveAll("testdata")
+
+	store1 := store.NewStore()
+	config := &cluster.Config{
+		NodeID:     "reload-node",
+		ListenAddr: "127.0.0.1:19007",
+		RaftAddr:   "127.0.0.1:19017",
+		Bootstrap:  true,
+	}
+
+	raftNode, err := raft.NewNode(store1, config, dataDir)
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+	defer raftNode.Shutdown()
+
+	tuning := cluster.DefaultRaftConfig()
+	tuning.HeartbeatTimeout = 800 * time.Millisecond
+	tuning.ElectionTimeout = time.Second
+	tuning.SnapshotThreshold = 16
+
+	if err := raftNode.ReloadConfig(tuning); err != nil {
+		t.Fatalf("ReloadConfig failed: %v", err)
+	}
+
+	live := raftNode.GetRaft().ReloadableConfig()
+	if live.HeartbeatTimeout != 800*time.Millisecond || live.ElectionTimeout != time.Second {
+		t.Errorf("Timeouts not reloaded: %+v", live)
+	}
+	if live.SnapshotThreshold != 16 {
+		t.Errorf("Snapshot threshold not reloaded: %d", live.SnapshotThreshold)
+	}
+
+	// Heartbeat may not drop to the (non-reloadable) lease timeout
+	tuning.HeartbeatTimeout = 250 * time.Millisecond
+	tuning.ElectionTimeout = 250 * time.Millisecond
+	tuning.LeaderLeaseTimeout = 100 * time.Millisecond
+	if err := raftNode.ReloadConfig(tuning); err == nil {
+		t.Error("ReloadConfig should reject a heartbeat at or below the running lease timeout")
+	}
+}
+
+// TestRecoverCluster tests recovery of a node that lost quorum using peers.json
+func TestRecoverCluster(t *testing.T) {
+	dataDir := filepath.Join("testdata", "recover")
+	os.MkdirAll(dataDir, 0755)
+	defer os.RemoveAll("testdata")
+
+	config := &cluster.Config{
+		NodeID:     "recover-node",
+		ListenAddr: "127.0.0.1:19008",
+		RaftAddr:   "127.0.0.1:19018",
+		Bootstrap:  true,
+	}
+
+	raftNode, err := raft.NewNode(store.NewStore(), config, dataDir)
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+
+	// Wait for leader
+	time.Sleep(2 * time.Second)
+	if !raftNode.IsLeader() {
+		raftNode.Shutdown()
+		t.Fatal("Bootstrap node did not become leader")
+	}
+
+	cmd := raft.KVCommand{Op: "put", Key: "survivor-key", Value: []byte("survivor-value")}
+	if err := raftNode.Apply(cmd); err != nil {
+		raftNode.Shutdown()
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	// Add a voter that never comes up: the node loses quorum and steps down
+	if err := raftNode.Join("lost-node", "127.0.0.1:19098"); err == nil {
+		t.Log("Join of unreachable node unexpectedly succeeded")
+	}
+	time.Sleep(1 * time.Second)
+	if raftNode.IsLeader() {
+		t.Error("Node should have lost leadership without quorum")
+	}
+	raftNode.Shutdown()
+
+	// Recover with only the surviving node
+	peers := `[{"id": "recover-node", "address": "127.0.0.1:19018", "non_voter": false}]`
+	if err := os.WriteFile(filepath.Join(dataDir, raft.PeersFile), []byte(peers), 0644); err != nil {
+		t.Fatalf("Failed to write peers.json: %v", err)
+	}
+
+	config.Bootstrap = false
+	recovered := store.NewStore()
+	raftNode, err = raft.NewNode(recovered, config, dataDir)
+	if err != nil {
+		t.Fatalf("Failed to restart node with peers.json: %v", err)
+	}
+	defer raftNode.Shutdown()
+
+	// Wait for leader
+	time.Sleep(2 * time.Second)
+	if !raftNode.IsLeader() {
+		t.Fatal("Recovered node did not become leader")
+	}
+
+	val, ok := recovered.Get("survivor-key")
+	if !ok || string(val) != "survivor-value" {
+		t.Error("FSM state not preserved by recovery")
+	}
+
+	if _, err := os.Stat(filepath.Join(dataDir, raft.PeersFile)); !os.IsNotExist(err) {
+		t.Error("peers.json should be renamed after recovery")
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, raft.PeersFile+".applied")); err != nil {
+		t.Errorf("peers.json.applied missing: %v", err)
+	}
+
+	servers := raftNode.GetRaft().GetConfiguration().Configuration().Servers
+	if len(servers) != 1 || servers[0].ID != "recover-node" {
+		t.Errorf("Expected only recover-node in configuration, got %+v", servers)
+	}
+}
+
+// TestPersistentStoreRestart tests that a bolt-backed FSM keeps its state across restarts
+func TestPersistentStoreRestart(t *testing.T) {
+	dataDir := filepath.Join("testdata", "persistent")
+	os.MkdirAll(dataDir, 0755)
+	defer os.RemoveAll("testdata")
+
+	config := &cluster.Config{
+		NodeID:     "persistent-node",
+		ListenAddr: "127.0.0.1:19009",
+		RaftAddr:   "127.0.0.1:19019",
+		Bootstrap:  true,
+		Storage:    cluster.StorageConfig{Engine: store.EngineBolt},
+	}
+
+	store1, err := store.Open(config.Storage.Engine, dataDir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	raftNode, err := raft.NewNode(store1, config, dataDir)
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+
+	// Wait for leader
+	time.Sleep(2 * time.Second)
+	if !raftNode.IsLeader() {
+		raftNode.Shutdown()
+		t.Fatal("Node did not become leader")
+	}
+
+	for _, key := range []string{"disk-key1", "disk-key2"} {
+		if err := raftNode.Apply(raft.KVCommand{Op: "put", Key: key, Value: []byte(key)}); err != nil {
+			raftNode.Shutdown()
+			t.Fatalf("Apply failed: %v", err)
+		}
+	}
+	appliedBefore := store1.AppliedIndex()
+	raftNode.Shutdown()
+	store1.Close()
+
+	// The state is on disk before Raft replays anything
+	store2, err := store.Open(config.Storage.Engine, dataDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store2.Close()
+	if store2.Len() != 2 || store2.AppliedIndex() != appliedBefore {
+		t.Fatalf("Expected 2 keys at index %d on disk, got %d keys at index %d",
+			appliedBefore, store2.Len(), store2.AppliedIndex())
+	}
+
+	raftNode, err = raft.NewNode(store2, config, dataDir)
+	if err != nil {
+		t.Fatalf("Failed to restart node: %v", err)
+	}
+	defer raftNode.Shutdown()
+
+	// Wait for leader
+	time.Sleep(2 * time.Second)
+	if err := raftNode.Apply(raft.KVCommand{Op: "put", Key: "disk-key3", Value: []byte("disk-key3")}); err != nil {
+		t.Fatalf("Apply after restart failed: %v", err)
+	}
+
+	if store2.Len() != 3 {
+		t.Errorf("Expected 3 keys after restart, got %d", store2.Len())
+	}
+	if store2.AppliedIndex() <= appliedBefore {
+		t.Errorf("Applied index did not advance past %d", appliedBefore)
+	}
+}
+
+func TestWALLogStoreRestart(t *testing.T) {
+	dataDir := filepath.Join("testdata", "wal")
+	os.MkdirAll(dataDir, 0755)
+	defer os.RemoveAll("testdata")
+
+	config := &cluster.Config{
+		NodeID:     "wal-node",
+		ListenAddr: "127.0.0.1:19010",
+		RaftAddr:   "127.0.0.1:19020",
+		Bootstrap:  true,
+		Storage:    cluster.StorageConfig{LogStore: "wal", WALSegmentSize: 4096},
+	}
+
+	raftNode, err := raft.NewNode(store.NewStore(), config, dataDir)
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+
+	// Wait for leader
+	time.Sleep(2 * time.Second)
+	if !raftNode.IsLeader() {
+		raftNode.Shutdown()
+		t.Fatal("Node did not become leader")
+	}
+
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("wal-key%d", i)
+		if err := raftNode.Apply(raft.KVCommand{Op: "put", Key: key, Value: []byte(key)}); err != nil {
+			raftNode.Shutdown()
+			t.Fatalf("Apply failed: %v", err)
+		}
+	}
+	raftNode.Shutdown()
+
+	// The in-memory state is rebuilt by replaying the WAL
+	store2 := store.NewStore()
+	raftNode, err = raft.NewNode(store2, config, dataDir)
+	if err != nil {
+		t.Fatalf("Failed to restart node: %v", err)
+	}
+	defer raftNode.Shutdown()
+
+	// Wait for leader
+	time.Sleep(2 * time.Second)
+	if err := raftNode.Apply(raft.KVCommand{Op: "put", Key: "wal-key50", Value: []byte("wal-key50")}); err != nil {
+		t.Fatalf("Apply after restart failed: %v", err)
+	}
+	if store2.Len() != 51 {
+		t.Errorf("Expected 51 keys after restart, got %d", store2.Len())
+	}
+	if value, ok := store2.Get("wal-key7"); !ok || string(value) != "wal-key7" {
+		t.Errorf("Expected wal-key7 to be replayed, got %q", value)
+	}
+}
+
+
+func TestBackupRestore(t *testing.T) {
+	defer os.RemoveAll("testdata")
+
+	startNode := func(id, listenAddr, raftAddr string) (*raft.Node, *store.Store) {
+		dataDir := filepath.Join("testdata", id)
+		os.MkdirAll(dataDir, 0755)
+		s := store.NewStore()
+		node, err := raft.NewNode(s, &cluster.Config{
+			NodeID:     id,
+			ListenAddr: listenAddr,
+			RaftAddr:   raftAddr,
+			Bootstrap:  true,
+		}, dataDir)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", id, err)
+		}
+		return node, s
+	}
+
+	source, _ := startNode("backup-source", "127.0.0.1:19023", "127.0.0.1:19033")
+	defer source.Shutdown()
+	// The target is a separate, freshly bootstrapped cluster
+	target, targetStore := startNode("backup-target", "127.0.0.1:19024", "127.0.0.1:19034")
+	defer target.Shutdown()
+
+	// Wait for leaders
+	time.Sleep(2 * time.Second)
+	if !source.IsLeader() || !target.IsLeader() {
+		t.Fatal("Nodes did not become leaders")
+	}
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("backup-key%d", i)
+		if err := source.Apply(raft.KVCommand{Op: "put", Key: key, Value: []byte(key)}); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+	}
+	if err := target.Apply(raft.KVCommand{Op: "put", Key: "replaced", Value: []byte("old")}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	info, view, err := source.Backup()
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	var backup bytes.Buffer
+	err = raft.WriteBackup(&backup, info, view)
+	view.Release()
+	if err != nil {
+		t.Fatalf("WriteBackup failed: %v", err)
+	}
+	if info.Index == 0 || info.NodeID != "backup-source" {
+		t.Errorf("Unexpected backup info: %+v", info)
+	}
+
+	// Writes after the backup are not part of it
+	source.Apply(raft.KVCommand{Op: "put", Key: "after-backup", Value: []byte("x")})
+
+	restored, err := target.Restore(&backup)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if restored.Index != info.Index {
+		t.Errorf("Expected restored index %d, got %d", info.Index, restored.Index)
+	}
+	if targetStore.Len() != 20 {
+		t.Errorf("Expected 20 keys after restore, got %d", targetStore.Len())
+	}
+	if _, ok := targetStore.Get("replaced"); ok {
+		t.Error("Expected keys of the target cluster to be replaced")
+	}
+	if value, ok := targetStore.Get("backup-key7"); !ok || string(value) != "backup-key7" {
+		t.Errorf("Expected backup-key7 to be restored, got %q", value)
+	}
+
+	// The restored cluster keeps accepting writes
+	if err := target.Apply(raft.KVCommand{Op: "put", Key: "after-restore", Value: []byte("y")}); err != nil {
+		t.Fatalf("Apply after restore failed: %v", err)
+	}
+	if targetStore.Len() != 21 {
+		t.Errorf("Expected 21 keys, got %d", targetStore.Len())
+	}
+
+	if _, err := target.Restore(strings.NewReader("not a backup")); !errors.Is(err, raft.ErrInvalidBackup) {
+		t.Errorf("Expected ErrInvalidBackup, got %v", err)
+	}
+}
+
+// TestStateHashCheck tests that replicas compare state hashes and flag divergence
+func TestStateHashCheck(t *testing.T) {
+	defer os.RemoveAll("testdata")
+
+	startNode := func(id, listenAddr, raftAddr string, bootstrap bool) (*raft.Node, *store.Store) {
+		dataDir := filepath.Join("testdata", id)
+		os.MkdirAll(dataDir, 0755)
+		s := store.NewStore()
+		node, err := raft.NewNode(s, &cluster.Config{
+			NodeID:     id,
+			ListenAddr: listenAddr,
+			RaftAddr:   raftAddr,
+			Bootstrap:  bootstrap,
+			Raft:       cluster.RaftConfig{HashCheckInterval: 200 * time.Millisecond},
+		}, dataDir)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", id, err)
+		}
+		return node, s
+	}
+
+	leader, _ := startNode("hash-node1", "127.0.0.1:19025", "127.0.0.1:19035", true)
+	defer leader.Shutdown()
+	follower, followerStore := startNode("hash-node2", "127.0.0.1:19026", "127.0.0.1:19036", false)
+	defer follower.Shutdown()
+
+	time.Sleep(2 * time.Second)
+	if !leader.IsLeader() {
+		t.Fatal("hash-node1 did not become leader")
+	}
+	if err := leader.Join("hash-node2", "127.0.0.1:19036"); err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("hash-key%d", i)
+		if err := leader.Apply(raft.KVCommand{Op: "put", Key: key, Value: []byte(key)}); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+	}
+	time.Sleep(time.Second)
+
+	check, ok := follower.LastHashCheck()
+	if !ok || !check.Match {
+		t.Fatalf("Expected a matching hash check on the follower, got %+v (%v)", check, ok)
+	}
+	leaderHash, _ := leader.StateHash(check.Index)
+	followerHash, _ := follower.StateHash(check.Index)
+	if leaderHash != followerHash {
+		t.Errorf("Expected equal hashes at index %d, got %+v and %+v", check.Index, leaderHash, followerHash)
+	}
+
+	// Change the follower's data behind Raft's back, then replicate one more write
+	_, events, cancel := follower.Events().Subscribe(0, 16)
+	defer cancel()
+	followerStore.Put("rogue", []byte("x"))
+	if err := leader.Apply(raft.KVCommand{Op: "put", Key: "after", Value: []byte("y")}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Type != raft.EventStateDiverged {
+				continue
+			}
+			if e.NodeID != "hash-node2" || e.Hash == e.ExpectedHash {
+				t.Errorf("Unexpected divergence event %+v", e)
+			}
+			if check, _ := follower.LastHashCheck(); check.Match {
+				t.Errorf("Expected the last check to report a mismatch, got %+v", check)
+			}
+			return
+		case <-timeout:
+			t.Fatal("No state_diverged event on the follower")
+		}
+	}
+}
+
+// TestAdvertiseRedisAddr tests that a new leader records its RESP address for followers
+func TestAdvertiseRedisAddr(t *testing.T) {
+	dataDir := filepath.Join("testdata", "advertise")
+	os.MkdirAll(dataDir, 0755)
+	defer os.RemoveAll("testdata")
+
+	store1 := store.NewStore()
+	config := &cluster.Config{
+		NodeID:     "advertise-node",
+		ListenAddr: "127.0.0.1:19061",
+		RaftAddr:   "127.0.0.1:19062",
+		Bootstrap:  true,
+		Redis:      cluster.RedisConfig{ListenAddr: "0.0.0.0:19063", AdvertiseAddr: "kv-1.internal:19063"},
+	}
+
+	raftNode, err := raft.NewNode(store1, config, dataDir)
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+	defer raftNode.Shutdown()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if info, ok := store1.NodeInfo("127.0.0.1:19062"); ok {
+			if info.RedisAddr != "kv-1.internal:19063" {
+				t.Errorf("Expected advertised address kv-1.internal:19063, got %q", info.RedisAddr)
+			}
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Error("Leader never advertised its RESP address")
+}
+
+func TestReplicateLimits(t *testing.T) {
+	dataDir := filepath.Join("testdata", "limits")
+	os.MkdirAll(dataDir, 0755)
+	defer os.RemoveAll("testdata")
+
+	store1 := store.NewStore()
+	config := &cluster.Config{
+		NodeID:     "limits-node",
+		ListenAddr: "127.0.0.1:19071",
+		RaftAddr:   "127.0.0.1:19072",
+		Bootstrap:  true,
+		Limits:     cluster.LimitsConfig{MaxKeys: 1},
+	}
+
+	raftNode, err := raft.NewNode(store1, config, dataDir)
+	if err != nil {
+		t.Fatalf("Failed to create node: %v", err)
+	}
+	defer raftNode.Shutdown()
+
+	want := config.Limits.WithDefaults()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if limits, ok := store1.ClusterLimits(); ok && limits == want {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if limits, _ := store1.ClusterLimits(); limits != want {
+		t.Fatalf("Expected the leader to replicate limits %+v, got %+v", want, limits)
+	}
+
+	if err := raftNode.Apply(raft.KVCommand{Op: "put", Key: "key1", Value: []byte("1")}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	var quotaErr *store.QuotaError
+	if err := raftNode.Apply(raft.KVCommand{Op: "put", Key: "key2", Value: []byte("2")}); !errors.As(err, &quotaErr) {
+		t.Errorf("Expected the replicated key quota to reject key2, got %v", err)
+	}
+}
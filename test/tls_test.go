@@ -0,0 +1,276 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"distributed_cloud_service/internal/auth"
+	"distributed_cloud_service/internal/cluster"
+	"distributed_cloud_service/internal/raft"
+	"distributed_cloud_service/internal/store"
+	"distributed_cloud_service/internal/tlsutil"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA is a throwaway certificate authority generated in-process
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	ca := &testCA{cert: cert, key: key, dir: t.TempDir()}
+	writePEM(t, filepath.Join(ca.dir, "ca.pem"), "CERTIFICATE", der)
+	return ca
+}
+
+// issue creates a certificate for name (valid for 127.0.0.1) and returns a TLS config pointing at it
+func (ca *testCA) issue(t *testing.T, name string) cluster.TLSConfig {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name, "localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(ca.dir, name+".pem")
+	keyFile := filepath.Join(ca.dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+
+	return cluster.TLSConfig{
+		CAFile:   filepath.Join(ca.dir, "ca.pem"),
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	}
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+// TestRaftTLSCluster tests replication over the mutual TLS transport
+func TestRaftTLSCluster(t *testing.T) {
+	dataDir1 := filepath.Join("testdata", "tls1")
+	dataDir2 := filepath.Join("testdata", "tls2")
+	os.MkdirAll(dataDir1, 0755)
+	os.MkdirAll(dataDir2, 0755)
+	defer os.RemoveAll("testdata")
+
+	ca := newTestCA(t)
+
+	store1 := store.NewStore()
+	store2 := store.NewStore()
+
+	config1 := &cluster.Config{
+		NodeID:     "tls-node1",
+		ListenAddr: "127.0.0.1:19021",
+		RaftAddr:   "127.0.0.1:19031",
+		Bootstrap:  true,
+		RaftTLS:    ca.issue(t, "tls-node1"),
+	}
+	config2 := &cluster.Config{
+		NodeID:     "tls-node2",
+		ListenAddr: "127.0.0.1:19022",
+		RaftAddr:   "127.0.0.1:19032",
+		RaftTLS:    ca.issue(t, "tls-node2"),
+	}
+
+	raftNode1, err := raft.NewNode(store1, config1, dataDir1)
+	if err != nil {
+		t.Fatalf("Failed to create node1: %v", err)
+	}
+	defer raftNode1.Shutdown()
+
+	raftNode2, err := raft.NewNode(store2, config2, dataDir2)
+	if err != nil {
+		t.Fatalf("Failed to create node2: %v", err)
+	}
+	defer raftNode2.Shutdown()
+
+	// Wait for leader
+	time.Sleep(2 * time.Second)
+	if !raftNode1.IsLeader() {
+		t.Fatal("Bootstrap node did not become leader")
+	}
+
+	if err := raftNode1.Join("tls-node2", "127.0.0.1:19032"); err != nil {
+		t.Fatalf("Join over TLS failed: %v", err)
+	}
+
+	cmd := raft.KVCommand{Op: "put", Key: "tls-key", Value: []byte("tls-value")}
+	if err := raftNode1.Apply(cmd); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	// Wait for replication
+	time.Sleep(1 * time.Second)
+
+	if val, ok := store2.Get("tls-key"); !ok || string(val) != "tls-value" {
+		t.Error("Value not replicated over TLS transport")
+	}
+
+	// A peer with a certificate from another CA must be rejected
+	rogue := newTestCA(t).issue(t, "rogue")
+	rogueCert, err := tls.LoadX509KeyPair(rogue.CertFile, rogue.KeyFile)
+	if err != nil {
+		t.Fatalf("Failed to load rogue certificate: %v", err)
+	}
+	conn, err := tls.Dial("tcp", "127.0.0.1:19031", &tls.Config{
+		Certificates:       []tls.Certificate{rogueCert},
+		InsecureSkipVerify: true,
+	})
+	if err == nil {
+		// TLS 1.3 reports client certificate rejection on the first read
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	if err == nil {
+		t.Error("Raft transport accepted a certificate from an unknown CA")
+	}
+}
+
+// TestHTTPSClientCertificates tests the HTTPS listener, client certificate identities and certificate reload
+func TestHTTPSClientCertificates(t *testing.T) {
+	ca := newTestCA(t)
+	serverTLS := ca.issue(t, "api-server")
+	clientTLS := ca.issue(t, "ci-runner")
+
+	httpsConfig := cluster.HTTPTLSConfig{
+		CertFile:         serverTLS.CertFile,
+		KeyFile:          serverTLS.KeyFile,
+		ClientCAFile:     serverTLS.CAFile,
+		ClientAuth:       cluster.ClientAuthRequest,
+		ClientIdentities: map[string]string{"ci-runner": "ci"},
+	}
+	if err := httpsConfig.Validate(); err != nil {
+		t.Fatalf("Invalid HTTPS config: %v", err)
+	}
+
+	reloader, err := tlsutil.NewReloader(httpsConfig)
+	if err != nil {
+		t.Fatalf("Failed to create reloader: %v", err)
+	}
+	reloader.SetInterval(0)
+
+	handler := auth.NewMiddleware(auth.Options{
+		Token:          "secret",
+		CertIdentities: httpsConfig.ClientIdentities,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := auth.IdentityFromContext(r.Context())
+		w.Write([]byte(id.Name))
+	}))
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", reloader.TLSConfig())
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &http.Server{Handler: handler}
+	go server.Serve(ln)
+	defer server.Close()
+	url := "https://" + ln.Addr().String() + "/kv/key"
+
+	pool, err := tlsutil.LoadCAPool(serverTLS.CAFile)
+	if err != nil {
+		t.Fatalf("Failed to load CA: %v", err)
+	}
+	clientCert, err := tls.LoadX509KeyPair(clientTLS.CertFile, clientTLS.KeyFile)
+	if err != nil {
+		t.Fatalf("Failed to load client certificate: %v", err)
+	}
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			DisableKeepAlives: true,
+			TLSClientConfig:   &tls.Config{RootCAs: pool, Certificates: certs},
+		}}
+	}
+
+	// Client certificate maps to the "ci" identity
+	resp, err := newClient(clientCert).Get(url)
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "ci" {
+		t.Errorf("Expected identity ci, got %d %q", resp.StatusCode, body)
+	}
+	firstSerial := resp.TLS.PeerCertificates[0].SerialNumber
+
+	// Without a certificate or token the request is rejected
+	resp, err = newClient().Get(url)
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without credentials, got %d", resp.StatusCode)
+	}
+
+	// Rotating the certificate on disk is picked up without restarting the listener
+	time.Sleep(10 * time.Millisecond)
+	ca.issue(t, "api-server")
+	resp, err = newClient(clientCert).Get(url)
+	if err != nil {
+		t.Fatalf("HTTPS request after rotation failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.TLS.PeerCertificates[0].SerialNumber.Cmp(firstSerial) == 0 {
+		t.Error("Server certificate was not reloaded after rotation")
+	}
+}